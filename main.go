@@ -15,12 +15,12 @@ func main() {
 
 	if err != nil {
 		fmt.Println(err)
-		os.Exit(1)
+		os.Exit(program.ExitUsage)
 	}
 
 	// This ends up calling options.Run()
 	if err := context.Run(&options); err != nil {
 		log.Err(err).Msg("Program failed")
-		os.Exit(1)
+		os.Exit(program.ExitCode(err))
 	}
 }
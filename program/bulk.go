@@ -0,0 +1,78 @@
+package program
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Bulk holds the flags controlling how a batch of updates is applied
+type Bulk struct {
+	Parallelism int           `default:"1" help:"Number of updates to run concurrently"`
+	Stagger     time.Duration `help:"Time to wait between starting updates (e.g. 30s)"`
+}
+
+// run calls update for each of the count items using a pool of Parallelism workers, waiting Stagger between starting
+// each update.  No further updates are started once ctx is cancelled.  If stopOnError is set no further updates are
+// started once one fails.  The returned slice holds the error for each item, and is nil for items which succeeded or
+// were never started.
+func (bulk *Bulk) run(ctx context.Context, count int, dryRun, stopOnError bool, update func(i int) error) []error {
+	results := make([]error, count)
+	jobs := make(chan int)
+
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+
+	workers := bulk.Parallelism
+	if workers < 1 {
+		workers = 1
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				// The item may have been handed out before the failure or interrupt was seen
+				if ctx.Err() != nil || (stopOnError && failed.Load()) {
+					continue
+				}
+				if err := update(i); err != nil {
+					results[i] = err
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < count; i++ {
+		if stopOnError && failed.Load() {
+			log.Warn().Int("remaining", count-i).Msg("Not starting remaining updates after failure")
+			break
+		}
+
+		if ctx.Err() != nil {
+			log.Warn().Int("remaining", count-i).Msg("Not starting remaining updates after interrupt")
+			break
+		}
+
+		if i > 0 && bulk.Stagger > 0 && !dryRun {
+			log.Debug().Dur("stagger", bulk.Stagger).Msg("Waiting before next update")
+			select {
+			case <-ctx.Done():
+				continue
+			case <-time.After(bulk.Stagger):
+			}
+		}
+
+		jobs <- i
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,144 @@
+package program
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBulkRun(t *testing.T) {
+	failure := errors.New("failed")
+
+	tests := []struct {
+		name        string
+		parallelism int
+		stopOnError bool
+		fail        map[int]bool
+		wantStarted []int
+		wantErrors  map[int]bool
+	}{
+		{
+			name:        "serial runs every item",
+			parallelism: 1,
+			wantStarted: []int{0, 1, 2, 3, 4},
+		},
+		{
+			name:        "no parallelism is serial",
+			parallelism: 0,
+			wantStarted: []int{0, 1, 2, 3, 4},
+		},
+		{
+			name:        "errors are returned by item and do not stop the run",
+			parallelism: 1,
+			fail:        map[int]bool{1: true, 3: true},
+			wantStarted: []int{0, 1, 2, 3, 4},
+			wantErrors:  map[int]bool{1: true, 3: true},
+		},
+		{
+			name:        "stop on error starts nothing after a failure",
+			parallelism: 1,
+			stopOnError: true,
+			fail:        map[int]bool{1: true},
+			wantStarted: []int{0, 1},
+			wantErrors:  map[int]bool{1: true},
+		},
+		{
+			name:        "parallel runs every item",
+			parallelism: 3,
+			fail:        map[int]bool{2: true},
+			wantStarted: []int{0, 1, 2, 3, 4},
+			wantErrors:  map[int]bool{2: true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var lock sync.Mutex
+			started := map[int]bool{}
+
+			bulk := &Bulk{Parallelism: test.parallelism}
+			errs := bulk.run(context.Background(), 5, false, test.stopOnError, func(i int) error {
+				lock.Lock()
+				started[i] = true
+				lock.Unlock()
+
+				if test.fail[i] {
+					return failure
+				}
+				return nil
+			})
+
+			want := map[int]bool{}
+			for _, i := range test.wantStarted {
+				want[i] = true
+			}
+			assert.Equal(t, want, started)
+
+			assert.Len(t, errs, 5)
+			for i, err := range errs {
+				if test.wantErrors[i] {
+					assert.ErrorIs(t, err, failure, "item %d", i)
+				} else {
+					assert.NoError(t, err, "item %d", i)
+				}
+			}
+		})
+	}
+}
+
+func TestBulkRunParallelism(t *testing.T) {
+	for _, parallelism := range []int{1, 2, 4} {
+		var active, peak atomic.Int32
+
+		bulk := &Bulk{Parallelism: parallelism}
+		bulk.run(context.Background(), 12, false, false, func(i int) error {
+			now := active.Add(1)
+			defer active.Add(-1)
+
+			for {
+				highest := peak.Load()
+				if now <= highest || peak.CompareAndSwap(highest, now) {
+					break
+				}
+			}
+
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		})
+
+		assert.Equal(t, int32(parallelism), peak.Load(), "parallelism %d", parallelism)
+	}
+}
+
+func TestBulkRunStagger(t *testing.T) {
+	bulk := &Bulk{Parallelism: 4, Stagger: 20 * time.Millisecond}
+
+	start := time.Now()
+	bulk.run(context.Background(), 3, false, false, func(i int) error { return nil })
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond, "updates are started a stagger apart")
+
+	start = time.Now()
+	bulk.run(context.Background(), 3, true, false, func(i int) error { return nil })
+	assert.Less(t, time.Since(start), 20*time.Millisecond, "a dry run does not wait")
+}
+
+func TestBulkRunCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var started atomic.Int32
+	bulk := &Bulk{Parallelism: 1}
+	errs := bulk.run(ctx, 5, false, false, func(i int) error {
+		if started.Add(1) == 2 {
+			cancel()
+		}
+		return nil
+	})
+
+	assert.Equal(t, int32(2), started.Load(), "no updates are started once the context is cancelled")
+	assert.Len(t, errs, 5)
+}
@@ -0,0 +1,220 @@
+package program
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+// Certs reports when the certificates in TLS Secrets expire, soonest first, and optionally the state of cert-manager
+// Certificates, which show whether renewal is working before the old certificate runs out.
+type Certs struct {
+	WarnDays    int  `default:"30" help:"Warn about certificates expiring within this many days"`
+	CertManager bool `help:"Also report cert-manager Certificates"`
+
+	Selector `embed:""`
+}
+
+var certificateResource = schema.GroupVersionResource{Group: "cert-manager.io", Version: "v1", Resource: "certificates"}
+
+// certExpiry is when a certificate stored in the cluster expires
+type certExpiry struct {
+	namespace string
+	kind      string
+	name      string
+	subject   string
+	notAfter  time.Time
+	problem   string
+}
+
+func (program *Certs) Run(options *Options) error {
+
+	initColors(options)
+
+	if program.WarnDays < 0 {
+		return usageError("--warn-days must not be negative")
+	}
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	secrets, err := fetch(ctx, &program.Selector, "secret",
+		func(ctx context.Context, namespace, name string) (*corev1.Secret, error) {
+			return clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		},
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]corev1.Secret, string, error) {
+			options.FieldSelector = "type=" + string(corev1.SecretTypeTLS)
+			list, err := clientset.CoreV1().Secrets(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+	if err != nil {
+		return err
+	}
+
+	var found []certExpiry
+	for i := range secrets {
+		if secrets[i].Type == corev1.SecretTypeTLS {
+			found = append(found, secretExpiry(&secrets[i]))
+		}
+	}
+
+	if program.CertManager {
+		certificates, err := program.certificates(ctx, options)
+		if err != nil {
+			return err
+		}
+		found = append(found, certificates...)
+	}
+
+	// Unreadable certificates have no expiry and sort first
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].notAfter.Before(found[j].notAfter)
+	})
+
+	if len(found) == 0 {
+		log.Info().Msg("No certificates found")
+		return nil
+	}
+
+	now := time.Now()
+	warnBefore := now.Add(time.Duration(program.WarnDays) * 24 * time.Hour)
+	warnings := 0
+
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "KIND", "NAME", "SUBJECT", "EXPIRES", "IN", "STATUS"})
+
+	for _, c := range found {
+		expires, in := "-", "-"
+		status := paint(text.FgGreen, "ok")
+
+		if !c.notAfter.IsZero() {
+			expires = c.notAfter.UTC().Format(time.DateOnly)
+			in = duration.HumanDuration(c.notAfter.Sub(now))
+		}
+
+		switch {
+		case c.problem != "":
+			warnings++
+			status = paint(text.FgRed, c.problem)
+		case c.notAfter.Before(now):
+			warnings++
+			in = "-" + duration.HumanDuration(now.Sub(c.notAfter))
+			status = paint(text.FgRed, "expired")
+		case c.notAfter.Before(warnBefore):
+			warnings++
+			status = paint(text.FgYellow, "expiring soon")
+		}
+
+		t.AppendRow(table.Row{c.namespace, c.kind, c.name, c.subject, expires, in, status})
+	}
+
+	t.Render()
+
+	if warnings > 0 {
+		log.Warn().Int("count", warnings).Int("warn_days", program.WarnDays).Msg("Certificates expired, expiring or broken")
+	}
+
+	return nil
+}
+
+// secretExpiry reads the leaf certificate of a TLS Secret
+func secretExpiry(secret *corev1.Secret) certExpiry {
+	c := certExpiry{namespace: secret.Namespace, kind: "Secret", name: secret.Name, subject: "-"}
+
+	block, _ := pem.Decode(secret.Data[corev1.TLSCertKey])
+	if block == nil {
+		c.problem = "no PEM certificate in " + corev1.TLSCertKey
+		return c
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		c.problem = "unreadable certificate: " + err.Error()
+		return c
+	}
+
+	c.notAfter = cert.NotAfter
+	c.subject = cert.Subject.CommonName
+	if len(cert.DNSNames) > 0 {
+		c.subject = strings.Join(cert.DNSNames, ", ")
+	}
+
+	return c
+}
+
+// certificates returns the expiry of the selected cert-manager Certificates, flagging those which are not ready since
+// then renewal has failed
+func (program *Certs) certificates(ctx context.Context, options *Options) ([]certExpiry, error) {
+	client, err := options.Dynamic()
+	if err != nil {
+		return nil, err
+	}
+
+	certificates := client.Resource(certificateResource).Namespace
+
+	items, err := fetch(ctx, &program.Selector, "Certificate",
+		func(ctx context.Context, namespace, name string) (*unstructured.Unstructured, error) {
+			return certificates(namespace).Get(ctx, name, metav1.GetOptions{})
+		},
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]unstructured.Unstructured, string, error) {
+			list, err := certificates(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.GetContinue(), nil
+		})
+
+	// Listing a resource type the cluster does not serve fails with not found
+	if apierrors.IsNotFound(err) {
+		return nil, usageError("cert-manager is not installed in this cluster (no %s resource)", certificateResource.GroupResource())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result []certExpiry
+	for i := range items {
+		item := &items[i]
+		c := certExpiry{namespace: item.GetNamespace(), kind: "Certificate", name: item.GetName(), subject: "-"}
+
+		if names, _, _ := unstructured.NestedStringSlice(item.Object, "spec", "dnsNames"); len(names) > 0 {
+			c.subject = strings.Join(names, ", ")
+		}
+
+		if notAfter, _, _ := unstructured.NestedString(item.Object, "status", "notAfter"); notAfter != "" {
+			if parsed, err := time.Parse(time.RFC3339, notAfter); err == nil {
+				c.notAfter = parsed
+			}
+		}
+
+		if status := conditionStatus(item, "Ready"); status != string(corev1.ConditionTrue) {
+			c.problem = fmt.Sprintf("not ready (%s)", orDash(status))
+		}
+
+		result = append(result, c)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,310 @@
+package program
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/rs/zerolog/log"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Cleanup deletes finished Jobs and old ReplicaSets which are no longer needed
+type Cleanup struct {
+	Days int  `default:"7" help:"Delete Jobs which finished more than this many days ago"`
+	Yes  bool `short:"y" help:"Delete without asking for confirmation"`
+
+	Labels        map[string]string `short:"l" help:"Label filters to select Jobs and ReplicaSets"`
+	AllNamespaces bool              `short:"A" help:"Clean up in all namespaces"`
+
+	Bulk `embed:""`
+}
+
+// revisionAnnotation holds the Deployment revision of a ReplicaSet
+const revisionAnnotation = "deployment.kubernetes.io/revision"
+
+// defaultRevisionHistoryLimit is the Deployment default for the number of old ReplicaSets to keep
+const defaultRevisionHistoryLimit = 10
+
+// cleanupCandidate is an object to be deleted.  The UID and resource version it was listed with are preconditions of
+// the delete, so an object which changed while waiting for confirmation, such as a ReplicaSet scaled up again by a
+// rollback, is not deleted.
+type cleanupCandidate struct {
+	Kind            string
+	Namespace       string
+	Name            string
+	UID             types.UID
+	ResourceVersion string
+	Age             time.Duration
+	Reason          string
+}
+
+func (program *Cleanup) Run(options *Options) error {
+
+	initColors(options)
+
+	if program.Days < 0 {
+		return usageError("--days must not be negative")
+	}
+
+	selector := Selector{Labels: program.Labels, AllNamespaces: program.AllNamespaces, ChunkSize: 500}
+
+	clientset, err := selector.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	jobs, err := finishedJobs(ctx, clientset, &selector, time.Duration(program.Days)*24*time.Hour)
+	if err != nil {
+		return err
+	}
+
+	replicaSets, err := oldReplicaSets(ctx, clientset, &selector)
+	if err != nil {
+		return err
+	}
+
+	candidates := append(jobs, replicaSets...)
+
+	if len(candidates) == 0 {
+		log.Info().Msg("Nothing to clean up")
+		return nil
+	}
+
+	printCleanupCandidates(candidates)
+
+	if options.DryRun {
+		log.Info().Int("count", len(candidates)).Msg("Dry run, not deleting")
+		return nil
+	}
+
+	if !program.Yes && !confirm(fmt.Sprintf("Delete these %d objects?", len(candidates))) {
+		return usageError("not confirmed, use --yes to delete without asking")
+	}
+
+	return options.runAsLeader(ctx, clientset, func(ctx context.Context) error {
+		results := newSummary()
+		defer results.print()
+
+		errs := program.Bulk.run(ctx, len(candidates), options.DryRun, false, func(i int) error {
+			c := candidates[i]
+
+			err := withRetries(ctx, options.Retries, func() error {
+				return c.delete(ctx, clientset)
+			})
+
+			switch {
+			case apierrors.IsNotFound(err):
+				results.record(c.Namespace, c.Kind+"/"+c.Name, outcomeSkipped, "already deleted")
+			case apierrors.IsConflict(err):
+				results.record(c.Namespace, c.Kind+"/"+c.Name, outcomeSkipped, "changed since listed")
+			case err != nil:
+				results.record(c.Namespace, c.Kind+"/"+c.Name, outcomeFailed, err.Error())
+				return fmt.Errorf("%s %s: %w", c.Kind, c.Name, apiError(err))
+			default:
+				log.Info().Str("namespace", c.Namespace).Str(c.Kind, c.Name).Msg("Deleted")
+				results.record(c.Namespace, c.Kind+"/"+c.Name, outcomeUpdated, "deleted: "+c.Reason)
+			}
+			return nil
+		})
+
+		for _, c := range candidates {
+			if !results.has(c.Namespace, c.Kind+"/"+c.Name) {
+				results.record(c.Namespace, c.Kind+"/"+c.Name, outcomeSkipped, "not started")
+			}
+		}
+
+		return errors.Join(errs...)
+	})
+}
+
+// delete deletes the candidate, unless it has changed since it was listed
+func (c *cleanupCandidate) delete(ctx context.Context, clientset kubernetes.Interface) error {
+	propagation := metav1.DeletePropagationBackground
+	deleteOptions := metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+		Preconditions:     &metav1.Preconditions{UID: &c.UID, ResourceVersion: &c.ResourceVersion},
+	}
+
+	switch c.Kind {
+	case "Job":
+		return clientset.BatchV1().Jobs(c.Namespace).Delete(ctx, c.Name, deleteOptions)
+	default:
+		return clientset.AppsV1().ReplicaSets(c.Namespace).Delete(ctx, c.Name, deleteOptions)
+	}
+}
+
+// finishedJobs returns the Jobs which completed or failed more than age ago.  Jobs created by CronJobs are left to the
+// CronJob's own history limits.
+func finishedJobs(ctx context.Context, clientset kubernetes.Interface, selector *Selector, age time.Duration) ([]cleanupCandidate, error) {
+	jobs, err := fetch(ctx, selector, "job", nil,
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]batchv1.Job, string, error) {
+			list, err := clientset.BatchV1().Jobs(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []cleanupCandidate
+
+	for _, job := range jobs {
+		if ownedBy(job.OwnerReferences, "CronJob") {
+			continue
+		}
+
+		for _, condition := range job.Status.Conditions {
+			if condition.Status != corev1.ConditionTrue ||
+				(condition.Type != batchv1.JobComplete && condition.Type != batchv1.JobFailed) {
+				continue
+			}
+
+			finished := time.Since(condition.LastTransitionTime.Time)
+			if finished > age {
+				result = append(result, cleanupCandidate{
+					Kind:            "Job",
+					Namespace:       job.Namespace,
+					Name:            job.Name,
+					UID:             job.UID,
+					ResourceVersion: job.ResourceVersion,
+					Age:             finished,
+					Reason:          fmt.Sprintf("%s %s ago", condition.Type, duration.HumanDuration(finished)),
+				})
+			}
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// oldReplicaSets returns the ReplicaSets with no replicas which are older than their Deployment's revision history
+// limit.  The Deployment controller normally removes these itself, but not if the limit was raised and later lowered,
+// or the ReplicaSets were orphaned.
+func oldReplicaSets(ctx context.Context, clientset kubernetes.Interface, selector *Selector) ([]cleanupCandidate, error) {
+	replicaSets, err := fetch(ctx, selector, "replicaset", nil,
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]appsv1.ReplicaSet, string, error) {
+			list, err := clientset.AppsV1().ReplicaSets(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	// Group the idle ReplicaSets by the Deployment which owns them
+	idle := map[string][]appsv1.ReplicaSet{}
+	for _, rs := range replicaSets {
+		owner := ownerName(rs.OwnerReferences, "Deployment")
+		if owner == "" || replicasOf(rs.Spec.Replicas) != 0 || rs.Status.Replicas != 0 {
+			continue
+		}
+		key := rs.Namespace + "/" + owner
+		idle[key] = append(idle[key], rs)
+	}
+
+	var result []cleanupCandidate
+
+	for key, sets := range idle {
+		namespace, name, _ := strings.Cut(key, "/")
+
+		limit := defaultRevisionHistoryLimit
+		deployment, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		switch {
+		case err == nil && deployment.Spec.RevisionHistoryLimit != nil:
+			limit = int(*deployment.Spec.RevisionHistoryLimit)
+		case err != nil && !apierrors.IsNotFound(err):
+			return nil, apiError(err)
+		}
+
+		// The Deployment's current ReplicaSet is idle when it is scaled to zero, but is never old, and the controller
+		// does not count it against the limit
+		if err == nil {
+			current := deployment.Annotations[revisionAnnotation]
+			sets = slices.DeleteFunc(sets, func(rs appsv1.ReplicaSet) bool {
+				return rs.Annotations[revisionAnnotation] == current
+			})
+		}
+
+		// Newest revisions first, so the ones beyond the limit are at the end
+		sort.Slice(sets, func(i, j int) bool {
+			return revision(&sets[i]) > revision(&sets[j])
+		})
+
+		for i := limit; i < len(sets); i++ {
+			rs := &sets[i]
+			result = append(result, cleanupCandidate{
+				Kind:            "ReplicaSet",
+				Namespace:       rs.Namespace,
+				Name:            rs.Name,
+				UID:             rs.UID,
+				ResourceVersion: rs.ResourceVersion,
+				Age:             time.Since(rs.CreationTimestamp.Time),
+				Reason:          fmt.Sprintf("revision %d of deployment %s, beyond history limit %d", revision(rs), name, limit),
+			})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Namespace != result[j].Namespace {
+			return result[i].Namespace < result[j].Namespace
+		}
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+// revision returns the Deployment revision of a ReplicaSet
+func revision(rs *appsv1.ReplicaSet) int {
+	value, _ := strconv.Atoi(rs.Annotations[revisionAnnotation])
+	return value
+}
+
+// ownedBy returns true if one of the owners is of the given kind
+func ownedBy(owners []metav1.OwnerReference, kind string) bool {
+	return ownerName(owners, kind) != ""
+}
+
+// ownerName returns the name of the owner of the given kind, or "" if there is none
+func ownerName(owners []metav1.OwnerReference, kind string) string {
+	for _, owner := range owners {
+		if owner.Kind == kind {
+			return owner.Name
+		}
+	}
+	return ""
+}
+
+// printCleanupCandidates shows what will be deleted
+func printCleanupCandidates(candidates []cleanupCandidate) {
+	t := newTable()
+	t.AppendHeader(table.Row{"KIND", "NAMESPACE", "NAME", "AGE", "REASON"})
+
+	for _, c := range candidates {
+		t.AppendRow(table.Row{c.Kind, c.Namespace, c.Name, duration.HumanDuration(c.Age), c.Reason})
+	}
+
+	t.Render()
+}
@@ -0,0 +1,124 @@
+package program
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestOldReplicaSets(t *testing.T) {
+	deployment := func(replicas int32, revision, limit int) *appsv1.Deployment {
+		history := int32(limit)
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", Annotations: map[string]string{
+				revisionAnnotation: strconv.Itoa(revision),
+			}},
+			Spec: appsv1.DeploymentSpec{Replicas: &replicas, RevisionHistoryLimit: &history},
+		}
+	}
+
+	replicaSet := func(revision int, replicas int32) *appsv1.ReplicaSet {
+		return &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:       "default",
+				Name:            "web-" + strconv.Itoa(revision),
+				Annotations:     map[string]string{revisionAnnotation: strconv.Itoa(revision)},
+				OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "web"}},
+			},
+			Spec:   appsv1.ReplicaSetSpec{Replicas: &replicas},
+			Status: appsv1.ReplicaSetStatus{Replicas: replicas},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		want    []string
+	}{
+		{
+			name:    "beyond the limit",
+			objects: []runtime.Object{deployment(2, 5, 2), replicaSet(1, 0), replicaSet(2, 0), replicaSet(3, 0), replicaSet(4, 0), replicaSet(5, 2)},
+			want:    []string{"web-1", "web-2"},
+		},
+		{
+			name:    "the current revision of a deployment scaled to zero is kept and not counted",
+			objects: []runtime.Object{deployment(0, 5, 2), replicaSet(1, 0), replicaSet(2, 0), replicaSet(3, 0), replicaSet(4, 0), replicaSet(5, 0)},
+			want:    []string{"web-1", "web-2"},
+		},
+		{
+			name:    "within the limit",
+			objects: []runtime.Object{deployment(0, 3, 2), replicaSet(1, 0), replicaSet(2, 0), replicaSet(3, 0)},
+		},
+		{
+			name:    "orphans beyond the default limit",
+			objects: []runtime.Object{replicaSet(1, 0), replicaSet(2, 0), replicaSet(3, 0), replicaSet(4, 0), replicaSet(5, 0), replicaSet(6, 0), replicaSet(7, 0), replicaSet(8, 0), replicaSet(9, 0), replicaSet(10, 0), replicaSet(11, 0), replicaSet(12, 0)},
+			want:    []string{"web-1", "web-2"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			candidates, err := oldReplicaSets(context.Background(), fake.NewSimpleClientset(test.objects...), &Selector{ChunkSize: 500, namespaceName: "default"})
+			require.NoError(t, err)
+
+			var names []string
+			for _, candidate := range candidates {
+				names = append(names, candidate.Name)
+			}
+			assert.ElementsMatch(t, test.want, names)
+		})
+	}
+}
+
+func TestCleanupCandidateDelete(t *testing.T) {
+	rs := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-1", UID: "uid-1", ResourceVersion: "10"}}
+
+	tests := []struct {
+		name            string
+		uid             types.UID
+		resourceVersion string
+		wantConflict    bool
+	}{
+		{name: "unchanged", uid: "uid-1", resourceVersion: "10"},
+		{name: "changed since listed", uid: "uid-1", resourceVersion: "9", wantConflict: true},
+		{name: "replaced since listed", uid: "uid-0", resourceVersion: "10", wantConflict: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(rs.DeepCopy())
+
+			// The fake clientset does not check preconditions, so check them as the API server would
+			clientset.PrependReactor("delete", "replicasets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				preconditions := action.(k8stesting.DeleteActionImpl).DeleteOptions.Preconditions
+				require.NotNil(t, preconditions)
+				if *preconditions.UID != rs.UID || *preconditions.ResourceVersion != rs.ResourceVersion {
+					return true, nil, apierrors.NewConflict(appsv1.Resource("replicasets"), rs.Name, errors.New("precondition failed"))
+				}
+				return false, nil, nil
+			})
+
+			candidate := cleanupCandidate{Kind: "ReplicaSet", Namespace: "default", Name: "web-1", UID: test.uid, ResourceVersion: test.resourceVersion}
+			err := candidate.delete(context.Background(), clientset)
+
+			if test.wantConflict {
+				assert.True(t, apierrors.IsConflict(err), "%v is a conflict", err)
+				return
+			}
+			require.NoError(t, err)
+			_, err = clientset.AppsV1().ReplicaSets("default").Get(context.Background(), "web-1", metav1.GetOptions{})
+			assert.True(t, apierrors.IsNotFound(err))
+		})
+	}
+}
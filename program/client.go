@@ -0,0 +1,51 @@
+package program
+
+import (
+	"context"
+
+	v1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// HPAClient is the part of the Kubernetes API used to inspect and modify HPAs.  It allows the HPA logic to be run
+// against something other than a live cluster.
+type HPAClient interface {
+	List(ctx context.Context, namespace string, opts metav1.ListOptions) (*v1.HorizontalPodAutoscalerList, error)
+	Get(ctx context.Context, namespace, name string) (*v1.HorizontalPodAutoscaler, error)
+	Update(ctx context.Context, hpa *v1.HorizontalPodAutoscaler) (*v1.HorizontalPodAutoscaler, error)
+	Patch(ctx context.Context, namespace, name string, patchType types.PatchType, data []byte) (*v1.HorizontalPodAutoscaler, error)
+	CreateEvent(ctx context.Context, event *corev1.Event) error
+}
+
+// NewHPAClient returns an HPAClient backed by the given Kubernetes clientset
+func NewHPAClient(clientset kubernetes.Interface) HPAClient {
+	return &clientsetHPAClient{clientset}
+}
+
+type clientsetHPAClient struct {
+	clientset kubernetes.Interface
+}
+
+func (c *clientsetHPAClient) List(ctx context.Context, namespace string, opts metav1.ListOptions) (*v1.HorizontalPodAutoscalerList, error) {
+	return c.clientset.AutoscalingV1().HorizontalPodAutoscalers(namespace).List(ctx, opts)
+}
+
+func (c *clientsetHPAClient) Get(ctx context.Context, namespace, name string) (*v1.HorizontalPodAutoscaler, error) {
+	return c.clientset.AutoscalingV1().HorizontalPodAutoscalers(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+func (c *clientsetHPAClient) Update(ctx context.Context, hpa *v1.HorizontalPodAutoscaler) (*v1.HorizontalPodAutoscaler, error) {
+	return c.clientset.AutoscalingV1().HorizontalPodAutoscalers(hpa.Namespace).Update(ctx, hpa, metav1.UpdateOptions{FieldManager: FieldManager})
+}
+
+func (c *clientsetHPAClient) Patch(ctx context.Context, namespace, name string, patchType types.PatchType, data []byte) (*v1.HorizontalPodAutoscaler, error) {
+	return c.clientset.AutoscalingV1().HorizontalPodAutoscalers(namespace).Patch(ctx, name, patchType, data, metav1.PatchOptions{FieldManager: FieldManager})
+}
+
+func (c *clientsetHPAClient) CreateEvent(ctx context.Context, event *corev1.Event) error {
+	_, err := c.clientset.CoreV1().Events(event.Namespace).Create(ctx, event, metav1.CreateOptions{})
+	return err
+}
@@ -0,0 +1,190 @@
+package program
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/rs/zerolog/log"
+	v2 "k8s.io/api/autoscaling/v2"
+)
+
+// CloudWatch holds the flags which publish the exported metrics to Amazon CloudWatch, so they can be alarmed on without
+// Prometheus
+type CloudWatch struct {
+	CloudWatchPublish   bool          `name:"cloudwatch" help:"Publish the metrics to CloudWatch with PutMetricData, using the AWS credentials of the environment, service account role or pod identity"`
+	CloudWatchNamespace string        `name:"cloudwatch-namespace" default:"K8sutils/HPA" help:"CloudWatch namespace to publish the metrics in"`
+	CloudWatchRegion    string        `name:"cloudwatch-region" env:"AWS_REGION,AWS_DEFAULT_REGION" help:"AWS region to publish to (default the region of an EKS context)"`
+	CloudWatchCluster   string        `name:"cloudwatch-cluster" help:"Value of the Cluster dimension (default the EKS cluster name or kubeconfig context)"`
+	CloudWatchInterval  time.Duration `name:"cloudwatch-interval" default:"1m" help:"How often to publish the metrics"`
+}
+
+// cloudWatchBatch is the most metric data PutMetricData accepts in one request
+const cloudWatchBatch = 1000
+
+// eksContext matches the context names aws eks update-kubeconfig writes, which are the ARNs of the clusters
+var eksContext = regexp.MustCompile(`^arn:aws[a-z-]*:eks:([a-z0-9-]+):[0-9]+:cluster/(.+)$`)
+
+// cloudWatchPublisher publishes HPA metrics to CloudWatch
+type cloudWatchPublisher struct {
+	client    *cloudwatch.Client
+	namespace string
+	cluster   string
+}
+
+// newCloudWatchPublisher returns a publisher for the flags, or nil if --cloudwatch is not given.  The region and
+// cluster default to those of the kubeconfig context if it is an EKS cluster.  Credentials are found as by the AWS
+// CLI: from the environment or shared files, an IAM role for the service account, or EKS Pod Identity.
+func (c *CloudWatch) newCloudWatchPublisher(ctx context.Context, kubeContext string) (*cloudWatchPublisher, error) {
+	if !c.CloudWatchPublish {
+		return nil, nil
+	}
+
+	region, cluster := c.CloudWatchRegion, c.CloudWatchCluster
+	if match := eksContext.FindStringSubmatch(kubeContext); match != nil {
+		if region == "" {
+			region = match[1]
+		}
+		if cluster == "" {
+			cluster = match[2]
+		}
+	}
+	if cluster == "" {
+		cluster = kubeContext
+	}
+	if region == "" {
+		return nil, usageError("--cloudwatch needs --cloudwatch-region or AWS_REGION")
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, connectionError(err, "unable to load the AWS configuration")
+	}
+
+	return &cloudWatchPublisher{client: cloudwatch.NewFromConfig(cfg), namespace: c.CloudWatchNamespace, cluster: cluster}, nil
+}
+
+// cloudWatchDatum is one value of a metric, with its dimensions
+type cloudWatchDatum struct {
+	name       string
+	unit       string
+	value      float64
+	dimensions [][2]string
+}
+
+// cloudWatchName returns the CloudWatch style name of an exported metric, e.g. CurrentReplicas for current_replicas
+func cloudWatchName(name string) string {
+	words := strings.Split(name, "_")
+	for i, word := range words {
+		if word != "" {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return strings.Join(words, "")
+}
+
+// data returns the metrics of each HPA, and counts of the HPAs at their maximum or limited by their bounds across the
+// cluster, which a single alarm can watch
+func (p *cloudWatchPublisher) data(hpas []v2.HorizontalPodAutoscaler) []cloudWatchDatum {
+	var result []cloudWatchDatum
+	cluster := [2]string{"Cluster", p.cluster}
+	totals := map[string]float64{}
+
+	for i := range hpas {
+		hpa := &hpas[i]
+		dimensions := [][2]string{cluster, {"Namespace", hpa.Namespace}, {"HPA", hpa.Name}}
+
+		for _, gauge := range hpaGauges {
+			unit := "None"
+			if strings.HasSuffix(gauge.name, "_replicas") {
+				unit = "Count"
+			}
+			value := gauge.value(hpa)
+			result = append(result, cloudWatchDatum{cloudWatchName(gauge.name), unit, value, dimensions})
+
+			if gauge.name == "at_max" || gauge.name == "scaling_limited" {
+				totals[gauge.name] += value
+			}
+		}
+
+		for _, utilization := range hpaUtilization(hpa) {
+			resource := append(append([][2]string(nil), dimensions...), [2]string{"Resource", utilization.resource})
+			result = append(result, cloudWatchDatum{"TargetUtilizationPercent", "Percent", float64(utilization.target), resource})
+			if utilization.current != nil {
+				result = append(result, cloudWatchDatum{"CurrentUtilizationPercent", "Percent", float64(*utilization.current), resource})
+			}
+		}
+	}
+
+	result = append(result,
+		cloudWatchDatum{"HPAsAtMax", "Count", totals["at_max"], [][2]string{cluster}},
+		cloudWatchDatum{"HPAsScalingLimited", "Count", totals["scaling_limited"], [][2]string{cluster}},
+		cloudWatchDatum{"HPAs", "Count", float64(len(hpas)), [][2]string{cluster}},
+	)
+
+	return result
+}
+
+// publish sends the metrics of the HPAs at the time, in as many requests as it takes
+func (p *cloudWatchPublisher) publish(ctx context.Context, hpas []v2.HorizontalPodAutoscaler, now time.Time) error {
+	data := p.data(hpas)
+
+	for start := 0; start < len(data); start += cloudWatchBatch {
+		batch := data[start:min(start+cloudWatchBatch, len(data))]
+		metrics := make([]types.MetricDatum, 0, len(batch))
+		for _, datum := range batch {
+			dimensions := make([]types.Dimension, 0, len(datum.dimensions))
+			for _, dimension := range datum.dimensions {
+				dimensions = append(dimensions, types.Dimension{Name: aws.String(dimension[0]), Value: aws.String(dimension[1])})
+			}
+			metrics = append(metrics, types.MetricDatum{
+				MetricName: aws.String(datum.name),
+				Unit:       types.StandardUnit(datum.unit),
+				Value:      aws.Float64(datum.value),
+				Timestamp:  aws.Time(now),
+				Dimensions: dimensions,
+			})
+		}
+
+		_, err := p.client.PutMetricData(ctx, &cloudwatch.PutMetricDataInput{Namespace: aws.String(p.namespace), MetricData: metrics})
+		if err != nil {
+			var response *awshttp.ResponseError
+			if errors.As(err, &response) && (response.HTTPStatusCode() == http.StatusForbidden || response.HTTPStatusCode() == http.StatusUnauthorized) {
+				return connectionError(err, "not authorized to publish to CloudWatch, check the credentials and IAM policy")
+			}
+			return fmt.Errorf("PutMetricData: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// export publishes the metrics of the HPAs every interval until the context is done
+func (p *cloudWatchPublisher) export(ctx context.Context, interval time.Duration, list func() ([]v2.HorizontalPodAutoscaler, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		hpas, err := list()
+		if err != nil {
+			log.Warn().Err(err).Msg("Listing HPAs for CloudWatch")
+		} else if err := p.publish(ctx, hpas, time.Now()); err != nil {
+			log.Warn().Err(err).Msg("Failed to publish metrics to CloudWatch")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package program
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCloudWatchPublish(t *testing.T) {
+	var lock sync.Mutex
+	var requests []map[string][]string
+	var status int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"), "requests are signed")
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			unzipped, err := gzip.NewReader(r.Body)
+			if !assert.NoError(t, err) {
+				return
+			}
+			body = unzipped
+		}
+		data, err := io.ReadAll(body)
+		form, parseErr := url.ParseQuery(string(data))
+		if !assert.NoError(t, errors.Join(err, parseErr)) {
+			return
+		}
+		requests = append(requests, form)
+
+		if status != 0 {
+			w.WriteHeader(status)
+			w.Write([]byte(`<ErrorResponse><Error><Type>Sender</Type><Code>AccessDenied</Code><Message>denied</Message></Error></ErrorResponse>`))
+			return
+		}
+		w.Write([]byte(`<PutMetricDataResponse><ResponseMetadata><RequestId>1</RequestId></ResponseMetadata></PutMetricDataResponse>`))
+	}))
+	defer server.Close()
+
+	publisher := &cloudWatchPublisher{
+		client: cloudwatch.New(cloudwatch.Options{
+			Region:           "eu-west-1",
+			BaseEndpoint:     aws.String(server.URL),
+			Credentials:      credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+			RetryMaxAttempts: 1,
+		}),
+		namespace: "K8sutils/HPA",
+		cluster:   "prod",
+	}
+
+	minimum := int32(2)
+	hpas := make([]v2.HorizontalPodAutoscaler, 200)
+	for i := range hpas {
+		hpas[i] = v2.HorizontalPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+			Spec:       v2.HorizontalPodAutoscalerSpec{MinReplicas: &minimum, MaxReplicas: 10},
+		}
+	}
+
+	data := publisher.data(hpas)
+	require.NoError(t, publisher.publish(context.Background(), hpas, time.Now()))
+
+	sent := 0
+	for _, request := range requests {
+		assert.Equal(t, "PutMetricData", request["Action"][0])
+		assert.Equal(t, "K8sutils/HPA", request["Namespace"][0])
+		for name := range request {
+			if strings.HasSuffix(name, ".MetricName") {
+				sent++
+			}
+		}
+	}
+	assert.Equal(t, len(data), sent, "every datum is sent")
+	assert.Len(t, requests, (len(data)+cloudWatchBatch-1)/cloudWatchBatch, "in batches")
+
+	status = http.StatusForbidden
+	err := publisher.publish(context.Background(), hpas[:1], time.Now())
+	assert.Equal(t, ExitConnection, ExitCode(err), "authorization failures are connection errors: %v", err)
+}
@@ -0,0 +1,236 @@
+package program
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/kong"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfig is read for defaults when --config is not given, if it exists
+const defaultConfig = "~/.k8sutils.yaml"
+
+// profilesKey is the setting holding the named profiles of a configuration file
+const profilesKey = "profiles"
+
+// BeforeResolve loads the configuration file so its settings, and those of the selected profile, become the defaults
+// of the flags not given on the command line or in the environment
+func (program *Options) BeforeResolve(ctx *kong.Context) error {
+	file, profile := defaultConfig, ""
+	for _, flag := range ctx.Flags() {
+		value, _ := ctx.FlagValue(flag).(string)
+		switch {
+		case value == "":
+		case flag.Name == "config":
+			file = value
+		case flag.Name == "profile":
+			profile = value
+		}
+	}
+
+	config, err := readConfig(kong.ExpandPath(file))
+	switch {
+	case os.IsNotExist(err) && file == defaultConfig && profile == "":
+		return nil
+	case os.IsNotExist(err) && file == defaultConfig:
+		return usageError("--profile %s needs a configuration file, %s does not exist", profile, defaultConfig)
+	case err != nil:
+		return usageError("reading configuration: %v", err)
+	}
+
+	// The file can name the profile to use when none is given
+	if profile == "" {
+		profile, _ = config.settings["profile"].(string)
+	}
+	if err := config.selectProfile(profile); err != nil {
+		return err
+	}
+
+	ctx.AddResolver(config)
+	return nil
+}
+
+// configFile holds the settings of a configuration file.  Each key is the name of a flag, without the dashes, and
+// applies to that flag in whichever command has it; a key naming a command holds settings for that command and its
+// subcommands only, which take precedence, e.g.
+//
+//	namespace: shop
+//	hpa:
+//	  require-ticket: true
+//	  export:
+//	    listen: ":9191"
+//
+// The profiles setting holds named sets of settings of the same form, such as the context, namespace and notifications
+// of one environment, which take precedence over the rest of the file when the profile is selected.
+type configFile struct {
+	file     string
+	settings map[string]any
+	// profile is the settings of the selected profile, if any
+	profile map[string]any
+}
+
+// readConfig reads a YAML configuration file
+func readConfig(file string) (*configFile, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := map[string]any{}
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	return &configFile{file: file, settings: settings}, nil
+}
+
+// profiles returns the profiles of the file by name
+func (c *configFile) profiles() map[string]any {
+	profiles, _ := c.settings[profilesKey].(map[string]any)
+	return profiles
+}
+
+// selectProfile makes the settings of the named profile take precedence, doing nothing if the name is empty
+func (c *configFile) selectProfile(name string) error {
+	if name == "" {
+		return nil
+	}
+
+	profiles := c.profiles()
+	profile, ok := profiles[name].(map[string]any)
+	if !ok {
+		names := settingNames(profiles)
+		if len(names) == 0 {
+			return usageError("no profile %s, %s has no profiles", name, c.file)
+		}
+		return usageError("no profile %s in %s, choose from %s", name, c.file, strings.Join(names, ", "))
+	}
+
+	c.profile = profile
+	return nil
+}
+
+// Resolve returns the setting for a flag not given on the command line.  A flag set by one of its environment
+// variables keeps that value, so the precedence is flags, then the environment, then the selected profile, then the
+// rest of the configuration file, then the defaults.
+func (c *configFile) Resolve(_ *kong.Context, parent *kong.Path, flag *kong.Flag) (any, error) {
+	for _, env := range flag.Envs {
+		if _, ok := os.LookupEnv(env); ok {
+			return nil, nil
+		}
+	}
+
+	// The commands above the flag, outermost first, each of which can have a section of settings
+	var commands []string
+	for node := parent.Node(); node != nil && node.Type == kong.CommandNode; node = node.Parent {
+		commands = append([]string{node.Name}, commands...)
+	}
+
+	if value := lookupSetting(c.profile, commands, flag.Name); value != nil {
+		return value, nil
+	}
+	return lookupSetting(c.settings, commands, flag.Name), nil
+}
+
+// lookupSetting returns the setting of the flag in the most specific of the sections for the commands which has one,
+// or nil if none do
+func lookupSetting(settings map[string]any, commands []string, name string) any {
+	var value any
+	section := settings
+	for i := 0; section != nil; i++ {
+		if v, ok := section[name]; ok {
+			value = v
+		}
+		if i == len(commands) {
+			break
+		}
+		section, _ = section[commands[i]].(map[string]any)
+	}
+	return value
+}
+
+// Validate checks every setting in the file names a flag or command, so a misspelt setting is not silently ignored
+func (c *configFile) Validate(app *kong.Application) error {
+	settings := make(map[string]any, len(c.settings))
+	for key, value := range c.settings {
+		if key != profilesKey {
+			settings[key] = value
+		}
+	}
+	if err := validateSettings(settings, app.Node, ""); err != nil {
+		return fmt.Errorf("%s: %w", c.file, err)
+	}
+
+	if profiles, ok := c.settings[profilesKey]; ok && c.profiles() == nil {
+		return fmt.Errorf("%s: %s must be a map of profile names to settings, not %v", c.file, profilesKey, profiles)
+	}
+	for _, name := range settingNames(c.profiles()) {
+		profile, ok := c.profiles()[name].(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: profile %s must be a map of settings", c.file, name)
+		}
+		if err := validateSettings(profile, app.Node, ""); err != nil {
+			return fmt.Errorf("%s: profile %s: %w", c.file, name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateSettings checks the settings of a section apply to the flags of its command or those below it
+func validateSettings(settings map[string]any, node *kong.Node, section string) error {
+	flags := map[string]bool{}
+	var collect func(node *kong.Node)
+	collect = func(node *kong.Node) {
+		for _, flag := range node.Flags {
+			flags[flag.Name] = true
+		}
+		for _, child := range node.Children {
+			collect(child)
+		}
+	}
+	collect(node)
+
+	for _, key := range settingNames(settings) {
+		if child := childCommand(node, key); child != nil {
+			if values, ok := settings[key].(map[string]any); ok {
+				if err := validateSettings(values, child, strings.TrimSpace(section+" "+key)); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if flags[key] {
+			continue
+		}
+		if section == "" {
+			return fmt.Errorf("%q is not a flag or command", key)
+		}
+		return fmt.Errorf("%q is not a flag of %s", key, section)
+	}
+
+	return nil
+}
+
+// settingNames returns the names of the settings, sorted
+func settingNames(settings map[string]any) []string {
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// childCommand returns the subcommand of the node with the name, or nil if there is none
+func childCommand(node *kong.Node, name string) *kong.Node {
+	for _, child := range node.Children {
+		if child.Type == kong.CommandNode && child.Name == name {
+			return child
+		}
+	}
+	return nil
+}
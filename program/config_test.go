@@ -0,0 +1,121 @@
+package program
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useConfig makes the settings the configuration file for the test, in place of the user's own, with no kubeconfig
+func useConfig(t *testing.T, settings string) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "k8sutils.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(settings), 0o644))
+	t.Setenv("K8SUTILS_CONFIG", file)
+	t.Setenv("KUBECONFIG", filepath.Join(dir, "kubeconfig"))
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		args      []string
+		env       string
+		wantChunk int64
+		wantSlack string
+	}{
+		{name: "default", wantChunk: 500},
+		{name: "file", config: "chunk-size: 100", wantChunk: 100},
+		{name: "command section", config: "chunk-size: 100\nhpa:\n  chunk-size: 200", wantChunk: 200},
+		{name: "subcommand section", config: "chunk-size: 100\nhpa:\n  chunk-size: 200\n  modify:\n    chunk-size: 300", wantChunk: 300},
+		{name: "other command sections do not apply", config: "chunk-size: 100\ndeploy:\n  chunk-size: 200", wantChunk: 100},
+		{
+			name:      "profile over the rest of the file",
+			config:    "hpa:\n  chunk-size: 200\nprofiles:\n  prod:\n    chunk-size: 400",
+			args:      []string{"--profile", "prod"},
+			wantChunk: 400,
+		},
+		{
+			name:      "profile section",
+			config:    "chunk-size: 100\nprofiles:\n  prod:\n    hpa:\n      modify:\n        chunk-size: 400",
+			args:      []string{"--profile", "prod"},
+			wantChunk: 400,
+		},
+		{
+			name:      "profile named in the file",
+			config:    "profile: prod\nprofiles:\n  prod:\n    chunk-size: 400\n  staging:\n    chunk-size: 50",
+			wantChunk: 400,
+		},
+		{
+			name:      "profile on the command line over the one named in the file",
+			config:    "profile: prod\nprofiles:\n  prod:\n    chunk-size: 400\n  staging:\n    chunk-size: 50",
+			args:      []string{"--profile", "staging"},
+			wantChunk: 50,
+		},
+		{
+			name:      "command line over the file",
+			config:    "chunk-size: 100\nprofiles:\n  prod:\n    chunk-size: 400",
+			args:      []string{"--profile", "prod", "--chunk-size", "20"},
+			wantChunk: 20,
+		},
+		{
+			name:      "environment over the file",
+			config:    "notify-slack: https://file.example\nprofiles:\n  prod:\n    notify-slack: https://profile.example",
+			args:      []string{"--profile", "prod"},
+			env:       "https://env.example",
+			wantChunk: 500,
+			wantSlack: "https://env.example",
+		},
+		{
+			name:      "file when the environment is not set",
+			config:    "notify-slack: https://file.example",
+			wantChunk: 500,
+			wantSlack: "https://file.example",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, test.config)
+			if test.env != "" {
+				t.Setenv("K8SUTILS_NOTIFY_SLACK", test.env)
+			}
+
+			var options Options
+			_, err := options.Parse(append([]string{"hpa", "modify", "--dry-run"}, test.args...))
+			require.NoError(t, err)
+
+			assert.Equal(t, test.wantChunk, options.Hpa.Modify.ChunkSize)
+			assert.Equal(t, test.wantSlack, options.NotifySlack)
+		})
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		args    []string
+		wantErr string
+	}{
+		{name: "misspelt setting", config: "chunksize: 100", wantErr: `"chunksize" is not a flag or command`},
+		{name: "setting of another command", config: "hpa:\n  replicas: 3", wantErr: `"replicas" is not a flag of hpa`},
+		{name: "misspelt profile setting", config: "profiles:\n  prod:\n    chunksize: 100", wantErr: `profile prod: "chunksize" is not a flag or command`},
+		{name: "unknown profile", config: "profiles:\n  prod:\n    chunk-size: 100", args: []string{"--profile", "dev"}, wantErr: "no profile dev in"},
+		{name: "file without profiles", config: "chunk-size: 100", args: []string{"--profile", "dev"}, wantErr: "has no profiles"},
+		{name: "missing file", args: []string{"--config", "/nonexistent/k8sutils.yaml"}, wantErr: "reading configuration"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useConfig(t, test.config)
+
+			var options Options
+			_, err := options.Parse(append([]string{"hpa", "modify"}, test.args...))
+			assert.ErrorContains(t, err, test.wantErr)
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package program
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// confirm asks the user whether to go ahead, returning true only if they answer yes.  Without a terminal there is no
+// one to ask, so the caller should require a --yes flag instead.
+func confirm(prompt string) bool {
+	if !isTerminal(os.Stdin) {
+		return false
+	}
+
+	fmt.Printf("%s [y/N] ", prompt)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,211 @@
+package program
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Cronjob shows CronJobs and suspends or resumes them, e.g. to pause batch work cluster-wide during an incident
+type Cronjob struct {
+	Suspend bool   `xor:"action" help:"Suspend the selected CronJobs so they start no new jobs"`
+	Resume  bool   `xor:"action" help:"Resume the selected CronJobs"`
+	Ticket  string `help:"Change ticket (e.g. JIRA-123) recorded with every modification"`
+
+	Selector `embed:""`
+	Bulk     `embed:""`
+}
+
+func (program *Cronjob) Run(options *Options) error {
+
+	initColors(options)
+
+	if (program.Suspend || program.Resume) && !program.selected() {
+		return usageError("select CronJobs by name, with --labels or with --all")
+	}
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	cronjobs, err := program.getCronJobs(ctx, clientset)
+	if err != nil {
+		return err
+	}
+
+	if !program.Suspend && !program.Resume {
+		program.printCronJobs(cronjobs)
+		return nil
+	}
+
+	return options.runAsLeader(ctx, clientset, func(ctx context.Context) error {
+		results := newSummary()
+		defer results.print()
+
+		errs := program.Bulk.run(ctx, len(cronjobs), options.DryRun, false, func(i int) error {
+			cronjob := &cronjobs[i]
+
+			changed, err := program.setSuspend(ctx, options, clientset, cronjob)
+			switch {
+			case err != nil:
+				fmt.Printf("Failed to update CronJob %s: %v\n", cronjob.Name, err)
+				results.record(cronjob.Namespace, cronjob.Name, outcomeFailed, err.Error())
+				return fmt.Errorf("CronJob %s: %w", cronjob.Name, err)
+			case !changed && program.Suspend:
+				results.record(cronjob.Namespace, cronjob.Name, outcomeSkipped, "already suspended")
+			case !changed:
+				results.record(cronjob.Namespace, cronjob.Name, outcomeSkipped, "not suspended")
+			case options.DryRun:
+				results.record(cronjob.Namespace, cronjob.Name, outcomeUpdated, "dry run: "+program.action())
+			default:
+				results.record(cronjob.Namespace, cronjob.Name, outcomeUpdated, program.action())
+			}
+			return nil
+		})
+
+		for _, cronjob := range cronjobs {
+			if !results.has(cronjob.Namespace, cronjob.Name) {
+				results.record(cronjob.Namespace, cronjob.Name, outcomeSkipped, "not started")
+			}
+		}
+
+		return errors.Join(errs...)
+	})
+}
+
+// action describes the change being made
+func (program *Cronjob) action() string {
+	action := "resumed"
+	if program.Suspend {
+		action = "suspended"
+	}
+	if program.Ticket != "" {
+		action += fmt.Sprintf(" (ticket %s)", program.Ticket)
+	}
+	return action
+}
+
+// setSuspend suspends or resumes the CronJob, returning false if it is already in the requested state
+func (program *Cronjob) setSuspend(ctx context.Context, options *Options, clientset kubernetes.Interface, cronjob *batchv1.CronJob) (bool, error) {
+	suspended := cronjob.Spec.Suspend != nil && *cronjob.Spec.Suspend
+	if suspended == program.Suspend {
+		return false, nil
+	}
+
+	log.Info().
+		Str("namespace", cronjob.Namespace).
+		Str("cronjob", cronjob.Name).
+		Bool("suspend", program.Suspend).
+		Str("ticket", program.Ticket).
+		Msg("Modifying")
+
+	if options.DryRun {
+		return true, nil
+	}
+
+	annotations := map[string]string{AnnotationChange: program.action()}
+	if program.Ticket != "" {
+		annotations[AnnotationTicket] = program.Ticket
+	}
+
+	// Setting suspend is idempotent, so a merge patch without a resourceVersion is safe against concurrent changes
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"annotations": annotations},
+		"spec":     map[string]any{"suspend": program.Suspend},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	var updated *batchv1.CronJob
+	err = withRetries(ctx, options.Retries, func() (err error) {
+		updated, err = clientset.BatchV1().CronJobs(cronjob.Namespace).Patch(ctx, cronjob.Name, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: FieldManager})
+		return err
+	})
+	if err != nil {
+		return false, apiError(err)
+	}
+
+	reason := "Resumed"
+	if program.Suspend {
+		reason = "Suspended"
+	}
+
+	recordObjectEvent(ctx, eventCreator(clientset), corev1.ObjectReference{
+		APIVersion:      "batch/v1",
+		Kind:            "CronJob",
+		Name:            updated.Name,
+		Namespace:       updated.Namespace,
+		UID:             updated.UID,
+		ResourceVersion: updated.ResourceVersion,
+	}, reason, program.action())
+
+	return true, nil
+}
+
+// getCronJobs returns the selected CronJobs sorted by namespace and name
+func (program *Cronjob) getCronJobs(ctx context.Context, clientset kubernetes.Interface) ([]batchv1.CronJob, error) {
+	cronjobs := clientset.BatchV1().CronJobs
+
+	return fetch(ctx, &program.Selector, "cronjob",
+		func(ctx context.Context, namespace, name string) (*batchv1.CronJob, error) {
+			return cronjobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		},
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]batchv1.CronJob, string, error) {
+			list, err := cronjobs(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+}
+
+// printCronJobs shows the CronJobs as a table, highlighting suspended ones
+func (program *Cronjob) printCronJobs(cronjobs []batchv1.CronJob) {
+	t := newTable()
+
+	header := table.Row{"NAME", "SCHEDULE", "SUSPEND", "ACTIVE", "LAST SCHEDULE"}
+	if program.AllNamespaces {
+		header = append(table.Row{"NAMESPACE"}, header...)
+	}
+	t.AppendHeader(header)
+
+	for i := range cronjobs {
+		cronjob := &cronjobs[i]
+
+		suspend := "False"
+		if cronjob.Spec.Suspend != nil && *cronjob.Spec.Suspend {
+			suspend = paint(text.FgYellow, "True")
+		}
+
+		last := "<none>"
+		if cronjob.Status.LastScheduleTime != nil {
+			last = duration.HumanDuration(time.Since(cronjob.Status.LastScheduleTime.Time)) + " ago"
+		}
+
+		row := table.Row{cronjob.Name, cronjob.Spec.Schedule, suspend, strconv.Itoa(len(cronjob.Status.Active)), last}
+		if program.AllNamespaces {
+			row = append(table.Row{cronjob.Namespace}, row...)
+		}
+		t.AppendRow(row)
+	}
+
+	t.Render()
+}
@@ -0,0 +1,262 @@
+package program
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Daemonsets shows the health of DaemonSets per node pool and lists the nodes missing a ready daemon pod.  A node
+// without its CNI, metrics or log shipping daemon is a common cause of pods with no metrics, which HPAs then treat
+// conservatively.
+type Daemonsets struct {
+	PoolLabel string `help:"Node label naming the node pool (default: the first of the well known cloud provider labels the node has)"`
+
+	Selector `embed:""`
+}
+
+// poolLabels are the node labels cloud providers and autoscalers use to name node pools, in the order they are tried
+var poolLabels = []string{
+	"eks.amazonaws.com/nodegroup",
+	"cloud.google.com/gke-nodepool",
+	"kubernetes.azure.com/agentpool",
+	"karpenter.sh/nodepool",
+	"node.kubernetes.io/instance-type",
+}
+
+// daemonPoolStatus counts a DaemonSet's daemons on the nodes of one pool
+type daemonPoolStatus struct {
+	desired int
+	ready   int
+}
+
+func (program *Daemonsets) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	daemonsets, err := fetch(ctx, &program.Selector, "daemonset",
+		func(ctx context.Context, namespace, name string) (*appsv1.DaemonSet, error) {
+			return clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		},
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]appsv1.DaemonSet, string, error) {
+			list, err := clientset.AppsV1().DaemonSets(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+	if err != nil {
+		return err
+	}
+
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return apiError(err)
+	}
+	sortObjects(nodes.Items)
+
+	summary := newTable()
+	summary.AppendHeader(table.Row{"NAMESPACE", "DAEMONSET", "POOL", "DESIRED", "READY", "UNAVAILABLE"})
+
+	missing := newTable()
+	missing.AppendHeader(table.Row{"NODE", "POOL", "NAMESPACE", "DAEMONSET", "STATUS"})
+	missingCount := 0
+
+	for _, ds := range daemonsets {
+		ready, err := readyDaemonNodes(ctx, clientset, &ds)
+		if err != nil {
+			return err
+		}
+
+		pools := map[string]*daemonPoolStatus{}
+		for _, node := range nodes.Items {
+			if !runsOn(&ds.Spec.Template.Spec, &node) {
+				continue
+			}
+
+			pool := nodePool(&node, program.PoolLabel)
+			status, ok := pools[pool]
+			if !ok {
+				status = &daemonPoolStatus{}
+				pools[pool] = status
+			}
+			status.desired++
+
+			state, found := ready[node.Name]
+			switch {
+			case found && state:
+				status.ready++
+				continue
+			case found:
+				missing.AppendRow(table.Row{node.Name, pool, ds.Namespace, ds.Name, paint(text.FgYellow, "pod not ready")})
+			default:
+				missing.AppendRow(table.Row{node.Name, pool, ds.Namespace, ds.Name, paint(text.FgRed, "no pod")})
+			}
+			missingCount++
+		}
+
+		names := make([]string, 0, len(pools))
+		for pool := range pools {
+			names = append(names, pool)
+		}
+		sort.Strings(names)
+
+		for _, pool := range names {
+			status := pools[pool]
+			unavailable := strconv.Itoa(status.desired - status.ready)
+			if status.ready < status.desired {
+				unavailable = paint(text.FgRed, unavailable)
+			}
+			summary.AppendRow(table.Row{ds.Namespace, ds.Name, pool, strconv.Itoa(status.desired), strconv.Itoa(status.ready), unavailable})
+		}
+	}
+
+	summary.Render()
+
+	if missingCount == 0 {
+		log.Info().Int("daemonsets", len(daemonsets)).Msg("Every node has its daemons")
+		return nil
+	}
+
+	fmt.Println()
+	missing.Render()
+	log.Warn().Int("count", missingCount).Msg("Nodes missing ready daemons")
+
+	return nil
+}
+
+// nodePool returns the value of the given node pool label, or of the first well known one if label is empty, or "-"
+// if the node has no pool label
+func nodePool(node *corev1.Node, label string) string {
+	if label != "" {
+		return orDash(node.Labels[label])
+	}
+
+	for _, label := range poolLabels {
+		if value := node.Labels[label]; value != "" {
+			return value
+		}
+	}
+	return "-"
+}
+
+// readyDaemonNodes returns, for each node with a pod of the DaemonSet, whether that pod is ready
+func readyDaemonNodes(ctx context.Context, clientset kubernetes.Interface, ds *appsv1.DaemonSet) (map[string]bool, error) {
+	selector, err := metav1.LabelSelectorAsSelector(ds.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("daemonset %s/%s: %w", ds.Namespace, ds.Name, err)
+	}
+
+	pods, err := clientset.CoreV1().Pods(ds.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, apiError(err)
+	}
+
+	nodes := map[string]bool{}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" || !metav1.IsControlledBy(&pod, ds) {
+			continue
+		}
+		nodes[pod.Spec.NodeName] = nodes[pod.Spec.NodeName] || isPodReady(&pod)
+	}
+
+	return nodes, nil
+}
+
+// isPodReady returns true if the pod's Ready condition is true
+func isPodReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// runsOn returns true if a DaemonSet with this pod template should run a pod on the node: the node matches its node
+// selector and required node affinity, and it tolerates the node's NoSchedule and NoExecute taints
+func runsOn(spec *corev1.PodSpec, node *corev1.Node) bool {
+	if !labels.SelectorFromSet(spec.NodeSelector).Matches(labels.Set(node.Labels)) {
+		return false
+	}
+
+	if affinity := spec.Affinity; affinity != nil && affinity.NodeAffinity != nil {
+		if required := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution; required != nil && !matchesNodeSelectorTerms(node, required.NodeSelectorTerms) {
+			return false
+		}
+	}
+
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+
+		tolerated := false
+		for _, toleration := range spec.Tolerations {
+			if toleration.ToleratesTaint(taint) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesNodeSelectorTerms returns true if the node matches any of the terms, each of which must match all its
+// expressions.  The only field a term can match is the node name.
+func matchesNodeSelectorTerms(node *corev1.Node, terms []corev1.NodeSelectorTerm) bool {
+	operators := map[corev1.NodeSelectorOperator]selection.Operator{
+		corev1.NodeSelectorOpIn:           selection.In,
+		corev1.NodeSelectorOpNotIn:        selection.NotIn,
+		corev1.NodeSelectorOpExists:       selection.Exists,
+		corev1.NodeSelectorOpDoesNotExist: selection.DoesNotExist,
+		corev1.NodeSelectorOpGt:           selection.GreaterThan,
+		corev1.NodeSelectorOpLt:           selection.LessThan,
+	}
+
+	matches := func(requirements []corev1.NodeSelectorRequirement, values labels.Set) bool {
+		for _, r := range requirements {
+			requirement, err := labels.NewRequirement(r.Key, operators[r.Operator], r.Values)
+			if err != nil || !requirement.Matches(values) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, term := range terms {
+		if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+			continue
+		}
+		if matches(term.MatchExpressions, labels.Set(node.Labels)) &&
+			matches(term.MatchFields, labels.Set{"metadata.name": node.Name}) {
+			return true
+		}
+	}
+
+	return false
+}
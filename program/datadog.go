@@ -0,0 +1,286 @@
+package program
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	v2 "k8s.io/api/autoscaling/v2"
+)
+
+// Datadog holds the flags which send HPA metrics and events to Datadog, for monitoring which is not Prometheus
+type Datadog struct {
+	DatadogAPIKey   string        `name:"datadog-api-key" env:"DD_API_KEY" placeholder:"KEY" help:"Datadog API key to send change summaries and alerts to as events, and from hpa export the HPA metrics and scaling events"`
+	DatadogSite     string        `name:"datadog-site" env:"DD_SITE" default:"datadoghq.com" help:"Datadog site of the account, e.g. datadoghq.eu or us5.datadoghq.com"`
+	DatadogTags     []string      `name:"datadog-tag" placeholder:"KEY:VALUE" help:"Tags to add to the metrics and events sent to Datadog"`
+	DatadogInterval time.Duration `name:"datadog-interval" default:"1m" help:"How often hpa export submits metrics to Datadog"`
+}
+
+// datadogMetricPrefix names the metrics submitted to Datadog, which are those exported to Prometheus
+const datadogMetricPrefix = "k8sutils.hpa."
+
+// datadogGauge is the type of a gauge in the metrics API
+const datadogGauge = 3
+
+// datadogClient submits metrics and events to the Datadog API, tagging them with the cluster and the --datadog-tag tags
+type datadogClient struct {
+	client *restClient
+	tags   []string
+}
+
+// newDatadogClient returns a client for the flags, or nil if no API key is given
+func (d *Datadog) newDatadogClient(cluster string) *datadogClient {
+	if d.DatadogAPIKey == "" {
+		return nil
+	}
+
+	tags := append([]string(nil), d.DatadogTags...)
+	if cluster != "" {
+		tags = append(tags, "cluster:"+cluster)
+	}
+
+	return &datadogClient{
+		client: &restClient{base: "https://api." + d.DatadogSite, service: "Datadog", headers: map[string]string{"DD-API-KEY": d.DatadogAPIKey}},
+		tags:   tags,
+	}
+}
+
+// hpaTags returns the tags identifying an HPA, with the common tags and any extra ones
+func (d *datadogClient) hpaTags(namespace, name string, extra ...string) []string {
+	tags := append([]string{"namespace:" + namespace, "hpa:" + name}, d.tags...)
+	return append(tags, extra...)
+}
+
+// datadogPoint is one value of a series in the metrics API
+type datadogPoint struct {
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+// datadogSeries is a metric with its tags, as submitted to the metrics API
+type datadogSeries struct {
+	Metric string         `json:"metric"`
+	Type   int            `json:"type"`
+	Points []datadogPoint `json:"points"`
+	Tags   []string       `json:"tags"`
+}
+
+// submitMetrics sends the value of every HPA metric at the time
+func (d *datadogClient) submitMetrics(ctx context.Context, hpas []v2.HorizontalPodAutoscaler, now time.Time) error {
+	var series []datadogSeries
+	gauge := func(name string, value float64, tags []string) {
+		series = append(series, datadogSeries{
+			Metric: datadogMetricPrefix + name,
+			Type:   datadogGauge,
+			Points: []datadogPoint{{Timestamp: now.Unix(), Value: value}},
+			Tags:   tags,
+		})
+	}
+
+	for i := range hpas {
+		hpa := &hpas[i]
+		ref := hpa.Spec.ScaleTargetRef
+		tags := d.hpaTags(hpa.Namespace, hpa.Name, "target_kind:"+ref.Kind, "target_name:"+ref.Name)
+
+		for _, g := range hpaGauges {
+			gauge(g.name, g.value(hpa), tags)
+		}
+
+		for _, utilization := range hpaUtilization(hpa) {
+			resourceTags := append(append([]string(nil), tags...), "resource:"+utilization.resource)
+			gauge("target_utilization_percent", float64(utilization.target), resourceTags)
+			if utilization.current != nil {
+				gauge("current_utilization_percent", float64(*utilization.current), resourceTags)
+			}
+		}
+	}
+
+	if len(series) == 0 {
+		return nil
+	}
+
+	_, err := d.client.call(ctx, http.MethodPost, "/api/v2/series", map[string]any{"series": series}, nil)
+	return err
+}
+
+// datadogEvent is an event as posted to the events API
+type datadogEvent struct {
+	Title          string   `json:"title"`
+	Text           string   `json:"text"`
+	Tags           []string `json:"tags"`
+	AlertType      string   `json:"alert_type"`
+	AggregationKey string   `json:"aggregation_key,omitempty"`
+	SourceType     string   `json:"source_type_name"`
+	DateHappened   int64    `json:"date_happened"`
+}
+
+// event posts an event, which is shown in the event stream and can be overlaid on dashboards
+func (d *datadogClient) event(ctx context.Context, event *datadogEvent) error {
+	event.SourceType = "k8sutils"
+	_, err := d.client.call(ctx, http.MethodPost, "/api/v1/events", event, nil)
+	return err
+}
+
+// export submits the metrics of the HPAs every interval until the context is done, along with an event for each
+// scaling or change of limits seen since the interval before
+func (d *datadogClient) export(ctx context.Context, interval time.Duration, list func() ([]v2.HorizontalPodAutoscaler, error)) {
+	changes := newHpaChanges()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		hpas, err := list()
+		if err != nil {
+			log.Warn().Err(err).Msg("Listing HPAs for Datadog")
+		} else {
+			now := time.Now()
+			if err := d.submitMetrics(ctx, hpas, now); err != nil {
+				log.Warn().Err(err).Msg("Failed to submit metrics to Datadog")
+			}
+			for _, change := range changes.observe(hpas) {
+				err := d.event(ctx, &datadogEvent{
+					Title:          change.title,
+					Text:           change.title,
+					Tags:           d.hpaTags(change.namespace, change.name, "change:"+change.kind),
+					AlertType:      "info",
+					AggregationKey: change.namespace + "/" + change.name,
+					DateHappened:   now.Unix(),
+				})
+				if err != nil {
+					log.Warn().Err(err).Msg("Failed to send event to Datadog")
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// hpaChange is a change seen in an HPA between two observations
+type hpaChange struct {
+	namespace, name string
+	// kind is "scale" when the replicas changed or "limits" when the min or max did
+	kind  string
+	title string
+}
+
+// hpaState is the replicas and limits of an HPA, which are compared between observations
+type hpaState struct {
+	replicas int32
+	limits   [2]int32
+}
+
+func hpaStateOf(hpa *v2.HorizontalPodAutoscaler) hpaState {
+	return hpaState{hpa.Status.CurrentReplicas, [2]int32{max(replicasOf(hpa.Spec.MinReplicas), 1), hpa.Spec.MaxReplicas}}
+}
+
+// compareHpaStates returns the changes of an HPA between two states
+func compareHpaStates(namespace, name string, before, after hpaState) []hpaChange {
+	var changes []hpaChange
+	key := namespace + "/" + name
+
+	if before.replicas != after.replicas {
+		changes = append(changes, hpaChange{namespace, name, "scale",
+			fmt.Sprintf("HPA %s scaled from %d to %d replicas", key, before.replicas, after.replicas)})
+	}
+	if before.limits != after.limits {
+		changes = append(changes, hpaChange{namespace, name, "limits",
+			fmt.Sprintf("HPA %s limits changed from %d-%d to %d-%d", key, before.limits[0], before.limits[1], after.limits[0], after.limits[1])})
+	}
+
+	return changes
+}
+
+// hpaChanges remembers the state of HPAs between observations, to find when they change
+type hpaChanges struct {
+	states map[string]hpaState
+}
+
+func newHpaChanges() *hpaChanges {
+	return &hpaChanges{states: map[string]hpaState{}}
+}
+
+// observe returns what changed in the HPAs since they were last observed.  HPAs seen for the first time have no
+// changes, and those gone are forgotten.
+func (c *hpaChanges) observe(hpas []v2.HorizontalPodAutoscaler) []hpaChange {
+	var changes []hpaChange
+	seen := map[string]bool{}
+
+	for i := range hpas {
+		hpa := &hpas[i]
+		key := hpa.Namespace + "/" + hpa.Name
+		seen[key] = true
+
+		state := hpaStateOf(hpa)
+		if before, ok := c.states[key]; ok {
+			changes = append(changes, compareHpaStates(hpa.Namespace, hpa.Name, before, state)...)
+		}
+		c.states[key] = state
+	}
+
+	for key := range c.states {
+		if !seen[key] {
+			delete(c.states, key)
+		}
+	}
+
+	return changes
+}
+
+// datadogNotifier posts change summaries and alerts as Datadog events.  Alerts with the same key are aggregated into
+// one, and a resolved alert is a success event.
+type datadogNotifier struct {
+	client *datadogClient
+}
+
+func (d *datadogNotifier) name() string {
+	return "datadog"
+}
+
+// datadogAlertType is the alert type of an event for each severity
+var datadogAlertType = map[string]string{
+	severityInfo:     "info",
+	severityWarning:  "warning",
+	severityCritical: "error",
+}
+
+func (d *datadogNotifier) notify(ctx context.Context, n *notification) error {
+	if n.Kind == notificationEvent {
+		return nil
+	}
+
+	alertType := datadogAlertType[n.Severity]
+	if n.Resolved {
+		alertType = "success"
+	}
+
+	tags := append([]string{"kind:" + n.Kind}, d.client.tags...)
+	if n.Key != "" {
+		namespace, name, _ := strings.Cut(alertSubject(n.Key), "/")
+		tags = d.client.hpaTags(namespace, name, "kind:"+n.Kind)
+	}
+	if n.Command != "" {
+		tags = append(tags, "command:"+n.Command)
+	}
+
+	text := n.Title
+	if len(n.Lines) > 0 {
+		text = strings.Join(n.Lines, "\n")
+	}
+
+	return d.client.event(ctx, &datadogEvent{
+		Title:          n.Title,
+		Text:           text,
+		Tags:           tags,
+		AlertType:      alertType,
+		AggregationKey: n.Key,
+		DateHappened:   n.Time.Unix(),
+	})
+}
@@ -0,0 +1,274 @@
+package program
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Deploy shows Deployments and changes their replicas.  Changes go through the scale subresource exactly as with the
+// scale command.
+type Deploy struct {
+	Replicas string `xor:"action" help:"Set replicas to a number (5), a percentage of the current replicas (50%) or a multiplier (2x)"`
+	Pause    bool   `xor:"action" help:"Pause rollouts of the selected Deployments, e.g. before coordinated HPA or limits changes"`
+	Resume   bool   `xor:"action" help:"Resume paused rollouts of the selected Deployments"`
+	Paused   bool   `help:"Only show Deployments whose rollouts are paused"`
+	Ticket   string `help:"Change ticket (e.g. JIRA-123) recorded with every modification"`
+
+	Selector `embed:""`
+	Bulk     `embed:""`
+}
+
+// deploymentStatus is a row of the deployment listing, also used for JSON output
+type deploymentStatus struct {
+	Namespace   string `json:"namespace"`
+	Name        string `json:"name"`
+	Replicas    int32  `json:"replicas"`
+	Ready       int32  `json:"ready"`
+	UpToDate    int32  `json:"upToDate"`
+	Available   int32  `json:"available"`
+	Unavailable int32  `json:"unavailable"`
+	Paused      bool   `json:"paused"`
+}
+
+func (program *Deploy) Run(options *Options) error {
+	if program.Replicas != "" {
+		scale := Scale{
+			Resource: "deployments.apps",
+			Replicas: program.Replicas,
+			Ticket:   program.Ticket,
+			Selector: program.Selector,
+			Bulk:     program.Bulk,
+		}
+		return scale.Run(options)
+	}
+
+	initColors(options)
+
+	if (program.Pause || program.Resume) && !program.selected() {
+		return usageError("select Deployments by name, with --labels or with --all")
+	}
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	deployments, err := program.getDeployments(ctx, clientset)
+	if err != nil {
+		return err
+	}
+
+	if program.Pause || program.Resume {
+		return options.runAsLeader(ctx, clientset, func(ctx context.Context) error {
+			return program.setPaused(ctx, options, clientset, deployments)
+		})
+	}
+
+	if program.Paused {
+		var paused []appsv1.Deployment
+		for _, d := range deployments {
+			if d.Spec.Paused {
+				paused = append(paused, d)
+			}
+		}
+		deployments = paused
+	}
+
+	rows := make([]deploymentStatus, 0, len(deployments))
+	for _, d := range deployments {
+		rows = append(rows, deploymentStatus{
+			Namespace:   d.Namespace,
+			Name:        d.Name,
+			Replicas:    replicasOf(d.Spec.Replicas),
+			Ready:       d.Status.ReadyReplicas,
+			UpToDate:    d.Status.UpdatedReplicas,
+			Available:   d.Status.AvailableReplicas,
+			Unavailable: d.Status.UnavailableReplicas,
+			Paused:      d.Spec.Paused,
+		})
+	}
+
+	if options.OutputFormat == "jsonl" {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, row := range rows {
+			if err := encoder.Encode(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	program.printDeployments(rows)
+	return nil
+}
+
+// getDeployments returns the selected Deployments sorted by namespace and name
+func (program *Deploy) getDeployments(ctx context.Context, clientset kubernetes.Interface) ([]appsv1.Deployment, error) {
+	deployments := clientset.AppsV1().Deployments
+
+	return fetch(ctx, &program.Selector, "deployment",
+		func(ctx context.Context, namespace, name string) (*appsv1.Deployment, error) {
+			return deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		},
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]appsv1.Deployment, string, error) {
+			list, err := deployments(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+}
+
+// printDeployments shows the deployments as a table, highlighting any with unavailable replicas
+func (program *Deploy) printDeployments(rows []deploymentStatus) {
+	t := newTable()
+
+	header := table.Row{"NAME", "REPLICAS", "READY", "UP-TO-DATE", "AVAILABLE", "UNAVAILABLE", "PAUSED"}
+	if program.AllNamespaces {
+		header = append(table.Row{"NAMESPACE"}, header...)
+	}
+	t.AppendHeader(header)
+
+	for _, d := range rows {
+		unavailable := strconv.Itoa(int(d.Unavailable))
+		if d.Unavailable > 0 {
+			unavailable = paint(text.FgRed, unavailable)
+		}
+
+		ready := strconv.Itoa(int(d.Ready))
+		if d.Ready < d.Replicas {
+			ready = paint(text.FgYellow, ready)
+		}
+
+		paused := ""
+		if d.Paused {
+			paused = paint(text.FgYellow, "paused")
+		}
+
+		row := table.Row{d.Name, strconv.Itoa(int(d.Replicas)), ready, strconv.Itoa(int(d.UpToDate)), strconv.Itoa(int(d.Available)), unavailable, paused}
+		if program.AllNamespaces {
+			row = append(table.Row{d.Namespace}, row...)
+		}
+		t.AppendRow(row)
+	}
+
+	t.Render()
+}
+
+// setPaused pauses or resumes the rollouts of the Deployments, then reports any of them which are left paused so they
+// are not forgotten
+func (program *Deploy) setPaused(ctx context.Context, options *Options, clientset kubernetes.Interface, deployments []appsv1.Deployment) error {
+	action := "resumed"
+	if program.Pause {
+		action = "paused"
+	}
+	if program.Ticket != "" {
+		action += fmt.Sprintf(" (ticket %s)", program.Ticket)
+	}
+
+	annotations := map[string]string{AnnotationChange: "rollout " + action}
+	if program.Ticket != "" {
+		annotations[AnnotationTicket] = program.Ticket
+	}
+
+	// Setting paused is idempotent, so a merge patch without a resourceVersion is safe against concurrent changes
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"annotations": annotations},
+		"spec":     map[string]any{"paused": program.Pause},
+	})
+	if err != nil {
+		return err
+	}
+
+	results := newSummary()
+
+	// leftPaused records whether each Deployment is paused after the run, or would be in a dry run
+	leftPaused := make([]bool, len(deployments))
+	for i := range deployments {
+		leftPaused[i] = deployments[i].Spec.Paused
+	}
+
+	errs := program.Bulk.run(ctx, len(deployments), options.DryRun, false, func(i int) error {
+		d := &deployments[i]
+
+		if d.Spec.Paused == program.Pause {
+			results.record(d.Namespace, d.Name, outcomeSkipped, "already "+strings.Fields(action)[0])
+			return nil
+		}
+
+		log.Info().Str("namespace", d.Namespace).Str("deployment", d.Name).Bool("paused", program.Pause).Str("ticket", program.Ticket).Msg("Modifying")
+
+		if options.DryRun {
+			results.record(d.Namespace, d.Name, outcomeUpdated, "dry run: "+action)
+			leftPaused[i] = program.Pause
+			return nil
+		}
+
+		var updated *appsv1.Deployment
+		err := withRetries(ctx, options.Retries, func() (err error) {
+			updated, err = clientset.AppsV1().Deployments(d.Namespace).Patch(ctx, d.Name, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: FieldManager})
+			return err
+		})
+		if err != nil {
+			err = apiError(err)
+			fmt.Printf("Failed to update deployment %s: %v\n", d.Name, err)
+			results.record(d.Namespace, d.Name, outcomeFailed, err.Error())
+			return fmt.Errorf("deployment %s: %w", d.Name, err)
+		}
+		*d = *updated
+
+		reason := "RolloutResumed"
+		if program.Pause {
+			reason = "RolloutPaused"
+		}
+		recordObjectEvent(ctx, eventCreator(clientset), corev1.ObjectReference{
+			APIVersion:      "apps/v1",
+			Kind:            "Deployment",
+			Name:            d.Name,
+			Namespace:       d.Namespace,
+			UID:             d.UID,
+			ResourceVersion: d.ResourceVersion,
+		}, reason, "rollout "+action)
+
+		results.record(d.Namespace, d.Name, outcomeUpdated, action)
+		leftPaused[i] = program.Pause
+		return nil
+	})
+
+	for _, d := range deployments {
+		if !results.has(d.Namespace, d.Name) {
+			results.record(d.Namespace, d.Name, outcomeSkipped, "not started")
+		}
+	}
+
+	results.print()
+
+	var paused []string
+	for i, d := range deployments {
+		if leftPaused[i] {
+			paused = append(paused, d.Namespace+"/"+d.Name)
+		}
+	}
+	if len(paused) > 0 {
+		log.Warn().Strs("deployments", paused).Int("count", len(paused)).Msg("Rollouts left paused, resume them with --resume")
+	}
+
+	return errors.Join(errs...)
+}
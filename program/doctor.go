@@ -0,0 +1,162 @@
+package program
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Doctor checks that the cluster can be reached and that this tool has the permissions it needs
+type Doctor struct{}
+
+type check struct {
+	Name   string
+	Passed bool
+	Detail string
+}
+
+func (program *Doctor) Run(options *Options) error {
+	initColors(options)
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	checks := program.checks(ctx, options)
+
+	t := newTable()
+	t.AppendHeader(table.Row{"CHECK", "RESULT", "DETAIL"})
+
+	failed := 0
+	for _, c := range checks {
+		result := text.FgGreen.Sprint("pass")
+		if !c.Passed {
+			result = text.FgRed.Sprint("FAIL")
+			failed++
+		}
+		t.AppendRow(table.Row{c.Name, result, c.Detail})
+	}
+	t.Render()
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
+
+// checks runs each check in turn, stopping when a failure means later checks cannot run
+func (program *Doctor) checks(ctx context.Context, options *Options) []check {
+	var checks []check
+
+	raw, err := options.clientConfig().RawConfig()
+	if err != nil {
+		return append(checks, check{"kubeconfig", false, err.Error()})
+	}
+
+	contextName := raw.CurrentContext
+	if options.Context != "" {
+		contextName = options.Context
+	}
+
+	config, err := options.RestConfig()
+	if err != nil {
+		return append(checks, check{"kubeconfig", false, err.Error()})
+	}
+	checks = append(checks, check{"kubeconfig", true, fmt.Sprintf("context %q, server %s", contextName, config.Host)})
+
+	namespace, err := options.ResolveNamespace()
+	if err != nil {
+		checks = append(checks, check{"namespace", false, err.Error()})
+		namespace = metav1.NamespaceDefault
+	} else {
+		checks = append(checks, check{"namespace", true, namespace})
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return append(checks, check{"client", false, err.Error()})
+	}
+
+	version, err := clientset.Discovery().ServerVersion()
+	if err != nil {
+		return append(checks, check{"reachability", false, err.Error()})
+	}
+	checks = append(checks, check{"reachability", true, "Kubernetes " + version.GitVersion})
+
+	groups, err := clientset.Discovery().ServerGroups()
+	if err != nil {
+		return append(checks, check{"API discovery", false, err.Error()})
+	}
+
+	versions := map[string]bool{}
+	for _, group := range groups.Groups {
+		for _, v := range group.Versions {
+			versions[v.GroupVersion] = true
+		}
+	}
+
+	checks = append(checks,
+		check{"autoscaling/v1", versions["autoscaling/v1"], availability(versions["autoscaling/v1"])},
+		check{"autoscaling/v2", versions["autoscaling/v2"], availability(versions["autoscaling/v2"])},
+	)
+
+	if versions["metrics.k8s.io/v1beta1"] {
+		err := clientset.Discovery().RESTClient().Get().AbsPath("/apis/metrics.k8s.io/v1beta1").Do(ctx).Error()
+		if err != nil {
+			checks = append(checks, check{"metrics-server", false, "registered but not responding: " + err.Error()})
+		} else {
+			checks = append(checks, check{"metrics-server", true, "metrics.k8s.io/v1beta1 available"})
+		}
+	} else {
+		checks = append(checks, check{"metrics-server", false, "metrics.k8s.io is not registered, CPU utilization will be unknown"})
+	}
+
+	for _, verb := range []string{"list", "get", "patch", "update"} {
+		checks = append(checks, accessCheck(ctx, clientset, namespace, verb, "autoscaling", "horizontalpodautoscalers"))
+	}
+	checks = append(checks, accessCheck(ctx, clientset, namespace, "create", "", "events"))
+
+	return checks
+}
+
+func availability(available bool) string {
+	if available {
+		return "available"
+	}
+	return "not served by this cluster"
+}
+
+// accessCheck asks the API server whether the current user may perform the verb on the resource
+func accessCheck(ctx context.Context, clientset *kubernetes.Clientset, namespace, verb, group, resource string) check {
+	name := fmt.Sprintf("%s %s", verb, resource)
+
+	review := &authorizationv1.SelfSubjectAccessReview{
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      verb,
+				Group:     group,
+				Resource:  resource,
+			},
+		},
+	}
+
+	result, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return check{name, false, err.Error()}
+	}
+
+	if !result.Status.Allowed {
+		detail := "denied in namespace " + namespace
+		if result.Status.Reason != "" {
+			detail += ": " + result.Status.Reason
+		}
+		return check{name, false, detail}
+	}
+
+	return check{name, true, "allowed in namespace " + namespace}
+}
@@ -0,0 +1,76 @@
+package program
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Exit codes returned by the program so automation can distinguish outcomes
+const (
+	ExitSuccess        = 0
+	ExitPartialFailure = 1
+	ExitUsage          = 2
+	ExitConnection     = 3
+)
+
+// ExitError is an error which carries the process exit code it should produce
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// ExitCode returns the process exit code appropriate for the error
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitSuccess
+	}
+
+	var exitError *ExitError
+	if errors.As(err, &exitError) {
+		return exitError.Code
+	}
+
+	return ExitPartialFailure
+}
+
+// usageError reports a problem with the way the program was invoked
+func usageError(format string, args ...any) error {
+	return &ExitError{Code: ExitUsage, Err: fmt.Errorf(format, args...)}
+}
+
+// connectionError reports a problem reaching or authenticating to the cluster
+func connectionError(err error, format string, args ...any) error {
+	return &ExitError{Code: ExitConnection, Err: fmt.Errorf("%s: %w", fmt.Sprintf(format, args...), err)}
+}
+
+// apiError classifies an error returned by the API server, marking connection and authentication failures so they
+// produce the connection exit code
+func apiError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var netError net.Error
+
+	switch {
+	case apierrors.IsUnauthorized(err):
+		return connectionError(err, "not authenticated to the cluster, check your credentials")
+	case apierrors.IsForbidden(err):
+		return connectionError(err, "permission denied")
+	case errors.As(err, &netError):
+		return connectionError(err, "unable to reach the cluster")
+	default:
+		return err
+	}
+}
@@ -0,0 +1,158 @@
+package program
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func testEventNotification() *notification {
+	maximum := int32(20)
+	return &notification{
+		Kind:     notificationEvent,
+		Command:  "hpa",
+		Cluster:  "prod",
+		Title:    "k8sutils changed replicas 2/10 -> 2/20",
+		Severity: severityInfo,
+		Time:     time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC),
+		Event: &busEvent{
+			Type:      busModified,
+			Namespace: "shop",
+			HPA:       "web",
+			From:      &busState{MinReplicas: 2, MaxReplicas: 10},
+			To:        &busState{MinReplicas: 2, MaxReplicas: maximum},
+			Ticket:    "OPS-42",
+		},
+	}
+}
+
+func TestEventsOnlyGoToTheBuses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("%s was sent an event", r.URL.Path)
+	}))
+	defer server.Close()
+
+	for _, destination := range []notifier{
+		&slackNotifier{url: server.URL + "/slack"},
+		&teamsNotifier{url: server.URL + "/teams"},
+		&pagerDutyNotifier{url: server.URL + "/pagerduty", routingKey: "key"},
+		&webhookNotifier{url: server.URL + "/webhook"},
+	} {
+		assert.NoError(t, destination.notify(context.Background(), testEventNotification()), destination.name())
+	}
+
+	assert.Nil(t, busMessage(&notification{Kind: notificationChange, Title: "1 updated, 0 failed, 0 skipped"}), "buses ignore other notifications")
+}
+
+func TestKafkaNotifier(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(1, "autoscaling.events"))
+	require.NoError(t, err)
+	defer cluster.Close()
+
+	buses, err := (&EventBus{PublishKafka: cluster.ListenAddrs(), PublishSubject: "autoscaling.events"}).newBusNotifiers()
+	require.NoError(t, err)
+	require.Len(t, buses, 1)
+	require.NoError(t, buses[0].notify(context.Background(), testEventNotification()))
+
+	consumer, err := kgo.NewClient(kgo.SeedBrokers(cluster.ListenAddrs()...), kgo.ConsumeTopics("autoscaling.events"))
+	require.NoError(t, err)
+	defer consumer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	fetches := consumer.PollFetches(ctx)
+	require.NoError(t, fetches.Err())
+	records := fetches.Records()
+	require.Len(t, records, 1)
+
+	assert.Equal(t, "shop/web", string(records[0].Key))
+	var event busEvent
+	require.NoError(t, json.Unmarshal(records[0].Value, &event))
+	assert.Equal(t, busModified, event.Type)
+	assert.Equal(t, "prod", event.Cluster)
+	assert.Equal(t, "hpa", event.Command)
+	assert.Equal(t, "k8sutils changed replicas 2/10 -> 2/20", event.Message)
+	assert.Equal(t, int32(20), event.To.MaxReplicas)
+}
+
+// fakeNats accepts NATS client connections, answering PINGs and sending each message published on the channel
+func fakeNats(t *testing.T) (string, <-chan [2]string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	published := make(chan [2]string, 10)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				fmt.Fprintf(conn, "INFO {\"server_id\":\"test\",\"version\":\"2.10.0\",\"proto\":1,\"max_payload\":1048576}\r\n")
+
+				reader := bufio.NewReader(conn)
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					fields := strings.Fields(line)
+					switch {
+					case len(fields) == 0:
+					case fields[0] == "PING":
+						fmt.Fprint(conn, "PONG\r\n")
+					case fields[0] == "PUB" && len(fields) == 3:
+						size, _ := strconv.Atoi(fields[2])
+						payload := make([]byte, size+2)
+						if _, err := io.ReadFull(reader, payload); err != nil {
+							return
+						}
+						published <- [2]string{fields[1], string(payload[:size])}
+					}
+				}
+			}()
+		}
+	}()
+
+	return "nats://" + listener.Addr().String(), published
+}
+
+func TestNatsNotifier(t *testing.T) {
+	url, published := fakeNats(t)
+
+	buses, err := (&EventBus{PublishNats: url, PublishSubject: "k8sutils.hpa"}).newBusNotifiers()
+	require.NoError(t, err)
+	require.Len(t, buses, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, buses[0].notify(ctx, testEventNotification()))
+
+	select {
+	case message := <-published:
+		assert.Equal(t, "k8sutils.hpa.modified", message[0], "the subject ends with the type of event")
+		var event busEvent
+		require.NoError(t, json.Unmarshal([]byte(message[1]), &event))
+		assert.Equal(t, "shop", event.Namespace)
+		assert.Equal(t, "OPS-42", event.Ticket)
+	case <-ctx.Done():
+		t.Fatal("nothing was published")
+	}
+}
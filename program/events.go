@@ -0,0 +1,67 @@
+package program
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// AnnotationTicket records the change ticket of the last modification made by this tool
+	AnnotationTicket = "k8sutils.io/ticket"
+	// AnnotationChange records a human readable description of the last modification made by this tool
+	AnnotationChange = "k8sutils.io/change"
+
+	eventSource = "k8sutils"
+)
+
+// recordEvent emits a Kubernetes Event against the HPA so the change shows up in `kubectl describe`.  Failure to
+// record the event is logged but does not fail the modification.
+func recordEvent(ctx context.Context, client HPAClient, hpa *v1.HorizontalPodAutoscaler, reason, message string) {
+	recordObjectEvent(ctx, client.CreateEvent, corev1.ObjectReference{
+		APIVersion:      "autoscaling/v1",
+		Kind:            "HorizontalPodAutoscaler",
+		Name:            hpa.Name,
+		Namespace:       hpa.Namespace,
+		UID:             hpa.UID,
+		ResourceVersion: hpa.ResourceVersion,
+	}, reason, message)
+}
+
+// recordObjectEvent emits a Kubernetes Event against any object using the given create function.  Failure to record
+// the event is logged but otherwise ignored.
+func recordObjectEvent(ctx context.Context, create func(context.Context, *corev1.Event) error, object corev1.ObjectReference, reason, message string) {
+	now := metav1.NewTime(time.Now())
+
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: object.Name + ".",
+			Namespace:    object.Namespace,
+		},
+		InvolvedObject: object,
+		Reason:         reason,
+		Message:        message,
+		Type:           corev1.EventTypeNormal,
+		Source:         corev1.EventSource{Component: eventSource},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+
+	if err := create(ctx, event); err != nil {
+		log.Warn().Err(err).Str("kind", object.Kind).Str("name", object.Name).Msg("Failed to record event")
+	}
+}
+
+// eventCreator returns a function which creates Events with the given clientset, for use with recordObjectEvent
+func eventCreator(clientset kubernetes.Interface) func(context.Context, *corev1.Event) error {
+	return func(ctx context.Context, event *corev1.Event) error {
+		_, err := clientset.CoreV1().Events(event.Namespace).Create(ctx, event, metav1.CreateOptions{FieldManager: FieldManager})
+		return err
+	}
+}
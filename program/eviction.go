@@ -0,0 +1,199 @@
+package program
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// evictionRetryInterval is how often to retry an eviction refused by a PodDisruptionBudget
+const evictionRetryInterval = 5 * time.Second
+
+// evictPod evicts the pod through the eviction API, so PodDisruptionBudgets are respected, and waits for it to be
+// deleted.  An eviction the API refuses because of a PDB is retried until timeout, as the budget frees up when
+// replacement pods become ready.
+func evictPod(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod, timeout time.Duration) error {
+	eviction := &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{Name: pod.Name, Namespace: pod.Namespace},
+	}
+
+	blocked := false
+
+	err := wait.PollUntilContextTimeout(ctx, evictionRetryInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		err := clientset.PolicyV1().Evictions(pod.Namespace).Evict(ctx, eviction)
+		switch {
+		case err == nil, apierrors.IsNotFound(err):
+			return true, nil
+		case apierrors.IsTooManyRequests(err):
+			if !blocked {
+				log.Info().Str("namespace", pod.Namespace).Str("pod", pod.Name).Msg("Eviction blocked by a disruption budget, retrying")
+				blocked = true
+			}
+			return false, nil
+		case isTransient(err):
+			return false, nil
+		default:
+			return false, apiError(err)
+		}
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("not evicted after %s, a disruption budget is still blocking it", timeout)
+	}
+	if err != nil {
+		return err
+	}
+
+	return waitForPodDeletion(ctx, clientset, pod, timeout)
+}
+
+// waitForPodDeletion waits until the pod is gone.  A pod with the same name but a different UID is a replacement, as
+// StatefulSets create, so the original is gone.
+func waitForPodDeletion(ctx context.Context, clientset kubernetes.Interface, pod *corev1.Pod, timeout time.Duration) error {
+	err := wait.PollUntilContextTimeout(ctx, rolloutPollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		current, err := clientset.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			return true, nil
+		case err != nil:
+			if isTransient(err) {
+				return false, nil
+			}
+			return false, apiError(err)
+		default:
+			return current.UID != pod.UID, nil
+		}
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("evicted but not deleted after %s", timeout)
+	}
+	return err
+}
+
+// Evict evicts the selected pods through the eviction API, so PodDisruptionBudgets are respected.  It is meant for
+// rebalancing, such as moving pods off hot nodes after an HPA maximum increase, so --stagger is the rate limit.
+type Evict struct {
+	Node            []string      `help:"Only evict pods running on these nodes"`
+	Limit           int           `help:"Evict at most this many pods (default all)"`
+	EvictionTimeout time.Duration `default:"5m" help:"Maximum time to wait for each pod to be evicted"`
+
+	Selector `embed:""`
+	Bulk     `embed:""`
+}
+
+func (program *Evict) Run(options *Options) error {
+
+	initColors(options)
+
+	if !program.selected() {
+		return usageError("select pods by name, with --labels or with --all")
+	}
+
+	if program.Limit < 0 {
+		return usageError("--limit must not be negative")
+	}
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	all, err := fetch(ctx, &program.Selector, "pod",
+		func(ctx context.Context, namespace, name string) (*corev1.Pod, error) {
+			return clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		},
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]corev1.Pod, string, error) {
+			list, err := clientset.CoreV1().Pods(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+	if err != nil {
+		return err
+	}
+
+	pods := program.evictable(all)
+	if len(pods) == 0 {
+		log.Info().Msg("No pods to evict")
+		return nil
+	}
+
+	return options.runAsLeader(ctx, clientset, func(ctx context.Context) error {
+		results := newSummary()
+		defer results.print()
+
+		errs := program.Bulk.run(ctx, len(pods), options.DryRun, false, func(i int) error {
+			pod := &pods[i]
+
+			log.Info().Str("namespace", pod.Namespace).Str("pod", pod.Name).Str("node", pod.Spec.NodeName).Msg("Evicting")
+
+			if options.DryRun {
+				results.record(pod.Namespace, pod.Name, outcomeUpdated, "dry run: evict")
+				return nil
+			}
+
+			if err := evictPod(ctx, clientset, pod, program.EvictionTimeout); err != nil {
+				fmt.Printf("Failed to evict pod %s: %v\n", pod.Name, err)
+				results.record(pod.Namespace, pod.Name, outcomeFailed, err.Error())
+				return fmt.Errorf("pod %s: %w", pod.Name, err)
+			}
+
+			results.record(pod.Namespace, pod.Name, outcomeUpdated, "evicted from "+pod.Spec.NodeName)
+			return nil
+		})
+
+		for _, pod := range pods {
+			if !results.has(pod.Namespace, pod.Name) {
+				results.record(pod.Namespace, pod.Name, outcomeSkipped, "not started")
+			}
+		}
+
+		return errors.Join(errs...)
+	})
+}
+
+// evictable returns the pods worth evicting, up to the limit.  Evicting a pod which is not running on a node, a
+// mirror pod or a DaemonSet pod cannot move it anywhere, so those are skipped.
+func (program *Evict) evictable(pods []corev1.Pod) []corev1.Pod {
+	nodes := map[string]bool{}
+	for _, node := range program.Node {
+		nodes[node] = true
+	}
+
+	var result []corev1.Pod
+	for _, pod := range pods {
+		owner := metav1.GetControllerOf(&pod)
+
+		switch {
+		case pod.Spec.NodeName == "" || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed:
+			continue
+		case len(nodes) > 0 && !nodes[pod.Spec.NodeName]:
+			continue
+		case pod.Annotations[mirrorPodAnnotation] != "":
+			log.Debug().Str("namespace", pod.Namespace).Str("pod", pod.Name).Msg("Skipping mirror pod")
+			continue
+		case owner != nil && owner.Kind == "DaemonSet":
+			log.Debug().Str("namespace", pod.Namespace).Str("pod", pod.Name).Msg("Skipping DaemonSet pod")
+			continue
+		}
+
+		result = append(result, pod)
+		if program.Limit > 0 && len(result) == program.Limit {
+			break
+		}
+	}
+
+	return result
+}
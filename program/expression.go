@@ -0,0 +1,148 @@
+package program
+
+import (
+	"math"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// expression changes a replica count.  It is written like the HPA limits: a number (5), a percentage of the current
+// value (50%) or a multiplier (2x).
+type expression func(current int32) int32
+
+// parseExpression parses a replica count expression
+func parseExpression(value string) (expression, error) {
+	switch {
+	case Number.MatchString(value):
+		num, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, err
+		}
+		return func(int32) int32 {
+			return int32(num)
+		}, nil
+
+	case Percentage.MatchString(value):
+		percent, err := strconv.ParseFloat(value[:len(value)-1], 32)
+		if err != nil {
+			return nil, usageError("invalid percentage %q", value)
+		}
+		return func(current int32) int32 {
+			return int32(math.Ceil(percent / 100 * float64(current)))
+		}, nil
+
+	case Multiply.MatchString(value):
+		multiplier, err := strconv.ParseFloat(value[:len(value)-1], 32)
+		if err != nil {
+			return nil, usageError("invalid multiplier %q", value)
+		}
+		return func(current int32) int32 {
+			return int32(float64(current) * multiplier)
+		}, nil
+
+	default:
+		return nil, usageError("invalid replicas %q, use a number, percentage (50%%) or multiplier (2x)", value)
+	}
+}
+
+// limits changes a minimum and maximum replica count
+type limits func(minimum, maximum int32) (int32, int32)
+
+// parseLimits parses the --min and --max expressions of the commands which manage replica ranges.  Either expression
+// may be empty to leave that limit alone.  The maximum is changed first, so as with HPAs a minimum percentage is
+// relative to the maximum the change leaves.  A limit given alone moves the other if needed to keep the minimum no
+// greater than the maximum, and when both are given the maximum is kept, unless both are numbers, when a minimum
+// greater than the maximum is an error.
+func parseLimits(minimum, maximum string) (limits, error) {
+	if minimum == "" && maximum == "" {
+		return nil, usageError("nothing to change, use --min or --max with a number, percentage (50%%) or multiplier (2x)")
+	}
+
+	var minChange, maxChange expression
+	var err error
+
+	if minimum != "" {
+		if minChange, err = parseExpression(minimum); err != nil {
+			return nil, err
+		}
+	}
+	if maximum != "" {
+		if maxChange, err = parseExpression(maximum); err != nil {
+			return nil, err
+		}
+	}
+
+	if minChange != nil && maxChange != nil && Number.MatchString(minimum) && Number.MatchString(maximum) && minChange(0) > maxChange(0) {
+		return nil, usageError("minimum %s is greater than maximum %s", minimum, maximum)
+	}
+
+	minRelativeToMax := Percentage.MatchString(minimum)
+
+	return func(min, max int32) (int32, int32) {
+		if maxChange != nil {
+			max = maxChange(max)
+		}
+
+		if minChange != nil {
+			if minRelativeToMax {
+				min = minChange(max)
+			} else {
+				min = minChange(min)
+			}
+		}
+
+		if min > max {
+			if maxChange != nil {
+				min = max
+			} else {
+				max = min
+			}
+		}
+
+		return min, max
+	}, nil
+}
+
+// quantityExpression changes a resource quantity such as a quota limit.  It is written as an absolute quantity (20 or
+// 64Gi), a percentage of the current value (150%) or a multiplier (2x).
+type quantityExpression func(current resource.Quantity) resource.Quantity
+
+// parseQuantityExpression parses a resource quantity expression
+func parseQuantityExpression(value string) (quantityExpression, error) {
+	var factor float64
+
+	switch {
+	case Percentage.MatchString(value):
+		percent, err := strconv.ParseFloat(value[:len(value)-1], 64)
+		if err != nil {
+			return nil, usageError("invalid percentage %q", value)
+		}
+		factor = percent / 100
+
+	case Multiply.MatchString(value):
+		multiplier, err := strconv.ParseFloat(value[:len(value)-1], 64)
+		if err != nil {
+			return nil, usageError("invalid multiplier %q", value)
+		}
+		factor = multiplier
+
+	default:
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return nil, usageError("invalid quantity %q, use a quantity (64Gi), percentage (50%%) or multiplier (2x)", value)
+		}
+		return func(resource.Quantity) resource.Quantity {
+			return quantity
+		}, nil
+	}
+
+	return func(current resource.Quantity) resource.Quantity {
+		scaled := resource.NewMilliQuantity(int64(math.Ceil(float64(current.MilliValue())*factor)), current.Format)
+		// Round up to whole units where the current value is whole, so pods and counts stay integers
+		if current.MilliValue()%1000 == 0 {
+			scaled.RoundUp(0)
+		}
+		return *scaled
+	}, nil
+}
@@ -0,0 +1,174 @@
+package program
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	v1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+// FakeHPAClient is an in-memory HPAClient for tests and for running the HPA logic without a cluster.  It enforces
+// resource versions the way the API server does, so conflict handling can be exercised.
+type FakeHPAClient struct {
+	lock    sync.Mutex
+	hpas    map[string]*v1.HorizontalPodAutoscaler
+	version int
+
+	// Events holds every event recorded through the client
+	Events []corev1.Event
+}
+
+var autoscalersResource = v1.Resource("horizontalpodautoscalers")
+
+// NewFakeHPAClient returns a FakeHPAClient holding copies of the given HPAs
+func NewFakeHPAClient(hpas ...v1.HorizontalPodAutoscaler) *FakeHPAClient {
+	fake := &FakeHPAClient{hpas: map[string]*v1.HorizontalPodAutoscaler{}}
+	for _, hpa := range hpas {
+		fake.store(hpa.DeepCopy())
+	}
+	return fake
+}
+
+func fakeKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// store saves the HPA with a new resource version.  The lock must be held.
+func (f *FakeHPAClient) store(hpa *v1.HorizontalPodAutoscaler) *v1.HorizontalPodAutoscaler {
+	f.version++
+	hpa.ResourceVersion = strconv.Itoa(f.version)
+	f.hpas[fakeKey(hpa.Namespace, hpa.Name)] = hpa
+	return hpa.DeepCopy()
+}
+
+func (f *FakeHPAClient) List(_ context.Context, namespace string, opts metav1.ListOptions) (*v1.HorizontalPodAutoscalerList, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	selector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+
+	list := &v1.HorizontalPodAutoscalerList{}
+	for _, hpa := range f.hpas {
+		if namespace != metav1.NamespaceAll && hpa.Namespace != namespace {
+			continue
+		}
+		if !selector.Matches(labels.Set(hpa.Labels)) {
+			continue
+		}
+		list.Items = append(list.Items, *hpa.DeepCopy())
+	}
+
+	sort.Slice(list.Items, func(i, j int) bool {
+		return fakeKey(list.Items[i].Namespace, list.Items[i].Name) < fakeKey(list.Items[j].Namespace, list.Items[j].Name)
+	})
+
+	// Pages continue after the key of the last item returned, as the API server's do
+	if opts.Continue != "" {
+		next := sort.Search(len(list.Items), func(i int) bool {
+			return fakeKey(list.Items[i].Namespace, list.Items[i].Name) > opts.Continue
+		})
+		list.Items = list.Items[next:]
+	}
+	if opts.Limit > 0 && int64(len(list.Items)) > opts.Limit {
+		list.Items = list.Items[:opts.Limit]
+		last := list.Items[len(list.Items)-1]
+		list.Continue = fakeKey(last.Namespace, last.Name)
+	}
+
+	list.ResourceVersion = strconv.Itoa(f.version)
+
+	return list, nil
+}
+
+func (f *FakeHPAClient) Get(_ context.Context, namespace, name string) (*v1.HorizontalPodAutoscaler, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	hpa, ok := f.hpas[fakeKey(namespace, name)]
+	if !ok {
+		return nil, apierrors.NewNotFound(autoscalersResource, name)
+	}
+
+	return hpa.DeepCopy(), nil
+}
+
+func (f *FakeHPAClient) Update(_ context.Context, hpa *v1.HorizontalPodAutoscaler) (*v1.HorizontalPodAutoscaler, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	current, ok := f.hpas[fakeKey(hpa.Namespace, hpa.Name)]
+	if !ok {
+		return nil, apierrors.NewNotFound(autoscalersResource, hpa.Name)
+	}
+
+	if hpa.ResourceVersion != "" && hpa.ResourceVersion != current.ResourceVersion {
+		return nil, apierrors.NewConflict(autoscalersResource, hpa.Name, fmt.Errorf("resource version %s is stale", hpa.ResourceVersion))
+	}
+
+	return f.store(hpa.DeepCopy()), nil
+}
+
+func (f *FakeHPAClient) Patch(_ context.Context, namespace, name string, patchType types.PatchType, data []byte) (*v1.HorizontalPodAutoscaler, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	current, ok := f.hpas[fakeKey(namespace, name)]
+	if !ok {
+		return nil, apierrors.NewNotFound(autoscalersResource, name)
+	}
+
+	if patchType != types.StrategicMergePatchType {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("patch type %s is not supported", patchType))
+	}
+
+	var precondition struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(data, &precondition); err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+
+	if rv := precondition.Metadata.ResourceVersion; rv != "" && rv != current.ResourceVersion {
+		return nil, apierrors.NewConflict(autoscalersResource, name, fmt.Errorf("resource version %s is stale", rv))
+	}
+
+	currentJSON, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+
+	patchedJSON, err := strategicpatch.StrategicMergePatch(currentJSON, data, v1.HorizontalPodAutoscaler{})
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+
+	patched := &v1.HorizontalPodAutoscaler{}
+	if err := json.Unmarshal(patchedJSON, patched); err != nil {
+		return nil, err
+	}
+
+	return f.store(patched), nil
+}
+
+func (f *FakeHPAClient) CreateEvent(_ context.Context, event *corev1.Event) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.Events = append(f.Events, *event.DeepCopy())
+	return nil
+}
@@ -0,0 +1,333 @@
+package program
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// gitHost is a Git hosting service holding manifests, on which changes are proposed as pull or merge requests
+type gitHost interface {
+	defaultBranch(ctx context.Context) (string, error)
+	// files lists the paths of the files under dir on the branch
+	files(ctx context.Context, branch, dir string) ([]string, error)
+	read(ctx context.Context, branch, file string) ([]byte, error)
+	// propose commits the files to a new branch and opens a pull request from it, returning the request's URL
+	propose(ctx context.Context, p *proposal) (string, error)
+}
+
+// proposal is a change to files in a repository, to be reviewed and merged
+type proposal struct {
+	base, branch string
+	title, body  string
+	files        []proposedFile
+}
+
+// proposedFile is the new content of a file
+type proposedFile struct {
+	path    string
+	content []byte
+}
+
+// Default API endpoints of the hosting services
+const (
+	githubAPI = "https://api.github.com"
+	gitlabAPI = "https://gitlab.com/api/v4"
+)
+
+// restClient calls a JSON API
+type restClient struct {
+	base    string
+	headers map[string]string
+	service string
+}
+
+// call sends the body as JSON and decodes the response into result, or stores it in result if it is a *[]byte
+func (c *restClient) call(ctx context.Context, method, endpoint string, body, result any) (http.Header, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.base, "/")+endpoint, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range c.headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, connectionError(err, "unable to reach %s", c.service)
+	}
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, connectionError(err, "reading %s response", c.service)
+	}
+
+	if response.StatusCode >= 300 {
+		err := fmt.Errorf("%s %s: %s: %s", method, endpoint, response.Status, strings.TrimSpace(string(data)))
+		if response.StatusCode == http.StatusUnauthorized {
+			return nil, connectionError(err, "not authenticated to %s, check the token", c.service)
+		}
+		return nil, err
+	}
+
+	switch result := result.(type) {
+	case nil:
+	case *[]byte:
+		*result = data
+	default:
+		if err := json.Unmarshal(data, result); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", method, endpoint, err)
+		}
+	}
+
+	return response.Header, nil
+}
+
+// escapePath escapes each element of a path in a repository for use in a URL
+func escapePath(file string) string {
+	parts := strings.Split(file, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// underDir returns true if the file is in dir or a directory below it; an empty dir is the whole repository
+func underDir(file, dir string) bool {
+	dir = strings.Trim(path.Clean("/"+dir), "/")
+	return dir == "" || strings.HasPrefix(file, dir+"/")
+}
+
+// githubHost proposes changes as GitHub pull requests
+type githubHost struct {
+	client *restClient
+	repo   string
+}
+
+func newGithubHost(api, repo, token string) *githubHost {
+	return &githubHost{
+		repo: repo,
+		client: &restClient{base: api, service: "GitHub", headers: map[string]string{
+			"Authorization":        "Bearer " + token,
+			"Accept":               "application/vnd.github+json",
+			"X-GitHub-Api-Version": "2022-11-28",
+		}},
+	}
+}
+
+func (g *githubHost) defaultBranch(ctx context.Context) (string, error) {
+	var repository struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	_, err := g.client.call(ctx, http.MethodGet, "/repos/"+g.repo, nil, &repository)
+	return repository.DefaultBranch, err
+}
+
+func (g *githubHost) files(ctx context.Context, branch, dir string) ([]string, error) {
+	var tree struct {
+		Tree []struct {
+			Path string `json:"path"`
+			Type string `json:"type"`
+		} `json:"tree"`
+		Truncated bool `json:"truncated"`
+	}
+	if _, err := g.client.call(ctx, http.MethodGet, "/repos/"+g.repo+"/git/trees/"+url.PathEscape(branch)+"?recursive=1", nil, &tree); err != nil {
+		return nil, err
+	}
+	if tree.Truncated {
+		return nil, errors.New("the repository is too large for GitHub to list, use a smaller --path")
+	}
+
+	var result []string
+	for _, entry := range tree.Tree {
+		if entry.Type == "blob" && underDir(entry.Path, dir) {
+			result = append(result, entry.Path)
+		}
+	}
+	return result, nil
+}
+
+func (g *githubHost) read(ctx context.Context, branch, file string) ([]byte, error) {
+	var content struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	if _, err := g.client.call(ctx, http.MethodGet, "/repos/"+g.repo+"/contents/"+escapePath(file)+"?ref="+url.QueryEscape(branch), nil, &content); err != nil {
+		return nil, err
+	}
+	if content.Encoding != "base64" {
+		return nil, fmt.Errorf("%s: unexpected encoding %q", file, content.Encoding)
+	}
+	return base64.StdEncoding.DecodeString(strings.ReplaceAll(content.Content, "\n", ""))
+}
+
+// propose makes a single commit of every file with the Git data API, so the pull request has one commit however many
+// files change
+func (g *githubHost) propose(ctx context.Context, p *proposal) (string, error) {
+	repo := "/repos/" + g.repo
+
+	var ref struct {
+		Object struct {
+			SHA string `json:"sha"`
+		} `json:"object"`
+	}
+	if _, err := g.client.call(ctx, http.MethodGet, repo+"/git/ref/heads/"+escapePath(p.base), nil, &ref); err != nil {
+		return "", err
+	}
+
+	var parent struct {
+		Tree struct {
+			SHA string `json:"sha"`
+		} `json:"tree"`
+	}
+	if _, err := g.client.call(ctx, http.MethodGet, repo+"/git/commits/"+ref.Object.SHA, nil, &parent); err != nil {
+		return "", err
+	}
+
+	type entry struct {
+		Path    string `json:"path"`
+		Mode    string `json:"mode"`
+		Type    string `json:"type"`
+		Content string `json:"content"`
+	}
+	var entries []entry
+	for _, file := range p.files {
+		entries = append(entries, entry{Path: file.path, Mode: "100644", Type: "blob", Content: string(file.content)})
+	}
+
+	var tree, commit struct {
+		SHA string `json:"sha"`
+	}
+	if _, err := g.client.call(ctx, http.MethodPost, repo+"/git/trees", map[string]any{"base_tree": parent.Tree.SHA, "tree": entries}, &tree); err != nil {
+		return "", err
+	}
+	if _, err := g.client.call(ctx, http.MethodPost, repo+"/git/commits", map[string]any{
+		"message": p.title,
+		"tree":    tree.SHA,
+		"parents": []string{ref.Object.SHA},
+	}, &commit); err != nil {
+		return "", err
+	}
+	if _, err := g.client.call(ctx, http.MethodPost, repo+"/git/refs", map[string]string{"ref": "refs/heads/" + p.branch, "sha": commit.SHA}, nil); err != nil {
+		return "", err
+	}
+
+	var pull struct {
+		URL string `json:"html_url"`
+	}
+	_, err := g.client.call(ctx, http.MethodPost, repo+"/pulls", map[string]string{
+		"title": p.title,
+		"body":  p.body,
+		"head":  p.branch,
+		"base":  p.base,
+	}, &pull)
+	return pull.URL, err
+}
+
+// gitlabHost proposes changes as GitLab merge requests
+type gitlabHost struct {
+	client  *restClient
+	project string
+}
+
+func newGitlabHost(api, project, token string) *gitlabHost {
+	return &gitlabHost{
+		project: "/projects/" + url.PathEscape(project),
+		client:  &restClient{base: api, service: "GitLab", headers: map[string]string{"PRIVATE-TOKEN": token}},
+	}
+}
+
+func (g *gitlabHost) defaultBranch(ctx context.Context) (string, error) {
+	var project struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	_, err := g.client.call(ctx, http.MethodGet, g.project, nil, &project)
+	return project.DefaultBranch, err
+}
+
+func (g *gitlabHost) files(ctx context.Context, branch, dir string) ([]string, error) {
+	query := url.Values{"ref": {branch}, "recursive": {"true"}, "per_page": {"100"}}
+	if dir = strings.Trim(path.Clean("/"+dir), "/"); dir != "" {
+		query.Set("path", dir)
+	}
+
+	var result []string
+	for page := 1; page > 0; {
+		query.Set("page", strconv.Itoa(page))
+
+		var entries []struct {
+			Path string `json:"path"`
+			Type string `json:"type"`
+		}
+		header, err := g.client.call(ctx, http.MethodGet, g.project+"/repository/tree?"+query.Encode(), nil, &entries)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.Type == "blob" {
+				result = append(result, entry.Path)
+			}
+		}
+
+		// The last page has no next page
+		page, _ = strconv.Atoi(header.Get("X-Next-Page"))
+	}
+	return result, nil
+}
+
+func (g *gitlabHost) read(ctx context.Context, branch, file string) ([]byte, error) {
+	var data []byte
+	_, err := g.client.call(ctx, http.MethodGet, g.project+"/repository/files/"+url.PathEscape(file)+"/raw?ref="+url.QueryEscape(branch), nil, &data)
+	return data, err
+}
+
+// propose makes a single commit of every file, creating the branch from the base as it does so
+func (g *gitlabHost) propose(ctx context.Context, p *proposal) (string, error) {
+	var actions []map[string]string
+	for _, file := range p.files {
+		actions = append(actions, map[string]string{"action": "update", "file_path": file.path, "content": string(file.content)})
+	}
+
+	if _, err := g.client.call(ctx, http.MethodPost, g.project+"/repository/commits", map[string]any{
+		"branch":         p.branch,
+		"start_branch":   p.base,
+		"commit_message": p.title,
+		"actions":        actions,
+	}, nil); err != nil {
+		return "", err
+	}
+
+	var request struct {
+		URL string `json:"web_url"`
+	}
+	_, err := g.client.call(ctx, http.MethodPost, g.project+"/merge_requests", map[string]any{
+		"source_branch":        p.branch,
+		"target_branch":        p.base,
+		"title":                p.title,
+		"description":          p.body,
+		"remove_source_branch": true,
+	}, &request)
+	return request.URL, err
+}
@@ -0,0 +1,248 @@
+package program
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/autoscaling/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// kustomizationFile is the file in which kustomize looks for its configuration
+const kustomizationFile = "kustomization.yaml"
+
+// writeKustomizePatches writes a strategic merge patch of each HPA's new replica range, and CPU target if cpu is set, to
+// dir/namespace/name.yaml, and lists the patches in dir/kustomization.yaml, a kustomize Component which overlays can
+// include with "components".  Patches already listed in an existing kustomization.yaml are kept.
+func writeKustomizePatches(dir string, hpas []*v1.HorizontalPodAutoscaler, cpu bool) error {
+	if len(hpas) == 0 {
+		return nil
+	}
+
+	kustomization := map[string]any{
+		"apiVersion": "kustomize.config.k8s.io/v1alpha1",
+		"kind":       "Component",
+	}
+	path := filepath.Join(dir, kustomizationFile)
+	if data, err := os.ReadFile(path); err == nil {
+		if err := yaml.Unmarshal(data, &kustomization); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	patches, _ := kustomization["patches"].([]any)
+	listed := map[string]bool{}
+	for _, patch := range patches {
+		if entry, ok := patch.(map[string]any); ok {
+			if p, ok := entry["path"].(string); ok {
+				listed[p] = true
+			}
+		}
+	}
+
+	for _, hpa := range hpas {
+		spec := map[string]any{"minReplicas": replicasOf(hpa.Spec.MinReplicas), "maxReplicas": hpa.Spec.MaxReplicas}
+		if cpu && hpa.Spec.TargetCPUUtilizationPercentage != nil {
+			// The v2 metrics list has no merge key, so the patch replaces the HPA's metrics with the CPU target
+			spec["metrics"] = hpaV1ToV2(hpa).Spec.Metrics
+		}
+
+		data, err := yaml.Marshal(map[string]any{
+			"apiVersion": "autoscaling/v2",
+			"kind":       "HorizontalPodAutoscaler",
+			"metadata":   map[string]string{"name": hpa.Name, "namespace": hpa.Namespace},
+			"spec":       spec,
+		})
+		if err != nil {
+			return err
+		}
+
+		relative := filepath.ToSlash(filepath.Join(hpa.Namespace, hpa.Name+".yaml"))
+		if err := os.MkdirAll(filepath.Join(dir, hpa.Namespace), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, relative), data, 0o644); err != nil {
+			return err
+		}
+
+		if !listed[relative] {
+			listed[relative] = true
+			patches = append(patches, map[string]any{"path": relative})
+		}
+	}
+
+	kustomization["patches"] = patches
+	data, err := yaml.Marshal(kustomization)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return err
+	}
+
+	log.Info().Str("dir", dir).Int("patches", len(hpas)).Msg("Wrote kustomize patches, include the directory in an overlay's components")
+
+	return nil
+}
+
+// helmKeys are the dotted paths in a chart's values of the settings of its HPA.  An empty path leaves that setting out.
+type helmKeys struct {
+	Min string `json:"min,omitempty"`
+	Max string `json:"max,omitempty"`
+	CPU string `json:"cpu,omitempty"`
+}
+
+// helmKeyConfig is the --helm-keys file, giving the paths of charts which differ from the default
+type helmKeyConfig struct {
+	Default helmKeys            `json:"default"`
+	Charts  map[string]helmKeys `json:"charts"`
+}
+
+// defaultHelmKeys are the paths used by the charts helm create generates, and by many others
+var defaultHelmKeys = helmKeys{Min: "autoscaling.minReplicas", Max: "autoscaling.maxReplicas", CPU: "autoscaling.targetCPUUtilizationPercentage"}
+
+// chartVersion matches the version helm appends to the chart name in the helm.sh/chart label
+var chartVersion = regexp.MustCompile(`-v?[0-9]+\.[0-9]+\.[0-9]+([-+][0-9A-Za-z.+-]*)?$`)
+
+// loadHelmKeys reads the --helm-keys file, if any, filling in what it leaves out from the defaults
+func loadHelmKeys(file string) (*helmKeyConfig, error) {
+	config := &helmKeyConfig{Default: defaultHelmKeys}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.UnmarshalStrict(data, config); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	fill := func(keys *helmKeys, from helmKeys) {
+		if keys.Min == "" && keys.Max == "" && keys.CPU == "" {
+			*keys = from
+		}
+	}
+	fill(&config.Default, defaultHelmKeys)
+	for chart, keys := range config.Charts {
+		fill(&keys, config.Default)
+		config.Charts[chart] = keys
+	}
+
+	return config, nil
+}
+
+// keys returns the paths of the settings of an HPA installed from the chart
+func (config *helmKeyConfig) keys(chart string) helmKeys {
+	if keys, ok := config.Charts[chart]; ok {
+		return keys
+	}
+	return config.Default
+}
+
+// helmRelease returns the Helm release and chart which installed the HPA, or empty strings if Helm did not
+func helmRelease(hpa *v1.HorizontalPodAutoscaler) (string, string) {
+	release := hpa.Annotations["meta.helm.sh/release-name"]
+	if release == "" {
+		release = hpa.Labels["app.kubernetes.io/instance"]
+	}
+	return release, chartVersion.ReplaceAllString(hpa.Labels["helm.sh/chart"], "")
+}
+
+// writeHelmValues writes the replica range and CPU target of each HPA installed by Helm into a values fragment for its
+// release, dir/namespace/release.yaml, at the paths the --helm-keys file gives for its chart
+func writeHelmValues(dir string, hpas []*v1.HorizontalPodAutoscaler, config *helmKeyConfig) error {
+	type release struct {
+		namespace, name string
+	}
+
+	values := map[release]map[string]any{}
+	set := map[release]map[string]string{}
+	var order []release
+	skipped := 0
+
+	for _, hpa := range hpas {
+		name, chart := helmRelease(hpa)
+		if name == "" {
+			skipped++
+			log.Debug().Str("namespace", hpa.Namespace).Str("hpa", hpa.Name).Msg("HPA was not installed by Helm")
+			continue
+		}
+
+		r := release{hpa.Namespace, name}
+		if values[r] == nil {
+			values[r] = map[string]any{}
+			set[r] = map[string]string{}
+			order = append(order, r)
+		}
+
+		keys := config.keys(chart)
+		for _, setting := range []struct {
+			path  string
+			value *int32
+		}{
+			{keys.Min, hpa.Spec.MinReplicas},
+			{keys.Max, &hpa.Spec.MaxReplicas},
+			{keys.CPU, hpa.Spec.TargetCPUUtilizationPercentage},
+		} {
+			if setting.path == "" || setting.value == nil {
+				continue
+			}
+			if other, ok := set[r][setting.path]; ok {
+				log.Warn().Str("release", hpa.Namespace+"/"+name).Str("key", setting.path).Strs("hpas", []string{other, hpa.Name}).
+					Msg("Several HPAs of the release have the same values key, give their chart its own paths with --helm-keys")
+			}
+			set[r][setting.path] = hpa.Name
+			setValue(values[r], setting.path, *setting.value)
+		}
+	}
+
+	for _, r := range order {
+		data, err := yaml.Marshal(values[r])
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Join(dir, r.namespace), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, r.namespace, r.name+".yaml"), data, 0o644); err != nil {
+			return err
+		}
+	}
+
+	if skipped > 0 {
+		log.Warn().Int("hpas", skipped).Msg("Skipped HPAs not installed by Helm")
+	}
+	log.Info().Str("dir", dir).Int("releases", len(order)).Msg("Wrote Helm values")
+
+	return nil
+}
+
+// setValue sets the value at the dotted path in the values, creating the maps on the way
+func setValue(values map[string]any, path string, value any) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := values[key].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			values[key] = next
+		}
+		values = next
+	}
+	values[keys[len(keys)-1]] = value
+}
+
+// pointers returns pointers to each of the items
+func pointers[T any](items []T) []*T {
+	result := make([]*T, len(items))
+	for i := range items {
+		result[i] = &items[i]
+	}
+	return result
+}
@@ -0,0 +1,187 @@
+package program
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	v2 "k8s.io/api/autoscaling/v2"
+	// The SQLite driver is pure Go, so the program still builds without cgo
+	_ "modernc.org/sqlite"
+)
+
+// hpaSnapshot is the spec and status of an HPA at a time, as recorded in the history by "hpa record"
+type hpaSnapshot struct {
+	Time       time.Time
+	Cluster    string
+	Namespace  string
+	HPA        string
+	TargetKind string
+	TargetName string
+	Min        int32
+	Max        int32
+	Current    int32
+	Desired    int32
+	// CPUTarget and CPUUtilization are percentages of the pods' CPU requests, for HPAs which scale on CPU utilization
+	CPUTarget      int32
+	CPUUtilization int32
+	AtMax          bool
+}
+
+// newSnapshot returns the snapshot of the HPA at the time
+func newSnapshot(hpa *v2.HorizontalPodAutoscaler, cluster string, now time.Time) hpaSnapshot {
+	s := hpaSnapshot{
+		Time:       now.UTC(),
+		Cluster:    cluster,
+		Namespace:  hpa.Namespace,
+		HPA:        hpa.Name,
+		TargetKind: hpa.Spec.ScaleTargetRef.Kind,
+		TargetName: hpa.Spec.ScaleTargetRef.Name,
+		Min:        max(replicasOf(hpa.Spec.MinReplicas), 1),
+		Max:        hpa.Spec.MaxReplicas,
+		Current:    hpa.Status.CurrentReplicas,
+		Desired:    hpa.Status.DesiredReplicas,
+		AtMax:      hpa.Status.CurrentReplicas >= hpa.Spec.MaxReplicas,
+	}
+	if current, target, ok := cpuUtilization(hpa); ok {
+		s.CPUUtilization, s.CPUTarget = current, target
+	}
+	return s
+}
+
+// historySchema creates the table of snapshots in a new history.  Times are stored as Unix nanoseconds so they sort
+// and compare as numbers.
+const historySchema = `
+CREATE TABLE IF NOT EXISTS snapshots (
+	time            INTEGER NOT NULL,
+	cluster         TEXT    NOT NULL DEFAULT '',
+	namespace       TEXT    NOT NULL,
+	hpa             TEXT    NOT NULL,
+	target_kind     TEXT    NOT NULL,
+	target_name     TEXT    NOT NULL,
+	min             INTEGER NOT NULL,
+	max             INTEGER NOT NULL,
+	current         INTEGER NOT NULL,
+	desired         INTEGER NOT NULL,
+	cpu_target      INTEGER NOT NULL DEFAULT 0,
+	cpu_utilization INTEGER NOT NULL DEFAULT 0,
+	at_max          INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS snapshots_by_time ON snapshots (time);
+`
+
+// openHistory opens the history database, creating it and its directory if need be.  Writers wait for each other
+// rather than failing, so several recorders can share a history.
+func openHistory(file string) (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", "file:"+file+"?_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return db, nil
+}
+
+// appendHistory adds the snapshots to the history in one transaction
+func appendHistory(file string, snapshots []hpaSnapshot) error {
+	db, err := openHistory(file)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	insert, err := tx.Prepare(`INSERT INTO snapshots (time, cluster, namespace, hpa, target_kind, target_name, min, max,
+		current, desired, cpu_target, cpu_utilization, at_max) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	for _, s := range snapshots {
+		_, err := insert.Exec(s.Time.UnixNano(), s.Cluster, s.Namespace, s.HPA, s.TargetKind, s.TargetName, s.Min, s.Max,
+			s.Current, s.Desired, s.CPUTarget, s.CPUUtilization, s.AtMax)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// readHistory returns the snapshots of the cluster in the history at or after since, by namespace/name and in time
+// order.  Snapshots recorded without a cluster are taken to be of any cluster.
+func readHistory(file, cluster string, since time.Time) (map[string][]hpaSnapshot, error) {
+	db, err := openHistory(file)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT time, cluster, namespace, hpa, target_kind, target_name, min, max, current, desired,
+		cpu_target, cpu_utilization, at_max FROM snapshots
+		WHERE time >= ? AND (cluster = '' OR ? = '' OR cluster = ?)
+		ORDER BY namespace, hpa, time`, since.UnixNano(), cluster, cluster)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	defer rows.Close()
+
+	result := map[string][]hpaSnapshot{}
+	for rows.Next() {
+		var s hpaSnapshot
+		var nanoseconds int64
+		err := rows.Scan(&nanoseconds, &s.Cluster, &s.Namespace, &s.HPA, &s.TargetKind, &s.TargetName, &s.Min, &s.Max,
+			&s.Current, &s.Desired, &s.CPUTarget, &s.CPUUtilization, &s.AtMax)
+		if err != nil {
+			return nil, err
+		}
+		s.Time = time.Unix(0, nanoseconds).UTC()
+
+		key := s.Namespace + "/" + s.HPA
+		result[key] = append(result[key], s)
+	}
+
+	return result, rows.Err()
+}
+
+// historyScaleEvents returns a scaling event for each change of replicas between the snapshots of the HPAs
+func historyScaleEvents(file, cluster string, hpas []v2.HorizontalPodAutoscaler) ([]scalingEvent, error) {
+	history, err := readHistory(file, cluster, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []scalingEvent
+	for _, hpa := range hpas {
+		var previous *hpaSnapshot
+		for i, s := range history[hpa.Namespace+"/"+hpa.Name] {
+			if previous == nil || s.Current != previous.Current {
+				result = append(result, scalingEvent{
+					Time:      s.Time,
+					Namespace: s.Namespace,
+					HPA:       s.HPA,
+					Replicas:  s.Current,
+					Source:    "history",
+				})
+			}
+			previous = &history[hpa.Namespace+"/"+hpa.Name][i]
+		}
+	}
+
+	return result, nil
+}
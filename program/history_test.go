@@ -0,0 +1,66 @@
+package program
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "k8sutils", "history.db")
+	start := time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC)
+
+	snapshot := func(minutes int, cluster, name string, current int32) hpaSnapshot {
+		return hpaSnapshot{
+			Time: start.Add(time.Duration(minutes) * time.Minute), Cluster: cluster, Namespace: "shop", HPA: name,
+			TargetKind: "Deployment", TargetName: name, Min: 2, Max: 10, Current: current, Desired: current,
+			CPUTarget: 50, CPUUtilization: 40 + current, AtMax: current >= 10,
+		}
+	}
+
+	// Separate runs add to the same history
+	require.NoError(t, appendHistory(file, []hpaSnapshot{snapshot(10, "prod", "web", 4), snapshot(0, "prod", "api", 2)}))
+	require.NoError(t, appendHistory(file, []hpaSnapshot{snapshot(5, "prod", "web", 10), snapshot(0, "staging", "web", 3), snapshot(20, "", "web", 6)}))
+
+	tests := []struct {
+		name    string
+		cluster string
+		since   time.Time
+		want    map[string][]hpaSnapshot
+	}{
+		{
+			name:    "the cluster's snapshots and those of no cluster, in time order",
+			cluster: "prod",
+			want: map[string][]hpaSnapshot{
+				"shop/api": {snapshot(0, "prod", "api", 2)},
+				"shop/web": {snapshot(5, "prod", "web", 10), snapshot(10, "prod", "web", 4), snapshot(20, "", "web", 6)},
+			},
+		},
+		{
+			name:    "since a time",
+			cluster: "prod",
+			since:   start.Add(10 * time.Minute),
+			want: map[string][]hpaSnapshot{
+				"shop/web": {snapshot(10, "prod", "web", 4), snapshot(20, "", "web", 6)},
+			},
+		},
+		{
+			name: "every cluster",
+			want: map[string][]hpaSnapshot{
+				"shop/api": {snapshot(0, "prod", "api", 2)},
+				"shop/web": {snapshot(0, "staging", "web", 3), snapshot(5, "prod", "web", 10), snapshot(10, "prod", "web", 4), snapshot(20, "", "web", 6)},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			history, err := readHistory(file, test.cluster, test.since)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, history)
+		})
+	}
+}
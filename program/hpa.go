@@ -6,68 +6,173 @@ import (
 	"fmt"
 	"github.com/rs/zerolog/log"
 	v1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
-	"math"
+	"os"
+	"os/signal"
 	"regexp"
-	"strconv"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
 )
 
+// HpaCmd groups the Horizontal Pod Autoscaler operations
+type HpaCmd struct {
+	Modify Hpa       `cmd:"" default:"withargs" help:"Show or modify HPAs (default)"`
+	Lock   HpaLock   `cmd:"" help:"Lock HPAs so this tool will not modify them"`
+	Unlock HpaUnlock `cmd:"" help:"Remove the lock from HPAs"`
+
+	SyncReplicas      HpaSyncReplicas      `cmd:"" help:"Set the replicas of each HPA's target to the HPA's desired count"`
+	Report            HpaReport            `cmd:"" help:"Summarise the health of every HPA in the cluster"`
+	Orphans           HpaOrphans           `cmd:"" help:"Find, and optionally delete, HPAs whose target no longer exists"`
+	Conflicts         HpaConflicts         `cmd:"" help:"Find workloads scaled by several HPAs or whose replicas are also set by GitOps"`
+	Headroom          HpaHeadroom          `cmd:"" help:"List the replicas each HPA can still add, closest to its maximum first"`
+	FitCheck          HpaFitCheck          `cmd:"" help:"Check whether the cluster could schedule every selected HPA at its maximum"`
+	Cost              HpaCost              `cmd:"" help:"Estimate the monthly cost of each HPA's workload now, at minimum and at maximum"`
+	Check             HpaCheck             `cmd:"" help:"Exit with an error if any selected HPA is at maximum, limited or unhealthy"`
+	Missing           HpaMissing           `cmd:"" help:"List Deployments and StatefulSets which no HPA or ScaledObject scales"`
+	Compare           HpaCompare           `cmd:"" help:"Show how the HPAs of two namespaces or several clusters differ"`
+	Drift             HpaDrift             `cmd:"" help:"Compare the live HPAs with the manifests in a directory"`
+	Timeline          HpaTimeline          `cmd:"" help:"Show the replica changes the selected HPAs have made, oldest first"`
+	Flapping          HpaFlapping          `cmd:"" help:"Find HPAs which keep scaling up and back down, with suggested fixes"`
+	Conditions        HpaConditions        `cmd:"" help:"List HPAs whose conditions say they cannot fetch metrics or scale"`
+	Recommend         HpaRecommend         `cmd:"" help:"Suggest min, max and CPU target values from Prometheus or recorded history"`
+	Dashboard         HpaDashboard         `cmd:"" help:"Write a Grafana dashboard charting the metrics of hpa export"`
+	Alerts            HpaAlerts            `cmd:"" help:"Write Prometheus alerting rules for the selected HPAs"`
+	Export            HpaExport            `cmd:"" help:"Serve the selected HPAs' state as Prometheus metrics until interrupted"`
+	Grpc              HpaGrpc              `cmd:"" name:"grpc" help:"Serve the list, plan, apply and report operations and HPA watches over gRPC"`
+	Record            HpaRecord            `cmd:"" help:"Append snapshots of the selected HPAs to a local history, once or continuously"`
+	Propose           HpaPropose           `cmd:"" help:"Make a change to the selected HPAs' manifests in a Git repository and open a pull request"`
+	Apply             HpaApply             `cmd:"" help:"Apply HPA manifests from a file or directory with server-side apply, showing the differences first"`
+	Manifests         HpaManifests         `cmd:"" help:"Write the selected HPAs as clean manifests, one file each, for a GitOps repository"`
+	Lint              HpaLint              `cmd:"" help:"List HPAs which break the policy rules, failing if any do"`
+	Webhook           HpaWebhook           `cmd:"" help:"Serve a validating admission webhook enforcing the policy rules until interrupted"`
+	ClusterAutoscaler HpaClusterAutoscaler `cmd:"" name:"cluster-autoscaler" aliases:"ca" help:"Show HPAs wanting capacity beside the cluster autoscaler's node groups and events"`
+}
+
 type Hpa struct {
-	Minimum    string            `aliases:"min" help:"Set minimum to this number"`
-	Maximum    string            `aliases:"max" help:"Set maximum to this number"`
-	CPUTarget  int               `aliases:"cpu" help:"Set scaling target"`
-	Info       bool              `help:"Show information about the HPAs"`
-	Kubeconfig string            `help:"Path to the kubeconfig file" type:"path" default:"~/.kube/config"`
-	Namespace  string            `short:"n" help:"Namespace to modify HPAs in"`
-	Context    string            `help:"Context to use in kubeconfig"`
-	Labels     map[string]string `short:"l" help:"Label filters to select HPAs"`
-	All        bool              `help:"Modify all HPAs in the namespace"`
-	HPAList    []string          `arg:"" optional:"" help:"Names of specific HPAs to modify"`
+	Minimum   string `name:"min" aliases:"minimum" help:"Set minimum to this number"`
+	Maximum   string `name:"max" aliases:"maximum" help:"Set maximum to this number"`
+	CPUTarget int    `name:"cpu" aliases:"cpu-target" help:"Set scaling target"`
+	Info      bool   `help:"Show information about the HPAs"`
+	Watch     bool   `short:"w" help:"Keep showing information, updating as the HPAs change"`
+
+	Duration time.Duration `help:"With --watch, stop after this long (default forever)"`
+
+	Selector `embed:"" set:"resources=HPAs"`
+
+	Ticket        string `help:"Change ticket (e.g. JIRA-123) recorded with every modification"`
+	RequireTicket bool   `help:"Refuse to modify HPAs unless --ticket is given"`
+	Atomic        bool   `help:"If any update fails, revert the HPAs already updated in this run"`
+	OverrideLock  bool   `help:"Modify HPAs even if they are locked"`
+
+	Output    string `short:"o" help:"Show the HPAs as kubectl get would (wide, yaml, json, name, jsonpath=..., custom-columns=...), or also write the changes, or with helm-values the selected HPAs, as files to commit to a GitOps repository (kustomize, helm-values)"`
+	OutputDir string `default:"." help:"Directory to write --output files to"`
+	HelmKeys  string `type:"existingfile" help:"YAML file giving the values paths of the HPA settings of each chart, for -o helm-values"`
+
+	Bulk `embed:""`
+
+	// rollouts looks up the Argo Rollouts scaled by HPAs when showing them
+	rollouts *rolloutResolver
+	// helmKeys gives the values paths to write for -o helm-values
+	helmKeys *helmKeyConfig
 }
 
 type strategy func(hpa *v1.HorizontalPodAutoscaler) error
 
+// newContext returns the context for API calls, which is cancelled when the program is interrupted
+func newContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
 func (program *Hpa) Run(options *Options) error {
 
 	initColors(options)
 
-	if !program.All && len(program.HPAList) == 0 && len(program.Labels) == 0 {
+	if !program.selected() || program.Watch {
 		program.Info = true
 	}
 
-	// Set up Kubernetes client
-	config, err := clientcmd.BuildConfigFromFlags("", program.Kubeconfig)
-	if err != nil {
-		panic(err.Error())
+	switch {
+	case program.Output == "", program.Output == "helm-values":
+	case program.Output == "kustomize":
+		if program.Info {
+			return usageError("-o kustomize writes the changes made, use it with HPAs selected to change")
+		}
+	case kubectlFormat(program.Output):
+		if program.Minimum != "" || program.Maximum != "" || program.CPUTarget != 0 || program.Watch {
+			return usageError("-o %s shows the HPAs, it cannot be used with --min, --max, --cpu or --watch", program.Output)
+		}
+		program.Info = true
+	default:
+		return usageError("unknown -o format %q", program.Output)
+	}
+
+	if program.Watch {
+		// Watches are long running requests, so are not subject to the request timeout
+		options.Timeout = 0
 	}
 
-	clientset, err := kubernetes.NewForConfig(config)
+	clientset, err := program.connect(options)
 	if err != nil {
-		panic(err.Error())
+		return err
 	}
 
-	// Get namespace from context if not provided
-	if program.Namespace == "" {
-		config, err := clientcmd.LoadFromFile(program.Kubeconfig)
+	if kubectlFormat(program.Output) {
+		ctx, cancel := newContext()
+		defer cancel()
+
+		selector := program.Selector
+		hpas, err := getHpasV2(ctx, clientset, &selector)
 		if err != nil {
-			panic(err.Error())
+			return err
 		}
+		return printKubectl(os.Stdout, hpas, program.Output, len(program.Names) == 1 && !program.AllNamespaces, program.AllNamespaces)
+	}
 
-		k8sContext := config.Contexts[config.CurrentContext]
-		if k8sContext.Namespace == "" {
-			panic("Namespace is not set in the current context and no namespace flag provided")
+	if program.Info {
+		dynamicClient, err := options.Dynamic()
+		if err != nil {
+			return err
 		}
-		program.Namespace = k8sContext.Namespace
+		program.rollouts = newRolloutResolver(dynamicClient)
 	}
 
-	ctx := context.WithValue(context.Background(), "options", options)
+	ctx, cancel := newContext()
+	defer cancel()
 
-	// Get HPAs
-	hpas, err := program.getHpas(err, clientset, ctx)
-	if err != nil {
-		return err
+	if program.Watch && program.Duration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, program.Duration)
+		defer cancel()
+	}
+
+	return options.runAsLeader(ctx, clientset, func(ctx context.Context) error {
+		if program.Watch {
+			return program.watch(ctx, clientset)
+		}
+
+		return program.Execute(ctx, options, WithRetries(WithTracing(NewHPAClient(clientset)), options.Retries))
+	})
+}
+
+// Execute shows or modifies the selected HPAs using the given client.  A modification is traced with a span for the run
+// and one for each HPA, with the API calls and the computing and verifying of its new values beneath.
+func (program *Hpa) Execute(ctx context.Context, options *Options, client HPAClient) (err error) {
+
+	if program.Output == "helm-values" {
+		var err error
+		if program.helmKeys, err = loadHelmKeys(program.HelmKeys); err != nil {
+			return usageError("--helm-keys: %v", err)
+		}
+	}
+
+	if program.Info && program.helmKeys != nil {
+		hpas, err := program.getHpas(ctx, client)
+		if err != nil {
+			return err
+		}
+		return writeHelmValues(program.OutputDir, pointers(hpas), program.helmKeys)
 	}
 
 	if program.Info {
@@ -75,8 +180,31 @@ func (program *Hpa) Run(options *Options) error {
 		// Example:
 		// test-hpa                  Deployment/test                      26%/45%   4         100       9          60d
 
-		program.printHPAs(hpas)
-		return nil
+		// Render each page as it arrives so large clusters show results quickly and use little memory
+		printer := program.newHPAPrinter(ctx)
+		return program.forEachPage(ctx, client, func(page []v1.HorizontalPodAutoscaler) error {
+			printer.print(page)
+			return nil
+		})
+	}
+
+	ctx, run := startSpan(ctx, "hpa", "k8sutils.dry_run", options.DryRun, "k8sutils.ticket", program.Ticket)
+	defer func() {
+		run.finish(err)
+		flushTraces()
+		if run != nil {
+			log.Info().Str("trace_id", run.traceIDString()).Msg("Exported trace of the run")
+		}
+	}()
+
+	// Get HPAs
+	hpas, err := program.getHpas(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	if program.RequireTicket && program.Ticket == "" {
+		return usageError("a change ticket is required for modifications, use --ticket")
 	}
 
 	cal, err := program.getStrategy()
@@ -85,59 +213,181 @@ func (program *Hpa) Run(options *Options) error {
 		return err
 	}
 
-	var listErrors []error
+	results := newSummary()
+	defer results.print()
+
+	return program.modify(ctx, options, client, hpas, cal, results)
+}
+
+// modify applies the strategy to the HPAs, recording the outcome of each in results.  Locked HPAs are skipped unless
+// the lock is overridden, and with --atomic the HPAs already updated are reverted if any update fails.
+func (program *Hpa) modify(ctx context.Context, options *Options, client HPAClient, hpas []v1.HorizontalPodAutoscaler, cal strategy, results *summary) error {
+	var selected []v1.HorizontalPodAutoscaler
 
 	for _, hpa := range hpas {
-		err := modifyHPA(ctx, &hpa,
-			cal,
-			clientset, program.Namespace)
+		if isLocked(&hpa) && !program.OverrideLock {
+			log.Warn().Str("hpa", hpa.Name).Msg("Skipping locked HPA, use --override-lock to modify it")
+			results.record(hpa.Namespace, hpa.Name, outcomeSkipped, "locked: "+hpa.Annotations[AnnotationLocked])
+			continue
+		}
+		selected = append(selected, hpa)
+	}
 
-		listErrors = append(listErrors, err)
+	var lock sync.Mutex
+	var updated, changes []*v1.HorizontalPodAutoscaler
 
-		if err != nil {
+	listErrors := program.Bulk.run(ctx, len(selected), options.DryRun, program.Atomic, func(i int) error {
+		hpa := &selected[i]
+		original := hpa.DeepCopy()
+
+		spanCtx, s := startSpan(ctx, "update", hpaAttributes(hpa.Namespace, hpa.Name)...)
+		changed, err := modifyHPA(spanCtx, options, hpa, cal, client, program.Ticket)
+		s.set("k8sutils.changed", changed)
+		if s.finish(err) != nil {
 			fmt.Printf("Failed to update HPA %s: %v\n", hpa.Name, err)
+			results.record(hpa.Namespace, hpa.Name, outcomeFailed, err.Error())
+			return fmt.Errorf("HPA %s: %w", hpa.Name, err)
+		}
+
+		switch {
+		case !changed:
+			results.record(hpa.Namespace, hpa.Name, outcomeSkipped, "already at the requested values")
+			return nil
+		case options.DryRun:
+			results.record(hpa.Namespace, hpa.Name, outcomeUpdated, "dry run: "+hpa.Annotations[AnnotationChange])
+		default:
+			results.record(hpa.Namespace, hpa.Name, outcomeUpdated, hpa.Annotations[AnnotationChange])
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+		updated = append(updated, original)
+		changes = append(changes, hpa)
+		return nil
+	})
 
+	for _, hpa := range selected {
+		if !results.has(hpa.Namespace, hpa.Name) {
+			results.record(hpa.Namespace, hpa.Name, outcomeSkipped, "not started")
 		}
 	}
 
-	return errors.Join(listErrors...)
+	err := errors.Join(listErrors...)
+
+	if err != nil && program.Atomic {
+		// Revert even if interrupted, so the batch is not left partially applied
+		err = errors.Join(err, revertHPAs(context.WithoutCancel(ctx), options, client, updated, results))
+		return err
+	}
+
+	if program.helmKeys != nil {
+		err = errors.Join(err, writeHelmValues(program.OutputDir, pointers(selected), program.helmKeys))
+	}
+
+	if program.Output == "kustomize" {
+		sort.Slice(changes, func(i, j int) bool {
+			a, b := changes[i], changes[j]
+			return a.Namespace < b.Namespace || (a.Namespace == b.Namespace && a.Name < b.Name)
+		})
+		err = errors.Join(err, writeKustomizePatches(program.OutputDir, changes, program.CPUTarget != 0))
+	}
+
+	return err
 }
 
-func (program *Hpa) getHpas(err error, clientset *kubernetes.Clientset, ctx context.Context) ([]v1.HorizontalPodAutoscaler, error) {
+func (program *Selector) getHpas(ctx context.Context, client HPAClient) ([]v1.HorizontalPodAutoscaler, error) {
 
 	var hpas []v1.HorizontalPodAutoscaler
 
-	if len(program.HPAList) > 0 {
-		for _, hpaName := range program.HPAList {
-			hpa, err := clientset.AutoscalingV1().HorizontalPodAutoscalers(program.Namespace).Get(context.TODO(), hpaName, metav1.GetOptions{})
+	err := program.forEachPage(ctx, client, func(page []v1.HorizontalPodAutoscaler) error {
+		hpas = append(hpas, page...)
+		return nil
+	})
+
+	// Process in a fixed order so repeated runs log identically and staggered changes roll out predictably
+	sortHPAs(hpas)
+
+	return hpas, err
+}
+
+// forEachPage calls fn with the selected HPAs a page at a time as they are fetched, so large listings can be processed
+// without holding every HPA in memory
+func (program *Selector) forEachPage(ctx context.Context, client HPAClient, fn func(page []v1.HorizontalPodAutoscaler) error) error {
+
+	if len(program.Names) > 0 && !program.AllNamespaces {
+		var hpas []v1.HorizontalPodAutoscaler
+
+		for _, hpaName := range program.Names {
+			hpa, err := client.Get(ctx, program.namespaceName, hpaName)
 			if err != nil {
+				if err := apiError(err); ExitCode(err) == ExitConnection {
+					return err
+				}
 				fmt.Printf("Failed to get HPA %s: %v\n", hpaName, err)
 				continue
 			}
 			hpas = append(hpas, *hpa)
 		}
-	} else {
-		listOptions := metav1.ListOptions{}
-		if len(program.Labels) > 0 {
-			labelSelector := ""
-			for key, value := range program.Labels {
-				if labelSelector != "" {
-					labelSelector += ","
-				}
-				labelSelector += fmt.Sprintf("%s=%s", key, value)
-			}
-			listOptions.LabelSelector = labelSelector
-		}
 
-		hpaList, err := clientset.AutoscalingV1().HorizontalPodAutoscalers(program.Namespace).List(context.TODO(), listOptions)
+		sortHPAs(hpas)
+		return fn(hpas)
+	}
+
+	listOptions := metav1.ListOptions{Limit: program.ChunkSize, LabelSelector: program.labelSelector()}
+	namespace := program.namespace()
+
+	for {
+		hpaList, err := client.List(ctx, namespace, listOptions)
 		if err != nil {
-			return hpas, err
+			return apiError(err)
+		}
+
+		log.Debug().Int("count", len(hpaList.Items)).Msg("Listed HPAs")
+
+		page := hpaList.Items
+		if len(program.Names) > 0 {
+			page = filterByName(page, program.Names)
+		}
+
+		// The API server returns listings in key order, so sorting each page keeps the whole listing in order
+		sortHPAs(page)
+
+		if err := fn(page); err != nil {
+			return err
+		}
+
+		if hpaList.Continue == "" {
+			return nil
 		}
+		listOptions.Continue = hpaList.Continue
+	}
+}
+
+// sortHPAs sorts HPAs by namespace and then name
+func sortHPAs(hpas []v1.HorizontalPodAutoscaler) {
+	sort.Slice(hpas, func(i, j int) bool {
+		if hpas[i].Namespace != hpas[j].Namespace {
+			return hpas[i].Namespace < hpas[j].Namespace
+		}
+		return hpas[i].Name < hpas[j].Name
+	})
+}
 
-		hpas = hpaList.Items
+// filterByName returns the HPAs whose name is one of the given names
+func filterByName(hpas []v1.HorizontalPodAutoscaler, names []string) []v1.HorizontalPodAutoscaler {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
 	}
 
-	return hpas, nil
+	var result []v1.HorizontalPodAutoscaler
+	for _, hpa := range hpas {
+		if wanted[hpa.Name] {
+			result = append(result, hpa)
+		}
+	}
+
+	return result
 }
 
 var (
@@ -146,127 +396,168 @@ var (
 	Multiply   = regexp.MustCompile(`^[0-9\\.]+x$`)
 )
 
+// getStrategy returns the change given by --min, --max and --cpu, any combination of which may be used together
 func (program *Hpa) getStrategy() (strategy, error) {
+	if program.CPUTarget <= 0 && program.Minimum == "" && program.Maximum == "" {
+		return nil, usageError("nothing to change, use --min, --max or --cpu with a number, percentage (50%%) or multiplier (2x)")
+	}
 
-	switch {
-	case program.CPUTarget > 0:
-		return func(hpa *v1.HorizontalPodAutoscaler) error {
-			*hpa.Spec.TargetCPUUtilizationPercentage = int32(program.CPUTarget)
-			return nil
-		}, nil
-
-	case Number.MatchString(program.Minimum):
-		if num, err := strconv.Atoi(program.Minimum); err != nil {
+	var change limits
+	if program.Minimum != "" || program.Maximum != "" {
+		var err error
+		if change, err = parseLimits(program.Minimum, program.Maximum); err != nil {
 			return nil, err
-		} else {
-			return func(hpa *v1.HorizontalPodAutoscaler) error {
-				minimum := int32(num)
-				hpa.Spec.MinReplicas = &minimum
-				reconcileMax(hpa)
-				return nil
-			}, nil
 		}
-	case Percentage.MatchString(program.Minimum):
-		if percent, err := strconv.ParseFloat(program.Minimum[:len(program.Minimum)-1], 32); err != nil {
-			return nil, err
-		} else {
-			return func(hpa *v1.HorizontalPodAutoscaler) error {
-				minimum := int32(math.Ceil(percent / 100 * float64(hpa.Spec.MaxReplicas)))
-				*hpa.Spec.MinReplicas = minimum
-				reconcileMax(hpa)
-				return nil
-			}, nil
+	}
+
+	return func(hpa *v1.HorizontalPodAutoscaler) error {
+		if program.CPUTarget > 0 {
+			target := int32(program.CPUTarget)
+			hpa.Spec.TargetCPUUtilizationPercentage = &target
 		}
 
-	case Multiply.MatchString(program.Minimum):
-		if multiplier, err := strconv.ParseFloat(program.Minimum[:len(program.Minimum)-1], 32); err != nil {
-			return nil, err
-		} else {
-			return func(hpa *v1.HorizontalPodAutoscaler) error {
-				minimum := int32(float64(*hpa.Spec.MinReplicas) * multiplier)
-				hpa.Spec.MinReplicas = &minimum
-				reconcileMax(hpa)
-				return nil
-			}, nil
+		if change != nil {
+			minimum, maximum := change(replicasOf(hpa.Spec.MinReplicas), hpa.Spec.MaxReplicas)
+			hpa.Spec.MinReplicas = &minimum
+			hpa.Spec.MaxReplicas = maximum
 		}
+		return nil
+	}, nil
+}
 
-	case Number.MatchString(program.Maximum):
-		if num, err := strconv.Atoi(program.Maximum); err != nil {
-			return nil, err
-		} else {
-			return func(hpa *v1.HorizontalPodAutoscaler) error {
-				hpa.Spec.MaxReplicas = int32(num)
-				reconcileMin(hpa)
-				return nil
-			}, nil
+// modifyHPA modifies the HPA per the strategy function passed.  If the HPA changes while being modified, it is fetched
+// again and the strategy re-applied to the current values.
+func modifyHPA(ctx context.Context, options *Options, hpa *v1.HorizontalPodAutoscaler, update strategy, client HPAClient, ticket string) (bool, error) {
+	changed := false
+
+	err := retryOnConflict(ctx, client, hpa, func(hpa *v1.HorizontalPodAutoscaler) error {
+		original := hpa.DeepCopy()
+		oldMax := hpa.Spec.MaxReplicas
+		oldMin := *hpa.Spec.MinReplicas
+
+		_, compute := startSpan(ctx, "compute", hpaAttributes(hpa.Namespace, hpa.Name)...)
+		if err := compute.finish(update(hpa)); err != nil {
+			return err
+		}
+		compute.set("k8sutils.replicas.from", fmt.Sprint(oldMin, "/", oldMax))
+		compute.set("k8sutils.replicas.to", fmt.Sprint(*hpa.Spec.MinReplicas, "/", hpa.Spec.MaxReplicas))
+
+		changed = !equality.Semantic.DeepEqual(original.Spec, hpa.Spec)
+		if !changed {
+			log.Info().
+				Str("hpa", hpa.Name).
+				Msg("HPA already at the requested values")
+			return nil
 		}
 
-	case Percentage.MatchString(program.Maximum):
-		if percent, err := strconv.ParseFloat(program.Maximum[:len(program.Maximum)-1], 32); err != nil {
-			return nil, err
-		} else {
-			return func(hpa *v1.HorizontalPodAutoscaler) error {
-				maximum := int32(math.Ceil(float64(percent) / 100 * float64(hpa.Spec.MaxReplicas)))
-				hpa.Spec.MaxReplicas = maximum
-				reconcileMin(hpa)
-				return nil
-			}, nil
+		change := fmt.Sprintf("replicas %d/%d -> %d/%d", oldMin, oldMax, *hpa.Spec.MinReplicas, hpa.Spec.MaxReplicas)
+		if ticket != "" {
+			change += " (ticket " + ticket + ")"
 		}
-	case Multiply.MatchString(program.Maximum):
-		if multiplier, err := strconv.ParseFloat(program.Maximum[:len(program.Maximum)-1], 32); err != nil {
-			return nil, err
-		} else {
-			return func(hpa *v1.HorizontalPodAutoscaler) error {
-				maximum := int32(float64(hpa.Spec.MaxReplicas) * multiplier)
-				hpa.Spec.MaxReplicas = maximum
-				reconcileMin(hpa)
-				return nil
-			}, nil
+
+		log.Info().
+			Str("from", fmt.Sprint(oldMin, "/", oldMax)).
+			Str("to", fmt.Sprint(*hpa.Spec.MinReplicas, "/", hpa.Spec.MaxReplicas)).
+			Str("hpa", hpa.Name).
+			Str("ticket", ticket).
+			Msg("Updating HPA")
+
+		if hpa.Annotations == nil {
+			hpa.Annotations = map[string]string{}
+		}
+		hpa.Annotations[AnnotationChange] = change
+		if ticket != "" {
+			hpa.Annotations[AnnotationTicket] = ticket
 		}
-	default:
-		return nil, errors.New("invalid arguments")
-	}
-}
 
-func reconcileMax(hpa *v1.HorizontalPodAutoscaler) {
-	if *hpa.Spec.MinReplicas > hpa.Spec.MaxReplicas {
-		hpa.Spec.MaxReplicas = *hpa.Spec.MinReplicas
-	}
+		if !options.DryRun {
+			log.Debug().Msg("Updating via API")
+			saved, err := patchHPA(ctx, client, original, hpa)
+
+			if err != nil {
+				return apiError(err)
+			} else {
+				log.Debug().Msg("Updated")
+			}
+
+			if err := verifyHPA(ctx, hpa, saved); err != nil {
+				return err
+			}
+
+			recordEvent(ctx, client, hpa, "Modified", "k8sutils changed "+change)
+			publishChange(busModified, original, hpa, "k8sutils changed "+change, ticket)
+		}
+
+		return nil
+	})
+
+	return changed, err
 }
 
-func reconcileMin(hpa *v1.HorizontalPodAutoscaler) {
-	if *hpa.Spec.MinReplicas > hpa.Spec.MaxReplicas {
-		*hpa.Spec.MinReplicas = hpa.Spec.MaxReplicas
+// verifyHPA checks the API server saved the requested min, max and target, which a mutating webhook or another
+// controller could have changed
+func verifyHPA(ctx context.Context, requested, saved *v1.HorizontalPodAutoscaler) error {
+	_, s := startSpan(ctx, "verify", hpaAttributes(requested.Namespace, requested.Name)...)
+	if saved == nil {
+		return s.finish(nil)
 	}
-}
 
-// modifyHPA modifies the HPA per the strategy function passed
-func modifyHPA(ctx context.Context, hpa *v1.HorizontalPodAutoscaler, update strategy, clientset *kubernetes.Clientset, namespace string) error {
-	oldMax := hpa.Spec.MaxReplicas
-	oldMin := *hpa.Spec.MinReplicas
+	values := func(hpa *v1.HorizontalPodAutoscaler) string {
+		cpu := "unset"
+		if hpa.Spec.TargetCPUUtilizationPercentage != nil {
+			cpu = fmt.Sprintf("%d%%", *hpa.Spec.TargetCPUUtilizationPercentage)
+		}
+		return fmt.Sprintf("replicas %d/%d, cpu %s", replicasOf(hpa.Spec.MinReplicas), hpa.Spec.MaxReplicas, cpu)
+	}
 
-	if err := update(hpa); err != nil {
-		return err
+	want, got := values(requested), values(saved)
+	if want != got {
+		return s.finish(fmt.Errorf("the API server saved %s rather than the requested %s, a webhook or another controller may have changed it", got, want))
 	}
+	return s.finish(nil)
+}
 
-	options := ctx.Value("options").(*Options)
+// revertHPAs restores the given HPAs to their original min, max, target and annotations.  Each HPA is fetched fresh so
+// the update is made against the current resource version.
+func revertHPAs(ctx context.Context, options *Options, client HPAClient, originals []*v1.HorizontalPodAutoscaler, results *summary) error {
+	if options.DryRun || len(originals) == 0 {
+		return nil
+	}
 
-	log.Info().
-		Str("from", fmt.Sprint(oldMin, "/", oldMax)).
-		Str("to", fmt.Sprint(*hpa.Spec.MinReplicas, "/", hpa.Spec.MaxReplicas)).
-		Str("hpa", hpa.Name).
-		Msg("Updating HPA")
+	var listErrors []error
 
-	if !options.DryRun {
-		log.Debug().Msg("Updating via API")
-		_, err := clientset.AutoscalingV1().HorizontalPodAutoscalers(namespace).Update(ctx, hpa, metav1.UpdateOptions{})
+	for _, original := range originals {
+		log.Warn().
+			Str("to", fmt.Sprint(*original.Spec.MinReplicas, "/", original.Spec.MaxReplicas)).
+			Str("hpa", original.Name).
+			Msg("Reverting HPA")
 
+		current, err := client.Get(ctx, original.Namespace, original.Name)
 		if err != nil {
+			listErrors = append(listErrors, fmt.Errorf("failed to revert HPA %s: %w", original.Name, err))
+			continue
+		}
+
+		err = retryOnConflict(ctx, client, current, func(current *v1.HorizontalPodAutoscaler) error {
+			restored := current.DeepCopy()
+			restored.Spec.MinReplicas = original.Spec.MinReplicas
+			restored.Spec.MaxReplicas = original.Spec.MaxReplicas
+			restored.Spec.TargetCPUUtilizationPercentage = original.Spec.TargetCPUUtilizationPercentage
+			restored.Annotations = original.Annotations
+
+			_, err := patchHPA(ctx, client, current, restored)
 			return err
-		} else {
-			log.Debug().Msg("Updated")
+		})
+
+		if err != nil {
+			listErrors = append(listErrors, fmt.Errorf("failed to revert HPA %s: %w", original.Name, err))
+			continue
 		}
+
+		recordEvent(ctx, client, current, "Reverted", "k8sutils reverted a partially applied change")
+		publishChange(busReverted, current, original, "k8sutils reverted a partially applied change", "")
+		results.record(original.Namespace, original.Name, outcomeReverted, "batch failed, restored original values")
 	}
 
-	return nil
+	return errors.Join(listErrors...)
 }
@@ -0,0 +1,387 @@
+package program
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/autoscaling/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// newTestHPA returns an HPA scaling a Deployment of the same name between minimum and maximum
+func newTestHPA(namespace, name string, minimum, maximum int32) v1.HorizontalPodAutoscaler {
+	target := int32(50)
+	return v1.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: v1.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef:                 v1.CrossVersionObjectReference{Kind: "Deployment", Name: name},
+			MinReplicas:                    &minimum,
+			MaxReplicas:                    maximum,
+			TargetCPUUtilizationPercentage: &target,
+		},
+	}
+}
+
+// failingHPAClient rejects patches to the named HPAs
+type failingHPAClient struct {
+	*FakeHPAClient
+	fail map[string]bool
+}
+
+func (c *failingHPAClient) Patch(ctx context.Context, namespace, name string, patchType types.PatchType, data []byte) (*v1.HorizontalPodAutoscaler, error) {
+	if c.fail[name] {
+		return nil, apierrors.NewBadRequest("rejected by test")
+	}
+	return c.FakeHPAClient.Patch(ctx, namespace, name, patchType, data)
+}
+
+// limitsOf returns the min/max of every HPA the client holds, by name
+func limitsOf(t *testing.T, client HPAClient) map[string][2]int32 {
+	t.Helper()
+
+	list, err := client.List(context.Background(), metav1.NamespaceAll, metav1.ListOptions{})
+	require.NoError(t, err)
+
+	result := map[string][2]int32{}
+	for _, hpa := range list.Items {
+		result[hpa.Name] = [2]int32{*hpa.Spec.MinReplicas, hpa.Spec.MaxReplicas}
+	}
+	return result
+}
+
+func TestExecuteAtomic(t *testing.T) {
+	tests := []struct {
+		name        string
+		atomic      bool
+		parallelism int
+		want        map[string][2]int32
+	}{
+		{
+			name:        "without atomic the updates made are kept",
+			parallelism: 1,
+			want:        map[string][2]int32{"a": {2, 20}, "b": {2, 10}, "c": {2, 20}},
+		},
+		{
+			name:        "atomic reverts the updates made and starts no more",
+			atomic:      true,
+			parallelism: 1,
+			want:        map[string][2]int32{"a": {2, 10}, "b": {2, 10}, "c": {2, 10}},
+		},
+		{
+			name:        "atomic reverts concurrent updates",
+			atomic:      true,
+			parallelism: 3,
+			want:        map[string][2]int32{"a": {2, 10}, "b": {2, 10}, "c": {2, 10}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := NewFakeHPAClient(newTestHPA("default", "a", 2, 10), newTestHPA("default", "b", 2, 10), newTestHPA("default", "c", 2, 10))
+			client := &failingHPAClient{fake, map[string]bool{"b": true}}
+
+			program := &Hpa{
+				Maximum:  "20",
+				Atomic:   test.atomic,
+				Selector: Selector{All: true, ChunkSize: 500, namespaceName: "default"},
+				Bulk:     Bulk{Parallelism: test.parallelism},
+			}
+
+			err := program.Execute(context.Background(), &Options{}, client)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "HPA b")
+
+			assert.Equal(t, test.want, limitsOf(t, fake))
+
+			if test.atomic {
+				a, err := fake.Get(context.Background(), "default", "a")
+				require.NoError(t, err)
+				assert.NotContains(t, a.Annotations, AnnotationChange, "the change annotation is reverted too")
+
+				reasons := map[string]int{}
+				for _, event := range fake.Events {
+					reasons[event.Reason]++
+				}
+				assert.NotZero(t, reasons["Reverted"])
+				assert.Equal(t, reasons["Modified"], reasons["Reverted"], "every HPA updated is reverted")
+			}
+		})
+	}
+}
+
+func TestGetStrategy(t *testing.T) {
+	tests := []struct {
+		name                     string
+		program                  Hpa
+		minimum, maximum         int32
+		wantMinimum, wantMaximum int32
+		wantTarget               int32
+	}{
+		{name: "cpu target", program: Hpa{CPUTarget: 70}, minimum: 2, maximum: 10, wantMinimum: 2, wantMaximum: 10, wantTarget: 70},
+		{name: "minimum number", program: Hpa{Minimum: "4"}, minimum: 2, maximum: 10, wantMinimum: 4, wantMaximum: 10, wantTarget: 50},
+		{name: "minimum above maximum raises maximum", program: Hpa{Minimum: "12"}, minimum: 2, maximum: 10, wantMinimum: 12, wantMaximum: 12, wantTarget: 50},
+		{name: "minimum percentage of maximum", program: Hpa{Minimum: "25%"}, minimum: 2, maximum: 10, wantMinimum: 3, wantMaximum: 10, wantTarget: 50},
+		{name: "minimum multiplier", program: Hpa{Minimum: "2x"}, minimum: 3, maximum: 10, wantMinimum: 6, wantMaximum: 10, wantTarget: 50},
+		{name: "maximum number", program: Hpa{Maximum: "20"}, minimum: 2, maximum: 10, wantMinimum: 2, wantMaximum: 20, wantTarget: 50},
+		{name: "maximum below minimum lowers minimum", program: Hpa{Maximum: "3"}, minimum: 5, maximum: 10, wantMinimum: 3, wantMaximum: 3, wantTarget: 50},
+		{name: "maximum percentage", program: Hpa{Maximum: "150%"}, minimum: 2, maximum: 10, wantMinimum: 2, wantMaximum: 15, wantTarget: 50},
+		{name: "maximum multiplier", program: Hpa{Maximum: "0.5x"}, minimum: 2, maximum: 10, wantMinimum: 2, wantMaximum: 5, wantTarget: 50},
+		{name: "minimum and maximum", program: Hpa{Minimum: "2x", Maximum: "20"}, minimum: 2, maximum: 10, wantMinimum: 4, wantMaximum: 20, wantTarget: 50},
+		{name: "minimum percentage of the new maximum", program: Hpa{Minimum: "50%", Maximum: "2x"}, minimum: 2, maximum: 10, wantMinimum: 10, wantMaximum: 20, wantTarget: 50},
+		{name: "maximum kept over a relative minimum", program: Hpa{Minimum: "3x", Maximum: "0.5x"}, minimum: 4, maximum: 10, wantMinimum: 5, wantMaximum: 5, wantTarget: 50},
+		{name: "every limit", program: Hpa{CPUTarget: 60, Minimum: "3", Maximum: "150%"}, minimum: 2, maximum: 10, wantMinimum: 3, wantMaximum: 15, wantTarget: 60},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			update, err := test.program.getStrategy()
+			require.NoError(t, err)
+
+			hpa := newTestHPA("default", "web", test.minimum, test.maximum)
+			require.NoError(t, update(&hpa))
+
+			assert.Equal(t, test.wantMinimum, *hpa.Spec.MinReplicas, "minimum")
+			assert.Equal(t, test.wantMaximum, hpa.Spec.MaxReplicas, "maximum")
+			assert.Equal(t, test.wantTarget, *hpa.Spec.TargetCPUUtilizationPercentage, "target")
+		})
+	}
+
+	for _, invalid := range []Hpa{{}, {Minimum: "lots"}, {Maximum: "-2"}, {Minimum: "20", Maximum: "10"}} {
+		_, err := invalid.getStrategy()
+		assert.Equal(t, ExitUsage, ExitCode(err), "%+v is a usage error", invalid)
+	}
+}
+
+// conflictingHPAClient changes the HPA behind the caller's back before the first patches, so they fail with a conflict
+type conflictingHPAClient struct {
+	*FakeHPAClient
+	conflicts int
+	change    func(hpa *v1.HorizontalPodAutoscaler)
+	patches   int
+}
+
+func (c *conflictingHPAClient) Patch(ctx context.Context, namespace, name string, patchType types.PatchType, data []byte) (*v1.HorizontalPodAutoscaler, error) {
+	c.patches++
+	if c.conflicts > 0 {
+		c.conflicts--
+		current, err := c.FakeHPAClient.Get(ctx, namespace, name)
+		if err != nil {
+			return nil, err
+		}
+		c.change(current)
+		if _, err := c.FakeHPAClient.Update(ctx, current); err != nil {
+			return nil, err
+		}
+	}
+	return c.FakeHPAClient.Patch(ctx, namespace, name, patchType, data)
+}
+
+func TestModifyHPA(t *testing.T) {
+	double := func(hpa *v1.HorizontalPodAutoscaler) error {
+		hpa.Spec.MaxReplicas *= 2
+		return nil
+	}
+
+	tests := []struct {
+		name        string
+		update      strategy
+		dryRun      bool
+		conflicts   int
+		ticket      string
+		wantChanged bool
+		wantMaximum int32
+		wantChange  string
+		wantEvents  int
+	}{
+		{name: "changes the HPA", update: double, wantChanged: true, wantMaximum: 20, wantChange: "replicas 2/10 -> 2/20", wantEvents: 1},
+		{name: "records the ticket", update: double, ticket: "OPS-1", wantChanged: true, wantMaximum: 20, wantChange: "replicas 2/10 -> 2/20 (ticket OPS-1)", wantEvents: 1},
+		{name: "dry run changes nothing", update: double, dryRun: true, wantChanged: true, wantMaximum: 10},
+		{name: "no change makes no update", update: func(hpa *v1.HorizontalPodAutoscaler) error { return nil }, wantMaximum: 10},
+		{name: "conflict reapplies the strategy to the current values", update: double, conflicts: 1, wantChanged: true, wantMaximum: 24, wantChange: "replicas 2/12 -> 2/24", wantEvents: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := NewFakeHPAClient(newTestHPA("default", "web", 2, 10))
+			client := &conflictingHPAClient{FakeHPAClient: fake, conflicts: test.conflicts, change: func(hpa *v1.HorizontalPodAutoscaler) {
+				hpa.Spec.MaxReplicas = 12
+			}}
+
+			hpa, err := fake.Get(context.Background(), "default", "web")
+			require.NoError(t, err)
+
+			changed, err := modifyHPA(context.Background(), &Options{DryRun: test.dryRun}, hpa, test.update, client, test.ticket)
+			require.NoError(t, err)
+			assert.Equal(t, test.wantChanged, changed)
+
+			stored, err := fake.Get(context.Background(), "default", "web")
+			require.NoError(t, err)
+			assert.Equal(t, test.wantMaximum, stored.Spec.MaxReplicas)
+			assert.Equal(t, test.wantChange, stored.Annotations[AnnotationChange])
+			assert.Equal(t, test.ticket, stored.Annotations[AnnotationTicket])
+			assert.Len(t, fake.Events, test.wantEvents)
+		})
+	}
+
+	t.Run("strategy errors are returned", func(t *testing.T) {
+		fake := NewFakeHPAClient(newTestHPA("default", "web", 2, 10))
+		hpa, err := fake.Get(context.Background(), "default", "web")
+		require.NoError(t, err)
+
+		_, err = modifyHPA(context.Background(), &Options{}, hpa, func(hpa *v1.HorizontalPodAutoscaler) error {
+			return errors.New("bad change")
+		}, fake, "")
+		assert.EqualError(t, err, "bad change")
+	})
+}
+
+func TestRevertHPAs(t *testing.T) {
+	original := newTestHPA("default", "web", 2, 10)
+	original.Annotations = map[string]string{"team": "payments"}
+
+	changed := original.DeepCopy()
+	changed.Spec.MaxReplicas = 40
+	*changed.Spec.MinReplicas = 8
+	*changed.Spec.TargetCPUUtilizationPercentage = 80
+	changed.Annotations = map[string]string{"team": "payments", AnnotationChange: "replicas 2/10 -> 8/40"}
+
+	tests := []struct {
+		name         string
+		dryRun       bool
+		originals    []*v1.HorizontalPodAutoscaler
+		wantErr      string
+		wantReverted []string
+		wantMaximum  int32
+	}{
+		{
+			name:         "restores the original values",
+			originals:    []*v1.HorizontalPodAutoscaler{&original},
+			wantReverted: []string{"web"},
+			wantMaximum:  10,
+		},
+		{
+			name:        "dry run changes nothing",
+			dryRun:      true,
+			originals:   []*v1.HorizontalPodAutoscaler{&original},
+			wantMaximum: 40,
+		},
+		{
+			name: "missing HPAs are reported and the rest reverted",
+			originals: func() []*v1.HorizontalPodAutoscaler {
+				gone := newTestHPA("default", "gone", 1, 5)
+				return []*v1.HorizontalPodAutoscaler{&gone, &original}
+			}(),
+			wantErr:      "failed to revert HPA gone",
+			wantReverted: []string{"web"},
+			wantMaximum:  10,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := NewFakeHPAClient(*changed)
+			results := newSummary()
+
+			err := revertHPAs(context.Background(), &Options{DryRun: test.dryRun}, fake, test.originals, results)
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			stored, err := fake.Get(context.Background(), "default", "web")
+			require.NoError(t, err)
+			assert.Equal(t, test.wantMaximum, stored.Spec.MaxReplicas)
+
+			var reverted []string
+			for _, o := range results.sorted() {
+				assert.Equal(t, outcomeReverted, o.Outcome)
+				reverted = append(reverted, o.Name)
+			}
+			assert.Equal(t, test.wantReverted, reverted)
+
+			if len(test.wantReverted) > 0 {
+				assert.Equal(t, int32(2), *stored.Spec.MinReplicas)
+				assert.Equal(t, int32(50), *stored.Spec.TargetCPUUtilizationPercentage)
+				assert.Equal(t, map[string]string{"team": "payments"}, stored.Annotations)
+			}
+		})
+	}
+}
+
+func TestForEachPage(t *testing.T) {
+	var hpas []v1.HorizontalPodAutoscaler
+	for _, key := range []string{"prod/web", "prod/api", "prod/worker", "staging/web", "staging/api"} {
+		namespace, name, _ := strings.Cut(key, "/")
+		hpa := newTestHPA(namespace, name, 1, 5)
+		if name == "web" {
+			hpa.Labels = map[string]string{"tier": "web"}
+		}
+		hpas = append(hpas, hpa)
+	}
+
+	tests := []struct {
+		name      string
+		selector  Selector
+		wantPages [][]string
+	}{
+		{
+			name:      "namespace in pages of the chunk size",
+			selector:  Selector{All: true, ChunkSize: 2, namespaceName: "prod"},
+			wantPages: [][]string{{"prod/api", "prod/web"}, {"prod/worker"}},
+		},
+		{
+			name:      "all namespaces",
+			selector:  Selector{All: true, AllNamespaces: true, ChunkSize: 500},
+			wantPages: [][]string{{"prod/api", "prod/web", "prod/worker", "staging/api", "staging/web"}},
+		},
+		{
+			name:      "labels",
+			selector:  Selector{Labels: map[string]string{"tier": "web"}, AllNamespaces: true, ChunkSize: 500},
+			wantPages: [][]string{{"prod/web", "staging/web"}},
+		},
+		{
+			name:      "names are fetched and missing ones skipped",
+			selector:  Selector{Names: []string{"worker", "missing", "api"}, ChunkSize: 500, namespaceName: "prod"},
+			wantPages: [][]string{{"prod/api", "prod/worker"}},
+		},
+		{
+			name:      "names in all namespaces",
+			selector:  Selector{Names: []string{"web"}, AllNamespaces: true, ChunkSize: 2},
+			wantPages: [][]string{{"prod/web"}, {}, {"staging/web"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var pages [][]string
+			err := test.selector.forEachPage(context.Background(), NewFakeHPAClient(hpas...), func(page []v1.HorizontalPodAutoscaler) error {
+				names := []string{}
+				for _, hpa := range page {
+					names = append(names, hpa.Namespace+"/"+hpa.Name)
+				}
+				pages = append(pages, names)
+				return nil
+			})
+			require.NoError(t, err)
+			assert.Equal(t, test.wantPages, pages)
+		})
+	}
+
+	t.Run("errors from the callback stop the listing", func(t *testing.T) {
+		selector := Selector{All: true, AllNamespaces: true, ChunkSize: 1}
+		calls := 0
+		err := selector.forEachPage(context.Background(), NewFakeHPAClient(hpas...), func(page []v1.HorizontalPodAutoscaler) error {
+			calls++
+			return errors.New("stop")
+		})
+		assert.EqualError(t, err, "stop")
+		assert.Equal(t, 1, calls)
+	})
+}
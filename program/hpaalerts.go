@@ -0,0 +1,192 @@
+package program
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/autoscaling/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// HpaAlerts writes Prometheus alerting rules for the selected HPAs, so alert coverage follows the HPA inventory when
+// it is regenerated: an HPA at its maximum, one whose replicas are limited by its bounds, and one which cannot fetch
+// its metrics or scale its target.  The rules use the metrics of kube-state-metrics or of "hpa export".
+type HpaAlerts struct {
+	Metrics    string        `default:"kube-state-metrics" enum:"kube-state-metrics,k8sutils" help:"Metrics the rules use (kube-state-metrics, or k8sutils for hpa export)"`
+	Format     string        `default:"prometheusrule" enum:"prometheusrule,rules" help:"Write a prometheus-operator PrometheusRule or a plain rules file"`
+	Name       string        `default:"k8sutils-hpa-alerts" help:"Name of the PrometheusRule"`
+	Output     string        `short:"o" help:"File to write the rules to (default standard output)"`
+	Severity   string        `default:"warning" help:"Severity label of the at-max and scaling-limited alerts"`
+	Critical   string        `default:"critical" help:"Severity label of the alert for HPAs unable to scale"`
+	AtMaxFor   time.Duration `default:"10m" help:"How long an HPA must be at its maximum before alerting"`
+	LimitedFor time.Duration `default:"30m" help:"How long an HPA must be limited by its bounds before alerting"`
+	FailingFor time.Duration `default:"5m" help:"How long an HPA must be unable to fetch metrics or scale before alerting"`
+
+	Selector `embed:"" set:"resources=HPAs"`
+}
+
+// alertRule is a Prometheus alerting rule
+type alertRule struct {
+	Alert       string            `json:"alert"`
+	Expr        string            `json:"expr"`
+	For         string            `json:"for"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// ruleGroup is a group of rules, one for each namespace
+type ruleGroup struct {
+	Name  string      `json:"name"`
+	Rules []alertRule `json:"rules"`
+}
+
+// hpaAlertExprs are the expressions of each alert for each source of metrics, given the matchers selecting an HPA
+var hpaAlertExprs = map[string]map[string]func(matchers string) string{
+	"kube-state-metrics": {
+		"HpaAtMaxReplicas": func(m string) string {
+			return fmt.Sprintf("kube_horizontalpodautoscaler_status_current_replicas{%s} >= kube_horizontalpodautoscaler_spec_max_replicas{%s}", m, m)
+		},
+		"HpaScalingLimited": func(m string) string {
+			return fmt.Sprintf(`kube_horizontalpodautoscaler_status_condition{%s,condition="ScalingLimited",status="true"} == 1`, m)
+		},
+		"HpaUnableToScale": func(m string) string {
+			return fmt.Sprintf(`kube_horizontalpodautoscaler_status_condition{%s,condition=~"AbleToScale|ScalingActive",status="false"} == 1`, m)
+		},
+	},
+	"k8sutils": {
+		"HpaAtMaxReplicas": func(m string) string {
+			return fmt.Sprintf("%sat_max{%s} == 1", metricPrefix, m)
+		},
+		"HpaScalingLimited": func(m string) string {
+			return fmt.Sprintf("%sscaling_limited{%s} == 1", metricPrefix, m)
+		},
+		"HpaUnableToScale": func(m string) string {
+			return fmt.Sprintf("%sable_to_scale{%s} == 0", metricPrefix, m)
+		},
+	},
+}
+
+func (program *HpaAlerts) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	hpas, err := program.getHpas(ctx, WithRetries(NewHPAClient(clientset), options.Retries))
+	if err != nil {
+		return err
+	}
+
+	groups := program.ruleGroups(hpas)
+
+	var document any = map[string]any{"groups": groups}
+	if program.Format == "prometheusrule" {
+		metadata := map[string]any{"name": program.Name, "labels": map[string]string{"app.kubernetes.io/managed-by": "k8sutils"}}
+		if !program.AllNamespaces {
+			metadata["namespace"] = program.namespaceName
+		}
+		document = map[string]any{
+			"apiVersion": "monitoring.coreos.com/v1",
+			"kind":       "PrometheusRule",
+			"metadata":   metadata,
+			"spec":       map[string]any{"groups": groups},
+		}
+	}
+
+	data, err := yaml.Marshal(document)
+	if err != nil {
+		return err
+	}
+
+	if program.Output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	if err := os.WriteFile(program.Output, data, 0o644); err != nil {
+		return err
+	}
+
+	log.Info().Str("file", program.Output).Int("hpas", len(hpas)).Int("groups", len(groups)).Msg("Wrote alerting rules")
+
+	return nil
+}
+
+// ruleGroups makes a group for each namespace with the alerts for each of its HPAs
+func (program *HpaAlerts) ruleGroups(hpas []v1.HorizontalPodAutoscaler) []ruleGroup {
+	exprs := hpaAlertExprs[program.Metrics]
+
+	hpaLabel := "horizontalpodautoscaler"
+	if program.Metrics == "k8sutils" {
+		hpaLabel = "hpa"
+	}
+
+	var groups []ruleGroup
+	for _, hpa := range hpas {
+		if len(groups) == 0 || groups[len(groups)-1].Name != "hpa-"+hpa.Namespace {
+			groups = append(groups, ruleGroup{Name: "hpa-" + hpa.Namespace})
+		}
+		group := &groups[len(groups)-1]
+
+		matchers := fmt.Sprintf("namespace=%s,%s=%s", labelValue(hpa.Namespace), hpaLabel, labelValue(hpa.Name))
+		labels := func(severity string) map[string]string {
+			return map[string]string{"severity": severity, "namespace": hpa.Namespace, "hpa": hpa.Name}
+		}
+		name := hpa.Namespace + "/" + hpa.Name
+
+		group.Rules = append(group.Rules,
+			alertRule{
+				Alert:  "HpaAtMaxReplicas",
+				Expr:   exprs["HpaAtMaxReplicas"](matchers),
+				For:    promDuration(program.AtMaxFor),
+				Labels: labels(program.Severity),
+				Annotations: map[string]string{
+					"summary":     fmt.Sprintf("HPA %s has been at its maximum of %d replicas for %s", name, hpa.Spec.MaxReplicas, promDuration(program.AtMaxFor)),
+					"description": fmt.Sprintf("%s %s cannot scale further; raise the maximum or check its load.", hpa.Spec.ScaleTargetRef.Kind, hpa.Spec.ScaleTargetRef.Name),
+				},
+			},
+			alertRule{
+				Alert:  "HpaScalingLimited",
+				Expr:   exprs["HpaScalingLimited"](matchers),
+				For:    promDuration(program.LimitedFor),
+				Labels: labels(program.Severity),
+				Annotations: map[string]string{
+					"summary": fmt.Sprintf("HPA %s wants more or fewer replicas than its bounds allow", name),
+				},
+			},
+			alertRule{
+				Alert:  "HpaUnableToScale",
+				Expr:   exprs["HpaUnableToScale"](matchers),
+				For:    promDuration(program.FailingFor),
+				Labels: labels(program.Critical),
+				Annotations: map[string]string{
+					"summary":     fmt.Sprintf("HPA %s cannot fetch its metrics or scale its target", name),
+					"description": "Run k8sutils hpa conditions to see the controller's message.",
+				},
+			},
+		)
+	}
+
+	return groups
+}
+
+// promDuration formats a duration the way Prometheus rules usually write them, e.g. "10m" rather than "10m0s"
+func promDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
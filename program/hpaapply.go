@@ -0,0 +1,220 @@
+package program
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	v2 "k8s.io/api/autoscaling/v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// HpaApply applies the HPA manifests in a file or directory, such as those written by "hpa manifests", with server-side
+// apply as this tool's field manager.  The differences from the cluster are shown first and only the HPAs which differ
+// are applied.  Fields set by another field manager, e.g. kubectl, are only taken over with --force-conflicts.
+type HpaApply struct {
+	Filename       string `short:"f" required:"" type:"path" help:"File or directory of YAML or JSON manifests, searched recursively"`
+	ForceConflicts bool   `help:"Take over fields another field manager set, rather than failing"`
+	OverrideLock   bool   `help:"Apply to HPAs even if they are locked"`
+	Yes            bool   `short:"y" help:"Apply without asking for confirmation"`
+}
+
+func (program *HpaApply) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := options.Clientset()
+	if err != nil {
+		return err
+	}
+
+	manifests, err := readHpaManifests(program.Filename, "")
+	if err != nil {
+		return usageError("reading manifests: %v", err)
+	}
+	if len(manifests) == 0 {
+		return usageError("no HPA manifests in %s", program.Filename)
+	}
+
+	// The namespace of the context is only needed for manifests which do not give their own
+	if err := defaultNamespace(options, manifests); err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	declared := hpaColumn{label: "MANIFESTS", settings: map[string]map[string]string{}}
+	cluster := hpaColumn{label: "CLUSTER", settings: map[string]map[string]string{}}
+	var changed []*v2.HorizontalPodAutoscaler
+	// lives are the HPAs in the cluster before they are applied to, for the published events
+	lives := map[string]*v2.HorizontalPodAutoscaler{}
+	results := newSummary()
+
+	for i := range manifests {
+		hpa := &manifests[i]
+		key := hpa.Namespace + "/" + hpa.Name
+
+		live, err := clientset.AutoscalingV2().HorizontalPodAutoscalers(hpa.Namespace).Get(ctx, hpa.Name, metav1.GetOptions{})
+		switch {
+		case apierrors.IsNotFound(err):
+			live = nil
+		case err != nil:
+			return apiError(err)
+		}
+
+		if live != nil && !program.OverrideLock {
+			if _, locked := live.Annotations[AnnotationLocked]; locked {
+				log.Warn().Str("namespace", hpa.Namespace).Str("hpa", hpa.Name).Msg("Skipping locked HPA, use --override-lock to apply to it")
+				results.record(hpa.Namespace, hpa.Name, outcomeSkipped, "locked: "+live.Annotations[AnnotationLocked])
+				continue
+			}
+		}
+
+		want := appliedSettings(hpa, hpa)
+		if live != nil {
+			have := withoutDefaults(appliedSettings(live, hpa), want)
+			if equalSettings(have, want) {
+				continue
+			}
+			cluster.settings[key] = have
+			lives[key] = live
+		}
+		declared.settings[key] = want
+		changed = append(changed, hpa)
+	}
+
+	if len(changed) == 0 {
+		log.Info().Int("manifests", len(manifests)).Msg("The HPAs match the manifests, nothing to apply")
+		results.print()
+		return nil
+	}
+
+	printHpaComparison([]hpaColumn{cluster, declared}, false)
+
+	if !options.DryRun && !program.Yes && !confirm(fmt.Sprintf("Apply these %d HPAs?", len(changed))) {
+		return usageError("not confirmed, use --yes to apply without asking")
+	}
+
+	return options.runAsLeader(ctx, clientset, func(ctx context.Context) error {
+		defer results.print()
+
+		failed := 0
+		for _, hpa := range changed {
+			outcome := "applied"
+			if _, ok := cluster.settings[hpa.Namespace+"/"+hpa.Name]; !ok {
+				outcome = "created"
+			}
+
+			saved, err := program.apply(ctx, clientset, hpa, options.DryRun)
+			if err != nil {
+				failed++
+				log.Error().Err(err).Str("namespace", hpa.Namespace).Str("hpa", hpa.Name).Msg("Failed to apply HPA")
+				results.record(hpa.Namespace, hpa.Name, outcomeFailed, err.Error())
+				continue
+			}
+
+			if options.DryRun {
+				outcome = "dry run: " + outcome
+			} else if saved != nil {
+				event := &busEvent{Type: busApplied, Namespace: hpa.Namespace, HPA: hpa.Name, To: busStateV2(saved), Message: "k8sutils " + outcome + " the HPA from a manifest"}
+				if live := lives[hpa.Namespace+"/"+hpa.Name]; live != nil {
+					event.From = busStateV2(live)
+				}
+				publishEvent(event)
+			}
+			results.record(hpa.Namespace, hpa.Name, outcomeUpdated, outcome)
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("failed to apply %d of %d HPAs", failed, len(changed))
+		}
+		return nil
+	})
+}
+
+// defaultNamespace puts the manifests which do not give a namespace in the namespace of the context
+func defaultNamespace(options *Options, manifests []v2.HorizontalPodAutoscaler) error {
+	var namespace string
+	for i := range manifests {
+		if manifests[i].Namespace != "" {
+			continue
+		}
+		if namespace == "" {
+			var err error
+			if namespace, err = options.ResolveNamespace(); err != nil {
+				return err
+			}
+		}
+		manifests[i].Namespace = namespace
+	}
+	return nil
+}
+
+// apply sends the manifest as a server-side apply patch.  In a dry run the API server checks the patch, including for
+// conflicts, without saving it.  It returns the HPA as saved.
+func (program *HpaApply) apply(ctx context.Context, clientset kubernetes.Interface, hpa *v2.HorizontalPodAutoscaler, dryRun bool) (*v2.HorizontalPodAutoscaler, error) {
+	manifest, err := runtime.DefaultUnstructuredConverter.ToUnstructured(hpa)
+	if err != nil {
+		return nil, err
+	}
+	delete(manifest, "status")
+	if metadata, ok := manifest["metadata"].(map[string]any); ok {
+		// Fields of a manifest exported with kubectl get which the API server sets, or would reject
+		for _, field := range []string{"creationTimestamp", "resourceVersion", "uid", "generation", "managedFields"} {
+			delete(metadata, field)
+		}
+	}
+	manifest["apiVersion"] = v2.SchemeGroupVersion.String()
+	manifest["kind"] = "HorizontalPodAutoscaler"
+
+	patch, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	force := program.ForceConflicts
+	patchOptions := metav1.PatchOptions{FieldManager: FieldManager, Force: &force}
+	if dryRun {
+		patchOptions.DryRun = []string{metav1.DryRunAll}
+	}
+
+	log.Debug().Str("namespace", hpa.Namespace).Str("hpa", hpa.Name).RawJSON("patch", patch).Msg("Applying HPA")
+
+	saved, err := clientset.AutoscalingV2().HorizontalPodAutoscalers(hpa.Namespace).Patch(ctx, hpa.Name, types.ApplyPatchType, patch, patchOptions)
+	if apierrors.IsConflict(err) {
+		return nil, fmt.Errorf("%w; use --force-conflicts to take the fields over", err)
+	}
+	return saved, apiError(err)
+}
+
+// appliedSettings returns the settings of the HPA which are compared, with the labels and annotations the manifest
+// sets, since server-side apply leaves the others alone
+func appliedSettings(hpa, manifest *v2.HorizontalPodAutoscaler) map[string]string {
+	settings := hpaSettings(hpa)
+	for label := range manifest.Labels {
+		settings["label "+label] = hpa.Labels[label]
+	}
+	for annotation := range manifest.Annotations {
+		settings["annotation "+annotation] = hpa.Annotations[annotation]
+	}
+	return settings
+}
+
+// equalSettings returns true if the settings are the same
+func equalSettings(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for field, value := range a {
+		if other, ok := b[field]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,54 @@
+package program
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDefaultNamespace(t *testing.T) {
+	// A context which does not set a namespace
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	require.NoError(t, os.WriteFile(kubeconfig, []byte(`apiVersion: v1
+kind: Config
+clusters:
+  - name: test
+    cluster: {server: "https://127.0.0.1:6443"}
+contexts:
+  - name: test
+    context: {cluster: test}
+current-context: test
+`), 0o600))
+	t.Setenv("KUBECONFIG", kubeconfig)
+
+	manifest := func(namespace, name string) v2.HorizontalPodAutoscaler {
+		return v2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+	}
+
+	t.Run("every manifest has a namespace", func(t *testing.T) {
+		manifests := []v2.HorizontalPodAutoscaler{manifest("payments", "web"), manifest("checkout", "api")}
+		require.NoError(t, defaultNamespace(&Options{}, manifests))
+		assert.Equal(t, "payments", manifests[0].Namespace)
+		assert.Equal(t, "checkout", manifests[1].Namespace)
+	})
+
+	t.Run("manifests without a namespace", func(t *testing.T) {
+		manifests := []v2.HorizontalPodAutoscaler{manifest("payments", "web"), manifest("", "api")}
+		options := &Options{}
+		options.Namespace = "staging"
+		require.NoError(t, defaultNamespace(options, manifests))
+		assert.Equal(t, "payments", manifests[0].Namespace)
+		assert.Equal(t, "staging", manifests[1].Namespace)
+	})
+
+	t.Run("no namespace to default to", func(t *testing.T) {
+		manifests := []v2.HorizontalPodAutoscaler{manifest("", "api")}
+		err := defaultNamespace(&Options{}, manifests)
+		assert.Equal(t, ExitUsage, ExitCode(err))
+	})
+}
@@ -0,0 +1,100 @@
+package program
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	v2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// HpaCheck exits with an error if any selected HPA is saturated or unhealthy, so a cron job or CI pipeline can warn
+// before a service runs out of room to scale.  Nothing is printed for HPAs which pass.
+type HpaCheck struct {
+	FailOn []string `default:"at-max,scaling-limited,unhealthy" enum:"at-max,scaling-limited,unhealthy" help:"Conditions which fail the check (at-max, scaling-limited, unhealthy)"`
+
+	Selector `embed:"" set:"resources=HPAs"`
+}
+
+func (program *HpaCheck) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	// The v2 API reports the HPA conditions the check needs
+	selector := program.Selector
+	hpas, err := getHpasV2(ctx, clientset, &selector)
+	if err != nil {
+		return err
+	}
+
+	failOn := map[string]bool{}
+	for _, condition := range program.FailOn {
+		failOn[condition] = true
+	}
+
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "HPA", "REPLICAS", "FAILED"})
+	failed := 0
+
+	for i := range hpas {
+		hpa := &hpas[i]
+
+		problems := hpaCheckProblems(hpa, failOn)
+		if len(problems) == 0 {
+			continue
+		}
+
+		failed++
+		t.AppendRow(table.Row{
+			hpa.Namespace,
+			hpa.Name,
+			fmt.Sprintf("%d/%d", hpa.Status.CurrentReplicas, hpa.Spec.MaxReplicas),
+			paint(text.FgRed, strings.Join(problems, ", ")),
+		})
+	}
+
+	if failed == 0 {
+		log.Info().Int("hpas", len(hpas)).Strs("fail_on", program.FailOn).Msg("All HPAs passed the check")
+		return nil
+	}
+
+	t.Render()
+
+	return fmt.Errorf("%d of %d HPAs failed the check", failed, len(hpas))
+}
+
+// hpaCheckProblems returns which of the conditions being checked the HPA meets
+func hpaCheckProblems(hpa *v2.HorizontalPodAutoscaler, failOn map[string]bool) []string {
+	var problems []string
+
+	if failOn["at-max"] && hpa.Status.CurrentReplicas >= hpa.Spec.MaxReplicas {
+		problems = append(problems, "at-max")
+	}
+
+	if failOn["scaling-limited"] {
+		for _, condition := range hpa.Status.Conditions {
+			if condition.Type == v2.ScalingLimited && condition.Status == corev1.ConditionTrue {
+				problems = append(problems, "scaling-limited: "+condition.Reason)
+			}
+		}
+	}
+
+	if failOn["unhealthy"] {
+		if condition := failingCondition(hpa.Status.Conditions); condition != nil {
+			problems = append(problems, "unhealthy: "+condition.Reason)
+		}
+	}
+
+	return problems
+}
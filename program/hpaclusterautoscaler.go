@@ -0,0 +1,319 @@
+package program
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+)
+
+// HpaClusterAutoscaler puts the HPAs which want more pods beside the cluster autoscaler's node groups and its recent
+// events, so "the HPA wants pods but nodes can't appear" can be diagnosed in one place: HPAs near their maximum or
+// with pending pods, the node groups at their maximum size, and the scale ups which failed.
+type HpaClusterAutoscaler struct {
+	NearMax         int32  `default:"90" help:"Show HPAs whose replicas are at least this percentage of their maximum"`
+	StatusNamespace string `default:"kube-system" help:"Namespace of the cluster autoscaler and its status ConfigMap"`
+	StatusConfigMap string `default:"cluster-autoscaler-status" help:"Name of the cluster autoscaler's status ConfigMap"`
+	Events          int    `default:"10" help:"Number of recent cluster autoscaler events about node groups to show"`
+
+	Selector `embed:"" set:"resources=HPAs"`
+}
+
+// nodeGroup is the state of one node group from the cluster autoscaler's status
+type nodeGroup struct {
+	name             string
+	health           string
+	ready, target    int
+	minSize, maxSize int
+}
+
+// autoscalerSource is the source the cluster autoscaler records its events under
+const autoscalerSource = "cluster-autoscaler"
+
+// The status ConfigMap was human-readable text before cluster autoscaler 1.30, e.g.
+//
+//	Name:        my-node-group
+//	Health:      Healthy (ready=3 unready=0 ... cloudProviderTarget=3 (minSize=1, maxSize=10))
+var (
+	statusGroupName   = regexp.MustCompile(`^\s*Name:\s+(\S+)`)
+	statusGroupHealth = regexp.MustCompile(`^\s*Health:\s+(\w+) \(ready=(\d+).*cloudProviderTarget=(\d+) \(minSize=(\d+), maxSize=(\d+)\)`)
+)
+
+// autoscalerStatus is the YAML status ConfigMap of cluster autoscaler 1.30 and later
+type autoscalerStatus struct {
+	NodeGroups []struct {
+		Name   string `json:"name"`
+		Health struct {
+			Status     string `json:"status"`
+			NodeCounts struct {
+				Registered struct {
+					Ready int `json:"ready"`
+				} `json:"registered"`
+			} `json:"nodeCounts"`
+			CloudProviderTarget int `json:"cloudProviderTarget"`
+			MinSize             int `json:"minSize"`
+			MaxSize             int `json:"maxSize"`
+		} `json:"health"`
+	} `json:"nodeGroups"`
+}
+
+func (program *HpaClusterAutoscaler) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	selector := program.Selector
+	hpas, err := getHpasV2(ctx, clientset, &selector)
+	if err != nil {
+		return err
+	}
+
+	groups, err := program.nodeGroups(ctx, clientset)
+	if err != nil {
+		return err
+	}
+
+	pending, err := program.pendingPods(ctx, clientset)
+	if err != nil {
+		return err
+	}
+
+	// Events about node groups are recorded on the status ConfigMap
+	namespaces := []string{program.namespace()}
+	if !program.AllNamespaces && program.namespaceName != program.StatusNamespace {
+		namespaces = append(namespaces, program.StatusNamespace)
+	}
+	events, err := autoscalerEvents(ctx, clientset, namespaces)
+	if err != nil {
+		return err
+	}
+
+	// The latest event about each pending pod says why the autoscaler did or did not add a node for it
+	podEvents := map[string]*corev1.Event{}
+	for i := range events {
+		e := &events[i]
+		if e.InvolvedObject.Kind == "Pod" {
+			podEvents[e.InvolvedObject.Namespace+"/"+e.InvolvedObject.Name] = e
+		}
+	}
+
+	fmt.Println("HPAs wanting more capacity")
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "HPA", "REPLICAS", "DESIRED", "PENDING", "AUTOSCALER"})
+	wanting := 0
+
+	for i := range hpas {
+		hpa := &hpas[i]
+		ref := hpa.Spec.ScaleTargetRef
+		pods := pending[hpa.Namespace+"/"+ref.Kind+"/"+ref.Name]
+
+		nearMax := hpa.Status.CurrentReplicas*100 >= hpa.Spec.MaxReplicas*program.NearMax
+		if !nearMax && len(pods) == 0 && hpa.Status.DesiredReplicas <= hpa.Status.CurrentReplicas {
+			continue
+		}
+		wanting++
+
+		replicas := fmt.Sprintf("%d/%d", hpa.Status.CurrentReplicas, hpa.Spec.MaxReplicas)
+		if nearMax {
+			replicas = paint(text.FgYellow, replicas)
+		}
+
+		said := "-"
+		for _, pod := range pods {
+			if e, ok := podEvents[hpa.Namespace+"/"+pod]; ok {
+				said = e.Reason + ": " + e.Message
+			}
+		}
+
+		t.AppendRow(table.Row{hpa.Namespace, hpa.Name, replicas, strconv.Itoa(int(hpa.Status.DesiredReplicas)), strconv.Itoa(len(pods)), said})
+	}
+	t.Render()
+
+	fmt.Println()
+	fmt.Println("Node groups")
+	g := newTable()
+	g.AppendHeader(table.Row{"NODE GROUP", "HEALTH", "READY", "TARGET", "MIN", "MAX"})
+	atMax := 0
+	for _, group := range groups {
+		target := strconv.Itoa(group.target)
+		if group.target >= group.maxSize {
+			atMax++
+			target = paint(text.FgRed, target+" (at max)")
+		}
+		health := group.health
+		if health != "Healthy" {
+			health = paint(text.FgRed, health)
+		}
+		g.AppendRow(table.Row{group.name, health, strconv.Itoa(group.ready), target, strconv.Itoa(group.minSize), strconv.Itoa(group.maxSize)})
+	}
+	g.Render()
+
+	fmt.Println()
+	fmt.Println("Recent cluster autoscaler events")
+	e := newTable()
+	e.AppendHeader(table.Row{"AGE", "TYPE", "OBJECT", "REASON", "MESSAGE"})
+	now := time.Now()
+	shown := 0
+	for i := len(events) - 1; i >= 0 && shown < program.Events; i-- {
+		event := &events[i]
+		if event.InvolvedObject.Kind == "Pod" {
+			continue
+		}
+		shown++
+
+		kind := event.Type
+		if kind == corev1.EventTypeWarning {
+			kind = paint(text.FgYellow, kind)
+		}
+		e.AppendRow(table.Row{
+			duration.HumanDuration(now.Sub(eventTime(event))),
+			kind,
+			event.InvolvedObject.Kind + "/" + event.InvolvedObject.Name,
+			event.Reason,
+			event.Message,
+		})
+	}
+	e.Render()
+
+	if wanting > 0 && atMax > 0 {
+		log.Warn().Int("hpas", wanting).Int("node_groups", atMax).Msg("HPAs want capacity while node groups are at their maximum size")
+	}
+
+	return nil
+}
+
+// nodeGroups reads the node groups from the cluster autoscaler's status ConfigMap.  A cluster without the cluster
+// autoscaler, or where the status is not readable, just has no node groups to show.
+func (program *HpaClusterAutoscaler) nodeGroups(ctx context.Context, clientset kubernetes.Interface) ([]nodeGroup, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(program.StatusNamespace).Get(ctx, program.StatusConfigMap, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) || apierrors.IsForbidden(err) {
+			log.Warn().Err(err).Msg("Cluster autoscaler status is not available, not showing node groups")
+			return nil, nil
+		}
+		return nil, apiError(err)
+	}
+
+	groups := parseAutoscalerStatus(cm.Data["status"])
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].name < groups[j].name
+	})
+
+	return groups, nil
+}
+
+// parseAutoscalerStatus reads the node groups from either form of the status
+func parseAutoscalerStatus(status string) []nodeGroup {
+	var result []nodeGroup
+
+	var parsed autoscalerStatus
+	if err := yaml.NewYAMLOrJSONDecoder(bytes.NewReader([]byte(status)), 4096).Decode(&parsed); err == nil && len(parsed.NodeGroups) > 0 {
+		for _, g := range parsed.NodeGroups {
+			result = append(result, nodeGroup{
+				name:    g.Name,
+				health:  g.Health.Status,
+				ready:   g.Health.NodeCounts.Registered.Ready,
+				target:  g.Health.CloudProviderTarget,
+				minSize: g.Health.MinSize,
+				maxSize: g.Health.MaxSize,
+			})
+		}
+		return result
+	}
+
+	name := ""
+	for _, line := range bytes.Split([]byte(status), []byte("\n")) {
+		if match := statusGroupName.FindSubmatch(line); match != nil {
+			name = string(match[1])
+			continue
+		}
+		if match := statusGroupHealth.FindSubmatch(line); match != nil && name != "" {
+			number := func(i int) int {
+				n, _ := strconv.Atoi(string(match[i]))
+				return n
+			}
+			result = append(result, nodeGroup{
+				name:    name,
+				health:  string(match[1]),
+				ready:   number(2),
+				target:  number(3),
+				minSize: number(4),
+				maxSize: number(5),
+			})
+			name = ""
+		}
+	}
+
+	return result
+}
+
+// pendingPods returns the names of the pending pods of each workload, keyed "namespace/Kind/name"
+func (program *HpaClusterAutoscaler) pendingPods(ctx context.Context, clientset kubernetes.Interface) (map[string][]string, error) {
+	list, err := clientset.CoreV1().Pods(program.namespace()).List(ctx, metav1.ListOptions{FieldSelector: "status.phase=Pending"})
+	if err != nil {
+		return nil, apiError(err)
+	}
+
+	owners := newOwnerResolver(clientset)
+	result := map[string][]string{}
+	for i := range list.Items {
+		pod := &list.Items[i]
+		kind, name, err := owners.workload(ctx, pod)
+		if err != nil {
+			return nil, err
+		}
+		if kind == "" {
+			continue
+		}
+		key := pod.Namespace + "/" + kind + "/" + name
+		result[key] = append(result[key], pod.Name)
+	}
+
+	return result, nil
+}
+
+// autoscalerEvents returns the cluster autoscaler's events in the namespaces, oldest first
+func autoscalerEvents(ctx context.Context, clientset kubernetes.Interface, namespaces []string) ([]corev1.Event, error) {
+	var events []corev1.Event
+	for _, namespace := range namespaces {
+		list, err := clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{FieldSelector: "source=" + autoscalerSource})
+		if err != nil {
+			return nil, apiError(err)
+		}
+		events = append(events, list.Items...)
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return eventTime(&events[i]).Before(eventTime(&events[j]))
+	})
+
+	return events, nil
+}
+
+// eventTime returns when the event last happened
+func eventTime(event *corev1.Event) time.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	return event.EventTime.Time
+}
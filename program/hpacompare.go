@@ -0,0 +1,291 @@
+package program
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	v2 "k8s.io/api/autoscaling/v2"
+)
+
+// HpaCompare compares HPAs between two namespaces, typically staging and production, or between the same namespace in
+// several clusters, for multi-region consistency audits.  HPAs are matched by name or else by target, and the settings
+// which differ are shown side by side: replica limits, metric targets and scaling behavior.
+type HpaCompare struct {
+	Namespace2 string   `name:"namespace2" xor:"compare" required:"" help:"Namespace to compare with the one selected by --namespace"`
+	Contexts   []string `name:"compare-context" xor:"compare" required:"" help:"Kubeconfig contexts whose HPAs in the selected namespace are compared"`
+	ShowEqual  bool     `help:"Also show the settings which are the same"`
+
+	Labels    map[string]string `short:"l" help:"Label filters to select HPAs"`
+	ChunkSize int64             `default:"500" help:"Number of HPAs to fetch per list request"`
+}
+
+// hpaColumn is one side of a comparison: the settings of each HPA, keyed by the name it is matched under
+type hpaColumn struct {
+	label    string
+	settings map[string]map[string]string
+}
+
+// hpaLeadingSettings are shown first, in this order, with the metrics and behavior after them
+var hpaLeadingSettings = []string{"target", "min", "max"}
+
+func (program *HpaCompare) Run(options *Options) error {
+
+	initColors(options)
+
+	if len(program.Contexts) == 1 {
+		return usageError("give --compare-context at least twice")
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	var labels []string
+	var sides [][]v2.HorizontalPodAutoscaler
+
+	if len(program.Contexts) > 0 {
+		for _, name := range program.Contexts {
+			cluster := options.Kubernetes
+			cluster.Context = name
+
+			hpas, namespace, err := program.getHpas(ctx, &cluster, "")
+			if err != nil {
+				return fmt.Errorf("context %s: %w", name, err)
+			}
+			labels = append(labels, name+"/"+namespace)
+			sides = append(sides, hpas)
+		}
+	} else {
+		for _, namespace := range []string{"", program.Namespace2} {
+			hpas, namespace, err := program.getHpas(ctx, &options.Kubernetes, namespace)
+			if err != nil {
+				return err
+			}
+			labels = append(labels, namespace)
+			sides = append(sides, hpas)
+		}
+	}
+
+	columns := matchHpaColumns(labels, sides)
+	differing := printHpaComparison(columns, program.ShowEqual)
+
+	if differing > 0 {
+		log.Warn().Int("count", differing).Strs("compared", labels).Msg("HPAs which differ")
+	} else {
+		log.Info().Strs("compared", labels).Msg("HPAs match")
+	}
+
+	return nil
+}
+
+// getHpas returns the selected HPAs in the cluster and the namespace they are in, which is the given namespace or else
+// the one selected by the flags and kubeconfig
+func (program *HpaCompare) getHpas(ctx context.Context, cluster *Kubernetes, namespace string) ([]v2.HorizontalPodAutoscaler, string, error) {
+	clientset, err := cluster.Clientset()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if namespace == "" {
+		if namespace, err = cluster.ResolveNamespace(); err != nil {
+			return nil, "", err
+		}
+	}
+
+	selector := Selector{Labels: program.Labels, ChunkSize: program.ChunkSize, namespaceName: namespace}
+	hpas, err := getHpasV2(ctx, clientset, &selector)
+
+	return hpas, namespace, err
+}
+
+// matchHpaColumns builds a column of settings for each list of HPAs.  An HPA is matched to one in an earlier column
+// with the same name, or failing that to one with the same target which has no counterpart in this column yet.
+func matchHpaColumns(labels []string, sides [][]v2.HorizontalPodAutoscaler) []hpaColumn {
+	targets := map[string]string{}
+	var keys []string
+
+	columns := make([]hpaColumn, len(sides))
+	for c, hpas := range sides {
+		columns[c] = hpaColumn{label: labels[c], settings: map[string]map[string]string{}}
+
+		for i := range hpas {
+			hpa := &hpas[i]
+			settings := hpaSettings(hpa)
+
+			key := hpa.Name
+			if _, known := targets[key]; !known {
+				for _, other := range keys {
+					if _, taken := columns[c].settings[other]; !taken && targets[other] == settings["target"] {
+						key = other
+						break
+					}
+				}
+			}
+
+			if _, known := targets[key]; !known {
+				targets[key] = settings["target"]
+				keys = append(keys, key)
+			}
+			columns[c].settings[key] = settings
+		}
+	}
+
+	return columns
+}
+
+// printHpaComparison shows each setting of each HPA side by side, highlighting differences, and returns the number of
+// HPAs which differ.  Only differences are shown unless showEqual is set.
+func printHpaComparison(columns []hpaColumn, showEqual bool) int {
+	names := map[string]bool{}
+	for _, column := range columns {
+		for name := range column.settings {
+			names[name] = true
+		}
+	}
+
+	header := table.Row{"HPA", "SETTING"}
+	for _, column := range columns {
+		header = append(header, column.label)
+	}
+
+	t := newTable()
+	t.AppendHeader(header)
+	differing := 0
+
+	for _, name := range sortedKeys(names) {
+		fields := map[string]bool{}
+		for _, column := range columns {
+			for field := range column.settings[name] {
+				fields[field] = true
+			}
+		}
+
+		different := false
+		for _, field := range orderedSettings(fields) {
+			values := make([]string, len(columns))
+			same := true
+			for c, column := range columns {
+				settings, ok := column.settings[name]
+				switch {
+				case !ok:
+					values[c] = "(no HPA)"
+				case settings[field] == "":
+					values[c] = "-"
+				default:
+					values[c] = settings[field]
+				}
+				if values[c] != values[0] {
+					same = false
+				}
+			}
+
+			if same && !showEqual {
+				continue
+			}
+
+			row := table.Row{name, field}
+			for _, value := range values {
+				if !same {
+					value = paint(text.FgYellow, value)
+				}
+				row = append(row, value)
+			}
+			t.AppendRow(row)
+
+			different = different || !same
+		}
+
+		if different {
+			differing++
+		}
+	}
+
+	t.Render()
+
+	return differing
+}
+
+// orderedSettings returns the setting names with the leading settings first and the rest in alphabetical order
+func orderedSettings(fields map[string]bool) []string {
+	var result []string
+	for _, field := range hpaLeadingSettings {
+		if fields[field] {
+			result = append(result, field)
+			delete(fields, field)
+		}
+	}
+	return append(result, sortedKeys(fields)...)
+}
+
+// hpaSettings returns the settings of an HPA which are compared, as text
+func hpaSettings(hpa *v2.HorizontalPodAutoscaler) map[string]string {
+	ref := hpa.Spec.ScaleTargetRef
+
+	settings := map[string]string{
+		"target": ref.Kind + "/" + ref.Name,
+		"min":    strconv.Itoa(int(max(replicasOf(hpa.Spec.MinReplicas), 1))),
+		"max":    strconv.Itoa(int(hpa.Spec.MaxReplicas)),
+	}
+
+	for _, metric := range hpa.Spec.Metrics {
+		name, target := metricSetting(metric)
+		settings["metric "+name] = target
+	}
+
+	if behavior := hpa.Spec.Behavior; behavior != nil {
+		if behavior.ScaleUp != nil {
+			settings["behavior scaleUp"] = compactJSON(behavior.ScaleUp)
+		}
+		if behavior.ScaleDown != nil {
+			settings["behavior scaleDown"] = compactJSON(behavior.ScaleDown)
+		}
+	}
+
+	return settings
+}
+
+// metricSetting names a metric and describes its target
+func metricSetting(metric v2.MetricSpec) (string, string) {
+	switch {
+	case metric.Resource != nil:
+		return string(metric.Resource.Name), metricTarget(metric.Resource.Target)
+	case metric.ContainerResource != nil:
+		return metric.ContainerResource.Container + "/" + string(metric.ContainerResource.Name), metricTarget(metric.ContainerResource.Target)
+	case metric.Pods != nil:
+		return "pods " + metric.Pods.Metric.Name, metricTarget(metric.Pods.Target)
+	case metric.Object != nil:
+		object := metric.Object.DescribedObject
+		return fmt.Sprintf("object %s/%s %s", object.Kind, object.Name, metric.Object.Metric.Name), metricTarget(metric.Object.Target)
+	case metric.External != nil:
+		return "external " + metric.External.Metric.Name, metricTarget(metric.External.Target)
+	default:
+		return string(metric.Type), "?"
+	}
+}
+
+// metricTarget describes a metric target, e.g. "70%" or "avg 100m"
+func metricTarget(target v2.MetricTarget) string {
+	switch {
+	case target.AverageUtilization != nil:
+		return strconv.Itoa(int(*target.AverageUtilization)) + "%"
+	case target.AverageValue != nil:
+		return "avg " + target.AverageValue.String()
+	case target.Value != nil:
+		return target.Value.String()
+	default:
+		return "-"
+	}
+}
+
+// compactJSON renders a value as single line JSON for display
+func compactJSON(value any) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
@@ -0,0 +1,82 @@
+package program
+
+import (
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	v2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+// HpaConditions lists the HPAs whose conditions say they cannot fetch their metrics or cannot scale their target,
+// with the controller's message.  These failures are otherwise silent until a service fails to scale under load.
+type HpaConditions struct {
+	Selector `embed:"" set:"resources=HPAs"`
+}
+
+func (program *HpaConditions) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	// The v2 API reports the HPA conditions
+	selector := program.Selector
+	hpas, err := getHpasV2(ctx, clientset, &selector)
+	if err != nil {
+		return err
+	}
+
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "HPA", "CONDITION", "REASON", "SINCE", "MESSAGE"})
+	failing := 0
+	now := time.Now()
+
+	for i := range hpas {
+		hpa := &hpas[i]
+
+		// The controller has not looked at an HPA without conditions, e.g. because it was only just created
+		if len(hpa.Status.Conditions) == 0 {
+			failing++
+			t.AppendRow(table.Row{hpa.Namespace, hpa.Name, paint(text.FgYellow, "(none)"), "-", duration.HumanDuration(now.Sub(hpa.CreationTimestamp.Time)), "HPA has not been reconciled"})
+			continue
+		}
+
+		failed := false
+		for _, condition := range hpa.Status.Conditions {
+			if condition.Status != corev1.ConditionFalse || (condition.Type != v2.AbleToScale && condition.Type != v2.ScalingActive) {
+				continue
+			}
+
+			failed = true
+			since := "-"
+			if !condition.LastTransitionTime.IsZero() {
+				since = duration.HumanDuration(now.Sub(condition.LastTransitionTime.Time))
+			}
+			t.AppendRow(table.Row{hpa.Namespace, hpa.Name, paint(text.FgRed, string(condition.Type)), condition.Reason, since, condition.Message})
+		}
+		if failed {
+			failing++
+		}
+	}
+
+	if failing == 0 {
+		log.Info().Int("hpas", len(hpas)).Msg("All HPAs are able to scale")
+		return nil
+	}
+
+	t.Render()
+
+	log.Warn().Int("count", failing).Int("hpas", len(hpas)).Msg("HPAs which cannot fetch metrics or scale")
+
+	return nil
+}
@@ -0,0 +1,200 @@
+package program
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// HpaConflicts finds workloads with more than one autoscaler: several HPAs scaling the same target, or an HPA scaling a
+// workload whose replicas are also set by a GitOps controller or kubectl apply.  Each undoes the other's changes, which
+// shows up as replicas flapping on every sync.
+type HpaConflicts struct {
+	Selector `embed:"" set:"resources=HPAs"`
+}
+
+// replicaManagers are field managers of deployment tools which write the replicas they were given on every sync
+var replicaManagers = []string{"argocd-controller", "argocd-application-controller", "helm", "helm-controller", "kustomize-controller"}
+
+// autoscalerConflict is a workload with competing controllers of its replicas
+type autoscalerConflict struct {
+	namespace string
+	target    string
+	hpas      []string
+	problem   string
+}
+
+func (program *HpaConflicts) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	clients, err := newScaleClients(options, clientset)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	hpas, err := program.getHpas(ctx, WithRetries(NewHPAClient(clientset), options.Retries))
+	if err != nil {
+		return err
+	}
+
+	targets := map[string][]*v1.HorizontalPodAutoscaler{}
+	var keys []string
+	for i := range hpas {
+		hpa := &hpas[i]
+		ref := hpa.Spec.ScaleTargetRef
+		key := hpa.Namespace + "/" + ref.Kind + "/" + ref.Name
+		if _, ok := targets[key]; !ok {
+			keys = append(keys, key)
+		}
+		targets[key] = append(targets[key], hpa)
+	}
+	sort.Strings(keys)
+
+	var conflicts []autoscalerConflict
+	for _, key := range keys {
+		scalers := targets[key]
+		first := scalers[0]
+		ref := first.Spec.ScaleTargetRef
+
+		conflict := autoscalerConflict{namespace: first.Namespace, target: ref.Kind + "/" + ref.Name}
+		for _, hpa := range scalers {
+			conflict.hpas = append(conflict.hpas, hpaName(hpa))
+		}
+
+		var problems []string
+		if len(scalers) > 1 {
+			problems = append(problems, fmt.Sprintf("%d HPAs scale the same target", len(scalers)))
+		}
+
+		managers, err := gitOpsReplicaManagers(ctx, clients, first)
+		if err != nil {
+			return err
+		}
+		if len(managers) > 0 {
+			problems = append(problems, "replicas also set by "+strings.Join(managers, ", "))
+		}
+
+		if len(problems) > 0 {
+			conflict.problem = strings.Join(problems, "; ")
+			conflicts = append(conflicts, conflict)
+		}
+	}
+
+	if len(conflicts) == 0 {
+		log.Info().Int("hpas", len(hpas)).Msg("No conflicting autoscalers found")
+		return nil
+	}
+
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "TARGET", "HPAS", "CONFLICT"})
+	for _, c := range conflicts {
+		t.AppendRow(table.Row{c.namespace, c.target, strings.Join(c.hpas, ", "), paint(text.FgRed, c.problem)})
+	}
+	t.Render()
+
+	log.Warn().Int("count", len(conflicts)).Msg("Workloads with conflicting autoscalers")
+
+	return nil
+}
+
+// hpaName returns the HPA's name, noting the controller which created it, such as a KEDA ScaledObject
+func hpaName(hpa *v1.HorizontalPodAutoscaler) string {
+	if owner := metav1.GetControllerOf(hpa); owner != nil {
+		return fmt.Sprintf("%s (%s %s)", hpa.Name, owner.Kind, owner.Name)
+	}
+	return hpa.Name
+}
+
+// gitOpsReplicaManagers returns the deployment tools which set the replicas of the HPA's target: field managers of
+// known GitOps controllers, server-side apply, or a kubectl apply whose manifest included replicas.  The HPA itself
+// changes replicas through the scale subresource, so those changes are not counted.
+func gitOpsReplicaManagers(ctx context.Context, clients *scaleClients, hpa *v1.HorizontalPodAutoscaler) ([]string, error) {
+	ref := hpa.Spec.ScaleTargetRef
+
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return nil, nil
+	}
+
+	mapping, err := clients.mapper.RESTMapping(schema.GroupKind{Group: gv.Group, Kind: ref.Kind}, gv.Version)
+	if meta.IsNoMatchError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, apiError(err)
+	}
+
+	target, err := clients.metadata.Resource(mapping.Resource).Namespace(hpa.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, apiError(err)
+	}
+
+	found := map[string]bool{}
+	for _, entry := range target.ManagedFields {
+		if entry.Subresource != "" || entry.FieldsV1 == nil || !ownsReplicas(entry.FieldsV1.Raw) {
+			continue
+		}
+		if entry.Operation == metav1.ManagedFieldsOperationApply || isReplicaManager(entry.Manager) {
+			found[entry.Manager] = true
+		}
+	}
+
+	if applied := target.Annotations[corev1.LastAppliedConfigAnnotation]; applied != "" {
+		var manifest struct {
+			Spec struct {
+				Replicas *int32 `json:"replicas"`
+			} `json:"spec"`
+		}
+		if json.Unmarshal([]byte(applied), &manifest) == nil && manifest.Spec.Replicas != nil {
+			found["kubectl apply"] = true
+		}
+	}
+
+	return sortedKeys(found), nil
+}
+
+// ownsReplicas returns true if the managed fields include spec.replicas
+func ownsReplicas(fields []byte) bool {
+	var owned struct {
+		Spec map[string]json.RawMessage `json:"f:spec"`
+	}
+	if err := json.Unmarshal(fields, &owned); err != nil {
+		return false
+	}
+	_, ok := owned.Spec["f:replicas"]
+	return ok
+}
+
+// isReplicaManager returns true if the field manager is a known deployment tool
+func isReplicaManager(manager string) bool {
+	for _, name := range replicaManagers {
+		if manager == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package program
+
+import (
+	"strconv"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// HpaCost estimates what each HPA's workload costs per month now, at its minimum and at its maximum, from the
+// requests of one replica and a price per CPU and per GiB of memory.  Requests rather than usage are priced since they
+// are what the nodes must be sized for.  The default prices are roughly AWS Fargate on-demand rates.
+type HpaCost struct {
+	CPUPrice    float64 `name:"cpu-price" default:"0.04048" help:"Price of one requested CPU per hour"`
+	MemoryPrice float64 `default:"0.004445" help:"Price of one requested GiB of memory per hour"`
+	CSV         bool    `help:"Write the table as CSV for spreadsheets"`
+
+	Selector `embed:"" set:"resources=HPAs"`
+}
+
+// hoursPerMonth is the average number of hours in a month, as used by cloud provider pricing
+const hoursPerMonth = 730
+
+func (program *HpaCost) Run(options *Options) error {
+
+	initColors(options)
+
+	if program.CPUPrice < 0 || program.MemoryPrice < 0 {
+		return usageError("prices must not be negative")
+	}
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	hpas, err := program.getHpas(ctx, WithRetries(NewHPAClient(clientset), options.Retries))
+	if err != nil {
+		return err
+	}
+
+	selector := Selector{AllNamespaces: program.AllNamespaces, ChunkSize: program.ChunkSize, namespaceName: program.namespaceName}
+	templates, err := podTemplates(ctx, clientset, &selector)
+	if err != nil {
+		return err
+	}
+
+	specs := podSpecsByWorkload(templates)
+
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "HPA", "CPU/POD", "MEMORY/POD", "MONTHLY NOW", "MONTHLY AT MIN", "MONTHLY AT MAX"})
+
+	var current, minimum, maximum float64
+	unknown := 0
+
+	for _, hpa := range hpas {
+		ref := hpa.Spec.ScaleTargetRef
+		spec, ok := specs[hpa.Namespace+"/"+ref.Kind+"/"+ref.Name]
+		if !ok {
+			unknown++
+			t.AppendRow(table.Row{hpa.Namespace, hpa.Name, "-", "-", "-", "-", "-"})
+			continue
+		}
+
+		requests := podRequests(&corev1.Pod{Spec: *spec})
+		cpu := requests[corev1.ResourceCPU]
+		memory := requests[corev1.ResourceMemory]
+
+		perReplica := program.monthly(cpu.AsApproximateFloat64(), memory.AsApproximateFloat64()/(1<<30))
+		minReplicas := max(replicasOf(hpa.Spec.MinReplicas), 1)
+
+		current += perReplica * float64(hpa.Status.CurrentReplicas)
+		minimum += perReplica * float64(minReplicas)
+		maximum += perReplica * float64(hpa.Spec.MaxReplicas)
+
+		t.AppendRow(table.Row{
+			hpa.Namespace,
+			hpa.Name,
+			cpu.String(),
+			memory.String(),
+			formatCost(perReplica * float64(hpa.Status.CurrentReplicas)),
+			formatCost(perReplica * float64(minReplicas)),
+			formatCost(perReplica * float64(hpa.Spec.MaxReplicas)),
+		})
+	}
+
+	t.AppendFooter(table.Row{"", "TOTAL", "", "", formatCost(current), formatCost(minimum), formatCost(maximum)})
+
+	if program.CSV {
+		t.RenderCSV()
+	} else {
+		t.Render()
+	}
+
+	if unknown > 0 {
+		log.Warn().Int("count", unknown).Msg("HPAs whose target is not a Deployment or StatefulSet have no cost")
+	}
+
+	return nil
+}
+
+// monthly returns the monthly price of the CPUs and GiB of memory
+func (program *HpaCost) monthly(cpus, gib float64) float64 {
+	return (cpus*program.CPUPrice + gib*program.MemoryPrice) * hoursPerMonth
+}
+
+// formatCost shows a cost to the cent
+func formatCost(cost float64) string {
+	return strconv.FormatFloat(cost, 'f', 2, 64)
+}
@@ -0,0 +1,194 @@
+package program
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/autoscaling/v1"
+)
+
+// HpaDashboard writes a Grafana dashboard for the selected HPAs which charts the metrics served by "hpa export":
+// replicas against the HPA's bounds, and utilization against its target.  Panels are made for each HPA, or for each
+// namespace showing all of its HPAs.
+type HpaDashboard struct {
+	Per    string `default:"hpa" enum:"hpa,namespace" help:"Make panels for each HPA or for each namespace (hpa, namespace)"`
+	Title  string `default:"HPAs" help:"Title of the dashboard"`
+	Output string `short:"o" help:"File to write the dashboard to (default standard output)"`
+
+	Selector `embed:"" set:"resources=HPAs"`
+}
+
+// grafanaDashboard is the part of Grafana's dashboard model which is generated
+type grafanaDashboard struct {
+	Title         string         `json:"title"`
+	SchemaVersion int            `json:"schemaVersion"`
+	Refresh       string         `json:"refresh"`
+	Time          grafanaRange   `json:"time"`
+	Templating    map[string]any `json:"templating"`
+	Panels        []grafanaPanel `json:"panels"`
+}
+
+type grafanaRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type grafanaPanel struct {
+	ID          int             `json:"id"`
+	Type        string          `json:"type"`
+	Title       string          `json:"title"`
+	GridPos     grafanaGridPos  `json:"gridPos"`
+	Datasource  map[string]any  `json:"datasource,omitempty"`
+	Targets     []grafanaTarget `json:"targets,omitempty"`
+	FieldConfig map[string]any  `json:"fieldConfig,omitempty"`
+}
+
+type grafanaGridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type grafanaTarget struct {
+	RefID        string `json:"refId"`
+	Expr         string `json:"expr"`
+	LegendFormat string `json:"legendFormat"`
+}
+
+// grafanaDatasource refers to the dashboard's datasource variable, so the dashboard can be imported into any Grafana
+var grafanaDatasource = map[string]any{"type": "prometheus", "uid": "${datasource}"}
+
+// panelHeight is the height of each chart in Grafana grid units; two charts fill the 24 unit width
+const panelHeight = 8
+
+func (program *HpaDashboard) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	hpas, err := program.getHpas(ctx, WithRetries(NewHPAClient(clientset), options.Retries))
+	if err != nil {
+		return err
+	}
+
+	dashboard := newHpaDashboard(program.Title, program.Per, hpas)
+
+	data, err := json.MarshalIndent(dashboard, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if program.Output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	if err := os.WriteFile(program.Output, data, 0o644); err != nil {
+		return err
+	}
+
+	log.Info().Str("file", program.Output).Int("hpas", len(hpas)).Int("panels", len(dashboard.Panels)).Msg("Wrote dashboard")
+
+	return nil
+}
+
+// newHpaDashboard lays out a row for each HPA or namespace with its replicas and utilization charts side by side
+func newHpaDashboard(title, per string, hpas []v1.HorizontalPodAutoscaler) grafanaDashboard {
+	dashboard := grafanaDashboard{
+		Title:         title,
+		SchemaVersion: 39,
+		Refresh:       "1m",
+		Time:          grafanaRange{From: "now-6h", To: "now"},
+		Templating: map[string]any{"list": []map[string]any{{
+			"name":  "datasource",
+			"label": "Datasource",
+			"type":  "datasource",
+			"query": "prometheus",
+		}}},
+	}
+
+	// Each row is titled, and its charts select series with the matchers
+	type row struct {
+		title, legend, matchers string
+	}
+
+	var rows []row
+	if per == "namespace" {
+		namespaces := map[string]bool{}
+		for _, hpa := range hpas {
+			namespaces[hpa.Namespace] = true
+		}
+		for _, namespace := range sortedKeys(namespaces) {
+			rows = append(rows, row{namespace, "{{hpa}} ", fmt.Sprintf("namespace=%s", labelValue(namespace))})
+		}
+	} else {
+		for _, hpa := range hpas {
+			rows = append(rows, row{hpa.Namespace + "/" + hpa.Name, "", fmt.Sprintf("namespace=%s,hpa=%s", labelValue(hpa.Namespace), labelValue(hpa.Name))})
+		}
+	}
+
+	id := 0
+	y := 0
+	for _, r := range rows {
+		id++
+		dashboard.Panels = append(dashboard.Panels, grafanaPanel{ID: id, Type: "row", Title: r.title, GridPos: grafanaGridPos{H: 1, W: 24, Y: y}})
+		y++
+
+		series := func(metric, legend string) grafanaTarget {
+			return grafanaTarget{Expr: fmt.Sprintf("%s%s{%s}", metricPrefix, metric, r.matchers), LegendFormat: r.legend + legend}
+		}
+
+		id++
+		dashboard.Panels = append(dashboard.Panels, grafanaPanel{
+			ID:         id,
+			Type:       "timeseries",
+			Title:      "Replicas",
+			GridPos:    grafanaGridPos{H: panelHeight, W: 12, X: 0, Y: y},
+			Datasource: grafanaDatasource,
+			Targets: refIDs(
+				series("current_replicas", "current"),
+				series("desired_replicas", "desired"),
+				series("min_replicas", "min"),
+				series("max_replicas", "max"),
+			),
+			FieldConfig: map[string]any{"defaults": map[string]any{"min": 0, "decimals": 0}},
+		})
+
+		id++
+		dashboard.Panels = append(dashboard.Panels, grafanaPanel{
+			ID:         id,
+			Type:       "timeseries",
+			Title:      "Utilization",
+			GridPos:    grafanaGridPos{H: panelHeight, W: 12, X: 12, Y: y},
+			Datasource: grafanaDatasource,
+			Targets: refIDs(
+				series("current_utilization_percent", "{{resource}} current"),
+				series("target_utilization_percent", "{{resource}} target"),
+			),
+			FieldConfig: map[string]any{"defaults": map[string]any{"min": 0, "unit": "percent"}},
+		})
+
+		y += panelHeight
+	}
+
+	return dashboard
+}
+
+// refIDs names the queries of a panel A, B, C and so on
+func refIDs(targets ...grafanaTarget) []grafanaTarget {
+	for i := range targets {
+		targets[i].RefID = string(rune('A' + i))
+	}
+	return targets
+}
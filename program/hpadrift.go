@@ -0,0 +1,242 @@
+package program
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/autoscaling/v1"
+	v2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// HpaDrift compares the live HPAs with the manifests in a directory, such as a GitOps repository, matching them by
+// namespace and name.  It reports HPAs which exist only in one place and settings which differ.  Settings a manifest
+// leaves out are not compared where the API server fills in a default.
+type HpaDrift struct {
+	Manifests   string `required:"" type:"existingdir" help:"Directory of YAML or JSON manifests, searched recursively"`
+	FailOnDrift bool   `help:"Exit with an error if anything has drifted, for scheduled drift checks"`
+	ShowEqual   bool   `help:"Also show the settings which are the same"`
+
+	AllNamespaces bool  `short:"A" help:"Compare HPAs in all namespaces rather than just those the manifests use"`
+	ChunkSize     int64 `default:"500" help:"Number of HPAs to fetch per list request"`
+}
+
+// defaultCPUTarget is the CPU utilization target the API server gives an HPA which has no metrics
+const defaultCPUTarget = "80%"
+
+func (program *HpaDrift) Run(options *Options) error {
+
+	initColors(options)
+
+	selector := Selector{AllNamespaces: program.AllNamespaces, ChunkSize: program.ChunkSize}
+
+	clientset, err := selector.connect(options)
+	if err != nil {
+		return err
+	}
+
+	namespace := selector.namespaceName
+	if namespace == "" {
+		if namespace, err = options.ResolveNamespace(); err != nil {
+			return err
+		}
+	}
+
+	manifests, err := readHpaManifests(program.Manifests, namespace)
+	if err != nil {
+		return usageError("reading manifests: %v", err)
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	var live []v2.HorizontalPodAutoscaler
+	if program.AllNamespaces {
+		if live, err = getHpasV2(ctx, clientset, &selector); err != nil {
+			return err
+		}
+	} else {
+		namespaces := map[string]bool{namespace: true}
+		for _, hpa := range manifests {
+			namespaces[hpa.Namespace] = true
+		}
+		for _, ns := range sortedKeys(namespaces) {
+			selector.namespaceName = ns
+			hpas, err := getHpasV2(ctx, clientset, &selector)
+			if err != nil {
+				return err
+			}
+			live = append(live, hpas...)
+		}
+	}
+
+	declared := hpaColumn{label: "MANIFESTS", settings: map[string]map[string]string{}}
+	for i := range manifests {
+		hpa := &manifests[i]
+		declared.settings[hpa.Namespace+"/"+hpa.Name] = hpaSettings(hpa)
+	}
+
+	cluster := hpaColumn{label: "CLUSTER", settings: map[string]map[string]string{}}
+	for i := range live {
+		hpa := &live[i]
+		key := hpa.Namespace + "/" + hpa.Name
+		cluster.settings[key] = withoutDefaults(hpaSettings(hpa), declared.settings[key])
+	}
+
+	drifted := printHpaComparison([]hpaColumn{declared, cluster}, program.ShowEqual)
+
+	if drifted == 0 {
+		log.Info().Int("manifests", len(manifests)).Int("live", len(live)).Msg("No drift")
+		return nil
+	}
+
+	log.Warn().Int("count", drifted).Msg("HPAs drifted from the manifests")
+
+	if program.FailOnDrift {
+		return fmt.Errorf("%d HPAs drifted from the manifests", drifted)
+	}
+	return nil
+}
+
+// withoutDefaults removes the live settings which the manifest leaves to the API server's defaults: the CPU target of
+// an HPA without metrics, and a direction of scaling behavior the manifest does not set
+func withoutDefaults(live, declared map[string]string) map[string]string {
+	if declared == nil {
+		return live
+	}
+
+	hasMetrics := false
+	for field := range declared {
+		if strings.HasPrefix(field, "metric ") {
+			hasMetrics = true
+		}
+	}
+
+	for field, value := range live {
+		switch {
+		case !hasMetrics && field == "metric "+string(corev1.ResourceCPU) && value == defaultCPUTarget:
+			delete(live, field)
+		case strings.HasPrefix(field, "behavior ") && declared[field] == "":
+			delete(live, field)
+		}
+	}
+
+	return live
+}
+
+// readHpaManifests returns the HPAs defined in the YAML and JSON files under dir.  Manifests without a namespace are
+// placed in the given one, as kubectl apply would.  autoscaling/v1 manifests are converted to v2 for comparison.
+func readHpaManifests(dir, namespace string) ([]v2.HorizontalPodAutoscaler, error) {
+	var result []v2.HorizontalPodAutoscaler
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		hpas, err := decodeHpas(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		for _, hpa := range hpas {
+			if hpa.Namespace == "" {
+				hpa.Namespace = namespace
+			}
+			result = append(result, hpa)
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+// decodeHpas returns the HPAs among the documents of a manifest file, ignoring other kinds
+func decodeHpas(data []byte) ([]v2.HorizontalPodAutoscaler, error) {
+	var result []v2.HorizontalPodAutoscaler
+
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		var raw map[string]any
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				return result, nil
+			}
+			return nil, err
+		}
+
+		if raw["kind"] != "HorizontalPodAutoscaler" {
+			continue
+		}
+
+		document, err := json.Marshal(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		switch raw["apiVersion"] {
+		case "autoscaling/v2":
+			var hpa v2.HorizontalPodAutoscaler
+			if err := json.Unmarshal(document, &hpa); err != nil {
+				return nil, err
+			}
+			result = append(result, hpa)
+		case "autoscaling/v1":
+			var hpa v1.HorizontalPodAutoscaler
+			if err := json.Unmarshal(document, &hpa); err != nil {
+				return nil, err
+			}
+			result = append(result, hpaV1ToV2(&hpa))
+		default:
+			log.Warn().Interface("apiVersion", raw["apiVersion"]).Msg("Ignoring HPA manifest with unsupported apiVersion")
+		}
+	}
+}
+
+// hpaV1ToV2 converts an autoscaling/v1 HPA, whose only metric is a CPU utilization target
+func hpaV1ToV2(hpa *v1.HorizontalPodAutoscaler) v2.HorizontalPodAutoscaler {
+	ref := hpa.Spec.ScaleTargetRef
+	result := v2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Namespace: hpa.Namespace, Name: hpa.Name, Labels: hpa.Labels, Annotations: hpa.Annotations},
+		Spec: v2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: v2.CrossVersionObjectReference{Kind: ref.Kind, Name: ref.Name, APIVersion: ref.APIVersion},
+			MinReplicas:    hpa.Spec.MinReplicas,
+			MaxReplicas:    hpa.Spec.MaxReplicas,
+		},
+	}
+
+	if target := hpa.Spec.TargetCPUUtilizationPercentage; target != nil {
+		result.Spec.Metrics = []v2.MetricSpec{{
+			Type: v2.ResourceMetricSourceType,
+			Resource: &v2.ResourceMetricSource{
+				Name:   corev1.ResourceCPU,
+				Target: v2.MetricTarget{Type: v2.UtilizationMetricType, AverageUtilization: target},
+			},
+		}}
+	}
+
+	return result
+}
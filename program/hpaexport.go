@@ -0,0 +1,332 @@
+package program
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	v2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	autoscalingv2 "k8s.io/client-go/listers/autoscaling/v2"
+	"k8s.io/client-go/tools/cache"
+)
+
+// HpaExport runs until interrupted, watching the selected HPAs and serving their state as Prometheus metrics, for
+// alerting and dashboards.  With --datadog-api-key it also submits the metrics to Datadog, with an event whenever an
+// HPA scales or its limits change, and with --cloudwatch publishes them to CloudWatch.  With --publish-nats or
+// --publish-kafka each scaling and change of limits is published to the event bus.  It can run in the cluster with
+// a service account or outside it with a kubeconfig.
+type HpaExport struct {
+	Listen string `default:":9090" help:"Address to serve metrics on"`
+	Path   string `default:"/metrics" help:"Path to serve metrics on"`
+
+	CloudWatch `embed:"" group:"CloudWatch"`
+	Selector   `embed:"" set:"resources=HPAs"`
+}
+
+// metricPrefix names the metrics this tool exports
+const metricPrefix = "k8sutils_hpa_"
+
+// shutdownTimeout is how long scrapes in progress are given to finish when the exporter stops
+const shutdownTimeout = 5 * time.Second
+
+// hpaGauge is one exported metric, with the value of each HPA
+type hpaGauge struct {
+	name, help string
+	value      func(hpa *v2.HorizontalPodAutoscaler) float64
+}
+
+var hpaGauges = []hpaGauge{
+	{"current_replicas", "Current number of replicas of the HPA's target", func(hpa *v2.HorizontalPodAutoscaler) float64 {
+		return float64(hpa.Status.CurrentReplicas)
+	}},
+	{"desired_replicas", "Number of replicas the HPA last calculated", func(hpa *v2.HorizontalPodAutoscaler) float64 {
+		return float64(hpa.Status.DesiredReplicas)
+	}},
+	{"min_replicas", "Minimum replicas of the HPA", func(hpa *v2.HorizontalPodAutoscaler) float64 {
+		return float64(max(replicasOf(hpa.Spec.MinReplicas), 1))
+	}},
+	{"max_replicas", "Maximum replicas of the HPA", func(hpa *v2.HorizontalPodAutoscaler) float64 {
+		return float64(hpa.Spec.MaxReplicas)
+	}},
+	{"at_max", "1 if the HPA is at its maximum replicas", func(hpa *v2.HorizontalPodAutoscaler) float64 {
+		if hpa.Status.CurrentReplicas >= hpa.Spec.MaxReplicas {
+			return 1
+		}
+		return 0
+	}},
+	{"scaling_limited", "1 if the HPA's ScalingLimited condition is true, so it wants more or fewer replicas than its bounds allow", func(hpa *v2.HorizontalPodAutoscaler) float64 {
+		for _, condition := range hpa.Status.Conditions {
+			if condition.Type == v2.ScalingLimited && condition.Status == corev1.ConditionTrue {
+				return 1
+			}
+		}
+		return 0
+	}},
+	{"able_to_scale", "0 if the HPA's AbleToScale or ScalingActive condition is false", func(hpa *v2.HorizontalPodAutoscaler) float64 {
+		if failingCondition(hpa.Status.Conditions) != nil {
+			return 0
+		}
+		return 1
+	}},
+}
+
+func (program *HpaExport) Run(options *Options) error {
+
+	initColors(options)
+
+	// The watch is a long running request, so is not subject to the request timeout
+	options.Timeout = 0
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	cloudWatch, err := program.newCloudWatchPublisher(ctx, options.contextName())
+	if err != nil {
+		return err
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithNamespace(program.namespace()),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = program.labelSelector()
+		}))
+
+	// The factory only starts informers which have been asked for
+	informer := factory.Autoscaling().V2().HorizontalPodAutoscalers()
+	informer.Informer()
+
+	if options.EventBus.enabled() {
+		names := map[string]bool{}
+		for _, name := range program.Names {
+			names[name] = true
+		}
+
+		// The scaling of each HPA is published as the watch sees it rather than at an interval, so none is missed
+		_, err := informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			UpdateFunc: func(before, after any) {
+				old, ok := before.(*v2.HorizontalPodAutoscaler)
+				if !ok {
+					return
+				}
+				if hpa, ok := after.(*v2.HorizontalPodAutoscaler); ok && (len(names) == 0 || names[hpa.Name]) {
+					publishObserved(old, hpa)
+				}
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	factory.Start(ctx.Done())
+	defer factory.Shutdown()
+
+	if !cache.WaitForCacheSync(ctx.Done(), informer.Informer().HasSynced) {
+		return connectionError(ctx.Err(), "unable to sync HPAs from the cluster")
+	}
+
+	lister := informer.Lister()
+
+	if len(notifiers) > 0 {
+		go func() {
+			alerts := newHpaAlerts()
+			ticker := time.NewTicker(alertInterval)
+			defer ticker.Stop()
+			for {
+				hpas, err := listV2(lister, program.Names)
+				if err != nil {
+					log.Warn().Err(err).Msg("Checking HPAs for alerts")
+				} else {
+					alerts.check(hpas, time.Now())
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+
+	if datadog := options.newDatadogClient(options.contextName()); datadog != nil {
+		go datadog.export(ctx, options.DatadogInterval, func() ([]v2.HorizontalPodAutoscaler, error) {
+			return listV2(lister, program.Names)
+		})
+	}
+
+	if cloudWatch != nil {
+		go cloudWatch.export(ctx, program.CloudWatchInterval, func() ([]v2.HorizontalPodAutoscaler, error) {
+			return listV2(lister, program.Names)
+		})
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(program.Path, func(w http.ResponseWriter, r *http.Request) {
+		hpas, err := listV2(lister, program.Names)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeHpaMetrics(w, hpas)
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+
+	server := &http.Server{Addr: program.Listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdown); err != nil {
+			log.Warn().Err(err).Msg("Stopping metrics server")
+		}
+	}()
+
+	log.Info().Str("listen", program.Listen).Str("path", program.Path).Msg("Serving HPA metrics")
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serving metrics: %w", err)
+	}
+
+	return nil
+}
+
+// listV2 returns the HPAs in the lister with the given names, or all of them if none are given, sorted
+func listV2(lister autoscalingv2.HorizontalPodAutoscalerLister, names []string) ([]v2.HorizontalPodAutoscaler, error) {
+	items, err := lister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	hpas := make([]v2.HorizontalPodAutoscaler, 0, len(items))
+	for _, hpa := range items {
+		hpas = append(hpas, *hpa)
+	}
+	if len(names) > 0 {
+		hpas = filterV2ByName(hpas, names)
+	}
+	sortObjects(hpas)
+
+	return hpas, nil
+}
+
+// filterV2ByName returns the HPAs with the given names
+func filterV2ByName(hpas []v2.HorizontalPodAutoscaler, names []string) []v2.HorizontalPodAutoscaler {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	var result []v2.HorizontalPodAutoscaler
+	for _, hpa := range hpas {
+		if wanted[hpa.Name] {
+			result = append(result, hpa)
+		}
+	}
+
+	return result
+}
+
+// writeHpaMetrics writes the HPAs' metrics in the Prometheus text format
+func writeHpaMetrics(w io.Writer, hpas []v2.HorizontalPodAutoscaler) {
+	for _, gauge := range hpaGauges {
+		fmt.Fprintf(w, "# HELP %s%s %s\n# TYPE %s%s gauge\n", metricPrefix, gauge.name, gauge.help, metricPrefix, gauge.name)
+		for i := range hpas {
+			hpa := &hpas[i]
+			fmt.Fprintf(w, "%s%s{%s} %g\n", metricPrefix, gauge.name, hpaLabels(hpa), gauge.value(hpa))
+		}
+	}
+
+	// Utilization is only known for resource metrics with a utilization target
+	writeUtilization := func(name, help string, value func(hpa *v2.HorizontalPodAutoscaler, resource corev1.ResourceName) (int32, bool)) {
+		fmt.Fprintf(w, "# HELP %s%s %s\n# TYPE %s%s gauge\n", metricPrefix, name, help, metricPrefix, name)
+		for i := range hpas {
+			hpa := &hpas[i]
+			for _, metric := range hpa.Spec.Metrics {
+				if metric.Resource == nil {
+					continue
+				}
+				if v, ok := value(hpa, metric.Resource.Name); ok {
+					fmt.Fprintf(w, "%s%s{%s,resource=%s} %d\n", metricPrefix, name, hpaLabels(hpa), labelValue(string(metric.Resource.Name)), v)
+				}
+			}
+		}
+	}
+
+	writeUtilization("target_utilization_percent", "Target average utilization of a resource, as a percentage of requests",
+		func(hpa *v2.HorizontalPodAutoscaler, resource corev1.ResourceName) (int32, bool) {
+			for _, metric := range hpa.Spec.Metrics {
+				if metric.Resource != nil && metric.Resource.Name == resource && metric.Resource.Target.AverageUtilization != nil {
+					return *metric.Resource.Target.AverageUtilization, true
+				}
+			}
+			return 0, false
+		})
+
+	writeUtilization("current_utilization_percent", "Current average utilization of a resource, as a percentage of requests",
+		func(hpa *v2.HorizontalPodAutoscaler, resource corev1.ResourceName) (int32, bool) {
+			for _, metric := range hpa.Status.CurrentMetrics {
+				if metric.Resource != nil && metric.Resource.Name == resource && metric.Resource.Current.AverageUtilization != nil {
+					return *metric.Resource.Current.AverageUtilization, true
+				}
+			}
+			return 0, false
+		})
+}
+
+// resourceUtilization is the target and, if known, current average utilization of a resource metric, as percentages of
+// requests
+type resourceUtilization struct {
+	resource string
+	target   int32
+	current  *int32
+}
+
+// hpaUtilization returns the utilization of each resource metric of the HPA with a utilization target
+func hpaUtilization(hpa *v2.HorizontalPodAutoscaler) []resourceUtilization {
+	var result []resourceUtilization
+	for _, metric := range hpa.Spec.Metrics {
+		if metric.Resource == nil || metric.Resource.Target.AverageUtilization == nil {
+			continue
+		}
+		utilization := resourceUtilization{resource: string(metric.Resource.Name), target: *metric.Resource.Target.AverageUtilization}
+		for _, current := range hpa.Status.CurrentMetrics {
+			if current.Resource != nil && current.Resource.Name == metric.Resource.Name && current.Resource.Current.AverageUtilization != nil {
+				utilization.current = current.Resource.Current.AverageUtilization
+			}
+		}
+		result = append(result, utilization)
+	}
+	return result
+}
+
+// hpaLabels returns the Prometheus labels identifying an HPA and its target
+func hpaLabels(hpa *v2.HorizontalPodAutoscaler) string {
+	ref := hpa.Spec.ScaleTargetRef
+	return fmt.Sprintf("namespace=%s,hpa=%s,target_kind=%s,target_name=%s",
+		labelValue(hpa.Namespace), labelValue(hpa.Name), labelValue(ref.Kind), labelValue(ref.Name))
+}
+
+// labelValue quotes a Prometheus label value
+func labelValue(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
@@ -0,0 +1,194 @@
+package program
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HpaFitCheck works out whether the cluster could schedule every selected HPA at its maximum at the same time.  The
+// extra pods are fitted onto the free requests of the schedulable nodes, plus the nodes the cluster autoscaler could
+// still add to each pool given --max-nodes.  Like simulate-outage only CPU and memory requests are considered, so
+// pods which do not fit here will certainly not fit, while those which do may still be held back by affinity or taints.
+type HpaFitCheck struct {
+	MaxNodes  map[string]int `help:"Most nodes the cluster autoscaler may run in each node pool, e.g. general=20;gpu=4"`
+	PoolLabel string         `help:"Node label naming the node pool (default: the first of the well known cloud provider labels the node has)"`
+
+	Selector `embed:"" set:"resources=HPAs"`
+}
+
+// fitDemand is the extra capacity one HPA needs to reach its maximum
+type fitDemand struct {
+	namespace string
+	hpa       string
+	target    string
+	extra     int32
+	requests  corev1.ResourceList
+	found     bool
+}
+
+func (program *HpaFitCheck) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	hpas, err := program.getHpas(ctx, WithRetries(NewHPAClient(clientset), options.Retries))
+	if err != nil {
+		return err
+	}
+
+	selector := Selector{AllNamespaces: program.AllNamespaces, ChunkSize: program.ChunkSize, namespaceName: program.namespaceName}
+	templates, err := podTemplates(ctx, clientset, &selector)
+	if err != nil {
+		return err
+	}
+
+	specs := podSpecsByWorkload(templates)
+
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return apiError(err)
+	}
+	sortObjects(nodes.Items)
+
+	requested, err := requestsByNode(ctx, clientset)
+	if err != nil {
+		return err
+	}
+
+	available, added := program.capacity(nodes.Items)
+
+	// Each HPA's extra pods are fitted as a workload of their own, keyed the same way as the demand
+	var demands []fitDemand
+	pending := map[string][]corev1.Pod{}
+	for _, hpa := range hpas {
+		ref := hpa.Spec.ScaleTargetRef
+		key := hpa.Namespace + "/" + ref.Kind + "/" + ref.Name
+		demand := fitDemand{
+			namespace: hpa.Namespace,
+			hpa:       hpa.Name,
+			target:    ref.Kind + "/" + ref.Name,
+			extra:     max(hpa.Spec.MaxReplicas-hpa.Status.CurrentReplicas, 0),
+		}
+
+		if spec, ok := specs[key]; ok {
+			demand.found = true
+			pod := corev1.Pod{Spec: *spec}
+			demand.requests = podRequests(&pod)
+			for i := int32(0); i < demand.extra; i++ {
+				pending[hpa.Namespace+"/"+hpa.Name] = append(pending[hpa.Namespace+"/"+hpa.Name], pod)
+			}
+		}
+
+		demands = append(demands, demand)
+	}
+
+	unplaced := placePods(pending, available, requested)
+
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "HPA", "TARGET", "EXTRA PODS", "CPU", "MEMORY", "UNSCHEDULABLE"})
+
+	failing, unknown := 0, 0
+	totalCPU, totalMemory := resource.Quantity{}, resource.Quantity{}
+	for _, d := range demands {
+		if !d.found {
+			unknown++
+			t.AppendRow(table.Row{d.namespace, d.hpa, d.target, strconv.Itoa(int(d.extra)), "-", "-", paint(text.FgYellow, "unknown target pod template")})
+			continue
+		}
+
+		cpu := scaleQuantity(d.requests[corev1.ResourceCPU], d.extra)
+		memory := scaleQuantity(d.requests[corev1.ResourceMemory], d.extra)
+		totalCPU.Add(cpu)
+		totalMemory.Add(memory)
+
+		status := paint(text.FgGreen, "0")
+		if n := unplaced[d.namespace+"/"+d.hpa]; n > 0 {
+			failing++
+			status = paint(text.FgRed, strconv.Itoa(n))
+		}
+
+		t.AppendRow(table.Row{d.namespace, d.hpa, d.target, strconv.Itoa(int(d.extra)), cpu.String(), memory.String(), status})
+	}
+
+	t.Render()
+
+	log.Info().
+		Str("cpu", totalCPU.String()).
+		Str("memory", totalMemory.String()).
+		Int("nodes", len(available)-added).
+		Int("autoscaler_nodes", added).
+		Msg("Extra requests at maximum")
+
+	if unknown > 0 {
+		log.Warn().Int("count", unknown).Msg("HPAs whose target is not a Deployment or StatefulSet were not checked")
+	}
+	if failing > 0 {
+		log.Warn().Int("count", failing).Msg("HPAs which cannot reach their maximum")
+	}
+
+	return nil
+}
+
+// capacity returns the schedulable nodes followed by the nodes the cluster autoscaler could still add, each a copy of
+// the first existing node of its pool, and the number added.  Pools with no existing node cannot be modelled.
+func (program *HpaFitCheck) capacity(nodes []corev1.Node) ([]corev1.Node, int) {
+	var available []corev1.Node
+	count := map[string]int{}
+	example := map[string]*corev1.Node{}
+
+	for i := range nodes {
+		node := &nodes[i]
+		pool := nodePool(node, program.PoolLabel)
+		count[pool]++
+		if example[pool] == nil {
+			example[pool] = node
+		}
+		if !node.Spec.Unschedulable {
+			available = append(available, *node)
+		}
+	}
+
+	pools := make([]string, 0, len(program.MaxNodes))
+	for pool := range program.MaxNodes {
+		pools = append(pools, pool)
+	}
+	sort.Strings(pools)
+
+	added := 0
+	for _, pool := range pools {
+		if example[pool] == nil {
+			log.Warn().Str("pool", pool).Msg("No existing node in pool, cannot model the nodes the autoscaler would add")
+			continue
+		}
+
+		for i := count[pool]; i < program.MaxNodes[pool]; i++ {
+			node := example[pool].DeepCopy()
+			node.Name = fmt.Sprintf("%s (new %d)", pool, i+1)
+			node.Spec.Unschedulable = false
+			available = append(available, *node)
+			added++
+		}
+	}
+
+	return available, added
+}
+
+// scaleQuantity returns the quantity multiplied by n
+func scaleQuantity(q resource.Quantity, n int32) resource.Quantity {
+	return *resource.NewMilliQuantity(q.MilliValue()*int64(n), q.Format)
+}
@@ -0,0 +1,192 @@
+package program
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	v2 "k8s.io/api/autoscaling/v2"
+)
+
+// HpaFlapping finds HPAs which keep scaling up and back down, from the same scaling events as the timeline, and
+// suggests the stabilization window or target changes which would calm them.
+type HpaFlapping struct {
+	MaxReversals int           `default:"3" help:"Flag HPAs which changed direction more than this many times within the window"`
+	Window       time.Duration `default:"1h" help:"Window in which direction changes are counted"`
+	AuditLog     string        `type:"existingfile" help:"API server audit log (JSON lines) to read scale operations from as well as events"`
+	History      string        `type:"existingfile" help:"History written by hpa record to read replica changes from as well as events"`
+
+	Selector `embed:"" set:"resources=HPAs"`
+}
+
+// flapping describes how an HPA has been changing direction
+type flapping struct {
+	events    int
+	reversals int
+	// shortest time from scaling up to scaling down again, and from scaling down to scaling up again
+	upToDown, downToUp time.Duration
+}
+
+// defaultScaleDownWindow is the scale down stabilization window of an HPA which does not set one
+const defaultScaleDownWindow = 300 * time.Second
+
+// maxSuggestedWindow limits the stabilization window suggested, beyond which the HPA would be slow to give back capacity
+const maxSuggestedWindow = time.Hour
+
+func (program *HpaFlapping) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	selector := program.Selector
+	hpas, err := getHpasV2(ctx, clientset, &selector)
+	if err != nil {
+		return err
+	}
+
+	events, err := program.Selector.scalingEvents(ctx, clientset, hpas, program.AuditLog, program.History, options.contextName())
+	if err != nil {
+		return err
+	}
+
+	byHpa := map[string][]scalingEvent{}
+	for _, e := range events {
+		key := e.Namespace + "/" + e.HPA
+		byHpa[key] = append(byHpa[key], e)
+	}
+
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "HPA", "EVENTS", "REVERSALS", "SUGGESTIONS"})
+	flagged := 0
+
+	for i := range hpas {
+		hpa := &hpas[i]
+
+		f := measureFlapping(byHpa[hpa.Namespace+"/"+hpa.Name], program.Window)
+		if f.reversals <= program.MaxReversals {
+			continue
+		}
+
+		flagged++
+		t.AppendRow(table.Row{
+			hpa.Namespace,
+			hpa.Name,
+			strconv.Itoa(f.events),
+			paint(text.FgRed, strconv.Itoa(f.reversals)),
+			strings.Join(flappingSuggestions(hpa, f), "; "),
+		})
+	}
+
+	if flagged == 0 {
+		log.Info().Int("hpas", len(hpas)).Int("events", len(events)).Stringer("window", program.Window).Msg("No flapping HPAs found")
+		return nil
+	}
+
+	t.Render()
+
+	log.Warn().Int("count", flagged).Stringer("window", program.Window).Msg("HPAs flapping")
+
+	return nil
+}
+
+// measureFlapping finds the most direction changes within any window of time, and the shortest time the HPA held a
+// direction before reversing
+func measureFlapping(events []scalingEvent, window time.Duration) flapping {
+	f := flapping{events: len(events)}
+
+	var reversals []time.Time
+	var direction int32
+	var turned time.Time
+
+	for i := 1; i < len(events); i++ {
+		delta := events[i].Replicas - events[i-1].Replicas
+		if delta == 0 {
+			continue
+		}
+
+		if direction != 0 && (delta > 0) != (direction > 0) {
+			held := events[i].Time.Sub(turned)
+			if delta < 0 {
+				f.upToDown = shortest(f.upToDown, held)
+			} else {
+				f.downToUp = shortest(f.downToUp, held)
+			}
+			reversals = append(reversals, events[i].Time)
+		}
+
+		if direction == 0 || (delta > 0) != (direction > 0) {
+			turned = events[i].Time
+		}
+		direction = delta
+	}
+
+	for first, last := 0, 0; last < len(reversals); last++ {
+		for reversals[last].Sub(reversals[first]) > window {
+			first++
+		}
+		f.reversals = max(f.reversals, last-first+1)
+	}
+
+	return f
+}
+
+// shortest returns the shorter duration, treating zero as not yet measured
+func shortest(current, d time.Duration) time.Duration {
+	if current == 0 {
+		return d
+	}
+	return min(current, d)
+}
+
+// flappingSuggestions suggests changes to the HPA's behavior and target which would stop it reversing so often
+func flappingSuggestions(hpa *v2.HorizontalPodAutoscaler, f flapping) []string {
+	var suggestions []string
+
+	scaleDown := defaultScaleDownWindow
+	var scaleUp time.Duration
+	if behavior := hpa.Spec.Behavior; behavior != nil {
+		if rules := behavior.ScaleDown; rules != nil && rules.StabilizationWindowSeconds != nil {
+			scaleDown = time.Duration(*rules.StabilizationWindowSeconds) * time.Second
+		}
+		if rules := behavior.ScaleUp; rules != nil && rules.StabilizationWindowSeconds != nil {
+			scaleUp = time.Duration(*rules.StabilizationWindowSeconds) * time.Second
+		}
+	}
+
+	// Scaling down soon after scaling up: hold the capacity until the load has been gone for longer
+	if f.upToDown > 0 && scaleDown < maxSuggestedWindow {
+		window := min(max(2*f.upToDown, 2*scaleDown), maxSuggestedWindow).Round(time.Minute)
+		suggestions = append(suggestions, fmt.Sprintf("raise scaleDown stabilizationWindowSeconds from %d to %d",
+			int(scaleDown.Seconds()), int(window.Seconds())))
+	}
+
+	// Scaling up soon after scaling down: it gave back too much at once, or reacts to bursts it could ride out
+	if f.downToUp > 0 && f.downToUp < 2*scaleDown {
+		suggestions = append(suggestions, "add a scaleDown policy limiting each step, e.g. 10% per 60s")
+		if scaleUp == 0 {
+			suggestions = append(suggestions, "set scaleUp stabilizationWindowSeconds to 60 to ride out short bursts")
+		}
+	}
+
+	// A high target leaves little room for normal variation, so it keeps being crossed
+	if _, target, ok := cpuUtilization(hpa); ok && target >= 80 {
+		suggestions = append(suggestions, fmt.Sprintf("lower the CPU target from %d%% to %d%%", target, target-10))
+	}
+
+	if len(suggestions) == 0 {
+		suggestions = append(suggestions, "check whether the metric itself oscillates")
+	}
+
+	return suggestions
+}
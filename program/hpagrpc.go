@@ -0,0 +1,560 @@
+package program
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	v1 "k8s.io/api/autoscaling/v1"
+	v2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+
+	k8sutilsv1 "github.com/deweysasser/k8sutils/api/k8sutils/v1"
+)
+
+// HpaGrpc serves the list, plan, apply and report operations of the hpa commands over gRPC, with a stream of HPA
+// changes for watching, for platform services which prefer a typed client to running this tool.  The service is
+// defined in api/k8sutils/v1/hpa.proto.
+//
+// The service makes changes with the credentials of this tool, so callers are authenticated, either by a client
+// certificate or by their Kubernetes token, and it does not serve Apply requests unless they are.  Callers
+// authenticated by token are only allowed the requests their own RBAC allows.
+type HpaGrpc struct {
+	Listen        string `default:":9443" help:"Address to serve gRPC on"`
+	TLSCert       string `name:"tls-cert" required:"" type:"existingfile" help:"TLS certificate to serve with (reloaded when it changes)"`
+	TLSKey        string `name:"tls-key" required:"" type:"existingfile" help:"Private key of the TLS certificate"`
+	ClientCA      string `name:"client-ca" type:"existingfile" help:"Require callers to give a client certificate signed by this CA"`
+	TokenReview   bool   `help:"Authenticate callers by their Kubernetes bearer token, allowing them only the requests their RBAC allows"`
+	ReadOnly      bool   `help:"Refuse Apply requests"`
+	RequireTicket bool   `help:"Refuse Apply requests which do not give a ticket"`
+
+	Bulk `embed:""`
+}
+
+func (program *HpaGrpc) Run(options *Options) error {
+
+	if !program.ReadOnly && program.ClientCA == "" && !program.TokenReview {
+		return usageError("serving Apply requests needs authenticated callers, give --client-ca or --token-review, or --read-only")
+	}
+
+	initColors(options)
+
+	// Watches are long running requests, so are not subject to the request timeout
+	options.Timeout = 0
+
+	clientset, err := options.Clientset()
+	if err != nil {
+		return err
+	}
+
+	namespace, err := options.ResolveNamespace()
+	if err != nil {
+		return err
+	}
+
+	tlsConfig, err := program.tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	service := &hpaServer{
+		config:    program,
+		options:   options,
+		clientset: clientset,
+		client:    WithRetries(NewHPAClient(clientset), options.Retries),
+		namespace: namespace,
+	}
+
+	server := grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(tlsConfig)),
+		grpc.UnaryInterceptor(service.authenticateUnary),
+		grpc.StreamInterceptor(service.authenticateStream),
+	)
+	k8sutilsv1.RegisterHPAServiceServer(server, service)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+
+	listener, err := net.Listen("tcp", program.Listen)
+	if err != nil {
+		return fmt.Errorf("serving gRPC: %w", err)
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+
+	log.Info().Str("listen", program.Listen).Bool("read-only", program.ReadOnly).
+		Bool("client-certificates", program.ClientCA != "").Bool("token-review", program.TokenReview).
+		Msg("Serving HPA gRPC API")
+
+	if err := server.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return fmt.Errorf("serving gRPC: %w", err)
+	}
+
+	return nil
+}
+
+// tlsConfig returns the TLS configuration to serve with, which requires client certificates if a client CA is given
+func (program *HpaGrpc) tlsConfig() (*tls.Config, error) {
+	certificates := &certificateLoader{certFile: program.TLSCert, keyFile: program.TLSKey}
+	if _, err := certificates.get(nil); err != nil {
+		return nil, usageError("loading --tls-cert and --tls-key: %v", err)
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certificates.get}
+
+	if program.ClientCA != "" {
+		pem, err := os.ReadFile(program.ClientCA)
+		if err != nil {
+			return nil, usageError("reading --client-ca: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, usageError("--client-ca %s has no PEM certificates", program.ClientCA)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return config, nil
+}
+
+// hpaServer implements the HPAService on the given cluster
+type hpaServer struct {
+	k8sutilsv1.UnimplementedHPAServiceServer
+
+	config    *HpaGrpc
+	options   *Options
+	clientset kubernetes.Interface
+	client    HPAClient
+	// namespace is the namespace selected when a request does not give one
+	namespace string
+}
+
+// selector returns the selector for the selection in a request
+func (s *hpaServer) selector(selection *k8sutilsv1.Selection) Selector {
+	selector := Selector{
+		Labels:        selection.GetLabels(),
+		All:           selection.GetAll(),
+		Names:         selection.GetNames(),
+		AllNamespaces: selection.GetAllNamespaces(),
+		ChunkSize:     500,
+		namespaceName: selection.GetNamespace(),
+	}
+	if selector.namespaceName == "" {
+		selector.namespaceName = s.namespace
+	}
+	return selector
+}
+
+// change returns the command which makes the change in a request
+func (s *hpaServer) change(change *k8sutilsv1.Change) (*Hpa, strategy, error) {
+	program := &Hpa{
+		Minimum:      change.GetMin(),
+		Maximum:      change.GetMax(),
+		CPUTarget:    int(change.GetCpuTarget()),
+		Selector:     s.selector(change.GetSelection()),
+		Ticket:       change.GetTicket(),
+		Atomic:       change.GetAtomic(),
+		OverrideLock: change.GetOverrideLock(),
+		Bulk:         s.config.Bulk,
+	}
+
+	if !program.selected() {
+		return nil, nil, status.Error(codes.InvalidArgument, "no HPAs selected, give names, labels or all")
+	}
+
+	update, err := program.getStrategy()
+	if err != nil {
+		return nil, nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return program, update, nil
+}
+
+// callerKey is the context key of the user a request was authenticated as
+type callerKey struct{}
+
+// authenticateUnary authenticates the caller of a request, if callers are authenticated by token
+func (s *hpaServer) authenticateUnary(ctx context.Context, request any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := s.authenticate(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, request)
+}
+
+// authenticateStream authenticates the caller of a stream, if callers are authenticated by token
+func (s *hpaServer) authenticateStream(server any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(server, &authenticatedStream{ServerStream: stream, ctx: ctx})
+}
+
+// authenticatedStream is a stream whose context has the user it was authenticated as
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *authenticatedStream) Context() context.Context {
+	return stream.ctx
+}
+
+// authenticate checks the bearer token of a call with a TokenReview and returns the context with the user it
+// belongs to.  Health checks need no token, so probes can make them.
+func (s *hpaServer) authenticate(ctx context.Context, method string) (context.Context, error) {
+	if !s.config.TokenReview || strings.HasPrefix(method, "/"+healthpb.Health_ServiceDesc.ServiceName+"/") {
+		return ctx, nil
+	}
+
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, value := range md.Get("authorization") {
+			if bearer, ok := strings.CutPrefix(value, "Bearer "); ok {
+				token = bearer
+			}
+		}
+	}
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "a bearer token is required")
+	}
+
+	review, err := s.clientset.AuthenticationV1().TokenReviews().Create(ctx,
+		&authenticationv1.TokenReview{Spec: authenticationv1.TokenReviewSpec{Token: token}}, metav1.CreateOptions{})
+	if err != nil {
+		log.Warn().Err(err).Msg("Reviewing a caller's token")
+		return nil, status.Error(codes.Unavailable, "the token could not be reviewed")
+	}
+	if !review.Status.Authenticated {
+		return nil, status.Error(codes.Unauthenticated, "the token is not valid")
+	}
+
+	return context.WithValue(ctx, callerKey{}, review.Status.User), nil
+}
+
+// authorize checks with a SubjectAccessReview that the caller may perform the verbs on HPAs in the namespace, which is
+// empty for all namespaces.  Callers authenticated by client certificate may make any request.
+func (s *hpaServer) authorize(ctx context.Context, namespace string, verbs ...string) error {
+	user, ok := ctx.Value(callerKey{}).(authenticationv1.UserInfo)
+	if !ok {
+		return nil
+	}
+
+	extra := map[string]authorizationv1.ExtraValue{}
+	for key, value := range user.Extra {
+		extra[key] = authorizationv1.ExtraValue(value)
+	}
+
+	for _, verb := range verbs {
+		review := &authorizationv1.SubjectAccessReview{
+			Spec: authorizationv1.SubjectAccessReviewSpec{
+				User:   user.Username,
+				UID:    user.UID,
+				Groups: user.Groups,
+				Extra:  extra,
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace: namespace,
+					Verb:      verb,
+					Group:     v2.GroupName,
+					Resource:  "horizontalpodautoscalers",
+				},
+			},
+		}
+
+		result, err := s.clientset.AuthorizationV1().SubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+		if err != nil {
+			return grpcError(apiError(err))
+		}
+		if !result.Status.Allowed {
+			where := "in namespace " + namespace
+			if namespace == metav1.NamespaceAll {
+				where = "in all namespaces"
+			}
+			return status.Errorf(codes.PermissionDenied, "%s may not %s HPAs %s", user.Username, verb, where)
+		}
+	}
+
+	return nil
+}
+
+func (s *hpaServer) List(ctx context.Context, request *k8sutilsv1.ListRequest) (*k8sutilsv1.ListResponse, error) {
+	selection := s.selector(request.GetSelection())
+	selector := selection
+
+	if err := s.authorize(ctx, selector.namespace(), "list"); err != nil {
+		return nil, err
+	}
+
+	hpas, err := getHpasV2(ctx, s.clientset, &selector)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	response := &k8sutilsv1.ListResponse{}
+	for i := range hpas {
+		response.Hpas = append(response.Hpas, hpaMessage(&hpas[i]))
+	}
+	return response, nil
+}
+
+func (s *hpaServer) Plan(ctx context.Context, request *k8sutilsv1.PlanRequest) (*k8sutilsv1.PlanResponse, error) {
+	program, update, err := s.change(request.GetChange())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.authorize(ctx, program.namespace(), "list"); err != nil {
+		return nil, err
+	}
+
+	hpas, err := program.getHpas(ctx, s.client)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	response := &k8sutilsv1.PlanResponse{}
+	for i := range hpas {
+		hpa := &hpas[i]
+		planned := hpa.DeepCopy()
+		if err := update(planned); err != nil {
+			return nil, grpcError(err)
+		}
+
+		from, to := limitsMessage(hpa), limitsMessage(planned)
+		response.Changes = append(response.Changes, &k8sutilsv1.PlannedChange{
+			Namespace: hpa.Namespace,
+			Name:      hpa.Name,
+			From:      from,
+			To:        to,
+			Changed:   !proto.Equal(from, to),
+			Locked:    isLocked(hpa),
+		})
+	}
+	return response, nil
+}
+
+func (s *hpaServer) Apply(ctx context.Context, request *k8sutilsv1.ApplyRequest) (*k8sutilsv1.ApplyResponse, error) {
+	if s.config.ReadOnly {
+		return nil, status.Error(codes.PermissionDenied, "the server is read only")
+	}
+
+	if s.config.RequireTicket && request.GetChange().GetTicket() == "" {
+		return nil, status.Error(codes.InvalidArgument, "a change ticket is required for modifications")
+	}
+
+	program, update, err := s.change(request.GetChange())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.authorize(ctx, program.namespace(), "list", "patch"); err != nil {
+		return nil, err
+	}
+
+	hpas, err := program.getHpas(ctx, s.client)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	log.Info().Int("hpas", len(hpas)).Str("ticket", program.Ticket).Msg("Applying change requested over gRPC")
+
+	results := newSummary()
+	err = program.modify(ctx, s.options, s.client, hpas, update, results)
+	results.notifyChanges()
+
+	response := &k8sutilsv1.ApplyResponse{Counts: map[string]int32{}}
+	for _, o := range results.sorted() {
+		response.Outcomes = append(response.Outcomes, &k8sutilsv1.Outcome{Namespace: o.Namespace, Name: o.Name, Result: o.Outcome, Reason: o.Reason})
+		response.Counts[o.Outcome]++
+	}
+
+	// Failures are reported in the response rather than failing the call, so the caller still learns which HPAs were
+	// changed
+	if err != nil {
+		response.Error = err.Error()
+	}
+
+	return response, nil
+}
+
+func (s *hpaServer) Report(ctx context.Context, request *k8sutilsv1.ReportRequest) (*k8sutilsv1.ReportResponse, error) {
+	selector := Selector{AllNamespaces: true, ChunkSize: 500}
+	if request.GetSelection() != nil {
+		selection := s.selector(request.GetSelection())
+		selector = selection
+	}
+
+	if err := s.authorize(ctx, selector.namespace(), "list"); err != nil {
+		return nil, err
+	}
+
+	hpas, err := getHpasV2(ctx, s.clientset, &selector)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	fleet := summarizeHpas(hpas)
+
+	response := &k8sutilsv1.ReportResponse{
+		Total:             int32(fleet.total),
+		Namespaces:        int32(fleet.namespaces),
+		AtMaximum:         int32(fleet.atMax),
+		FailingConditions: int32(len(fleet.failing)),
+		ManagedThroughV1:  int32(fleet.legacy),
+		CpuUtilization:    distributionMessage(fleet.utilization),
+		Replicas:          distributionMessage(fleet.capacity),
+		RunningReplicas:   fleet.running,
+		MaximumReplicas:   fleet.ceiling,
+	}
+	for b, bucket := range ratioBuckets {
+		response.Ratios = append(response.Ratios, &k8sutilsv1.RatioBucket{Label: bucket.label, Hpas: int32(fleet.ratios[b])})
+	}
+	for _, f := range fleet.failing {
+		response.Failing = append(response.Failing, hpaMessage(f.hpa))
+	}
+
+	return response, nil
+}
+
+func (s *hpaServer) Watch(request *k8sutilsv1.WatchRequest, stream k8sutilsv1.HPAService_WatchServer) error {
+	ctx := stream.Context()
+	selector := s.selector(request.GetSelection())
+
+	if err := s.authorize(ctx, selector.namespace(), "list", "watch"); err != nil {
+		return err
+	}
+
+	wanted := map[string]bool{}
+	for _, name := range selector.Names {
+		wanted[name] = true
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(s.clientset, 0,
+		informers.WithNamespace(selector.namespace()),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = selector.labelSelector()
+		}))
+	informer := factory.Autoscaling().V2().HorizontalPodAutoscalers().Informer()
+
+	// The handlers are called one at a time, so sending from them keeps the events in order
+	events := make(chan *k8sutilsv1.WatchResponse, 100)
+	send := func(kind k8sutilsv1.WatchResponse_Type, obj any) {
+		if unknown, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = unknown.Obj
+		}
+		hpa, ok := obj.(*v2.HorizontalPodAutoscaler)
+		if !ok || (len(wanted) > 0 && !wanted[hpa.Name]) {
+			return
+		}
+		select {
+		case events <- &k8sutilsv1.WatchResponse{Type: kind, Hpa: hpaMessage(hpa)}:
+		case <-ctx.Done():
+		}
+	}
+
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj any) { send(k8sutilsv1.WatchResponse_TYPE_ADDED, obj) },
+		UpdateFunc: func(_, obj any) { send(k8sutilsv1.WatchResponse_TYPE_MODIFIED, obj) },
+		DeleteFunc: func(obj any) { send(k8sutilsv1.WatchResponse_TYPE_DELETED, obj) },
+	})
+	if err != nil {
+		return grpcError(err)
+	}
+
+	factory.Start(ctx.Done())
+	defer factory.Shutdown()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-events:
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// grpcError converts an error to a gRPC status, marking connection and authentication failures as unavailable
+func grpcError(err error) error {
+	switch ExitCode(err) {
+	case ExitUsage:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case ExitConnection:
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// hpaMessage converts an HPA to its gRPC message
+func hpaMessage(hpa *v2.HorizontalPodAutoscaler) *k8sutilsv1.HPA {
+	message := &k8sutilsv1.HPA{
+		Namespace:       hpa.Namespace,
+		Name:            hpa.Name,
+		TargetKind:      hpa.Spec.ScaleTargetRef.Kind,
+		TargetName:      hpa.Spec.ScaleTargetRef.Name,
+		MinReplicas:     max(replicasOf(hpa.Spec.MinReplicas), 1),
+		MaxReplicas:     hpa.Spec.MaxReplicas,
+		CurrentReplicas: hpa.Status.CurrentReplicas,
+		DesiredReplicas: hpa.Status.DesiredReplicas,
+	}
+
+	if current, target, ok := cpuUtilization(hpa); ok {
+		message.CpuUtilization, message.CpuTarget = current, target
+	}
+
+	if reason, ok := hpa.Annotations[AnnotationLocked]; ok {
+		message.Locked, message.LockReason = true, reason
+	}
+
+	if condition := failingCondition(hpa.Status.Conditions); condition != nil {
+		message.FailingCondition = &k8sutilsv1.Condition{Type: string(condition.Type), Reason: condition.Reason, Message: condition.Message}
+	}
+
+	return message
+}
+
+// limitsMessage returns the values of an HPA which a change sets
+func limitsMessage(hpa *v1.HorizontalPodAutoscaler) *k8sutilsv1.Limits {
+	limits := &k8sutilsv1.Limits{MinReplicas: max(replicasOf(hpa.Spec.MinReplicas), 1), MaxReplicas: hpa.Spec.MaxReplicas}
+	if hpa.Spec.TargetCPUUtilizationPercentage != nil {
+		limits.CpuTarget = *hpa.Spec.TargetCPUUtilizationPercentage
+	}
+	return limits
+}
+
+// distributionMessage returns the percentiles of the values
+func distributionMessage(values []float64) *k8sutilsv1.Distribution {
+	distribution := &k8sutilsv1.Distribution{Hpas: int32(len(values))}
+	if ranks := percentileValues(values); ranks != nil {
+		distribution.P50, distribution.P90, distribution.Max = ranks[0], ranks[1], ranks[2]
+	}
+	return distribution
+}
@@ -0,0 +1,122 @@
+package program
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	k8sutilsv1 "github.com/deweysasser/k8sutils/api/k8sutils/v1"
+)
+
+// reviewingClientset returns a clientset which authenticates the token "good" as alice, who may only list and patch
+// HPAs in the payments namespace.  The access reviews it answers are recorded.
+func reviewingClientset(reviews *[]authorizationv1.ResourceAttributes) *fake.Clientset {
+	clientset := fake.NewSimpleClientset()
+
+	clientset.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		if review.Spec.Token == "good" {
+			review.Status = authenticationv1.TokenReviewStatus{
+				Authenticated: true,
+				User:          authenticationv1.UserInfo{Username: "alice", Groups: []string{"developers"}},
+			}
+		}
+		return true, review, nil
+	})
+
+	clientset.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		attributes := review.Spec.ResourceAttributes
+		*reviews = append(*reviews, *attributes)
+		review.Status.Allowed = review.Spec.User == "alice" && review.Spec.Groups[0] == "developers" &&
+			attributes.Namespace == "payments" && (attributes.Verb == "list" || attributes.Verb == "patch")
+		return true, review, nil
+	})
+
+	return clientset
+}
+
+func TestHpaGrpcAuthenticate(t *testing.T) {
+	tests := []struct {
+		name          string
+		tokenReview   bool
+		method        string
+		authorization string
+		wantCode      codes.Code
+		wantUser      string
+	}{
+		{name: "not required", method: "/k8sutils.v1.HPAService/List"},
+		{name: "valid token", tokenReview: true, method: "/k8sutils.v1.HPAService/List", authorization: "Bearer good", wantUser: "alice"},
+		{name: "invalid token", tokenReview: true, method: "/k8sutils.v1.HPAService/List", authorization: "Bearer bad", wantCode: codes.Unauthenticated},
+		{name: "no token", tokenReview: true, method: "/k8sutils.v1.HPAService/Apply", wantCode: codes.Unauthenticated},
+		{name: "not a bearer token", tokenReview: true, method: "/k8sutils.v1.HPAService/List", authorization: "Basic good", wantCode: codes.Unauthenticated},
+		{name: "health checks need no token", tokenReview: true, method: "/grpc.health.v1.Health/Check"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var reviews []authorizationv1.ResourceAttributes
+			s := &hpaServer{config: &HpaGrpc{TokenReview: test.tokenReview}, clientset: reviewingClientset(&reviews)}
+
+			ctx := context.Background()
+			if test.authorization != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", test.authorization))
+			}
+
+			ctx, err := s.authenticate(ctx, test.method)
+			if test.wantCode != codes.OK {
+				assert.Equal(t, test.wantCode, status.Code(err))
+				return
+			}
+			require.NoError(t, err)
+
+			user, ok := ctx.Value(callerKey{}).(authenticationv1.UserInfo)
+			assert.Equal(t, test.wantUser != "", ok)
+			assert.Equal(t, test.wantUser, user.Username)
+		})
+	}
+}
+
+func TestHpaGrpcAuthorize(t *testing.T) {
+	var reviews []authorizationv1.ResourceAttributes
+	s := &hpaServer{config: &HpaGrpc{TokenReview: true}, clientset: reviewingClientset(&reviews), namespace: "default"}
+
+	ctx, err := s.authenticate(metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer good")),
+		"/k8sutils.v1.HPAService/Apply")
+	require.NoError(t, err)
+
+	assert.NoError(t, s.authorize(ctx, "payments", "list", "patch"))
+	assert.Equal(t, []authorizationv1.ResourceAttributes{
+		{Namespace: "payments", Verb: "list", Group: "autoscaling", Resource: "horizontalpodautoscalers"},
+		{Namespace: "payments", Verb: "patch", Group: "autoscaling", Resource: "horizontalpodautoscalers"},
+	}, reviews)
+
+	err = s.authorize(ctx, "", "list")
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.ErrorContains(t, err, "alice may not list HPAs in all namespaces")
+
+	_, err = s.Apply(ctx, &k8sutilsv1.ApplyRequest{Change: &k8sutilsv1.Change{
+		Selection: &k8sutilsv1.Selection{Namespace: "checkout", All: true},
+		Min:       "2",
+	}})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err), "changes are refused in namespaces the caller may not patch HPAs in")
+
+	assert.NoError(t, (&hpaServer{}).authorize(context.Background(), "", "patch"), "callers authenticated by certificate may make any request")
+}
+
+func TestHpaGrpcNeedsAuthenticationForApply(t *testing.T) {
+	program := &HpaGrpc{TLSCert: "tls.crt", TLSKey: "tls.key"}
+	err := program.Run(&Options{})
+	assert.Equal(t, ExitUsage, ExitCode(err))
+	assert.ErrorContains(t, err, "--client-ca or --token-review")
+}
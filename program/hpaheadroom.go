@@ -0,0 +1,89 @@
+package program
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/autoscaling/v1"
+)
+
+// HpaHeadroom lists how many more replicas each HPA can add before reaching its maximum, the services closest to
+// their ceiling first, so capacity planning can start with them.
+type HpaHeadroom struct {
+	Selector `embed:"" set:"resources=HPAs"`
+}
+
+// headroom is the remaining replica capacity of an HPA
+type headroom struct {
+	hpa       *v1.HorizontalPodAutoscaler
+	remaining int32
+	percent   float64
+}
+
+func (program *HpaHeadroom) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	hpas, err := program.getHpas(ctx, WithRetries(NewHPAClient(clientset), options.Retries))
+	if err != nil {
+		return err
+	}
+
+	rows := make([]headroom, 0, len(hpas))
+	for i := range hpas {
+		hpa := &hpas[i]
+		remaining := max(hpa.Spec.MaxReplicas-hpa.Status.CurrentReplicas, 0)
+		rows = append(rows, headroom{hpa, remaining, 100 * float64(remaining) / float64(max(hpa.Spec.MaxReplicas, 1))})
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].percent != rows[j].percent {
+			return rows[i].percent < rows[j].percent
+		}
+		return rows[i].remaining < rows[j].remaining
+	})
+
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "HPA", "CURRENT", "MAX", "HEADROOM", "HEADROOM %"})
+
+	exhausted := 0
+	for _, row := range rows {
+		percent := fmt.Sprintf("%.0f%%", row.percent)
+		switch {
+		case row.remaining == 0:
+			exhausted++
+			percent = paint(text.FgRed, percent)
+		case row.percent < 20:
+			percent = paint(text.FgYellow, percent)
+		}
+
+		t.AppendRow(table.Row{
+			row.hpa.Namespace,
+			row.hpa.Name,
+			strconv.Itoa(int(row.hpa.Status.CurrentReplicas)),
+			strconv.Itoa(int(row.hpa.Spec.MaxReplicas)),
+			strconv.Itoa(int(row.remaining)),
+			percent,
+		})
+	}
+
+	t.Render()
+
+	if exhausted > 0 {
+		log.Warn().Int("count", exhausted).Msg("HPAs with no headroom left")
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package program
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	v2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// HpaManifests writes each selected HPA as a clean manifest, dir/namespace/name.yaml, for committing to a GitOps
+// repository managed by Flux or Argo CD, or with -o terraform as a resource, dir/namespace/name.tf, for moving it into
+// Terraform.  Status and the metadata the API server, controllers and this tool add are left out, and an HPA changed
+// by a ScalingSchedule is written with the values it had before.  HPAs owned by another
+// resource, such as KEDA ScaledObjects, are skipped since their owner is what belongs in the repository.
+type HpaManifests struct {
+	OutputDir string `required:"" help:"Directory to write the manifests to"`
+	Output    string `short:"o" enum:"yaml,terraform" default:"yaml" help:"Write YAML manifests, or Terraform kubernetes_horizontal_pod_autoscaler_v2 resources (yaml, terraform)"`
+
+	Selector `embed:"" set:"resources=HPAs"`
+}
+
+// runtimeAnnotations are added by tools as they work, rather than being part of what an HPA should be
+var runtimeAnnotations = []string{
+	"kubectl.kubernetes.io/last-applied-configuration",
+	"argocd.argoproj.io/tracking-id",
+	AnnotationChange,
+	AnnotationTicket,
+	AnnotationLocked,
+	AnnotationScheduledBy,
+	AnnotationScheduleOriginal,
+}
+
+// runtimeLabelPrefixes mark the labels GitOps controllers add to track what they applied
+var runtimeLabelPrefixes = []string{"kustomize.toolkit.fluxcd.io/", "helm.toolkit.fluxcd.io/"}
+
+func (program *HpaManifests) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	selector := program.Selector
+	hpas, err := getHpasV2(ctx, clientset, &selector)
+	if err != nil {
+		return err
+	}
+
+	written, owned := 0, 0
+	for i := range hpas {
+		hpa := &hpas[i]
+
+		if owner := metav1.GetControllerOf(hpa); owner != nil {
+			owned++
+			log.Debug().Str("namespace", hpa.Namespace).Str("hpa", hpa.Name).Str("owner", owner.Kind+"/"+owner.Name).Msg("Skipping HPA owned by another resource")
+			continue
+		}
+
+		var data []byte
+		extension := ".yaml"
+		if program.Output == "terraform" {
+			data, extension = terraformHPA(cleanHPA(hpa)), ".tf"
+		} else if data, err = cleanManifest(hpa); err != nil {
+			return fmt.Errorf("HPA %s/%s: %w", hpa.Namespace, hpa.Name, err)
+		}
+
+		if err := os.MkdirAll(filepath.Join(program.OutputDir, hpa.Namespace), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(program.OutputDir, hpa.Namespace, hpa.Name+extension), data, 0o644); err != nil {
+			return err
+		}
+		written++
+	}
+
+	if owned > 0 {
+		log.Info().Int("hpas", owned).Msg("Skipped HPAs owned by another resource")
+	}
+	log.Info().Str("dir", program.OutputDir).Int("hpas", written).Msg("Wrote HPA manifests")
+
+	return nil
+}
+
+// cleanHPA returns a copy of the HPA with only what belongs in a repository
+func cleanHPA(hpa *v2.HorizontalPodAutoscaler) *v2.HorizontalPodAutoscaler {
+	hpa = hpa.DeepCopy()
+
+	if original, ok := hpa.Annotations[AnnotationScheduleOriginal]; ok {
+		var minimum, maximum int32
+		if _, err := fmt.Sscanf(original, "%d/%d", &minimum, &maximum); err == nil {
+			hpa.Spec.MinReplicas = &minimum
+			hpa.Spec.MaxReplicas = maximum
+		}
+	}
+
+	for _, annotation := range runtimeAnnotations {
+		delete(hpa.Annotations, annotation)
+	}
+	for label := range hpa.Labels {
+		for _, prefix := range runtimeLabelPrefixes {
+			if strings.HasPrefix(label, prefix) {
+				delete(hpa.Labels, label)
+			}
+		}
+	}
+
+	meta := metav1.ObjectMeta{Name: hpa.Name, Namespace: hpa.Namespace, Labels: hpa.Labels, Annotations: hpa.Annotations}
+	if len(meta.Labels) == 0 {
+		meta.Labels = nil
+	}
+	if len(meta.Annotations) == 0 {
+		meta.Annotations = nil
+	}
+
+	return &v2.HorizontalPodAutoscaler{ObjectMeta: meta, Spec: hpa.Spec}
+}
+
+// cleanManifest returns the cleaned HPA as YAML
+func cleanManifest(hpa *v2.HorizontalPodAutoscaler) ([]byte, error) {
+	manifest, err := runtime.DefaultUnstructuredConverter.ToUnstructured(cleanHPA(hpa))
+	if err != nil {
+		return nil, err
+	}
+	delete(manifest, "status")
+	if metadata, ok := manifest["metadata"].(map[string]any); ok {
+		delete(metadata, "creationTimestamp")
+	}
+	manifest["apiVersion"] = v2.SchemeGroupVersion.String()
+	manifest["kind"] = "HorizontalPodAutoscaler"
+
+	return yaml.Marshal(manifest)
+}
@@ -0,0 +1,106 @@
+package program
+
+import (
+	"strconv"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/rs/zerolog/log"
+)
+
+// HpaMissing lists the Deployments and StatefulSets running at least --threshold replicas with neither an HPA nor a
+// KEDA ScaledObject scaling them, so platform teams can find the services which are not autoscaled.
+type HpaMissing struct {
+	Threshold int32 `default:"2" help:"Only list workloads with at least this many replicas"`
+
+	Selector `embed:""`
+}
+
+// unscaledWorkload is a workload no autoscaler manages
+type unscaledWorkload struct {
+	namespace string
+	kind      string
+	name      string
+	replicas  int32
+}
+
+func (program *HpaMissing) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	client, err := options.Dynamic()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	scaled := map[string]bool{}
+
+	hpaSelector := Selector{AllNamespaces: program.AllNamespaces, ChunkSize: program.ChunkSize, namespaceName: program.namespaceName}
+	hpas, err := hpaSelector.getHpas(ctx, WithRetries(NewHPAClient(clientset), options.Retries))
+	if err != nil {
+		return err
+	}
+	for _, hpa := range hpas {
+		ref := hpa.Spec.ScaleTargetRef
+		scaled[hpa.Namespace+"/"+ref.Kind+"/"+ref.Name] = true
+	}
+
+	// KEDA creates an HPA for each ScaledObject, but a paused ScaledObject has none.  Clusters without KEDA are reported
+	// as a usage error, which here just means there are no ScaledObjects.
+	soSelector := Selector{AllNamespaces: program.AllNamespaces, ChunkSize: program.ChunkSize, namespaceName: program.namespaceName}
+	scaledObjects, err := getScaledObjects(ctx, client, &soSelector)
+	if err != nil && ExitCode(err) != ExitUsage {
+		return err
+	}
+	for i := range scaledObjects {
+		kind, name := scaleTarget(&scaledObjects[i])
+		scaled[scaledObjects[i].GetNamespace()+"/"+kind+"/"+name] = true
+	}
+
+	deployments, err := (&Deploy{Selector: program.Selector}).getDeployments(ctx, clientset)
+	if err != nil {
+		return err
+	}
+
+	statefulsets, err := (&Statefulset{Selector: program.Selector}).getStatefulSets(ctx, clientset)
+	if err != nil {
+		return err
+	}
+
+	var found []unscaledWorkload
+	for _, d := range deployments {
+		found = append(found, unscaledWorkload{d.Namespace, "Deployment", d.Name, replicasOf(d.Spec.Replicas)})
+	}
+	for _, sts := range statefulsets {
+		found = append(found, unscaledWorkload{sts.Namespace, "StatefulSet", sts.Name, replicasOf(sts.Spec.Replicas)})
+	}
+
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "KIND", "NAME", "REPLICAS"})
+	count := 0
+
+	for _, w := range found {
+		if w.replicas < program.Threshold || scaled[w.namespace+"/"+w.kind+"/"+w.name] {
+			continue
+		}
+		count++
+		t.AppendRow(table.Row{w.namespace, w.kind, w.name, strconv.Itoa(int(w.replicas))})
+	}
+
+	if count == 0 {
+		log.Info().Int("workloads", len(found)).Msg("Every workload above the threshold is autoscaled")
+		return nil
+	}
+
+	t.Render()
+	log.Warn().Int("count", count).Int32("threshold", program.Threshold).Msg("Workloads without an autoscaler")
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package program
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/autoscaling/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// HpaOrphans finds HPAs whose scaleTargetRef names a workload which no longer exists, usually left behind when a
+// service was removed without its HPA.  They report errors forever and confuse anyone reading the HPA list.
+//
+// Only HPAs whose target the cluster says does not exist are deleted.  A target kind which the cluster does not serve
+// may only be missing for a while, as when a CRD such as Argo Rollouts is upgraded, so those HPAs are listed but only
+// deleted with --delete-unserved.
+type HpaOrphans struct {
+	Delete         bool `help:"Delete the orphaned HPAs"`
+	DeleteUnserved bool `help:"Also delete HPAs whose target kind the cluster does not serve, with --delete"`
+	Yes            bool `short:"y" help:"Delete without asking for confirmation"`
+	OverrideLock   bool `help:"Delete HPAs even if they are locked"`
+
+	Selector `embed:"" set:"resources=HPAs"`
+	Bulk     `embed:""`
+}
+
+// orphanedHpa is an HPA whose target is missing
+type orphanedHpa struct {
+	hpa    *v1.HorizontalPodAutoscaler
+	reason string
+	// unserved is true if the kind of the target is not served, rather than the target not existing
+	unserved bool
+}
+
+func (program *HpaOrphans) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	clients, err := newScaleClients(options, clientset)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	client := WithRetries(NewHPAClient(clientset), options.Retries)
+
+	hpas, err := program.getHpas(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	var orphans []orphanedHpa
+	for i := range hpas {
+		reason, unserved, err := missingTarget(ctx, clients, &hpas[i])
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			orphans = append(orphans, orphanedHpa{&hpas[i], reason, unserved})
+		}
+	}
+
+	if len(orphans) == 0 {
+		log.Info().Int("hpas", len(hpas)).Msg("No orphaned HPAs found")
+		return nil
+	}
+
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "HPA", "TARGET", "PROBLEM"})
+	for _, o := range orphans {
+		ref := o.hpa.Spec.ScaleTargetRef
+		t.AppendRow(table.Row{o.hpa.Namespace, o.hpa.Name, ref.Kind + "/" + ref.Name, o.reason})
+	}
+	t.Render()
+
+	log.Warn().Int("count", len(orphans)).Msg("Orphaned HPAs")
+
+	if !program.Delete {
+		return nil
+	}
+
+	results := newSummary()
+	defer results.print()
+
+	var deletable []orphanedHpa
+	for _, o := range orphans {
+		if isLocked(o.hpa) && !program.OverrideLock {
+			log.Warn().Str("namespace", o.hpa.Namespace).Str("hpa", o.hpa.Name).Msg("Skipping locked HPA, use --override-lock to delete it")
+			results.record(o.hpa.Namespace, o.hpa.Name, outcomeSkipped, "locked: "+o.hpa.Annotations[AnnotationLocked])
+			continue
+		}
+		if o.unserved && !program.DeleteUnserved {
+			results.record(o.hpa.Namespace, o.hpa.Name, outcomeSkipped, o.reason+", use --delete-unserved to delete it")
+			continue
+		}
+		deletable = append(deletable, o)
+	}
+
+	if len(deletable) == 0 {
+		return nil
+	}
+
+	if options.DryRun {
+		log.Info().Int("count", len(deletable)).Msg("Dry run, not deleting")
+		return nil
+	}
+
+	if !program.Yes && !confirm(fmt.Sprintf("Delete these %d HPAs?", len(deletable))) {
+		return usageError("not confirmed, use --yes to delete without asking")
+	}
+
+	return options.runAsLeader(ctx, clientset, func(ctx context.Context) error {
+		errs := program.Bulk.run(ctx, len(deletable), options.DryRun, false, func(i int) error {
+			hpa := deletable[i].hpa
+
+			// The preconditions keep an HPA which was changed since it was listed, e.g. to point at a new target
+			deleteOptions := metav1.DeleteOptions{
+				Preconditions: &metav1.Preconditions{UID: &hpa.UID, ResourceVersion: &hpa.ResourceVersion},
+			}
+
+			err := withRetries(ctx, options.Retries, func() error {
+				return clientset.AutoscalingV1().HorizontalPodAutoscalers(hpa.Namespace).Delete(ctx, hpa.Name, deleteOptions)
+			})
+
+			switch {
+			case apierrors.IsNotFound(err):
+				results.record(hpa.Namespace, hpa.Name, outcomeSkipped, "already deleted")
+			case apierrors.IsConflict(err):
+				results.record(hpa.Namespace, hpa.Name, outcomeSkipped, "changed since listed")
+			case err != nil:
+				results.record(hpa.Namespace, hpa.Name, outcomeFailed, err.Error())
+				return fmt.Errorf("HPA %s: %w", hpa.Name, apiError(err))
+			default:
+				log.Info().Str("namespace", hpa.Namespace).Str("hpa", hpa.Name).Msg("Deleted")
+				results.record(hpa.Namespace, hpa.Name, outcomeUpdated, "deleted: "+deletable[i].reason)
+			}
+			return nil
+		})
+
+		for _, o := range deletable {
+			if !results.has(o.hpa.Namespace, o.hpa.Name) {
+				results.record(o.hpa.Namespace, o.hpa.Name, outcomeSkipped, "not started")
+			}
+		}
+
+		return errors.Join(errs...)
+	})
+}
+
+// missingTarget returns why the HPA's scale target does not exist, or "" if it does.  If the target's kind cannot be
+// found it also returns true, as the kind may be served again later.
+func missingTarget(ctx context.Context, clients *scaleClients, hpa *v1.HorizontalPodAutoscaler) (string, bool, error) {
+	ref := hpa.Spec.ScaleTargetRef
+
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return fmt.Sprintf("invalid apiVersion %q", ref.APIVersion), true, nil
+	}
+
+	mapping, err := clients.mapper.RESTMapping(schema.GroupKind{Group: gv.Group, Kind: ref.Kind}, gv.Version)
+	if meta.IsNoMatchError(err) {
+		return fmt.Sprintf("the cluster does not serve %s %s", ref.APIVersion, ref.Kind), true, nil
+	}
+	if err != nil {
+		return "", false, apiError(err)
+	}
+
+	_, err = clients.metadata.Resource(mapping.Resource).Namespace(hpa.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		return "target does not exist", false, nil
+	case err != nil:
+		return "", false, apiError(err)
+	}
+
+	return "", false, nil
+}
@@ -0,0 +1,66 @@
+package program
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	metadatafake "k8s.io/client-go/metadata/fake"
+)
+
+func TestMissingTarget(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(appsv1.SchemeGroupVersion.WithKind("Deployment"), meta.RESTScopeNamespace)
+
+	web := &metav1.PartialObjectMetadata{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+	}
+	scheme := runtime.NewScheme()
+	require.NoError(t, metav1.AddMetaToScheme(scheme))
+
+	clients := &scaleClients{metadata: metadatafake.NewSimpleMetadataClient(scheme, web), mapper: mapper}
+
+	tests := []struct {
+		name         string
+		apiVersion   string
+		kind         string
+		target       string
+		wantReason   string
+		wantUnserved bool
+	}{
+		{name: "target exists", apiVersion: "apps/v1", kind: "Deployment", target: "web"},
+		{name: "target deleted", apiVersion: "apps/v1", kind: "Deployment", target: "api", wantReason: "target does not exist"},
+		{
+			name:         "kind not served",
+			apiVersion:   "argoproj.io/v1alpha1",
+			kind:         "Rollout",
+			target:       "web",
+			wantReason:   "the cluster does not serve argoproj.io/v1alpha1 Rollout",
+			wantUnserved: true,
+		},
+		{name: "invalid apiVersion", apiVersion: "a/b/c", kind: "Deployment", target: "web", wantReason: `invalid apiVersion "a/b/c"`, wantUnserved: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hpa := &v1.HorizontalPodAutoscaler{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+				Spec: v1.HorizontalPodAutoscalerSpec{
+					ScaleTargetRef: v1.CrossVersionObjectReference{APIVersion: test.apiVersion, Kind: test.kind, Name: test.target},
+				},
+			}
+
+			reason, unserved, err := missingTarget(context.Background(), clients, hpa)
+			require.NoError(t, err)
+			assert.Equal(t, test.wantReason, reason)
+			assert.Equal(t, test.wantUnserved, unserved)
+		})
+	}
+}
@@ -0,0 +1,556 @@
+package program
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+	v1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// HpaPropose makes a change to the selected HPAs in their manifests in a Git repository rather than in the cluster,
+// opening a GitHub pull request or GitLab merge request which summarises it for review.  Manifests are matched to the
+// HPAs by namespace and name, and only the changed values are edited so comments and formatting are kept.  With
+// --apply the cluster is changed as well, e.g. to scale now while the change to the repository is reviewed, but only
+// for the HPAs whose manifests are in the request.
+type HpaPropose struct {
+	Minimum   string `name:"min" help:"Set minimum to this number"`
+	Maximum   string `name:"max" help:"Set maximum to this number"`
+	CPUTarget int    `name:"cpu" help:"Set scaling target"`
+
+	Repo     string `required:"" placeholder:"OWNER/REPO" help:"Repository holding the manifests, e.g. org/infra (the project path on GitLab)"`
+	Path     string `help:"Directory of the repository to search for HPA manifests (default the whole repository)"`
+	Provider string `enum:"github,gitlab" default:"github" help:"Service hosting the repository (github, gitlab)"`
+	APIURL   string `name:"api-url" help:"API URL of GitHub Enterprise or a self-hosted GitLab (default the public service)"`
+	GitToken string `required:"" env:"K8SUTILS_GIT_TOKEN,GITHUB_TOKEN,GITLAB_TOKEN" help:"Token to read the repository and open the request with"`
+	Base     string `help:"Branch to propose the change to (default the repository's default branch)"`
+	Branch   string `help:"Branch to commit the change to (default k8sutils/hpa-TIMESTAMP)"`
+	Title    string `help:"Title of the request (default a description of the change)"`
+
+	Ticket       string `help:"Change ticket (e.g. JIRA-123) recorded in the request"`
+	Apply        bool   `help:"Also change the HPAs in the cluster whose manifests are changed"`
+	OverrideLock bool   `help:"Change HPAs even if they are locked"`
+
+	Selector `embed:"" set:"resources=HPAs"`
+}
+
+// proposedChange is an HPA as it is and as the change would leave it
+type proposedChange struct {
+	current, proposed *v1.HorizontalPodAutoscaler
+	manifest          *hpaManifest
+}
+
+func (program *HpaPropose) Run(options *Options) error {
+
+	initColors(options)
+
+	if !program.selected() {
+		return usageError("select the HPAs to change by name, with -l or with --all")
+	}
+
+	change := Hpa{Minimum: program.Minimum, Maximum: program.Maximum, CPUTarget: program.CPUTarget}
+	update, err := change.getStrategy()
+	if err != nil {
+		return err
+	}
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	client := WithRetries(NewHPAClient(clientset), options.Retries)
+	hpas, err := program.getHpas(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	var changes []*proposedChange
+	for i := range hpas {
+		hpa := &hpas[i]
+		if isLocked(hpa) && !program.OverrideLock {
+			log.Warn().Str("hpa", hpa.Name).Msg("Skipping locked HPA, use --override-lock to change it")
+			continue
+		}
+
+		proposed := hpa.DeepCopy()
+		if err := update(proposed); err != nil {
+			return err
+		}
+		if !equality.Semantic.DeepEqual(hpa.Spec, proposed.Spec) {
+			changes = append(changes, &proposedChange{current: hpa, proposed: proposed})
+		}
+	}
+
+	if len(changes) == 0 {
+		log.Info().Int("hpas", len(hpas)).Msg("HPAs already at the requested values, nothing to propose")
+		return nil
+	}
+
+	host := program.host()
+	base := program.Base
+	if base == "" {
+		if base, err = host.defaultBranch(ctx); err != nil {
+			return err
+		}
+	}
+
+	manifests, err := program.findManifests(ctx, host, base)
+	if err != nil {
+		return err
+	}
+
+	files, missing, err := proposeEdits(changes, manifests, program.CPUTarget != 0)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no manifests of the %d HPAs to change were found in %s", len(changes), program.location())
+	}
+	if len(missing) > 0 {
+		log.Warn().Strs("hpas", missing).Msg("No manifest found for HPAs, they are left out of the request")
+	}
+
+	var included []*proposedChange
+	for _, c := range changes {
+		if c.manifest != nil {
+			included = append(included, c)
+		}
+	}
+
+	p := &proposal{
+		base:   base,
+		branch: program.Branch,
+		title:  program.title(included),
+		body:   program.body(included, missing, options.Context),
+		files:  files,
+	}
+	if p.branch == "" {
+		p.branch = "k8sutils/hpa-" + time.Now().UTC().Format("20060102-150405")
+	}
+
+	if options.DryRun {
+		log.Info().Str("repo", program.Repo).Str("base", base).Str("title", p.title).Msg("Dry run, not opening a request")
+		return nil
+	}
+
+	link, err := host.propose(ctx, p)
+	if err != nil {
+		return err
+	}
+	log.Info().Str("url", link).Str("branch", p.branch).Int("files", len(files)).Msg("Opened request")
+	fmt.Println(link)
+
+	if !program.Apply {
+		return nil
+	}
+
+	results := newSummary()
+	defer results.print()
+
+	// Only the HPAs whose manifests are changed are changed in the cluster, or the cluster drifts from the repository
+	var applyErrors []error
+	for _, c := range included {
+		hpa := c.current
+		if _, err := modifyHPA(ctx, options, hpa, update, client, program.Ticket); err != nil {
+			results.record(hpa.Namespace, hpa.Name, outcomeFailed, err.Error())
+			applyErrors = append(applyErrors, fmt.Errorf("HPA %s: %w", hpa.Name, err))
+			continue
+		}
+		results.record(hpa.Namespace, hpa.Name, outcomeUpdated, hpa.Annotations[AnnotationChange])
+	}
+
+	return errors.Join(applyErrors...)
+}
+
+// host returns the client of the service hosting the repository
+func (program *HpaPropose) host() gitHost {
+	api := program.APIURL
+	if program.Provider == "gitlab" {
+		if api == "" {
+			api = gitlabAPI
+		}
+		return newGitlabHost(api, program.Repo, program.GitToken)
+	}
+	if api == "" {
+		api = githubAPI
+	}
+	return newGithubHost(api, program.Repo, program.GitToken)
+}
+
+// location describes where manifests are searched for
+func (program *HpaPropose) location() string {
+	if program.Path == "" {
+		return program.Repo
+	}
+	return program.Repo + "/" + strings.Trim(program.Path, "/")
+}
+
+// findManifests returns the HPAs defined in the YAML files under --path.  Files which are not valid YAML, such as Helm
+// templates, are skipped.
+func (program *HpaPropose) findManifests(ctx context.Context, host gitHost, branch string) ([]*hpaManifest, error) {
+	files, err := host.files(ctx, branch, program.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*hpaManifest
+	read := 0
+	for _, file := range files {
+		switch strings.ToLower(path.Ext(file)) {
+		case ".yaml", ".yml":
+		default:
+			continue
+		}
+
+		data, err := host.read(ctx, branch, file)
+		if err != nil {
+			return nil, err
+		}
+		read++
+
+		manifests, err := decodeHpaManifests(file, data)
+		if err != nil {
+			log.Debug().Err(err).Str("file", file).Msg("Skipping file which is not valid YAML")
+			continue
+		}
+		result = append(result, manifests...)
+	}
+
+	log.Debug().Int("files", read).Int("hpas", len(result)).Str("in", program.location()).Msg("Read manifests")
+
+	return result, nil
+}
+
+// title returns the title of the request, which is also the commit message
+func (program *HpaPropose) title(changes []*proposedChange) string {
+	if program.Title != "" {
+		return program.Title
+	}
+
+	var setting string
+	switch {
+	case program.CPUTarget > 0:
+		setting = fmt.Sprintf("CPU target to %d%%", program.CPUTarget)
+	case program.Minimum != "":
+		setting = "minimum to " + program.Minimum
+	default:
+		setting = "maximum to " + program.Maximum
+	}
+
+	which := fmt.Sprintf("%d HPAs", len(changes))
+	if len(changes) == 1 {
+		which = changes[0].current.Namespace + "/" + changes[0].current.Name
+	}
+
+	title := fmt.Sprintf("Set %s of %s", setting, which)
+	if program.Ticket != "" {
+		title = program.Ticket + ": " + title
+	}
+	return title
+}
+
+// body returns the description of the request, a table of the changes and the HPAs left out
+func (program *HpaPropose) body(changes []*proposedChange, missing []string, cluster string) string {
+	var out strings.Builder
+
+	out.WriteString("Proposed by `k8sutils hpa propose`")
+	if cluster != "" {
+		out.WriteString(" from cluster `" + cluster + "`")
+	}
+	out.WriteString(".\n\n")
+	if program.Ticket != "" {
+		out.WriteString("Ticket: " + program.Ticket + "\n\n")
+	}
+
+	out.WriteString("| HPA | Replicas (min/max) | CPU target | Manifest |\n|---|---|---|---|\n")
+	for _, c := range changes {
+		current, proposed := c.current.Spec, c.proposed.Spec
+		fmt.Fprintf(&out, "| %s/%s | %d/%d → %d/%d | %s | `%s` |\n", c.current.Namespace, c.current.Name,
+			replicasOf(current.MinReplicas), current.MaxReplicas, replicasOf(proposed.MinReplicas), proposed.MaxReplicas,
+			changedPercent(current.TargetCPUUtilizationPercentage, proposed.TargetCPUUtilizationPercentage), c.manifest.file)
+	}
+
+	if len(missing) > 0 {
+		out.WriteString("\nNot changed, as no manifest was found: " + strings.Join(missing, ", ") + "\n")
+	}
+
+	return out.String()
+}
+
+// changedPercent describes a percentage which may have changed
+func changedPercent(from, to *int32) string {
+	format := func(value *int32) string {
+		if value == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%d%%", *value)
+	}
+	if equality.Semantic.DeepEqual(from, to) {
+		return format(from)
+	}
+	return format(from) + " → " + format(to)
+}
+
+// hpaManifest is an HPA document in a manifest file
+type hpaManifest struct {
+	file            string
+	namespace, name string
+	v1              bool
+	root            *yaml.Node
+	// source is the content of the file
+	source []byte
+}
+
+// decodeHpaManifests returns the HPA documents in a manifest file, keeping the YAML nodes so the file can be edited
+// without changing anything else in it
+func decodeHpaManifests(file string, data []byte) ([]*hpaManifest, error) {
+	var result []*hpaManifest
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var document yaml.Node
+		if err := decoder.Decode(&document); err != nil {
+			if errors.Is(err, io.EOF) {
+				return result, nil
+			}
+			return nil, err
+		}
+		if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+
+		root := document.Content[0]
+		if yamlValue(root, "kind").Value != "HorizontalPodAutoscaler" {
+			continue
+		}
+		metadata := yamlValue(root, "metadata")
+		result = append(result, &hpaManifest{
+			file:      file,
+			namespace: yamlValue(metadata, "namespace").Value,
+			name:      yamlValue(metadata, "name").Value,
+			v1:        yamlValue(root, "apiVersion").Value == "autoscaling/v1",
+			root:      root,
+			source:    data,
+		})
+	}
+}
+
+// yamlValue returns the value of the key in a YAML mapping, which is an empty node if there is none
+func yamlValue(mapping *yaml.Node, key string) *yaml.Node {
+	if _, v := yamlKeyValue(mapping, key); v != nil {
+		return v
+	}
+	return &yaml.Node{}
+}
+
+// yamlKeyValue returns the key and value nodes of the key in a YAML mapping, or nils if there is none
+func yamlKeyValue(mapping *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i], mapping.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// proposeEdits matches each change to its manifest and edits the manifests, returning the edited files and the HPAs
+// which have no manifest.  A manifest without a namespace matches an HPA of its name in any namespace, as long as no
+// manifest names the HPA's namespace.
+func proposeEdits(changes []*proposedChange, manifests []*hpaManifest, cpu bool) ([]proposedFile, []string, error) {
+	edits := map[string][]manifestEdit{}
+	sources := map[string][]byte{}
+	var files, missing []string
+
+	for _, c := range changes {
+		key := c.current.Namespace + "/" + c.current.Name
+
+		var exact, unqualified []*hpaManifest
+		for _, m := range manifests {
+			switch {
+			case m.name != c.current.Name:
+			case m.namespace == c.current.Namespace:
+				exact = append(exact, m)
+			case m.namespace == "":
+				unqualified = append(unqualified, m)
+			}
+		}
+		candidates := exact
+		if len(candidates) == 0 {
+			candidates = unqualified
+		}
+
+		switch len(candidates) {
+		case 0:
+			missing = append(missing, key)
+			continue
+		case 1:
+		default:
+			var files []string
+			for _, m := range candidates {
+				files = append(files, m.file)
+			}
+			log.Warn().Str("hpa", key).Strs("files", files).Msg("Several manifests define the HPA, change them by hand")
+			missing = append(missing, key)
+			continue
+		}
+
+		m := candidates[0]
+		e, err := m.edits(c.proposed, cpu)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s, HPA %s: %w", m.file, key, err)
+		}
+		c.manifest = m
+		if _, ok := sources[m.file]; !ok {
+			sources[m.file] = m.source
+			files = append(files, m.file)
+		}
+		edits[m.file] = append(edits[m.file], e...)
+	}
+
+	var result []proposedFile
+	sort.Strings(files)
+	for _, file := range files {
+		if len(edits[file]) == 0 {
+			continue
+		}
+		content, diff := applyEdits(sources[file], edits[file])
+		result = append(result, proposedFile{path: file, content: content})
+
+		fmt.Println(paint(text.Bold, file))
+		for _, line := range diff {
+			color := text.FgGreen
+			if strings.HasPrefix(line, "-") {
+				color = text.FgRed
+			}
+			fmt.Println(paint(color, line))
+		}
+	}
+
+	return result, missing, nil
+}
+
+// manifestEdit replaces the text at a position in a manifest file, or with a zero column inserts a line before the line
+type manifestEdit struct {
+	line, column, length int
+	text                 string
+}
+
+// edits returns the edits which give the manifest the HPA's replica range, and its CPU target if cpu is set
+func (m *hpaManifest) edits(hpa *v1.HorizontalPodAutoscaler, cpu bool) ([]manifestEdit, error) {
+	spec := yamlValue(m.root, "spec")
+	if spec.Kind != yaml.MappingNode || spec.Style&yaml.FlowStyle != 0 {
+		return nil, errors.New("spec is not a YAML block mapping, change it by hand")
+	}
+
+	maxKey, maxValue := yamlKeyValue(spec, "maxReplicas")
+	if maxKey == nil {
+		return nil, errors.New("spec has no maxReplicas")
+	}
+
+	var result []manifestEdit
+	set := func(node *yaml.Node, value int32) error {
+		if node.Kind != yaml.ScalarNode {
+			return fmt.Errorf("line %d is not a number", node.Line)
+		}
+		if node.Value == strconv.Itoa(int(value)) {
+			return nil
+		}
+		length := len([]rune(node.Value))
+		if node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 {
+			length += 2
+		}
+		result = append(result, manifestEdit{line: node.Line, column: node.Column, length: length, text: strconv.Itoa(int(value))})
+		return nil
+	}
+	// setOrAdd adds a missing setting of the spec beside maxReplicas, with its indentation
+	setOrAdd := func(key string, value int32) error {
+		if _, node := yamlKeyValue(spec, key); node != nil {
+			return set(node, value)
+		}
+		result = append(result, manifestEdit{line: maxKey.Line, text: fmt.Sprintf("%s%s: %d", strings.Repeat(" ", maxKey.Column-1), key, value)})
+		return nil
+	}
+
+	if err := setOrAdd("minReplicas", replicasOf(hpa.Spec.MinReplicas)); err != nil {
+		return nil, err
+	}
+	if err := set(maxValue, hpa.Spec.MaxReplicas); err != nil {
+		return nil, err
+	}
+
+	if !cpu || hpa.Spec.TargetCPUUtilizationPercentage == nil {
+		return result, nil
+	}
+	target := *hpa.Spec.TargetCPUUtilizationPercentage
+
+	if m.v1 {
+		return result, setOrAdd("targetCPUUtilizationPercentage", target)
+	}
+
+	metrics := yamlValue(spec, "metrics")
+	for _, metric := range metrics.Content {
+		resource := yamlValue(metric, "resource")
+		if yamlValue(metric, "type").Value != "Resource" || yamlValue(resource, "name").Value != "cpu" {
+			continue
+		}
+		if utilization := yamlValue(yamlValue(resource, "target"), "averageUtilization"); utilization.Kind == yaml.ScalarNode {
+			return result, set(utilization, target)
+		}
+	}
+
+	return nil, errors.New("no CPU utilization metric to change")
+}
+
+// applyEdits returns the content with the edits made, and the lines removed and added by them
+func applyEdits(content []byte, edits []manifestEdit) ([]byte, []string) {
+	lines := strings.SplitAfter(string(content), "\n")
+
+	// Edit from the end so the positions of the edits still to make do not move.  Lines inserted before the same line
+	// end up in the reverse of the order they are inserted in, so those are inserted last first.
+	edits = slices.Clone(edits)
+	slices.Reverse(edits)
+	sort.SliceStable(edits, func(i, j int) bool {
+		a, b := edits[i], edits[j]
+		return a.line > b.line || (a.line == b.line && a.column > b.column)
+	})
+
+	var diff []string
+	for _, edit := range edits {
+		i := edit.line - 1
+		if edit.column == 0 {
+			lines = append(lines[:i], append([]string{edit.text + "\n"}, lines[i:]...)...)
+			diff = append([]string{fmt.Sprintf("+%d: %s", edit.line, edit.text)}, diff...)
+			continue
+		}
+
+		line := []rune(lines[i])
+		start := edit.column - 1
+		edited := string(line[:start]) + edit.text + string(line[start+edit.length:])
+		diff = append([]string{
+			fmt.Sprintf("-%d: %s", edit.line, strings.TrimRight(lines[i], "\r\n")),
+			fmt.Sprintf("+%d: %s", edit.line, strings.TrimRight(edited, "\r\n")),
+		}, diff...)
+		lines[i] = edited
+	}
+
+	return []byte(strings.Join(lines, "")), diff
+}
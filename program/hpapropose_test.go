@@ -0,0 +1,338 @@
+package program
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// proposedHpa returns an HPA with the given limits, and CPU target unless it is 0
+func proposedHpa(namespace, name string, minimum, maximum, cpu int32) *v1.HorizontalPodAutoscaler {
+	hpa := &v1.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       v1.HorizontalPodAutoscalerSpec{MinReplicas: &minimum, MaxReplicas: maximum},
+	}
+	if cpu != 0 {
+		hpa.Spec.TargetCPUUtilizationPercentage = &cpu
+	}
+	return hpa
+}
+
+func TestManifestEdits(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		hpa      *v1.HorizontalPodAutoscaler
+		cpu      bool
+		want     string
+		wantErr  string
+	}{
+		{
+			name: "v2 limits and CPU target",
+			manifest: `apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: web
+spec:
+  minReplicas: 2   # keep two for redundancy
+  maxReplicas: 10
+  metrics:
+    - type: Resource
+      resource:
+        name: memory
+        target:
+          type: Utilization
+          averageUtilization: 80
+    - type: Resource
+      resource:
+        name: cpu
+        target:
+          type: Utilization
+          averageUtilization: 70
+`,
+			hpa: proposedHpa("default", "web", 4, 20, 60),
+			cpu: true,
+			want: `apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: web
+spec:
+  minReplicas: 4   # keep two for redundancy
+  maxReplicas: 20
+  metrics:
+    - type: Resource
+      resource:
+        name: memory
+        target:
+          type: Utilization
+          averageUtilization: 80
+    - type: Resource
+      resource:
+        name: cpu
+        target:
+          type: Utilization
+          averageUtilization: 60
+`,
+		},
+		{
+			name: "quoted scalars are replaced with their quotes",
+			manifest: `kind: HorizontalPodAutoscaler
+spec:
+  minReplicas: '2'
+  maxReplicas: "10" # ≤ the node pool
+`,
+			hpa: proposedHpa("default", "web", 3, 100, 0),
+			want: `kind: HorizontalPodAutoscaler
+spec:
+  minReplicas: 3
+  maxReplicas: 100 # ≤ the node pool
+`,
+		},
+		{
+			name: "unchanged values are not edited",
+			manifest: `kind: HorizontalPodAutoscaler
+spec:
+  minReplicas: "2"
+  maxReplicas: 10
+`,
+			hpa: proposedHpa("default", "web", 2, 10, 0),
+			want: `kind: HorizontalPodAutoscaler
+spec:
+  minReplicas: "2"
+  maxReplicas: 10
+`,
+		},
+		{
+			name: "a missing minReplicas is inserted with the indentation of maxReplicas",
+			manifest: `kind: HorizontalPodAutoscaler
+spec:
+    scaleTargetRef:
+        kind: Deployment
+        name: web
+    maxReplicas: 10
+`,
+			hpa: proposedHpa("default", "web", 3, 10, 0),
+			want: `kind: HorizontalPodAutoscaler
+spec:
+    scaleTargetRef:
+        kind: Deployment
+        name: web
+    minReplicas: 3
+    maxReplicas: 10
+`,
+		},
+		{
+			name: "v1 CPU target",
+			manifest: `apiVersion: autoscaling/v1
+kind: HorizontalPodAutoscaler
+spec:
+  maxReplicas: 10
+  targetCPUUtilizationPercentage: 80
+`,
+			hpa: proposedHpa("default", "web", 1, 10, 50),
+			cpu: true,
+			want: `apiVersion: autoscaling/v1
+kind: HorizontalPodAutoscaler
+spec:
+  minReplicas: 1
+  maxReplicas: 10
+  targetCPUUtilizationPercentage: 50
+`,
+		},
+		{
+			name: "inserted lines keep their order",
+			manifest: `apiVersion: autoscaling/v1
+kind: HorizontalPodAutoscaler
+spec:
+  maxReplicas: 10
+`,
+			hpa: proposedHpa("default", "web", 2, 12, 50),
+			cpu: true,
+			want: `apiVersion: autoscaling/v1
+kind: HorizontalPodAutoscaler
+spec:
+  minReplicas: 2
+  targetCPUUtilizationPercentage: 50
+  maxReplicas: 12
+`,
+		},
+		{
+			name: "v2 without a CPU metric",
+			manifest: `apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+spec:
+  maxReplicas: 10
+  metrics:
+    - type: Resource
+      resource:
+        name: memory
+        target:
+          type: Utilization
+          averageUtilization: 80
+`,
+			hpa:     proposedHpa("default", "web", 1, 10, 50),
+			cpu:     true,
+			wantErr: "no CPU utilization metric to change",
+		},
+		{
+			name:     "flow style spec",
+			manifest: "kind: HorizontalPodAutoscaler\nspec: {minReplicas: 1, maxReplicas: 10}\n",
+			hpa:      proposedHpa("default", "web", 2, 10, 0),
+			wantErr:  "spec is not a YAML block mapping",
+		},
+		{
+			name:     "no maxReplicas",
+			manifest: "kind: HorizontalPodAutoscaler\nspec:\n  minReplicas: 1\n",
+			hpa:      proposedHpa("default", "web", 2, 10, 0),
+			wantErr:  "spec has no maxReplicas",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			manifests, err := decodeHpaManifests("hpa.yaml", []byte(test.manifest))
+			require.NoError(t, err)
+			require.Len(t, manifests, 1)
+
+			edits, err := manifests[0].edits(test.hpa, test.cpu)
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			content, _ := applyEdits([]byte(test.manifest), edits)
+			assert.Equal(t, test.want, string(content))
+		})
+	}
+}
+
+func TestApplyEditsDiff(t *testing.T) {
+	content, diff := applyEdits([]byte("spec:\n  maxReplicas: 10\n"), []manifestEdit{
+		{line: 2, column: 16, length: 2, text: "20"},
+		{line: 2, text: "  minReplicas: 2"},
+	})
+
+	assert.Equal(t, "spec:\n  minReplicas: 2\n  maxReplicas: 20\n", string(content))
+	assert.Equal(t, []string{"+2:   minReplicas: 2", "-2:   maxReplicas: 10", "+2:   maxReplicas: 20"}, diff)
+}
+
+func TestDecodeHpaManifests(t *testing.T) {
+	manifests, err := decodeHpaManifests("web.yaml", []byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+---
+# The HPA of the web deployment
+apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: web
+  namespace: payments
+spec:
+  maxReplicas: 10
+---
+---
+apiVersion: autoscaling/v1
+kind: HorizontalPodAutoscaler
+metadata:
+  name: worker
+spec:
+  maxReplicas: 4
+`))
+	require.NoError(t, err)
+
+	require.Len(t, manifests, 2)
+	assert.Equal(t, []string{"payments", "web"}, []string{manifests[0].namespace, manifests[0].name})
+	assert.False(t, manifests[0].v1)
+	assert.Equal(t, []string{"", "worker"}, []string{manifests[1].namespace, manifests[1].name})
+	assert.True(t, manifests[1].v1)
+
+	_, err = decodeHpaManifests("chart.yaml", []byte("spec:\n  maxReplicas: {{ .Values.max }\n"))
+	assert.Error(t, err, "templates are not YAML")
+}
+
+func TestProposeEdits(t *testing.T) {
+	both := []byte(`apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: web
+  namespace: payments
+spec:
+  maxReplicas: 10
+---
+apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: worker
+  namespace: payments
+spec:
+  minReplicas: 1
+  maxReplicas: 4
+`)
+	unqualified := []byte("kind: HorizontalPodAutoscaler\nmetadata:\n  name: web\nspec:\n  maxReplicas: 10\n")
+	duplicate := []byte("kind: HorizontalPodAutoscaler\nmetadata:\n  name: api\nspec:\n  maxReplicas: 10\n")
+
+	var manifests []*hpaManifest
+	for file, data := range map[string][]byte{
+		"payments/hpas.yaml": both,
+		"base/web.yaml":      unqualified,
+		"a/api.yaml":         duplicate,
+		"b/api.yaml":         duplicate,
+	} {
+		decoded, err := decodeHpaManifests(file, data)
+		require.NoError(t, err)
+		manifests = append(manifests, decoded...)
+	}
+
+	change := func(namespace, name string, minimum, maximum int32) *proposedChange {
+		return &proposedChange{current: proposedHpa(namespace, name, 1, 10, 0), proposed: proposedHpa(namespace, name, minimum, maximum, 0)}
+	}
+	changes := []*proposedChange{
+		change("payments", "web", 2, 20),
+		change("payments", "worker", 2, 8),
+		change("staging", "web", 1, 5),
+		change("payments", "api", 1, 5),
+		change("payments", "queue", 1, 5),
+	}
+
+	files, missing, err := proposeEdits(changes, manifests, false)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"payments/api", "payments/queue"}, missing, "HPAs with several manifests or none are left out")
+
+	require.Len(t, files, 2)
+	assert.Equal(t, "base/web.yaml", files[0].path, "a manifest without a namespace matches an HPA of its name in any namespace")
+	assert.Equal(t, "kind: HorizontalPodAutoscaler\nmetadata:\n  name: web\nspec:\n  minReplicas: 1\n  maxReplicas: 5\n", string(files[0].content))
+	assert.Equal(t, "payments/hpas.yaml", files[1].path)
+	assert.Equal(t, `apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: web
+  namespace: payments
+spec:
+  minReplicas: 2
+  maxReplicas: 20
+---
+apiVersion: autoscaling/v2
+kind: HorizontalPodAutoscaler
+metadata:
+  name: worker
+  namespace: payments
+spec:
+  minReplicas: 2
+  maxReplicas: 8
+`, string(files[1].content), "every document of a file is edited")
+
+	for _, c := range changes {
+		key := c.current.Namespace + "/" + c.current.Name
+		if key == "payments/api" || key == "payments/queue" {
+			assert.Nil(t, c.manifest, key)
+		} else {
+			assert.NotNil(t, c.manifest, key)
+		}
+	}
+}
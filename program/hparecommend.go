@@ -0,0 +1,331 @@
+package program
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// HpaRecommend suggests min, max and CPU target values for each HPA from its target's CPU usage and replica counts over
+// --window in Prometheus: the minimum covers the low (p10) demand, and the maximum covers the peak (p99) demand with
+// --headroom to spare.  Spiky workloads get a lower target, so there is room to absorb a spike while new pods start.
+// With --history the demand and replicas come from the history written by "hpa record" rather than Prometheus.  With
+// --apply the recommendations are made to the HPAs.
+type HpaRecommend struct {
+	Window       string  `default:"7d" help:"Prometheus duration of history to base recommendations on"`
+	History      string  `type:"existingfile" help:"History written by hpa record to base recommendations on instead of Prometheus"`
+	Headroom     float64 `default:"30" help:"Percentage above the peak demand the maximum allows for"`
+	Apply        bool    `help:"Change the HPAs to the recommended values"`
+	OverrideLock bool    `help:"Apply recommendations to locked HPAs too"`
+	Ticket       string  `help:"Change ticket (e.g. JIRA-123) recorded with every modification"`
+
+	Prometheus `embed:""`
+	Selector   `embed:"" set:"resources=HPAs"`
+	Bulk       `embed:""`
+}
+
+// spikeRatio is how many times the median demand the peak must be for a workload to be treated as spiky
+const spikeRatio = 2
+
+// minSuggestedTarget is the lowest CPU target recommended for spiky workloads
+const minSuggestedTarget = 50
+
+// hpaRecommendation is what the history of one HPA suggests
+type hpaRecommendation struct {
+	hpa *v1.HorizontalPodAutoscaler
+	// demand percentiles in cores and the CPU request of each pod
+	p10, p50, p99 float64
+	request       float64
+	peakReplicas  string
+	min, max      int32
+	target        int32
+	// problem is why no recommendation could be made
+	problem string
+}
+
+// minHistorySnapshots is how many measurements of an HPA's CPU utilization the history needs for a recommendation
+const minHistorySnapshots = 10
+
+func (program *HpaRecommend) Run(options *Options) error {
+
+	initColors(options)
+
+	if program.Apply && !program.selected() {
+		return usageError("no HPAs selected to apply to, name them or use --labels or --all")
+	}
+
+	if program.History == "" && program.PrometheusURL == "" {
+		return usageError("--prometheus-url or --history is required")
+	}
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	client := WithRetries(NewHPAClient(clientset), options.Retries)
+	hpas, err := program.getHpas(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	selector := Selector{AllNamespaces: program.AllNamespaces, ChunkSize: program.ChunkSize, namespaceName: program.namespaceName}
+	templates, err := podTemplates(ctx, clientset, &selector)
+	if err != nil {
+		return err
+	}
+	specs := podSpecsByWorkload(templates)
+
+	var history map[string][]hpaSnapshot
+	if program.History != "" {
+		window, err := parsePromDuration(program.Window)
+		if err != nil {
+			return usageError("bad --window: %v", err)
+		}
+		if history, err = readHistory(program.History, options.contextName(), time.Now().Add(-window)); err != nil {
+			return usageError("reading history: %v", err)
+		}
+	}
+
+	var recommendations []hpaRecommendation
+	for i := range hpas {
+		hpa := &hpas[i]
+		ref := hpa.Spec.ScaleTargetRef
+
+		r, err := program.recommend(ctx, hpa, specs[hpa.Namespace+"/"+ref.Kind+"/"+ref.Name], history)
+		if err != nil {
+			return err
+		}
+		recommendations = append(recommendations, r)
+	}
+
+	printRecommendations(recommendations)
+
+	if !program.Apply {
+		return nil
+	}
+
+	var changes []hpaRecommendation
+	for _, r := range recommendations {
+		if r.problem == "" {
+			changes = append(changes, r)
+		}
+	}
+
+	return options.runAsLeader(ctx, clientset, func(ctx context.Context) error {
+		results := newSummary()
+		defer results.print()
+
+		errs := program.Bulk.run(ctx, len(changes), options.DryRun, false, func(i int) error {
+			r := changes[i]
+			hpa := r.hpa
+
+			if isLocked(hpa) && !program.OverrideLock {
+				results.record(hpa.Namespace, hpa.Name, outcomeSkipped, "locked: "+hpa.Annotations[AnnotationLocked])
+				return nil
+			}
+
+			changed, err := modifyHPA(ctx, options, hpa, r.strategy(), client, program.Ticket)
+			switch {
+			case err != nil:
+				fmt.Printf("Failed to update HPA %s: %v\n", hpa.Name, err)
+				results.record(hpa.Namespace, hpa.Name, outcomeFailed, err.Error())
+				return fmt.Errorf("HPA %s: %w", hpa.Name, err)
+			case !changed:
+				results.record(hpa.Namespace, hpa.Name, outcomeSkipped, "already at the recommended values")
+			case options.DryRun:
+				results.record(hpa.Namespace, hpa.Name, outcomeUpdated, "dry run: "+hpa.Annotations[AnnotationChange])
+			default:
+				results.record(hpa.Namespace, hpa.Name, outcomeUpdated, hpa.Annotations[AnnotationChange])
+			}
+			return nil
+		})
+
+		for _, r := range changes {
+			if !results.has(r.hpa.Namespace, r.hpa.Name) {
+				results.record(r.hpa.Namespace, r.hpa.Name, outcomeSkipped, "not started")
+			}
+		}
+
+		return errors.Join(errs...)
+	})
+}
+
+// recommend finds the demand of the HPA's target, from Prometheus or else the recorded history, and works out the
+// values the HPA should have
+func (program *HpaRecommend) recommend(ctx context.Context, hpa *v1.HorizontalPodAutoscaler, spec *corev1.PodSpec, history map[string][]hpaSnapshot) (hpaRecommendation, error) {
+	r := hpaRecommendation{hpa: hpa, peakReplicas: "-"}
+
+	if hpa.Spec.TargetCPUUtilizationPercentage == nil {
+		r.problem = "does not scale on CPU utilization"
+		return r, nil
+	}
+
+	if spec == nil {
+		r.problem = "target not found"
+		return r, nil
+	}
+	for _, container := range spec.Containers {
+		request := container.Resources.Requests[corev1.ResourceCPU]
+		r.request += request.AsApproximateFloat64()
+	}
+	if r.request == 0 {
+		r.problem = "no CPU request"
+		return r, nil
+	}
+
+	if history != nil {
+		historyDemand(&r, history[hpa.Namespace+"/"+hpa.Name])
+	} else if err := program.prometheusDemand(ctx, &r); err != nil {
+		return r, err
+	}
+	if r.problem != "" {
+		return r, nil
+	}
+
+	// Lower the target of a spiky workload by 10 points, but not below the minimum or above where it already is
+	r.target = *hpa.Spec.TargetCPUUtilizationPercentage
+	if r.p50 > 0 && r.p99/r.p50 > spikeRatio {
+		r.target = max(r.target-10, min(r.target, minSuggestedTarget))
+	}
+
+	perPod := r.request * float64(r.target) / 100
+	r.min = max(int32(math.Ceil(r.p10/perPod)), 1)
+	r.max = max(int32(math.Ceil(r.p99*(1+program.Headroom/100)/perPod)), r.min)
+
+	return r, nil
+}
+
+// prometheusDemand queries the CPU usage of the HPA's target over the window, and the most replicas it had
+func (program *HpaRecommend) prometheusDemand(ctx context.Context, r *hpaRecommendation) error {
+	hpa := r.hpa
+
+	// Pods of a Deployment are named <name>-<hash>-<suffix> and of a StatefulSet <name>-<ordinal>
+	pods := regexp.QuoteMeta(hpa.Spec.ScaleTargetRef.Name) + "-[a-z0-9]+(-[a-z0-9]+)?"
+	demand := fmt.Sprintf(`sum(rate(container_cpu_usage_seconds_total{namespace=%s,pod=~%s,container!="",container!="POD"}[5m]))`,
+		promString(hpa.Namespace), promString(pods))
+
+	for _, q := range []struct {
+		quantile float64
+		value    *float64
+	}{{0.10, &r.p10}, {0.50, &r.p50}, {0.99, &r.p99}} {
+		value, ok, err := program.query(ctx, fmt.Sprintf("quantile_over_time(%g, (%s)[%s:5m])", q.quantile, demand, program.Window))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			r.problem = "no CPU usage history"
+			return nil
+		}
+		*q.value = value
+	}
+
+	// Replica history comes from kube-state-metrics, which may not be installed
+	replicas, ok, err := program.query(ctx, fmt.Sprintf("max_over_time(kube_horizontalpodautoscaler_status_current_replicas{namespace=%s,horizontalpodautoscaler=%s}[%s])",
+		promString(hpa.Namespace), promString(hpa.Name), program.Window))
+	if err != nil {
+		return err
+	}
+	if ok {
+		r.peakReplicas = strconv.Itoa(int(replicas))
+	}
+
+	return nil
+}
+
+// historyDemand works out the CPU demand at each snapshot of the HPA, as its replicas times their utilization of the
+// current request, and the most replicas it had
+func historyDemand(r *hpaRecommendation, snapshots []hpaSnapshot) {
+	var demand []float64
+	var peak int32
+	for _, s := range snapshots {
+		peak = max(peak, s.Current)
+		if s.CPUTarget > 0 {
+			demand = append(demand, float64(s.Current)*float64(s.CPUUtilization)/100*r.request)
+		}
+	}
+
+	if len(snapshots) > 0 {
+		r.peakReplicas = strconv.Itoa(int(peak))
+	}
+	if len(demand) < minHistorySnapshots {
+		r.problem = fmt.Sprintf("%d CPU measurements in the history, %d needed", len(demand), minHistorySnapshots)
+		return
+	}
+
+	sort.Float64s(demand)
+	rank := func(p float64) float64 {
+		return demand[max(int(math.Ceil(p*float64(len(demand))))-1, 0)]
+	}
+	r.p10, r.p50, r.p99 = rank(0.10), rank(0.50), rank(0.99)
+}
+
+// strategy changes an HPA to the recommended values
+func (r *hpaRecommendation) strategy() strategy {
+	return func(hpa *v1.HorizontalPodAutoscaler) error {
+		minimum := r.min
+		hpa.Spec.MinReplicas = &minimum
+		hpa.Spec.MaxReplicas = r.max
+		target := r.target
+		hpa.Spec.TargetCPUUtilizationPercentage = &target
+		return nil
+	}
+}
+
+// printRecommendations shows the demand, current values and recommended values of each HPA
+func printRecommendations(recommendations []hpaRecommendation) {
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "HPA", "CPU P10/P50/P99", "REQUEST", "PEAK REPLICAS", "CURRENT", "RECOMMENDED"})
+
+	for _, r := range recommendations {
+		hpa := r.hpa
+
+		current := fmt.Sprintf("%d/%d", max(replicasOf(hpa.Spec.MinReplicas), 1), hpa.Spec.MaxReplicas)
+		if target := hpa.Spec.TargetCPUUtilizationPercentage; target != nil {
+			current += fmt.Sprintf(" at %d%%", *target)
+		}
+
+		if r.problem != "" {
+			t.AppendRow(table.Row{hpa.Namespace, hpa.Name, "-", "-", r.peakReplicas, current, paint(text.FgYellow, r.problem)})
+			continue
+		}
+
+		recommended := fmt.Sprintf("%d/%d at %d%%", r.min, r.max, r.target)
+		if recommended != current {
+			recommended = paint(text.FgGreen, recommended)
+		}
+
+		t.AppendRow(table.Row{
+			hpa.Namespace,
+			hpa.Name,
+			fmt.Sprintf("%s/%s/%s", cores(r.p10), cores(r.p50), cores(r.p99)),
+			cores(r.request),
+			r.peakReplicas,
+			current,
+			recommended,
+		})
+	}
+
+	t.Render()
+
+	log.Info().Int("hpas", len(recommendations)).Msg("Recommendations made")
+}
+
+// cores shows an amount of CPU in millicores
+func cores(value float64) string {
+	return fmt.Sprintf("%.0fm", value*1000)
+}
@@ -0,0 +1,76 @@
+package program
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"k8s.io/client-go/kubernetes"
+)
+
+// HpaRecord adds a snapshot of the spec and status of each selected HPA to a local SQLite history, once or every
+// --interval until interrupted.  The timeline, flapping and recommend commands read the history with --history, so
+// they can look further back than the cluster keeps events, without Prometheus.
+type HpaRecord struct {
+	History  string        `default:"~/.k8sutils/history.db" type:"path" help:"SQLite database to add the snapshots to, created if need be"`
+	Interval time.Duration `help:"Record a snapshot every interval until interrupted (default record once)"`
+
+	Selector `embed:"" set:"resources=HPAs"`
+}
+
+func (program *HpaRecord) Run(options *Options) error {
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	cluster := options.contextName()
+
+	if program.Interval <= 0 {
+		return program.record(ctx, clientset, cluster)
+	}
+
+	return options.runAsLeader(ctx, clientset, func(ctx context.Context) error {
+		ticker := time.NewTicker(program.Interval)
+		defer ticker.Stop()
+
+		for {
+			// A failure is retried at the next interval rather than ending the recording
+			if err := program.record(ctx, clientset, cluster); err != nil {
+				log.Warn().Err(err).Msg("Failed to record HPAs")
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// record adds a snapshot of each selected HPA to the history
+func (program *HpaRecord) record(ctx context.Context, clientset kubernetes.Interface, cluster string) error {
+	selector := program.Selector
+	hpas, err := getHpasV2(ctx, clientset, &selector)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	snapshots := make([]hpaSnapshot, 0, len(hpas))
+	for i := range hpas {
+		snapshots = append(snapshots, newSnapshot(&hpas[i], cluster, now))
+	}
+
+	if err := appendHistory(program.History, snapshots); err != nil {
+		return usageError("writing history: %v", err)
+	}
+
+	log.Info().Int("hpas", len(snapshots)).Str("history", program.History).Msg("Recorded HPAs")
+	return nil
+}
@@ -0,0 +1,270 @@
+package program
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/rs/zerolog/log"
+	v2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// HpaReport summarises the health of every HPA in the cluster for platform reviews: how many are pinned at their
+// maximum, how many report a failing condition, how many are still managed through the deprecated autoscaling/v1 API,
+// how much room their min to max ranges give them, and how their CPU utilization and replicas are spread relative to
+// their targets and maximums.
+type HpaReport struct {
+	Labels    map[string]string `short:"l" help:"Label filters to select HPAs"`
+	ChunkSize int64             `default:"500" help:"Number of HPAs to fetch per list request"`
+}
+
+// ratioBuckets are the upper bounds of the max/min ratio ranges reported, the last catching everything above
+var ratioBuckets = []struct {
+	label string
+	upper float64
+}{
+	{"1 (fixed)", 1},
+	{"up to 2x", 2},
+	{"up to 5x", 5},
+	{"up to 10x", 10},
+	{"over 10x", 0},
+}
+
+func (program *HpaReport) Run(options *Options) error {
+
+	initColors(options)
+
+	selector := Selector{Labels: program.Labels, AllNamespaces: true, ChunkSize: program.ChunkSize}
+
+	clientset, err := selector.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	hpas, err := getHpasV2(ctx, clientset, &selector)
+	if err != nil {
+		return err
+	}
+
+	fleet := summarizeHpas(hpas)
+
+	t := newTable()
+	t.AppendHeader(table.Row{"MEASURE", "HPAS", "SHARE"})
+	t.AppendRow(table.Row{"total", strconv.Itoa(fleet.total), fmt.Sprintf("in %d namespaces", fleet.namespaces)})
+	t.AppendRow(table.Row{"at maximum", strconv.Itoa(fleet.atMax), share(fleet.atMax, fleet.total)})
+	t.AppendRow(table.Row{"failing conditions", strconv.Itoa(len(fleet.failing)), share(len(fleet.failing), fleet.total)})
+	t.AppendRow(table.Row{"managed through autoscaling/v1", strconv.Itoa(fleet.legacy), share(fleet.legacy, fleet.total)})
+	t.Render()
+
+	fmt.Println()
+
+	r := newTable()
+	r.AppendHeader(table.Row{"MAX/MIN RATIO", "HPAS", "SHARE"})
+	for b, bucket := range ratioBuckets {
+		r.AppendRow(table.Row{bucket.label, strconv.Itoa(fleet.ratios[b]), share(fleet.ratios[b], fleet.total)})
+	}
+	r.Render()
+
+	fmt.Println()
+
+	u := newTable()
+	u.AppendHeader(table.Row{"STATISTIC", "HPAS", "P50", "P90", "MAX"})
+	u.AppendRow(append(table.Row{"CPU utilization % of target", strconv.Itoa(len(fleet.utilization))}, percentiles(fleet.utilization)...))
+	u.AppendRow(append(table.Row{"replicas % of maximum", strconv.Itoa(len(fleet.capacity))}, percentiles(fleet.capacity)...))
+	u.Render()
+
+	log.Info().Int64("replicas", fleet.running).Int64("maximum", fleet.ceiling).Str("share", share(int(fleet.running), int(fleet.ceiling))).Msg("Fleet replicas in use")
+
+	if len(fleet.failing) > 0 {
+		fmt.Println()
+		failing := newTable()
+		failing.AppendHeader(table.Row{"NAMESPACE", "HPA", "CONDITION", "REASON", "MESSAGE"})
+		for _, f := range fleet.failing {
+			failing.AppendRow(table.Row{f.hpa.Namespace, f.hpa.Name, string(f.condition.Type), f.condition.Reason, f.condition.Message})
+		}
+		failing.Render()
+		log.Warn().Int("count", len(fleet.failing)).Msg("HPAs with failing conditions")
+	}
+
+	return nil
+}
+
+// hpaFleet holds the measures of a set of HPAs shown by the report
+type hpaFleet struct {
+	total, namespaces, atMax, legacy int
+	// ratios counts the HPAs in each of the ratioBuckets
+	ratios []int
+	// utilization and capacity are each HPA's CPU utilization as a percentage of its target, and its replicas as a
+	// percentage of its maximum
+	utilization, capacity []float64
+	running, ceiling      int64
+	failing               []failingHpa
+}
+
+// failingHpa is an HPA with the condition which says it is not working
+type failingHpa struct {
+	hpa       *v2.HorizontalPodAutoscaler
+	condition *v2.HorizontalPodAutoscalerCondition
+}
+
+// summarizeHpas measures the HPAs for the report
+func summarizeHpas(hpas []v2.HorizontalPodAutoscaler) *hpaFleet {
+	fleet := &hpaFleet{total: len(hpas), ratios: make([]int, len(ratioBuckets))}
+	namespaces := map[string]bool{}
+
+	for i := range hpas {
+		hpa := &hpas[i]
+		namespaces[hpa.Namespace] = true
+
+		if hpa.Status.CurrentReplicas >= hpa.Spec.MaxReplicas {
+			fleet.atMax++
+		}
+
+		if current, target, ok := cpuUtilization(hpa); ok {
+			fleet.utilization = append(fleet.utilization, 100*float64(current)/float64(target))
+		}
+		if hpa.Spec.MaxReplicas > 0 {
+			fleet.capacity = append(fleet.capacity, 100*float64(hpa.Status.CurrentReplicas)/float64(hpa.Spec.MaxReplicas))
+		}
+		fleet.running += int64(hpa.Status.CurrentReplicas)
+		fleet.ceiling += int64(hpa.Spec.MaxReplicas)
+
+		if managedThroughV1(&hpa.ObjectMeta) {
+			fleet.legacy++
+		}
+
+		minimum := max(replicasOf(hpa.Spec.MinReplicas), 1)
+		ratio := float64(hpa.Spec.MaxReplicas) / float64(minimum)
+		for b, bucket := range ratioBuckets {
+			if bucket.upper == 0 || ratio <= bucket.upper {
+				fleet.ratios[b]++
+				break
+			}
+		}
+
+		if condition := failingCondition(hpa.Status.Conditions); condition != nil {
+			fleet.failing = append(fleet.failing, failingHpa{hpa, condition})
+		}
+	}
+
+	fleet.namespaces = len(namespaces)
+	return fleet
+}
+
+// getHpasV2 returns the selected HPAs through the autoscaling/v2 API, which unlike v1 reports conditions, every metric
+// and scaling behavior
+func getHpasV2(ctx context.Context, clientset kubernetes.Interface, selector *Selector) ([]v2.HorizontalPodAutoscaler, error) {
+	hpas := clientset.AutoscalingV2().HorizontalPodAutoscalers
+
+	return fetch(ctx, selector, "HPA",
+		func(ctx context.Context, namespace, name string) (*v2.HorizontalPodAutoscaler, error) {
+			return hpas(namespace).Get(ctx, name, metav1.GetOptions{})
+		},
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]v2.HorizontalPodAutoscaler, string, error) {
+			list, err := hpas(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+}
+
+// cpuUtilization returns the HPA's current and target average CPU utilization, if it scales on CPU utilization and
+// has measured it
+func cpuUtilization(hpa *v2.HorizontalPodAutoscaler) (int32, int32, bool) {
+	var target int32
+	for _, metric := range hpa.Spec.Metrics {
+		if metric.Type == v2.ResourceMetricSourceType && metric.Resource != nil && metric.Resource.Name == corev1.ResourceCPU &&
+			metric.Resource.Target.AverageUtilization != nil {
+			target = *metric.Resource.Target.AverageUtilization
+		}
+	}
+	if target == 0 {
+		return 0, 0, false
+	}
+
+	for _, metric := range hpa.Status.CurrentMetrics {
+		if metric.Type == v2.ResourceMetricSourceType && metric.Resource != nil && metric.Resource.Name == corev1.ResourceCPU &&
+			metric.Resource.Current.AverageUtilization != nil {
+			return *metric.Resource.Current.AverageUtilization, target, true
+		}
+	}
+	return 0, 0, false
+}
+
+// percentiles returns the 50th and 90th percentiles and the maximum of the values by nearest rank, or dashes if there
+// are none
+func percentiles(values []float64) table.Row {
+	ranks := percentileValues(values)
+	if ranks == nil {
+		return table.Row{"-", "-", "-"}
+	}
+
+	row := table.Row{}
+	for _, value := range ranks {
+		row = append(row, fmt.Sprintf("%.0f%%", value))
+	}
+	return row
+}
+
+// percentileValues returns the 50th and 90th percentiles and the maximum of the values by nearest rank, or nil if there
+// are none
+func percentileValues(values []float64) []float64 {
+	if len(values) == 0 {
+		return nil
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(sorted)))) - 1
+		return sorted[max(i, 0)]
+	}
+
+	return []float64{rank(0.5), rank(0.9), rank(1)}
+}
+
+// failingCondition returns the first of the HPA's AbleToScale and ScalingActive conditions which is false, or nil if
+// the HPA is working
+func failingCondition(conditions []v2.HorizontalPodAutoscalerCondition) *v2.HorizontalPodAutoscalerCondition {
+	for i := range conditions {
+		condition := &conditions[i]
+		switch condition.Type {
+		case v2.AbleToScale, v2.ScalingActive:
+			if condition.Status == corev1.ConditionFalse {
+				return condition
+			}
+		}
+	}
+	return nil
+}
+
+// managedThroughV1 returns true if someone other than this tool last wrote the object's spec through the
+// autoscaling/v1 API, which cannot express multiple metrics or scaling behavior
+func managedThroughV1(meta *metav1.ObjectMeta) bool {
+	for _, entry := range meta.ManagedFields {
+		if entry.Subresource == "" && entry.Manager != FieldManager && entry.APIVersion == "autoscaling/v1" {
+			return true
+		}
+	}
+	return strings.Contains(meta.Annotations[corev1.LastAppliedConfigAnnotation], `"apiVersion":"autoscaling/v1"`)
+}
+
+// share returns count as a percentage of total
+func share(count, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", 100*float64(count)/float64(total))
+}
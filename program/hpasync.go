@@ -0,0 +1,114 @@
+package program
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	v1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// HpaSyncReplicas sets the replicas of each HPA's target to the HPA's desired replica count.  GitOps repositories which
+// keep replicas in Git can then copy values which roughly match what is running, so a sync does not scale a busy
+// service back down to a stale count.
+type HpaSyncReplicas struct {
+	Ticket string `help:"Change ticket (e.g. JIRA-123) recorded with every modification"`
+
+	Selector `embed:"" set:"resources=HPAs"`
+	Bulk     `embed:""`
+}
+
+func (program *HpaSyncReplicas) Run(options *Options) error {
+
+	initColors(options)
+
+	if !program.selected() {
+		return usageError("no HPAs selected, name them or use --labels or --all")
+	}
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	clients, err := newScaleClients(options, clientset)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	hpas, err := program.getHpas(ctx, WithRetries(NewHPAClient(clientset), options.Retries))
+	if err != nil {
+		return err
+	}
+
+	scaler := &Scale{Ticket: program.Ticket}
+
+	return options.runAsLeader(ctx, clientset, func(ctx context.Context) error {
+		results := newSummary()
+		defer results.print()
+
+		errs := program.Bulk.run(ctx, len(hpas), options.DryRun, false, func(i int) error {
+			hpa := &hpas[i]
+
+			message, err := syncReplicas(ctx, options, clients, scaler, hpa)
+			switch {
+			case err != nil:
+				fmt.Printf("Failed to sync replicas for HPA %s: %v\n", hpa.Name, err)
+				results.record(hpa.Namespace, hpa.Name, outcomeFailed, err.Error())
+				return fmt.Errorf("HPA %s: %w", hpa.Name, err)
+			case message == "":
+				results.record(hpa.Namespace, hpa.Name, outcomeSkipped, "target already at the desired replicas")
+			case options.DryRun:
+				results.record(hpa.Namespace, hpa.Name, outcomeUpdated, "dry run: "+message)
+			default:
+				results.record(hpa.Namespace, hpa.Name, outcomeUpdated, message)
+			}
+			return nil
+		})
+
+		for _, hpa := range hpas {
+			if !results.has(hpa.Namespace, hpa.Name) {
+				results.record(hpa.Namespace, hpa.Name, outcomeSkipped, "not started")
+			}
+		}
+
+		return errors.Join(errs...)
+	})
+}
+
+// syncReplicas scales the HPA's target to the HPA's desired replicas, returning a description of the change or "" if
+// the target is already there
+func syncReplicas(ctx context.Context, options *Options, clients *scaleClients, scaler *Scale, hpa *v1.HorizontalPodAutoscaler) (string, error) {
+	desired := hpa.Status.DesiredReplicas
+
+	// An HPA which has not run yet reports no desired count, which must not be taken as a request to scale to zero
+	if desired == 0 {
+		return "", nil
+	}
+
+	ref := hpa.Spec.ScaleTargetRef
+
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return "", err
+	}
+
+	mapping, err := clients.mapper.RESTMapping(schema.GroupKind{Group: gv.Group, Kind: ref.Kind}, gv.Version)
+	if err != nil {
+		return "", apiError(err)
+	}
+
+	message, err := scaler.scaleOne(ctx, options, clients, mapping.Resource.GroupResource(), mapping.GroupVersionKind,
+		types.NamespacedName{Namespace: hpa.Namespace, Name: ref.Name},
+		func(int32) int32 { return desired })
+	if message != "" {
+		message = fmt.Sprintf("%s %s %s", ref.Kind, ref.Name, message)
+	}
+
+	return message, err
+}
@@ -0,0 +1,361 @@
+package program
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	v2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// HpaTimeline shows the replica changes the selected HPAs have made, oldest first.  They come from the HPA
+// controller's SuccessfulRescale events, which the cluster only keeps for a short time (an hour by default), and
+// optionally from an API server audit log, which records every scale the controller made for as long as it is kept, or
+// the history written by "hpa record".
+type HpaTimeline struct {
+	AuditLog string        `type:"existingfile" help:"API server audit log (JSON lines) to read scale operations from as well as events"`
+	History  string        `type:"existingfile" help:"History written by hpa record to read replica changes from as well as events"`
+	Since    time.Duration `help:"Only show changes in this long before now (default everything available)"`
+	Graph    bool          `help:"Draw a chart of each HPA's replicas over time instead of listing the changes"`
+	Width    int           `default:"60" help:"Width of the chart in characters"`
+	Height   int           `default:"10" help:"Height of the chart in lines"`
+
+	Selector `embed:"" set:"resources=HPAs"`
+}
+
+// scalingEvent is a change of replicas made by an HPA
+type scalingEvent struct {
+	Time      time.Time
+	Namespace string
+	HPA       string
+	Replicas  int32
+	Reason    string
+	Source    string
+}
+
+// successfulRescale is the reason of the Event the HPA controller records when it changes replicas
+const successfulRescale = "SuccessfulRescale"
+
+// rescaleMessage matches the message of a SuccessfulRescale event, e.g. "New size: 4; reason: cpu resource
+// utilization (percentage of request) above target"
+var rescaleMessage = regexp.MustCompile(`^New size: (\d+); reason: (.*)$`)
+
+func (program *HpaTimeline) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	selector := program.Selector
+	hpas, err := getHpasV2(ctx, clientset, &selector)
+	if err != nil {
+		return err
+	}
+
+	events, err := program.Selector.scalingEvents(ctx, clientset, hpas, program.AuditLog, program.History, options.contextName())
+	if err != nil {
+		return err
+	}
+
+	if program.Since > 0 {
+		events = eventsSince(events, time.Now().Add(-program.Since))
+	}
+
+	if len(events) == 0 {
+		log.Info().Int("hpas", len(hpas)).Msg("No scaling events found, events are only kept for a short time")
+		return nil
+	}
+
+	if program.Graph {
+		printReplicaCharts(events, hpas, time.Now(), max(program.Width, 10), max(program.Height, 2))
+	} else {
+		printTimeline(events)
+	}
+
+	return nil
+}
+
+// scalingEvents returns the replica changes of the HPAs, from their SuccessfulRescale events, from the scale
+// operations in the audit log if auditLog is not empty, and from the cluster's snapshots in the history if history is
+// not empty, sorted by time
+func (program *Selector) scalingEvents(ctx context.Context, clientset kubernetes.Interface, hpas []v2.HorizontalPodAutoscaler, auditLog, history, cluster string) ([]scalingEvent, error) {
+	selected := map[string]bool{}
+	for _, hpa := range hpas {
+		selected[hpa.Namespace+"/"+hpa.Name] = true
+	}
+
+	var result []scalingEvent
+
+	listOptions := metav1.ListOptions{
+		Limit:         program.ChunkSize,
+		FieldSelector: "involvedObject.kind=HorizontalPodAutoscaler,reason=" + successfulRescale,
+	}
+	for {
+		list, err := clientset.CoreV1().Events(program.namespace()).List(ctx, listOptions)
+		if err != nil {
+			return nil, apiError(err)
+		}
+
+		for i := range list.Items {
+			event := &list.Items[i]
+			if !selected[event.InvolvedObject.Namespace+"/"+event.InvolvedObject.Name] {
+				continue
+			}
+			if e, ok := parseRescaleEvent(event); ok {
+				result = append(result, e)
+			}
+		}
+
+		if list.Continue == "" {
+			break
+		}
+		listOptions.Continue = list.Continue
+	}
+
+	if auditLog != "" {
+		audited, err := auditScaleEvents(auditLog, hpas)
+		if err != nil {
+			return nil, usageError("reading audit log: %v", err)
+		}
+		result = append(result, audited...)
+	}
+
+	if history != "" {
+		recorded, err := historyScaleEvents(history, cluster, hpas)
+		if err != nil {
+			return nil, usageError("reading history: %v", err)
+		}
+		result = append(result, recorded...)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Time.Before(result[j].Time)
+	})
+
+	return result, nil
+}
+
+// parseRescaleEvent reads the new replica count from a SuccessfulRescale event.  An event repeated with the same
+// message is only seen at its latest time.
+func parseRescaleEvent(event *corev1.Event) (scalingEvent, bool) {
+	match := rescaleMessage.FindStringSubmatch(event.Message)
+	if match == nil {
+		return scalingEvent{}, false
+	}
+
+	replicas, err := strconv.Atoi(match[1])
+	if err != nil {
+		return scalingEvent{}, false
+	}
+
+	return scalingEvent{
+		Time:      eventTime(event),
+		Namespace: event.InvolvedObject.Namespace,
+		HPA:       event.InvolvedObject.Name,
+		Replicas:  int32(replicas),
+		Reason:    match[2],
+		Source:    "event",
+	}, true
+}
+
+// auditEntry is the part of an API server audit event needed to find scale operations
+type auditEntry struct {
+	Stage string `json:"stage"`
+	User  struct {
+		Username string `json:"username"`
+	} `json:"user"`
+	ObjectRef struct {
+		Resource    string `json:"resource"`
+		Namespace   string `json:"namespace"`
+		Name        string `json:"name"`
+		Subresource string `json:"subresource"`
+	} `json:"objectRef"`
+	RequestObject struct {
+		Spec struct {
+			Replicas *int32 `json:"replicas"`
+		} `json:"spec"`
+	} `json:"requestObject"`
+	StageTimestamp metav1.MicroTime `json:"stageTimestamp"`
+	ResponseStatus struct {
+		Code int `json:"code"`
+	} `json:"responseStatus"`
+}
+
+// auditScaleEvents reads the successful writes to the scale subresource of the HPAs' targets made by the HPA controller
+// from an audit log.  The log must be recorded at the Request level or above to include the new replicas.
+func auditScaleEvents(path string, hpas []v2.HorizontalPodAutoscaler) ([]scalingEvent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	targets := map[string]string{}
+	for _, hpa := range hpas {
+		ref := hpa.Spec.ScaleTargetRef
+		targets[hpa.Namespace+"/"+strings.ToLower(ref.Kind)+"s/"+ref.Name] = hpa.Name
+	}
+
+	var result []scalingEvent
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+
+		ref := entry.ObjectRef
+		if entry.Stage != "ResponseComplete" || ref.Subresource != "scale" || entry.RequestObject.Spec.Replicas == nil ||
+			entry.ResponseStatus.Code >= 300 || !strings.Contains(entry.User.Username, "horizontal-pod-autoscaler") {
+			continue
+		}
+
+		hpa, ok := targets[ref.Namespace+"/"+ref.Resource+"/"+ref.Name]
+		if !ok {
+			continue
+		}
+
+		result = append(result, scalingEvent{
+			Time:      entry.StageTimestamp.Time,
+			Namespace: ref.Namespace,
+			HPA:       hpa,
+			Replicas:  *entry.RequestObject.Spec.Replicas,
+			Source:    "audit",
+		})
+	}
+
+	return result, scanner.Err()
+}
+
+// eventsSince returns the events at or after the time
+func eventsSince(events []scalingEvent, since time.Time) []scalingEvent {
+	var result []scalingEvent
+	for _, e := range events {
+		if !e.Time.Before(since) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// printTimeline shows the replica changes in order with the change from each HPA's previous count
+func printTimeline(events []scalingEvent) {
+	t := newTable()
+	t.AppendHeader(table.Row{"TIME", "NAMESPACE", "HPA", "REPLICAS", "CHANGE", "REASON", "SOURCE"})
+
+	previous := map[string]int32{}
+	for _, e := range events {
+		key := e.Namespace + "/" + e.HPA
+
+		change := "-"
+		if last, ok := previous[key]; ok {
+			switch delta := e.Replicas - last; {
+			case delta > 0:
+				change = paint(text.FgGreen, fmt.Sprintf("+%d", delta))
+			case delta < 0:
+				change = paint(text.FgYellow, strconv.Itoa(int(delta)))
+			default:
+				change = "0"
+			}
+		}
+		previous[key] = e.Replicas
+
+		t.AppendRow(table.Row{e.Time.Local().Format(time.DateTime), e.Namespace, e.HPA, strconv.Itoa(int(e.Replicas)), change, orDash(e.Reason), e.Source})
+	}
+
+	t.Render()
+}
+
+// printReplicaCharts draws a chart of the replicas of each HPA with scaling events, from its first event until now,
+// ending at its current replicas
+func printReplicaCharts(events []scalingEvent, hpas []v2.HorizontalPodAutoscaler, now time.Time, width, height int) {
+	current := map[string]int32{}
+	for _, hpa := range hpas {
+		current[hpa.Namespace+"/"+hpa.Name] = hpa.Status.CurrentReplicas
+	}
+
+	byHpa := map[string][]scalingEvent{}
+	names := map[string]bool{}
+	for _, e := range events {
+		key := e.Namespace + "/" + e.HPA
+		byHpa[key] = append(byHpa[key], e)
+		names[key] = true
+	}
+
+	for i, key := range sortedKeys(names) {
+		if i > 0 {
+			fmt.Println()
+		}
+		printReplicaChart(key, byHpa[key], current[key], now, width, height)
+	}
+}
+
+// printReplicaChart draws the replicas over time as columns of blocks.  Each column shows the most replicas during its
+// share of the time, so a short spike is not lost between columns.
+func printReplicaChart(name string, events []scalingEvent, current int32, now time.Time, width, height int) {
+	start := events[0].Time
+	if !now.After(start) {
+		now = start.Add(time.Minute)
+	}
+	step := now.Sub(start) / time.Duration(width)
+
+	columns := make([]int32, width)
+	peak := current
+	next := 0
+	replicas := events[0].Replicas
+	for c := range columns {
+		end := start.Add(step * time.Duration(c+1))
+		highest := replicas
+		for ; next < len(events) && events[next].Time.Before(end); next++ {
+			replicas = events[next].Replicas
+			highest = max(highest, replicas)
+		}
+		if c == width-1 {
+			highest = max(highest, current)
+		}
+		columns[c] = highest
+		peak = max(peak, highest)
+	}
+
+	// Use one line per replica when they fit
+	rows := min(int32(height), max(peak, 1))
+
+	fmt.Printf("%s  %s .. %s\n", name, start.Local().Format(time.DateTime), now.Local().Format(time.DateTime))
+
+	label := len(strconv.Itoa(int(peak)))
+	for row := rows; row > 0; row-- {
+		level := (peak*row + rows - 1) / rows
+
+		var line strings.Builder
+		for _, value := range columns {
+			if value >= level {
+				line.WriteString("█")
+			} else {
+				line.WriteString(" ")
+			}
+		}
+		fmt.Printf("%*d ┤%s\n", label, level, line.String())
+	}
+	fmt.Printf("%*s └%s\n", label, "", strings.Repeat("─", width))
+}
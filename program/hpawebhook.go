@@ -0,0 +1,211 @@
+package program
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/autoscaling/v1"
+	v2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// HpaWebhook runs until interrupted as a validating admission webhook, so the policy rules of "hpa lint" are enforced
+// when HPAs are created or updated rather than found afterwards.  HPAs breaking a --deny rule are rejected, and those
+// breaking any other rule are admitted with a warning, which kubectl shows.
+type HpaWebhook struct {
+	Listen   string   `default:":8443" help:"Address to serve the webhook on"`
+	Path     string   `default:"/validate" help:"Path to serve the webhook on"`
+	TLSCert  string   `name:"tls-cert" required:"" type:"existingfile" help:"TLS certificate to serve with, which the API server must trust (reloaded when it changes)"`
+	TLSKey   string   `name:"tls-key" required:"" type:"existingfile" help:"Key of the TLS certificate"`
+	Deny     []string `default:"min-equals-max,missing-requests,target-range" enum:"min-equals-max,missing-requests,target-range" help:"Rules whose violations are rejected (min-equals-max, missing-requests, target-range)"`
+	WarnOnly bool     `help:"Admit every HPA, only warning about violations, e.g. while introducing the policy"`
+
+	HpaPolicy `embed:""`
+}
+
+// maxReviewSize limits the size of an admission review read from the API server
+const maxReviewSize = 3 << 20
+
+func (program *HpaWebhook) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := options.Clientset()
+	if err != nil {
+		return err
+	}
+
+	certificates := &certificateLoader{certFile: program.TLSCert, keyFile: program.TLSKey}
+	if _, err := certificates.get(nil); err != nil {
+		return usageError("loading --tls-cert and --tls-key: %v", err)
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	deny := map[string]bool{}
+	if !program.WarnOnly {
+		for _, rule := range program.Deny {
+			deny[rule] = true
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(program.Path, func(w http.ResponseWriter, r *http.Request) {
+		var review admissionv1.AdmissionReview
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxReviewSize)).Decode(&review); err != nil || review.Request == nil {
+			http.Error(w, "expected an AdmissionReview", http.StatusBadRequest)
+			return
+		}
+
+		review.Response = program.review(r.Context(), clientset, review.Request, deny)
+		review.Response.UID = review.Request.UID
+		review.Request = nil
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(&review); err != nil {
+			log.Warn().Err(err).Msg("Writing admission response")
+		}
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+
+	server := &http.Server{
+		Addr:              program.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig:         &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certificates.get},
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdown); err != nil {
+			log.Warn().Err(err).Msg("Stopping webhook server")
+		}
+	}()
+
+	log.Info().Str("listen", program.Listen).Str("path", program.Path).Strs("deny", sortedKeys(deny)).Msg("Serving HPA admission webhook")
+
+	if err := server.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serving webhook: %w", err)
+	}
+
+	return nil
+}
+
+// review decides whether to admit the HPA in the request, and with which warnings
+func (program *HpaWebhook) review(ctx context.Context, clientset kubernetes.Interface, request *admissionv1.AdmissionRequest, deny map[string]bool) *admissionv1.AdmissionResponse {
+	allowed := &admissionv1.AdmissionResponse{Allowed: true}
+
+	if request.Kind.Kind != "HorizontalPodAutoscaler" || request.Operation == admissionv1.Delete {
+		return allowed
+	}
+
+	// The API server sends the HPA in the version the webhook is registered for
+	var hpa v2.HorizontalPodAutoscaler
+	var err error
+	if request.Kind.Version == "v1" {
+		var old v1.HorizontalPodAutoscaler
+		if err = json.Unmarshal(request.Object.Raw, &old); err == nil {
+			hpa = hpaV1ToV2(&old)
+		}
+	} else {
+		err = json.Unmarshal(request.Object.Raw, &hpa)
+	}
+	if err != nil {
+		allowed.Warnings = []string{"k8sutils: could not read the HPA to check it: " + err.Error()}
+		return allowed
+	}
+	if hpa.Namespace == "" {
+		hpa.Namespace = request.Namespace
+	}
+
+	spec, err := targetPodSpec(ctx, clientset, hpa.Namespace, hpa.Spec.ScaleTargetRef)
+	if err != nil {
+		allowed.Warnings = append(allowed.Warnings, "k8sutils: could not check the target's requests: "+err.Error())
+	}
+
+	var denied []string
+	for _, v := range program.violations(&hpa, spec) {
+		if deny[v.rule] {
+			denied = append(denied, v.String())
+		} else {
+			allowed.Warnings = append(allowed.Warnings, "k8sutils: "+v.String())
+		}
+	}
+
+	logger := log.With().Str("namespace", hpa.Namespace).Str("hpa", hpa.Name).Str("operation", string(request.Operation)).Str("user", request.UserInfo.Username).Logger()
+
+	if len(denied) > 0 {
+		logger.Info().Strs("violations", denied).Msg("Rejected HPA")
+		return &admissionv1.AdmissionResponse{
+			Allowed:  false,
+			Warnings: allowed.Warnings,
+			Result: &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Code:    http.StatusForbidden,
+				Reason:  metav1.StatusReasonForbidden,
+				Message: "HPA breaks policy: " + strings.Join(denied, "; "),
+			},
+		}
+	}
+
+	if len(allowed.Warnings) > 0 {
+		logger.Info().Strs("warnings", allowed.Warnings).Msg("Admitted HPA with warnings")
+	}
+
+	return allowed
+}
+
+// certificateLoader serves the TLS certificate from its files, loading it again when they change, so a certificate
+// renewed by e.g. cert-manager is picked up without a restart
+type certificateLoader struct {
+	certFile, keyFile string
+
+	lock        sync.Mutex
+	certificate *tls.Certificate
+	modified    time.Time
+}
+
+func (loader *certificateLoader) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	loader.lock.Lock()
+	defer loader.lock.Unlock()
+
+	info, err := os.Stat(loader.certFile)
+	if err != nil {
+		if loader.certificate != nil {
+			return loader.certificate, nil
+		}
+		return nil, err
+	}
+
+	if loader.certificate == nil || !info.ModTime().Equal(loader.modified) {
+		certificate, err := tls.LoadX509KeyPair(loader.certFile, loader.keyFile)
+		if err != nil {
+			if loader.certificate != nil {
+				log.Warn().Err(err).Msg("Reloading TLS certificate, keeping the previous one")
+				return loader.certificate, nil
+			}
+			return nil, err
+		}
+		loader.certificate = &certificate
+		loader.modified = info.ModTime()
+	}
+
+	return loader.certificate, nil
+}
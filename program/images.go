@@ -0,0 +1,193 @@
+package program
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Images lists the distinct container images running in each namespace with the workloads which use them.  Before
+// fleet operations such as a bulk restart it shows what will actually be pulled, and a mutable tag such as latest may
+// pull something different from what is running now.
+type Images struct {
+	Mutable bool `help:"Only show images referenced by a mutable tag (latest or no tag) rather than a pinned tag or digest"`
+
+	Selector `embed:""`
+}
+
+// imageUse is an image running in a namespace
+type imageUse struct {
+	namespace string
+	image     string
+	digests   map[string]bool
+	workloads map[string]bool
+}
+
+func (program *Images) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	pods, err := fetch(ctx, &program.Selector, "pod",
+		func(ctx context.Context, namespace, name string) (*corev1.Pod, error) {
+			return clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		},
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]corev1.Pod, string, error) {
+			list, err := clientset.CoreV1().Pods(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+	if err != nil {
+		return err
+	}
+
+	owners := newOwnerResolver(clientset)
+	uses := map[string]*imageUse{}
+
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+
+		kind, name, err := owners.workload(ctx, pod)
+		if err != nil {
+			return err
+		}
+		workload := "Pod/" + pod.Name
+		if kind != "" {
+			workload = kind + "/" + name
+		}
+
+		// The image ID reports the digest the node actually pulled
+		digests := map[string]string{}
+		for _, status := range pod.Status.ContainerStatuses {
+			if _, digest, ok := strings.Cut(status.ImageID, "@"); ok {
+				digests[status.Name] = digest
+			}
+		}
+
+		for _, container := range pod.Spec.Containers {
+			if program.Mutable && !isMutableImage(container.Image) {
+				continue
+			}
+
+			key := pod.Namespace + " " + container.Image
+			use, ok := uses[key]
+			if !ok {
+				use = &imageUse{namespace: pod.Namespace, image: container.Image, digests: map[string]bool{}, workloads: map[string]bool{}}
+				uses[key] = use
+			}
+			use.workloads[workload] = true
+			if digest := digests[container.Name]; digest != "" {
+				use.digests[digest] = true
+			}
+		}
+	}
+
+	rows := make([]*imageUse, 0, len(uses))
+	for _, use := range uses {
+		rows = append(rows, use)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].namespace != rows[j].namespace {
+			return rows[i].namespace < rows[j].namespace
+		}
+		return rows[i].image < rows[j].image
+	})
+
+	printImages(rows)
+
+	mutable := 0
+	for _, row := range rows {
+		if isMutableImage(row.image) {
+			mutable++
+		}
+	}
+	log.Info().Int("images", len(rows)).Int("mutable", mutable).Msg("Images in use")
+
+	return nil
+}
+
+// isMutableImage returns true if the image reference may point to different images over time: it is not pinned by
+// digest and its tag is latest or missing, which means latest
+func isMutableImage(image string) bool {
+	if strings.Contains(image, "@") {
+		return false
+	}
+
+	tag := imageTag(image)
+	return tag == "" || tag == "latest"
+}
+
+// imageTag returns the tag of an image reference, or "" if it has none.  A colon before the last slash separates a
+// registry port, not a tag.
+func imageTag(image string) string {
+	name, _, _ := strings.Cut(image, "@")
+	last := name[strings.LastIndex(name, "/")+1:]
+	if _, tag, ok := strings.Cut(last, ":"); ok {
+		return tag
+	}
+	return ""
+}
+
+// printImages shows each image with the digests running and the workloads using it.  Several digests for one
+// reference mean its tag has moved while pods were running.
+func printImages(rows []*imageUse) {
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "IMAGE", "DIGESTS", "WORKLOADS"})
+
+	for _, row := range rows {
+		image := row.image
+		if isMutableImage(image) {
+			image = paint(text.FgYellow, image)
+		}
+
+		digests := sortedKeys(row.digests)
+		for i, digest := range digests {
+			digests[i] = shortDigest(digest)
+		}
+		digestText := strings.Join(digests, ", ")
+		if len(digests) > 1 {
+			digestText = paint(text.FgRed, digestText)
+		}
+
+		t.AppendRow(table.Row{row.namespace, image, digestText, strings.Join(sortedKeys(row.workloads), ", ")})
+	}
+
+	t.Render()
+}
+
+// shortDigest abbreviates a sha256 digest to the length usually shown
+func shortDigest(digest string) string {
+	const length = len("sha256:") + 12
+	if len(digest) > length {
+		return digest[:length]
+	}
+	return digest
+}
+
+// sortedKeys returns the keys of a set in order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,375 @@
+package program
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// Keda shows or modifies KEDA ScaledObjects, which many services use in place of raw HPAs.  KEDA has no typed client,
+// so ScaledObjects are handled as unstructured objects.
+type Keda struct {
+	Minimum string `name:"min" help:"Set minReplicaCount to this number"`
+	Maximum string `name:"max" help:"Set maxReplicaCount to this number"`
+	Ticket  string `help:"Change ticket (e.g. JIRA-123) recorded with every modification"`
+	Overlap bool   `help:"Report workloads scaled by both a ScaledObject and an HPA which KEDA did not create"`
+
+	Selector `embed:""`
+	Bulk     `embed:""`
+}
+
+var scaledObjectResource = schema.GroupVersionResource{Group: "keda.sh", Version: "v1alpha1", Resource: "scaledobjects"}
+
+// KEDA's defaults for ScaledObjects which do not set their replica counts
+const (
+	kedaDefaultMinReplicas = 0
+	kedaDefaultMaxReplicas = 100
+)
+
+func (program *Keda) Run(options *Options) error {
+
+	initColors(options)
+
+	var change limits
+	if program.Overlap && (program.Minimum != "" || program.Maximum != "") {
+		return usageError("--overlap only reports, it cannot be combined with --minimum or --maximum")
+	}
+	if program.Minimum != "" || program.Maximum != "" {
+		if !program.selected() {
+			return usageError("select ScaledObjects by name, with --labels or with --all")
+		}
+
+		var err error
+		if change, err = parseLimits(program.Minimum, program.Maximum); err != nil {
+			return err
+		}
+	}
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	client, err := options.Dynamic()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	scaledObjects, err := getScaledObjects(ctx, client, &program.Selector)
+	if err != nil {
+		return err
+	}
+
+	if program.Overlap {
+		return program.reportOverlap(ctx, options, clientset, scaledObjects)
+	}
+
+	if change == nil {
+		program.printScaledObjects(scaledObjects)
+		return nil
+	}
+
+	return options.runAsLeader(ctx, clientset, func(ctx context.Context) error {
+		results := newSummary()
+		defer results.print()
+
+		errs := program.Bulk.run(ctx, len(scaledObjects), options.DryRun, false, func(i int) error {
+			so := &scaledObjects[i]
+
+			message, err := program.modify(ctx, options, client, clientset, so, change)
+			switch {
+			case err != nil:
+				fmt.Printf("Failed to update ScaledObject %s: %v\n", so.GetName(), err)
+				results.record(so.GetNamespace(), so.GetName(), outcomeFailed, err.Error())
+				return fmt.Errorf("ScaledObject %s: %w", so.GetName(), err)
+			case message == "":
+				results.record(so.GetNamespace(), so.GetName(), outcomeSkipped, "already at the requested values")
+			case options.DryRun:
+				results.record(so.GetNamespace(), so.GetName(), outcomeUpdated, "dry run: "+message)
+			default:
+				results.record(so.GetNamespace(), so.GetName(), outcomeUpdated, message)
+			}
+			return nil
+		})
+
+		for _, so := range scaledObjects {
+			if !results.has(so.GetNamespace(), so.GetName()) {
+				results.record(so.GetNamespace(), so.GetName(), outcomeSkipped, "not started")
+			}
+		}
+
+		return errors.Join(errs...)
+	})
+}
+
+// getScaledObjects returns the selected ScaledObjects sorted by namespace and name
+func getScaledObjects(ctx context.Context, client dynamic.Interface, selector *Selector) ([]unstructured.Unstructured, error) {
+	scaledObjects := client.Resource(scaledObjectResource).Namespace
+
+	items, err := fetch(ctx, selector, "ScaledObject",
+		func(ctx context.Context, namespace, name string) (*unstructured.Unstructured, error) {
+			return scaledObjects(namespace).Get(ctx, name, metav1.GetOptions{})
+		},
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]unstructured.Unstructured, string, error) {
+			list, err := scaledObjects(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.GetContinue(), nil
+		})
+
+	// Listing a resource type the cluster does not serve fails with not found
+	if apierrors.IsNotFound(err) {
+		return nil, usageError("KEDA is not installed in this cluster (no %s resource)", scaledObjectResource.GroupResource())
+	}
+
+	return items, err
+}
+
+// reportOverlap lists the HPAs which scale the same workload as a ScaledObject but were not created by it.  KEDA
+// creates and owns an HPA for each ScaledObject, so another HPA on the same target is redundant and the two fight over
+// the replica count.
+func (program *Keda) reportOverlap(ctx context.Context, options *Options, clientset kubernetes.Interface, scaledObjects []unstructured.Unstructured) error {
+	hpaSelector := Selector{AllNamespaces: program.AllNamespaces, ChunkSize: program.ChunkSize, namespaceName: program.namespaceName}
+	hpas, err := hpaSelector.getHpas(ctx, WithRetries(NewHPAClient(clientset), options.Retries))
+	if err != nil {
+		return err
+	}
+
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "SCALEDOBJECT", "TARGET", "REDUNDANT HPA", "CREATED BY"})
+	overlaps := 0
+
+	for i := range scaledObjects {
+		so := &scaledObjects[i]
+		kind, name := scaleTarget(so)
+
+		for j := range hpas {
+			hpa := &hpas[j]
+			ref := hpa.Spec.ScaleTargetRef
+			if hpa.Namespace != so.GetNamespace() || ref.Kind != kind || ref.Name != name {
+				continue
+			}
+
+			owner := metav1.GetControllerOf(hpa)
+			if owner != nil && owner.UID == so.GetUID() {
+				continue
+			}
+
+			creator := "-"
+			if owner != nil {
+				creator = owner.Kind + "/" + owner.Name
+			}
+
+			overlaps++
+			t.AppendRow(table.Row{so.GetNamespace(), so.GetName(), kind + "/" + name, paint(text.FgRed, hpa.Name), creator})
+		}
+	}
+
+	if overlaps == 0 {
+		log.Info().Int("scaledobjects", len(scaledObjects)).Msg("No HPAs overlap with ScaledObjects")
+		return nil
+	}
+
+	t.Render()
+	log.Warn().Int("count", overlaps).Msg("HPAs overlapping with ScaledObjects")
+
+	return nil
+}
+
+// replicaLimits returns the min and max replicas of a ScaledObject, applying KEDA's defaults
+func replicaLimits(so *unstructured.Unstructured) (int32, int32) {
+	minimum, found, _ := unstructured.NestedInt64(so.Object, "spec", "minReplicaCount")
+	if !found {
+		minimum = kedaDefaultMinReplicas
+	}
+
+	maximum, found, _ := unstructured.NestedInt64(so.Object, "spec", "maxReplicaCount")
+	if !found {
+		maximum = kedaDefaultMaxReplicas
+	}
+
+	return int32(minimum), int32(maximum)
+}
+
+// triggerTypes returns the type of each of the ScaledObject's triggers
+func triggerTypes(so *unstructured.Unstructured) []string {
+	triggers, _, _ := unstructured.NestedSlice(so.Object, "spec", "triggers")
+
+	var names []string
+	for _, trigger := range triggers {
+		if t, ok := trigger.(map[string]any); ok {
+			if name, ok := t["type"].(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+
+	return names
+}
+
+// scaleTarget returns the kind and name of the workload a ScaledObject scales
+func scaleTarget(so *unstructured.Unstructured) (string, string) {
+	kind, _, _ := unstructured.NestedString(so.Object, "spec", "scaleTargetRef", "kind")
+	name, _, _ := unstructured.NestedString(so.Object, "spec", "scaleTargetRef", "name")
+	if kind == "" {
+		kind = "Deployment"
+	}
+	return kind, name
+}
+
+// conditionStatus returns the status of the named condition in the object's status, or "" if it has none
+func conditionStatus(object *unstructured.Unstructured, conditionType string) string {
+	conditions, _, _ := unstructured.NestedSlice(object.Object, "status", "conditions")
+	for _, condition := range conditions {
+		if c, ok := condition.(map[string]any); ok && c["type"] == conditionType {
+			status, _ := c["status"].(string)
+			return status
+		}
+	}
+	return ""
+}
+
+// modify applies the change to a ScaledObject, returning a description of the change or "" if it already has the
+// requested values.  If the ScaledObject changes while being modified it is fetched again and the change re-applied.
+func (program *Keda) modify(ctx context.Context, options *Options, client dynamic.Interface, clientset kubernetes.Interface, so *unstructured.Unstructured, change limits) (string, error) {
+	scaledObjects := client.Resource(scaledObjectResource).Namespace(so.GetNamespace())
+	message := ""
+	first := true
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if !first {
+			current, err := scaledObjects.Get(ctx, so.GetName(), metav1.GetOptions{})
+			if err != nil {
+				return apiError(err)
+			}
+			*so = *current
+		}
+		first = false
+
+		oldMin, oldMax := replicaLimits(so)
+		newMin, newMax := change(oldMin, oldMax)
+
+		if newMin == oldMin && newMax == oldMax {
+			message = ""
+			return nil
+		}
+
+		message = fmt.Sprintf("replicas %d/%d -> %d/%d", oldMin, oldMax, newMin, newMax)
+		if program.Ticket != "" {
+			message += fmt.Sprintf(" (ticket %s)", program.Ticket)
+		}
+
+		log.Info().
+			Str("namespace", so.GetNamespace()).
+			Str("scaledobject", so.GetName()).
+			Str("change", message).
+			Str("ticket", program.Ticket).
+			Msg("Modifying")
+
+		if options.DryRun {
+			return nil
+		}
+
+		modified := so.DeepCopy()
+		if err := unstructured.SetNestedField(modified.Object, int64(newMin), "spec", "minReplicaCount"); err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(modified.Object, int64(newMax), "spec", "maxReplicaCount"); err != nil {
+			return err
+		}
+
+		annotations := modified.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[AnnotationChange] = message
+		if program.Ticket != "" {
+			annotations[AnnotationTicket] = program.Ticket
+		}
+		modified.SetAnnotations(annotations)
+
+		// The update carries the resourceVersion, so it fails with a conflict if the ScaledObject has changed
+		var updated *unstructured.Unstructured
+		err := withRetries(ctx, options.Retries, func() (err error) {
+			updated, err = scaledObjects.Update(ctx, modified, metav1.UpdateOptions{FieldManager: FieldManager})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		*so = *updated
+
+		recordObjectEvent(ctx, eventCreator(clientset), corev1.ObjectReference{
+			APIVersion:      so.GetAPIVersion(),
+			Kind:            so.GetKind(),
+			Name:            so.GetName(),
+			Namespace:       so.GetNamespace(),
+			UID:             so.GetUID(),
+			ResourceVersion: so.GetResourceVersion(),
+		}, "Modified", message)
+
+		return nil
+	})
+
+	return message, err
+}
+
+// printScaledObjects shows the ScaledObjects as a table
+func (program *Keda) printScaledObjects(scaledObjects []unstructured.Unstructured) {
+	t := newTable()
+
+	header := table.Row{"NAME", "TARGET", "MIN", "MAX", "TRIGGERS", "READY"}
+	if program.AllNamespaces {
+		header = append(table.Row{"NAMESPACE"}, header...)
+	}
+	t.AppendHeader(header)
+
+	for i := range scaledObjects {
+		so := &scaledObjects[i]
+		minimum, maximum := replicaLimits(so)
+		kind, name := scaleTarget(so)
+
+		ready := conditionStatus(so, "Ready")
+		switch ready {
+		case "True":
+			ready = paint(text.FgGreen, ready)
+		case "":
+			ready = "unknown"
+		default:
+			ready = paint(text.FgRed, ready)
+		}
+
+		row := table.Row{
+			so.GetName(),
+			kind + "/" + name,
+			strconv.Itoa(int(minimum)),
+			strconv.Itoa(int(maximum)),
+			strings.Join(triggerTypes(so), ","),
+			ready,
+		}
+		if program.AllNamespaces {
+			row = append(table.Row{so.GetNamespace()}, row...)
+		}
+		t.AppendRow(row)
+	}
+
+	t.Render()
+}
@@ -0,0 +1,201 @@
+package program
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	// Register the auth provider plugins (e.g. OIDC) referenced by kubeconfig files.  Exec credential plugins such as
+	// `aws eks get-token` and `gke-gcloud-auth-plugin` are built in to client-go.
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// Kubernetes holds the flags which select and configure the connection to the cluster.  Every subcommand uses it to
+// build its client, so they all behave identically.
+type Kubernetes struct {
+	Kubeconfig string        `env:"KUBECTL_PLUGINS_GLOBAL_FLAG_KUBECONFIG" help:"Path to the kubeconfig file (default $KUBECONFIG or ~/.kube/config)" type:"path"`
+	Context    string        `env:"KUBECTL_PLUGINS_GLOBAL_FLAG_CONTEXT" help:"Context to use in kubeconfig"`
+	Cluster    string        `env:"KUBECTL_PLUGINS_GLOBAL_FLAG_CLUSTER" help:"Cluster in the kubeconfig to use, overriding the context's"`
+	User       string        `env:"KUBECTL_PLUGINS_GLOBAL_FLAG_USER" help:"User in the kubeconfig to use, overriding the context's"`
+	Namespace  string        `short:"n" env:"KUBECTL_PLUGINS_GLOBAL_FLAG_NAMESPACE,KUBECTL_PLUGINS_CURRENT_NAMESPACE" help:"Namespace to operate in (default from the kubeconfig context)"`
+	Token      string        `env:"KUBECTL_PLUGINS_GLOBAL_FLAG_TOKEN" help:"Bearer token to authenticate to the API server with"`
+	As         string        `env:"KUBECTL_PLUGINS_GLOBAL_FLAG_AS" help:"User to impersonate"`
+	AsGroup    []string      `env:"KUBECTL_PLUGINS_GLOBAL_FLAG_AS_GROUP" help:"Groups to impersonate, with --as"`
+	QPS        float32       `default:"5" help:"Maximum sustained requests per second to the API server"`
+	Burst      int           `default:"10" help:"Maximum burst of requests to the API server"`
+	Timeout    time.Duration `default:"1m" aliases:"request-timeout" help:"Maximum time to wait for each API request (0 to wait forever)"`
+	Retries    int           `default:"3" help:"Number of times to retry API requests which fail with transient errors"`
+
+	AuthTimeout time.Duration `default:"30s" help:"Maximum time to wait for credentials and the first response from the cluster (0 to skip the check)"`
+
+	Server                string `help:"Address of the API server, overriding the kubeconfig"`
+	InsecureSkipTLSVerify bool   `help:"Do not verify the API server certificate (insecure)"`
+	CertificateAuthority  string `help:"Path to a CA certificate file for the API server, overriding the kubeconfig" type:"path"`
+
+	Verbose   int  `short:"v" type:"counter" help:"Log every API request and any client-side throttling"`
+	ForceJSON bool `help:"Talk to the API server in JSON rather than protobuf (useful with -v for debugging)"`
+}
+
+// apiWarnings reports warnings from the API server once per run, however many clients are created
+var apiWarnings = newWarningLogger()
+
+// clientConfig returns the kubeconfig with the command line overrides applied
+func (k *Kubernetes) clientConfig() clientcmd.ClientConfig {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = k.Kubeconfig
+
+	// The same overrides as kubectl's flags, so the program and kubectl connect alike
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: k.Context,
+		Context: clientcmdapi.Context{
+			Cluster:   k.Cluster,
+			AuthInfo:  k.User,
+			Namespace: k.Namespace,
+		},
+		ClusterInfo: clientcmdapi.Cluster{
+			Server:                k.Server,
+			InsecureSkipTLSVerify: k.InsecureSkipTLSVerify,
+			CertificateAuthority:  k.CertificateAuthority,
+		},
+		AuthInfo: clientcmdapi.AuthInfo{
+			Token:             k.Token,
+			Impersonate:       k.As,
+			ImpersonateGroups: k.AsGroup,
+		},
+	}
+
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+}
+
+// contextName returns the name of the kubeconfig context in use, or "" if the kubeconfig cannot be read
+func (k *Kubernetes) contextName() string {
+	if k.Context != "" {
+		return k.Context
+	}
+	raw, err := k.clientConfig().RawConfig()
+	if err != nil {
+		return ""
+	}
+	return raw.CurrentContext
+}
+
+// RestConfig returns the client configuration for the selected cluster
+func (k *Kubernetes) RestConfig() (*rest.Config, error) {
+	config, err := k.clientConfig().ClientConfig()
+	if err != nil {
+		return nil, connectionError(err, "unable to load kubeconfig, use --kubeconfig and --context to select a valid cluster")
+	}
+
+	config.QPS = k.QPS
+	config.Burst = k.Burst
+	config.Timeout = k.Timeout
+	config.WarningHandler = apiWarnings
+
+	if !k.ForceJSON {
+		// Protobuf is much cheaper than JSON to decode for large listings.  JSON remains acceptable for resources
+		// which have no protobuf encoding.
+		config.ContentType = runtime.ContentTypeProtobuf
+		config.AcceptContentTypes = runtime.ContentTypeProtobuf + "," + runtime.ContentTypeJSON
+	}
+	if k.Verbose > 0 {
+		config.RateLimiter = newThrottleReporter(k.QPS, k.Burst, verboseThrottleWarning)
+		config.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+			return &loggingTransport{rt}
+		}
+	} else {
+		config.RateLimiter = newThrottleReporter(k.QPS, k.Burst, throttleWarning)
+	}
+
+	return config, nil
+}
+
+// Clientset returns a Kubernetes clientset for the selected cluster
+func (k *Kubernetes) Clientset() (*kubernetes.Clientset, error) {
+	config, err := k.RestConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, connectionError(err, "unable to create Kubernetes client")
+	}
+
+	if err := k.checkAuth(clientset); err != nil {
+		return nil, err
+	}
+
+	return clientset, nil
+}
+
+// Dynamic returns a dynamic client for the selected cluster, for custom resources such as KEDA ScaledObjects which
+// have no typed client.  Custom resources are only served as JSON.
+func (k *Kubernetes) Dynamic() (dynamic.Interface, error) {
+	config, err := k.RestConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	config.ContentType = runtime.ContentTypeJSON
+	config.AcceptContentTypes = runtime.ContentTypeJSON
+
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, connectionError(err, "unable to create Kubernetes client")
+	}
+
+	return client, nil
+}
+
+// checkAuth makes a first request to the cluster so problems acquiring credentials (e.g. a hung or failing exec
+// plugin) are reported clearly and within --auth-timeout, rather than surfacing from the first real operation
+func (k *Kubernetes) checkAuth(clientset *kubernetes.Clientset) error {
+	if k.AuthTimeout <= 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), k.AuthTimeout)
+	defer cancel()
+
+	err := clientset.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Error()
+
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return connectionError(err, "no response from the cluster within %s, check that any credential plugin in your kubeconfig completes and the API server is reachable (see --auth-timeout)", k.AuthTimeout)
+	case apierrors.IsUnauthorized(err):
+		return connectionError(err, "the cluster rejected the credentials, refresh your login")
+	case strings.Contains(err.Error(), "getting credentials"):
+		return connectionError(err, "unable to acquire credentials, check that the credential plugin in your kubeconfig is installed and logged in")
+	default:
+		return apiError(err)
+	}
+}
+
+// ResolveNamespace returns the namespace given on the command line, or else the namespace of the kubeconfig context
+func (k *Kubernetes) ResolveNamespace() (string, error) {
+	if k.Namespace != "" {
+		return k.Namespace, nil
+	}
+
+	namespace, explicit, err := k.clientConfig().Namespace()
+	if err != nil {
+		return "", connectionError(err, "unable to load kubeconfig, use --kubeconfig and --context to select a valid cluster")
+	}
+
+	if !explicit {
+		return "", usageError("namespace is not set in the current context, use --namespace to select one")
+	}
+
+	return namespace, nil
+}
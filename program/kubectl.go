@@ -0,0 +1,321 @@
+package program
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	v2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/yaml"
+)
+
+// kubectlPluginPrefix starts the name of a kubectl plugin's executable, which kubectl runs for "kubectl <name>"
+const kubectlPluginPrefix = "kubectl-"
+
+// pluginArgs returns the command line to parse when the program runs as a kubectl plugin, and the name to show in
+// help, or the arguments unchanged if it is not a plugin.  kubectl runs kubectl-hpa for "kubectl hpa ..." passing only
+// the arguments after "hpa", so the words of the plugin name are put back.  kubectl-k8sutils runs the whole program.
+func pluginArgs(executable string, args []string) ([]string, string) {
+	name := strings.TrimSuffix(filepath.Base(executable), ".exe")
+	if !strings.HasPrefix(name, kubectlPluginPrefix) {
+		return args, ""
+	}
+
+	// Dashes separate the words of the command, and underscores stand for dashes within a word
+	words := strings.Split(strings.TrimPrefix(name, kubectlPluginPrefix), "-")
+	for i, word := range words {
+		words[i] = strings.ReplaceAll(word, "_", "-")
+	}
+
+	if len(words) == 1 && words[0] == "k8sutils" {
+		return args, "kubectl k8sutils"
+	}
+
+	return append(words, args...), "kubectl"
+}
+
+// kubectlFormat returns true if the -o format is one kubectl get has
+func kubectlFormat(format string) bool {
+	switch {
+	case format == "wide", format == "yaml", format == "json", format == "name":
+		return true
+	case strings.HasPrefix(format, "jsonpath="), strings.HasPrefix(format, "custom-columns="):
+		return true
+	default:
+		return false
+	}
+}
+
+// printKubectl writes the HPAs as kubectl get -o would.  A single HPA given by name is printed on its own, and
+// otherwise they are printed as a List.
+func printKubectl(out io.Writer, hpas []v2.HorizontalPodAutoscaler, format string, single, allNamespaces bool) error {
+	for i := range hpas {
+		hpas[i].APIVersion = v2.SchemeGroupVersion.String()
+		hpas[i].Kind = "HorizontalPodAutoscaler"
+		// kubectl leaves out the managed fields unless asked for them
+		hpas[i].ManagedFields = nil
+	}
+
+	var object any = map[string]any{"apiVersion": "v1", "kind": "List", "metadata": map[string]string{"resourceVersion": ""}, "items": hpas}
+	if single && len(hpas) == 1 {
+		object = &hpas[0]
+	}
+
+	switch {
+	case format == "wide":
+		return printKubectlTable(out, hpas, allNamespaces)
+
+	case format == "name":
+		for _, hpa := range hpas {
+			fmt.Fprintln(out, "horizontalpodautoscaler.autoscaling/"+hpa.Name)
+		}
+		return nil
+
+	case format == "json":
+		data, err := json.MarshalIndent(object, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out, string(data))
+		return err
+
+	case format == "yaml":
+		data, err := yaml.Marshal(object)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(data)
+		return err
+
+	case strings.HasPrefix(format, "jsonpath="):
+		parser, err := newJSONPath(strings.TrimPrefix(format, "jsonpath="))
+		if err != nil {
+			return err
+		}
+		data, err := toJSONValue(object)
+		if err != nil {
+			return err
+		}
+		return parser.Execute(out, data)
+
+	default:
+		return printCustomColumns(out, hpas, strings.TrimPrefix(format, "custom-columns="))
+	}
+}
+
+// newJSONPath parses a template as kubectl does, accepting a bare expression such as .metadata.name without braces
+func newJSONPath(template string) (*jsonpath.JSONPath, error) {
+	if !strings.Contains(template, "{") {
+		template = "{" + template + "}"
+	}
+
+	parser := jsonpath.New("output").AllowMissingKeys(true)
+	if err := parser.Parse(template); err != nil {
+		return nil, usageError("bad jsonpath %q: %v", template, err)
+	}
+	return parser, nil
+}
+
+// toJSONValue returns the value as the maps and slices JSON decodes to, which jsonpath walks by their JSON names
+func toJSONValue(value any) (any, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var result any
+	return result, json.Unmarshal(data, &result)
+}
+
+// printCustomColumns writes a column for each HEADER:expression of the spec
+func printCustomColumns(out io.Writer, hpas []v2.HorizontalPodAutoscaler, spec string) error {
+	var headers []string
+	var parsers []*jsonpath.JSONPath
+	for _, column := range strings.Split(spec, ",") {
+		header, expression, ok := strings.Cut(column, ":")
+		if !ok {
+			return usageError("bad custom-columns %q, expected HEADER:EXPRESSION", column)
+		}
+		parser, err := newJSONPath(expression)
+		if err != nil {
+			return err
+		}
+		headers = append(headers, header)
+		parsers = append(parsers, parser)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 3, ' ', 0)
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+
+	for i := range hpas {
+		item, err := toJSONValue(&hpas[i])
+		if err != nil {
+			return err
+		}
+
+		values := make([]string, len(parsers))
+		for c, parser := range parsers {
+			results, err := parser.FindResults(item)
+			if err != nil {
+				return err
+			}
+			var found []string
+			var buffer bytes.Buffer
+			for _, result := range results {
+				for _, value := range result {
+					buffer.Reset()
+					if err := parser.PrintResults(&buffer, []reflect.Value{value}); err != nil {
+						return err
+					}
+					found = append(found, buffer.String())
+				}
+			}
+			values[c] = strings.Join(found, ",")
+			if values[c] == "" {
+				values[c] = "<none>"
+			}
+		}
+		fmt.Fprintln(w, strings.Join(values, "\t"))
+	}
+
+	return w.Flush()
+}
+
+// printKubectlTable writes the HPAs with the columns of kubectl get, showing every metric rather than the first two
+func printKubectlTable(out io.Writer, hpas []v2.HorizontalPodAutoscaler, allNamespaces bool) error {
+	w := tabwriter.NewWriter(out, 0, 8, 3, ' ', 0)
+
+	header := "NAME\tREFERENCE\tTARGETS\tMINPODS\tMAXPODS\tREPLICAS\tAGE"
+	if allNamespaces {
+		header = "NAMESPACE\t" + header
+	}
+	fmt.Fprintln(w, header)
+
+	for i := range hpas {
+		hpa := &hpas[i]
+		ref := hpa.Spec.ScaleTargetRef
+
+		minimum := "<unset>"
+		if hpa.Spec.MinReplicas != nil {
+			minimum = strconv.Itoa(int(*hpa.Spec.MinReplicas))
+		}
+
+		row := []string{
+			hpa.Name,
+			ref.Kind + "/" + ref.Name,
+			kubectlTargets(hpa),
+			minimum,
+			strconv.Itoa(int(hpa.Spec.MaxReplicas)),
+			strconv.Itoa(int(hpa.Status.CurrentReplicas)),
+			duration.HumanDuration(time.Since(hpa.CreationTimestamp.Time)),
+		}
+		if allNamespaces {
+			row = append([]string{hpa.Namespace}, row...)
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+
+	return w.Flush()
+}
+
+// kubectlTargets describes each metric's current value against its target as kubectl does
+func kubectlTargets(hpa *v2.HorizontalPodAutoscaler) string {
+	if len(hpa.Spec.Metrics) == 0 {
+		return "<none>"
+	}
+
+	quantity := func(q *resource.Quantity) string {
+		if q == nil {
+			return "<unknown>"
+		}
+		return q.String()
+	}
+
+	var targets []string
+	for i, metric := range hpa.Spec.Metrics {
+		var current *v2.MetricStatus
+		if i < len(hpa.Status.CurrentMetrics) && hpa.Status.CurrentMetrics[i].Type == metric.Type {
+			current = &hpa.Status.CurrentMetrics[i]
+		}
+
+		switch {
+		case metric.Resource != nil, metric.ContainerResource != nil:
+			name, target := "", v2.MetricTarget{}
+			var status *v2.MetricValueStatus
+			if metric.Resource != nil {
+				name, target = string(metric.Resource.Name), metric.Resource.Target
+				if current != nil && current.Resource != nil {
+					status = &current.Resource.Current
+				}
+			} else {
+				name, target = string(metric.ContainerResource.Name), metric.ContainerResource.Target
+				if current != nil && current.ContainerResource != nil {
+					status = &current.ContainerResource.Current
+				}
+			}
+
+			value := "<unknown>"
+			if target.AverageUtilization != nil {
+				if status != nil && status.AverageUtilization != nil {
+					value = fmt.Sprintf("%d%%", *status.AverageUtilization)
+				}
+				targets = append(targets, fmt.Sprintf("%s: %s/%d%%", name, value, *target.AverageUtilization))
+			} else {
+				if status != nil && status.AverageValue != nil {
+					value = status.AverageValue.String()
+				}
+				targets = append(targets, fmt.Sprintf("%s: %s/%s", name, value, quantity(target.AverageValue)))
+			}
+
+		case metric.Pods != nil:
+			value := "<unknown>"
+			if current != nil && current.Pods != nil && current.Pods.Current.AverageValue != nil {
+				value = current.Pods.Current.AverageValue.String()
+			}
+			targets = append(targets, fmt.Sprintf("%s/%s", value, quantity(metric.Pods.Target.AverageValue)))
+
+		case metric.Object != nil, metric.External != nil:
+			target := v2.MetricTarget{}
+			var status *v2.MetricValueStatus
+			if metric.Object != nil {
+				target = metric.Object.Target
+				if current != nil && current.Object != nil {
+					status = &current.Object.Current
+				}
+			} else {
+				target = metric.External.Target
+				if current != nil && current.External != nil {
+					status = &current.External.Current
+				}
+			}
+
+			if target.AverageValue != nil {
+				value := "<unknown>"
+				if status != nil && status.AverageValue != nil {
+					value = status.AverageValue.String()
+				}
+				targets = append(targets, fmt.Sprintf("%s/%s (avg)", value, target.AverageValue.String()))
+			} else {
+				value := "<unknown>"
+				if status != nil && status.Value != nil {
+					value = status.Value.String()
+				}
+				targets = append(targets, fmt.Sprintf("%s/%s", value, quantity(target.Value)))
+			}
+
+		default:
+			targets = append(targets, "<unknown type>")
+		}
+	}
+
+	return strings.Join(targets, ", ")
+}
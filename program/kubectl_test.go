@@ -0,0 +1,41 @@
+package program
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPluginArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		executable string
+		args       []string
+		wantArgs   []string
+		wantName   string
+	}{
+		{name: "not a plugin", executable: "/usr/local/bin/k8sutils", args: []string{"hpa", "--all"}, wantArgs: []string{"hpa", "--all"}},
+		{name: "whole program", executable: "/usr/local/bin/kubectl-k8sutils", args: []string{"hpa", "--all"}, wantArgs: []string{"hpa", "--all"}, wantName: "kubectl k8sutils"},
+		{name: "command", executable: "kubectl-hpa", args: []string{"--all", "--max", "2x"}, wantArgs: []string{"hpa", "--all", "--max", "2x"}, wantName: "kubectl"},
+		{name: "subcommand", executable: "/home/me/.krew/bin/kubectl-hpa-report", args: []string{"-A"}, wantArgs: []string{"hpa", "report", "-A"}, wantName: "kubectl"},
+		{name: "underscore is a dash within a word", executable: "kubectl-hpa-sync_replicas", args: nil, wantArgs: []string{"hpa", "sync-replicas"}, wantName: "kubectl"},
+		{name: "windows executable", executable: "kubectl-hpa.exe", args: []string{"web"}, wantArgs: []string{"hpa", "web"}, wantName: "kubectl"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args, name := pluginArgs(test.executable, test.args)
+			assert.Equal(t, test.wantArgs, args)
+			assert.Equal(t, test.wantName, name)
+		})
+	}
+}
+
+func TestKubectlFormat(t *testing.T) {
+	for _, format := range []string{"wide", "yaml", "json", "name", "jsonpath={.items[*].metadata.name}", "custom-columns=NAME:.metadata.name"} {
+		assert.True(t, kubectlFormat(format), format)
+	}
+	for _, format := range []string{"", "kustomize", "helm-values", "table"} {
+		assert.False(t, kubectlFormat(format), format)
+	}
+}
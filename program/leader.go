@@ -0,0 +1,115 @@
+package program
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// LeaderElection holds the flags which let several copies of the tool run side by side, e.g. as replicas of an
+// in-cluster deployment, with only the one holding the lease doing any work
+type LeaderElection struct {
+	LeaderElect    bool          `help:"Only run while holding a lease, so that one of several replicas does the work"`
+	LeaseName      string        `default:"k8sutils" help:"Name of the lease used for leader election"`
+	LeaseNamespace string        `help:"Namespace of the lease used for leader election (default the selected namespace)"`
+	LeaseDuration  time.Duration `default:"15s" help:"How long other replicas wait before taking over an unrenewed lease"`
+	RenewDeadline  time.Duration `default:"10s" help:"How long the leader keeps trying to renew the lease before giving up"`
+	RetryPeriod    time.Duration `default:"2s" help:"How often to try to acquire or renew the lease"`
+}
+
+// errLostLeadership is returned when the lease is lost before the work is finished
+var errLostLeadership = errors.New("lost the leader election lease")
+
+// runAsLeader calls run once this process holds the lease, or immediately if leader election is not enabled.  The
+// context given to run is cancelled if the lease is lost.
+func (options *Options) runAsLeader(ctx context.Context, clientset kubernetes.Interface, run func(context.Context) error) error {
+	if !options.LeaderElect {
+		return run(ctx)
+	}
+
+	namespace := options.LeaseNamespace
+	if namespace == "" {
+		var err error
+		if namespace, err = options.ResolveNamespace(); err != nil {
+			return err
+		}
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	identity := hostname + "_" + uuid.NewString()
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Name: options.LeaseName, Namespace: namespace},
+		Client:     clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var started, finished, lost atomic.Bool
+	done := make(chan error, 1)
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		Name:            options.LeaseName,
+		LeaseDuration:   options.LeaseDuration,
+		RenewDeadline:   options.RenewDeadline,
+		RetryPeriod:     options.RetryPeriod,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				started.Store(true)
+				log.Info().Str("lease", namespace+"/"+options.LeaseName).Msg("Acquired leadership")
+				err := run(ctx)
+				finished.Store(true)
+				done <- err
+				// Stop renewing, which releases the lease for the other replicas
+				cancel()
+			},
+			OnStoppedLeading: func() {
+				if !finished.Load() && parent.Err() == nil {
+					lost.Store(true)
+					log.Warn().Str("lease", namespace+"/"+options.LeaseName).Msg("Lost leadership")
+				}
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					log.Info().Str("leader", leader).Msg("Waiting for leadership")
+				}
+			},
+		},
+	})
+	if err != nil {
+		return usageError("invalid leader election settings: %s", err)
+	}
+
+	log.Debug().Str("identity", identity).Str("lease", namespace+"/"+options.LeaseName).Msg("Starting leader election")
+	elector.Run(ctx)
+
+	if !started.Load() {
+		// Interrupted before ever becoming leader
+		return nil
+	}
+
+	// The context given to run is cancelled once Run returns, so this does not wait long
+	err = <-done
+	if lost.Load() {
+		return errors.Join(errLostLeadership, err)
+	}
+
+	return err
+}
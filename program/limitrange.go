@@ -0,0 +1,255 @@
+package program
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Limitrange audits LimitRanges against the workloads they apply to.  HPA CPU utilization is a percentage of the
+// container's request, so a request quietly set by a LimitRange default, or a LimitRange which rejects the requests a
+// workload asks for, makes autoscaling behave in ways that are hard to trace back.
+type Limitrange struct {
+	Labels        map[string]string `short:"l" help:"Label filters to select workloads"`
+	AllNamespaces bool              `short:"A" help:"Audit all namespaces"`
+}
+
+// limitRangeFinding is a problem found between a LimitRange and a workload container
+type limitRangeFinding struct {
+	Namespace  string
+	LimitRange string
+	Workload   string
+	Container  string
+	Finding    string
+}
+
+// auditedResources are the resources checked against LimitRanges
+var auditedResources = []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory}
+
+func (program *Limitrange) Run(options *Options) error {
+
+	initColors(options)
+
+	selector := Selector{Labels: program.Labels, AllNamespaces: program.AllNamespaces, ChunkSize: 500}
+
+	clientset, err := selector.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	// LimitRanges apply to every pod in their namespace, so they are not filtered by the workload labels
+	rangeSelector := selector
+	rangeSelector.Labels = nil
+
+	ranges, err := fetch(ctx, &rangeSelector, "limitrange", nil,
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]corev1.LimitRange, string, error) {
+			list, err := clientset.CoreV1().LimitRanges(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+	if err != nil {
+		return err
+	}
+
+	templates, err := podTemplates(ctx, clientset, &selector)
+	if err != nil {
+		return err
+	}
+
+	if len(ranges) > 0 {
+		printLimitRanges(ranges)
+	}
+
+	findings := auditLimitRanges(ranges, templates)
+
+	if len(findings) == 0 {
+		log.Info().Int("limitranges", len(ranges)).Int("workloads", len(templates)).Msg("No LimitRange problems found")
+		return nil
+	}
+
+	printLimitRangeFindings(findings)
+	log.Warn().Int("count", len(findings)).Msg("LimitRange problems found")
+
+	return nil
+}
+
+// auditLimitRanges compares the container requests of each workload with the LimitRanges in its namespace
+func auditLimitRanges(ranges []corev1.LimitRange, templates []podTemplate) []limitRangeFinding {
+	byNamespace := map[string][]corev1.LimitRange{}
+	for _, lr := range ranges {
+		byNamespace[lr.Namespace] = append(byNamespace[lr.Namespace], lr)
+	}
+
+	var findings []limitRangeFinding
+	reported := map[string]bool{}
+
+	for _, t := range templates {
+		namespaceRanges, ok := byNamespace[t.Namespace]
+		if !ok {
+			if !reported[t.Namespace] {
+				reported[t.Namespace] = true
+				findings = append(findings, limitRangeFinding{
+					Namespace: t.Namespace,
+					Finding:   "no LimitRange, containers without a CPU request give an HPA no utilization to scale on",
+				})
+			}
+			continue
+		}
+
+		for _, lr := range namespaceRanges {
+			for _, item := range lr.Spec.Limits {
+				if item.Type != corev1.LimitTypeContainer {
+					continue
+				}
+
+				for _, container := range t.Spec.Containers {
+					for _, problem := range checkContainerLimits(container.Resources, item) {
+						findings = append(findings, limitRangeFinding{
+							Namespace:  t.Namespace,
+							LimitRange: lr.Name,
+							Workload:   t.Kind + "/" + t.Name,
+							Container:  container.Name,
+							Finding:    problem,
+						})
+					}
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Namespace < findings[j].Namespace
+	})
+
+	return findings
+}
+
+// checkContainerLimits returns the ways a LimitRange item interferes with a container's resources.  A container which
+// sets a limit but no request gets the limit as its request before any LimitRange applies, so only containers setting
+// neither have their request defaulted.
+func checkContainerLimits(resources corev1.ResourceRequirements, item corev1.LimitRangeItem) []string {
+	var problems []string
+
+	for _, name := range auditedResources {
+		request, hasRequest := resources.Requests[name]
+		limit, hasLimit := resources.Limits[name]
+
+		if !hasRequest && !hasLimit {
+			defaulted, ok := item.DefaultRequest[name]
+			if !ok {
+				defaulted, ok = item.Default[name]
+			}
+			if ok {
+				problems = append(problems, fmt.Sprintf("%s request defaulted to %s, HPA utilization is measured against it", name, defaulted.String()))
+			}
+			continue
+		}
+
+		if !hasRequest {
+			request = limit
+		}
+
+		if !hasLimit {
+			if defaulted, ok := item.Default[name]; ok {
+				if request.Cmp(defaulted) > 0 {
+					problems = append(problems, fmt.Sprintf("%s request %s above default limit %s, pods are rejected", name, request.String(), defaulted.String()))
+				}
+				limit, hasLimit = defaulted, true
+			}
+		}
+
+		if minimum, ok := item.Min[name]; ok && request.Cmp(minimum) < 0 {
+			problems = append(problems, fmt.Sprintf("%s request %s below minimum %s, pods are rejected", name, request.String(), minimum.String()))
+		}
+
+		if maximum, ok := item.Max[name]; ok {
+			if request.Cmp(maximum) > 0 {
+				problems = append(problems, fmt.Sprintf("%s request %s above maximum %s, pods are rejected", name, request.String(), maximum.String()))
+			} else if hasLimit && limit.Cmp(maximum) > 0 {
+				problems = append(problems, fmt.Sprintf("%s limit %s above maximum %s, pods are rejected", name, limit.String(), maximum.String()))
+			}
+		}
+
+		if ratio, ok := item.MaxLimitRequestRatio[name]; ok && hasLimit && !request.IsZero() {
+			actual := limit.AsApproximateFloat64() / request.AsApproximateFloat64()
+			if actual > ratio.AsApproximateFloat64() {
+				problems = append(problems, fmt.Sprintf("%s limit/request ratio %.1f above maximum %s, pods are rejected", name, actual, ratio.String()))
+			}
+		}
+	}
+
+	return problems
+}
+
+// printLimitRanges shows the container limits and defaults of each LimitRange
+func printLimitRanges(ranges []corev1.LimitRange) {
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "LIMITRANGE", "TYPE", "RESOURCE", "MIN", "MAX", "DEFAULT REQUEST", "DEFAULT LIMIT"})
+
+	for _, lr := range ranges {
+		for _, item := range lr.Spec.Limits {
+			for _, name := range limitRangeResources(item) {
+				t.AppendRow(table.Row{
+					lr.Namespace,
+					lr.Name,
+					item.Type,
+					name,
+					quantityOrDash(item.Min, name),
+					quantityOrDash(item.Max, name),
+					quantityOrDash(item.DefaultRequest, name),
+					quantityOrDash(item.Default, name),
+				})
+			}
+		}
+	}
+
+	t.Render()
+}
+
+// printLimitRangeFindings shows the problems found
+func printLimitRangeFindings(findings []limitRangeFinding) {
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "LIMITRANGE", "WORKLOAD", "CONTAINER", "FINDING"})
+
+	for _, f := range findings {
+		t.AppendRow(table.Row{f.Namespace, f.LimitRange, f.Workload, f.Container, f.Finding})
+	}
+
+	t.Render()
+}
+
+// limitRangeResources returns the sorted names of the resources a LimitRange item constrains
+func limitRangeResources(item corev1.LimitRangeItem) []corev1.ResourceName {
+	seen := map[corev1.ResourceName]bool{}
+	for _, list := range []corev1.ResourceList{item.Min, item.Max, item.DefaultRequest, item.Default, item.MaxLimitRequestRatio} {
+		for name := range list {
+			seen[name] = true
+		}
+	}
+
+	names := make([]corev1.ResourceName, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+
+	return names
+}
+
+// quantityOrDash returns the quantity of the resource in the list, or "-" if it is not set
+func quantityOrDash(list corev1.ResourceList, name corev1.ResourceName) string {
+	if quantity, ok := list[name]; ok {
+		return quantity.String()
+	}
+	return "-"
+}
@@ -0,0 +1,100 @@
+package program
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/autoscaling/v1"
+)
+
+// AnnotationLocked marks an HPA as locked against modification by this tool.  The value is the reason for the lock.
+const AnnotationLocked = "k8sutils.io/locked"
+
+// HpaLock sets the lock annotation on the selected HPAs
+type HpaLock struct {
+	Reason string `help:"Reason for the lock, recorded in the annotation" default:"locked"`
+
+	Selector `embed:"" set:"resources=HPAs"`
+}
+
+// HpaUnlock removes the lock annotation from the selected HPAs
+type HpaUnlock struct {
+	Selector `embed:"" set:"resources=HPAs"`
+}
+
+func (program *HpaLock) Run(options *Options) error {
+	return program.setLock(options, func(hpa *v1.HorizontalPodAutoscaler) {
+		hpa.Annotations[AnnotationLocked] = program.Reason
+	})
+}
+
+func (program *HpaUnlock) Run(options *Options) error {
+	return program.setLock(options, func(hpa *v1.HorizontalPodAutoscaler) {
+		delete(hpa.Annotations, AnnotationLocked)
+	})
+}
+
+// isLocked returns true if the HPA carries the lock annotation
+func isLocked(hpa *v1.HorizontalPodAutoscaler) bool {
+	_, ok := hpa.Annotations[AnnotationLocked]
+	return ok
+}
+
+// setLock applies the annotation change to every selected HPA
+func (program *Selector) setLock(options *Options, change func(hpa *v1.HorizontalPodAutoscaler)) error {
+	if !program.selected() {
+		return usageError("no HPAs selected, name them or use --labels or --all")
+	}
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	client := WithRetries(NewHPAClient(clientset), options.Retries)
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	hpas, err := program.getHpas(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	var listErrors []error
+
+	for _, hpa := range hpas {
+		if err := updateLock(ctx, options, client, &hpa, change); err != nil {
+			fmt.Printf("Failed to update HPA %s: %v\n", hpa.Name, err)
+			listErrors = append(listErrors, err)
+		}
+	}
+
+	return errors.Join(listErrors...)
+}
+
+func updateLock(ctx context.Context, options *Options, client HPAClient, hpa *v1.HorizontalPodAutoscaler, change func(hpa *v1.HorizontalPodAutoscaler)) error {
+	return retryOnConflict(ctx, client, hpa, func(hpa *v1.HorizontalPodAutoscaler) error {
+		original := hpa.DeepCopy()
+
+		if hpa.Annotations == nil {
+			hpa.Annotations = map[string]string{}
+		}
+
+		change(hpa)
+
+		log.Info().
+			Str("hpa", hpa.Name).
+			Bool("locked", isLocked(hpa)).
+			Msg("Updating HPA lock")
+
+		if options.DryRun {
+			return nil
+		}
+
+		_, err := patchHPA(ctx, client, original, hpa)
+		return apiError(err)
+	})
+}
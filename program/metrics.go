@@ -0,0 +1,87 @@
+package program
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// The metrics API is served by metrics-server, which has no typed client in client-go, so its objects are read as
+// unstructured
+var nodeMetricsResource = schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "nodes"}
+
+// nodeUsage returns the current CPU and memory usage of each node by name.  It returns nil, and logs why, if the
+// metrics API is not installed or not readable, so callers can show what they have without it.
+func nodeUsage(ctx context.Context, client dynamic.Interface) (map[string]corev1.ResourceList, error) {
+	list, err := client.Resource(nodeMetricsResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		if isUnavailable(err) {
+			log.Warn().Err(err).Msg("Metrics API is not available, not showing usage")
+			return nil, nil
+		}
+		return nil, apiError(err)
+	}
+
+	usage := map[string]corev1.ResourceList{}
+	for _, item := range list.Items {
+		usage[item.GetName()] = metricsUsage(item.Object)
+	}
+
+	return usage, nil
+}
+
+// metricsUsage parses the usage field of a metrics object
+func metricsUsage(object map[string]any) corev1.ResourceList {
+	values, _, _ := unstructured.NestedStringMap(object, "usage")
+
+	usage := corev1.ResourceList{}
+	for name, value := range values {
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			log.Debug().Err(err).Str("resource", name).Str("value", value).Msg("Ignoring unparseable usage")
+			continue
+		}
+		usage[corev1.ResourceName(name)] = quantity
+	}
+
+	return usage
+}
+
+var podMetricsResource = schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"}
+
+// containerUsage returns the current CPU and memory usage of each container by "namespace/pod" and then container
+// name.  Like nodeUsage it returns nil, and logs why, if the metrics API is not available.
+func containerUsage(ctx context.Context, client dynamic.Interface, namespace string) (map[string]map[string]corev1.ResourceList, error) {
+	list, err := client.Resource(podMetricsResource).Namespace(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		if isUnavailable(err) {
+			log.Warn().Err(err).Msg("Metrics API is not available, not showing usage")
+			return nil, nil
+		}
+		return nil, apiError(err)
+	}
+
+	usage := map[string]map[string]corev1.ResourceList{}
+	for _, item := range list.Items {
+		containers, _, _ := unstructured.NestedSlice(item.Object, "containers")
+
+		byName := map[string]corev1.ResourceList{}
+		for _, c := range containers {
+			container, ok := c.(map[string]any)
+			if !ok {
+				continue
+			}
+			name, _, _ := unstructured.NestedString(container, "name")
+			byName[name] = metricsUsage(container)
+		}
+		usage[item.GetNamespace()+"/"+item.GetName()] = byName
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,225 @@
+package program
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/rs/zerolog/log"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NsCmd groups the operations on namespaces
+type NsCmd struct {
+	Summary NsSummary `cmd:"" help:"Show the workloads, requests, HPAs and quota usage of each namespace"`
+}
+
+// NsSummary shows one screen per namespace for tenancy reviews: how many workloads it runs, what its pods request and
+// are limited to, how much its HPAs may scale, and how much of its quota is used.
+type NsSummary struct {
+	Namespaces    []string `arg:"" optional:"" help:"Namespaces to summarise (default the current namespace)"`
+	AllNamespaces bool     `short:"A" help:"Summarise all namespaces"`
+}
+
+// namespaceSummary totals the contents of one namespace
+type namespaceSummary struct {
+	workloads        map[string]int
+	pods             int
+	requests, limits corev1.ResourceList
+	hpas             int
+	hpaCurrent       int32
+	hpaMin, hpaMax   int32
+	quotas           []corev1.ResourceQuota
+}
+
+func (program *NsSummary) Run(options *Options) error {
+
+	initColors(options)
+
+	// Named namespaces are picked out of cluster-wide listings rather than listing each in turn
+	selector := Selector{AllNamespaces: program.AllNamespaces || len(program.Namespaces) > 0, ChunkSize: 500}
+
+	clientset, err := selector.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	summaries, err := summariseNamespaces(ctx, options, clientset, &selector)
+	if err != nil {
+		return err
+	}
+
+	names := program.Namespaces
+	if len(names) == 0 {
+		for name := range summaries {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	if len(names) == 0 {
+		names = []string{selector.namespaceName}
+	}
+
+	for i, name := range names {
+		if i > 0 {
+			fmt.Println()
+		}
+
+		s, ok := summaries[name]
+		if !ok {
+			s = newNamespaceSummary()
+		}
+		printNamespaceSummary(name, s)
+	}
+
+	log.Info().Int("namespaces", len(names)).Msg("Summarised namespaces")
+
+	return nil
+}
+
+// newNamespaceSummary returns an empty summary
+func newNamespaceSummary() *namespaceSummary {
+	return &namespaceSummary{workloads: map[string]int{}, requests: corev1.ResourceList{}, limits: corev1.ResourceList{}}
+}
+
+// summariseNamespaces totals the workloads, pods, HPAs and quotas of the selected namespaces
+func summariseNamespaces(ctx context.Context, options *Options, clientset kubernetes.Interface, selector *Selector) (map[string]*namespaceSummary, error) {
+	summaries := map[string]*namespaceSummary{}
+	summary := func(namespace string) *namespaceSummary {
+		s, ok := summaries[namespace]
+		if !ok {
+			s = newNamespaceSummary()
+			summaries[namespace] = s
+		}
+		return s
+	}
+
+	templates, err := podTemplates(ctx, clientset, selector)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range templates {
+		summary(t.Namespace).workloads[t.Kind]++
+	}
+
+	cronjobs, err := fetch(ctx, selector, "cronjob", nil,
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]batchv1.CronJob, string, error) {
+			list, err := clientset.BatchV1().CronJobs(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	for _, cj := range cronjobs {
+		summary(cj.Namespace).workloads["CronJob"]++
+	}
+
+	pods, err := fetch(ctx, selector, "pod", nil,
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]corev1.Pod, string, error) {
+			list, err := clientset.CoreV1().Pods(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+
+		s := summary(pod.Namespace)
+		s.pods++
+		addResources(s.requests, podRequests(pod))
+		addResources(s.limits, podLimits(pod))
+	}
+
+	hpaSelector := Selector{AllNamespaces: selector.AllNamespaces, ChunkSize: selector.ChunkSize, namespaceName: selector.namespaceName}
+	hpas, err := hpaSelector.getHpas(ctx, WithRetries(NewHPAClient(clientset), options.Retries))
+	if err != nil {
+		return nil, err
+	}
+	for _, hpa := range hpas {
+		s := summary(hpa.Namespace)
+		s.hpas++
+		s.hpaMin += max(replicasOf(hpa.Spec.MinReplicas), 1)
+		s.hpaMax += hpa.Spec.MaxReplicas
+		s.hpaCurrent += hpa.Status.CurrentReplicas
+	}
+
+	quotas, err := clientset.CoreV1().ResourceQuotas(selector.namespace()).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, apiError(err)
+	}
+	for _, quota := range quotas.Items {
+		s := summary(quota.Namespace)
+		s.quotas = append(s.quotas, quota)
+	}
+
+	return summaries, nil
+}
+
+// printNamespaceSummary shows the totals of one namespace followed by its quota usage
+func printNamespaceSummary(name string, s *namespaceSummary) {
+	fmt.Printf("Namespace %s\n\n", name)
+
+	t := newTable()
+	t.AppendHeader(table.Row{"OBJECTS", "COUNT", "REPLICAS (CURRENT MIN/MAX)"})
+	for _, kind := range []string{"Deployment", "StatefulSet", "DaemonSet", "CronJob"} {
+		t.AppendRow(table.Row{kind + "s", strconv.Itoa(s.workloads[kind]), ""})
+	}
+	t.AppendRow(table.Row{"Running pods", strconv.Itoa(s.pods), ""})
+
+	replicas := "-"
+	if s.hpas > 0 {
+		replicas = fmt.Sprintf("%d %d/%d", s.hpaCurrent, s.hpaMin, s.hpaMax)
+	}
+	t.AppendRow(table.Row{"HPAs", strconv.Itoa(s.hpas), replicas})
+	t.Render()
+
+	fmt.Println()
+
+	r := newTable()
+	r.AppendHeader(table.Row{"RESOURCE", "REQUESTS", "LIMITS"})
+	for _, resource := range auditedResources {
+		r.AppendRow(table.Row{string(resource), quantityOrDash(s.requests, resource), quantityOrDash(s.limits, resource)})
+	}
+	r.Render()
+
+	if len(s.quotas) > 0 {
+		fmt.Println()
+		printQuotas(s.quotas)
+	}
+}
+
+// podLimits returns the total container limits of the pod
+func podLimits(pod *corev1.Pod) corev1.ResourceList {
+	total := corev1.ResourceList{}
+	for _, container := range pod.Spec.Containers {
+		addResources(total, container.Resources.Limits)
+	}
+	return total
+}
+
+// addResources adds the quantities in list to total
+func addResources(total, list corev1.ResourceList) {
+	for name, quantity := range list {
+		sum := total[name]
+		sum.Add(quantity)
+		total[name] = sum
+	}
+}
@@ -0,0 +1,437 @@
+package program
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NodeCmd groups the node maintenance operations
+type NodeCmd struct {
+	Cordon   NodeCordon   `cmd:"" help:"Mark nodes unschedulable"`
+	Uncordon NodeUncordon `cmd:"" help:"Mark nodes schedulable again"`
+	Drain    NodeDrain    `cmd:"" help:"Cordon nodes and evict their pods, first checking HPA minimums and PodDisruptionBudgets"`
+}
+
+// NodeSelector holds the flags which select the nodes to operate on
+type NodeSelector struct {
+	Labels map[string]string `short:"l" help:"Label filters to select nodes"`
+	Nodes  []string          `arg:"" optional:"" help:"Names of the nodes"`
+}
+
+type NodeCordon struct {
+	NodeSelector `embed:""`
+}
+
+type NodeUncordon struct {
+	NodeSelector `embed:""`
+}
+
+// NodeDrain does what `kubectl drain` does, but first works out what the evictions would do to the workloads on the
+// nodes.  Evicting every pod of a workload at once can take it below its HPA minimum, which is the capacity someone
+// decided it needs, even when its PodDisruptionBudget is missing or too loose to stop it.
+type NodeDrain struct {
+	NodeSelector `embed:""`
+
+	Force              bool          `help:"Drain even if it would take workloads below their HPA minimum, exceed PodDisruptionBudgets or delete unmanaged pods"`
+	DeleteEmptydirData bool          `help:"Evict pods using emptyDir volumes, whose data is lost (not implied by --force)"`
+	EvictionTimeout    time.Duration `default:"5m" help:"Maximum time to wait for each pod to be evicted"`
+
+	Bulk `embed:""`
+}
+
+// mirrorPodAnnotation marks the API copies of static pods, which the kubelet manages and eviction cannot remove
+const mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+// drainProblem is a reason draining the nodes could hurt a workload
+type drainProblem struct {
+	Namespace string
+	Object    string
+	Problem   string
+	// Refused problems stop the drain even with --force, as `kubectl drain` does
+	Refused bool
+}
+
+func (program *NodeCordon) Run(options *Options) error {
+	return program.setUnschedulable(options, true)
+}
+
+func (program *NodeUncordon) Run(options *Options) error {
+	return program.setUnschedulable(options, false)
+}
+
+// setUnschedulable cordons or uncordons the selected nodes
+func (program *NodeSelector) setUnschedulable(options *Options, unschedulable bool) error {
+
+	initColors(options)
+
+	clientset, err := options.Clientset()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	nodes, err := program.nodes(ctx, clientset)
+	if err != nil {
+		return err
+	}
+
+	return options.runAsLeader(ctx, clientset, func(ctx context.Context) error {
+		results := newSummary()
+		defer results.print()
+
+		var errs []error
+		for i := range nodes {
+			if ctx.Err() != nil {
+				break
+			}
+			if err := cordon(ctx, options, clientset, &nodes[i], unschedulable, results); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		for _, node := range nodes {
+			if !results.has("", node.Name) {
+				results.record("", node.Name, outcomeSkipped, "not started")
+			}
+		}
+
+		return errors.Join(errs...)
+	})
+}
+
+// nodes returns the selected nodes, sorted by name
+func (program *NodeSelector) nodes(ctx context.Context, clientset kubernetes.Interface) ([]corev1.Node, error) {
+	if len(program.Nodes) == 0 && len(program.Labels) == 0 {
+		return nil, usageError("select nodes by name or with --labels")
+	}
+
+	var nodes []corev1.Node
+
+	if len(program.Nodes) > 0 {
+		for _, name := range program.Nodes {
+			node, err := clientset.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				if err := apiError(err); ExitCode(err) == ExitConnection {
+					return nil, err
+				}
+				fmt.Printf("Failed to get node %s: %v\n", name, err)
+				continue
+			}
+			if len(program.Labels) > 0 && !labels.SelectorFromSet(program.Labels).Matches(labels.Set(node.Labels)) {
+				continue
+			}
+			nodes = append(nodes, *node)
+		}
+	} else {
+		list, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: labels.SelectorFromSet(program.Labels).String()})
+		if err != nil {
+			return nil, apiError(err)
+		}
+		nodes = list.Items
+	}
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+
+	return nodes, nil
+}
+
+// cordon sets whether the node is schedulable, recording the outcome
+func cordon(ctx context.Context, options *Options, clientset kubernetes.Interface, node *corev1.Node, unschedulable bool, results *summary) error {
+	action := "cordoned"
+	if !unschedulable {
+		action = "uncordoned"
+	}
+
+	if node.Spec.Unschedulable == unschedulable {
+		results.record("", node.Name, outcomeSkipped, "already "+action)
+		return nil
+	}
+
+	log.Info().Str("node", node.Name).Bool("unschedulable", unschedulable).Msg("Modifying")
+
+	if options.DryRun {
+		results.record("", node.Name, outcomeUpdated, "dry run: "+action)
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]any{"spec": map[string]any{"unschedulable": unschedulable}})
+	if err != nil {
+		return err
+	}
+
+	err = withRetries(ctx, options.Retries, func() error {
+		_, err := clientset.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{FieldManager: FieldManager})
+		return err
+	})
+	if err != nil {
+		err = apiError(err)
+		fmt.Printf("Failed to modify node %s: %v\n", node.Name, err)
+		results.record("", node.Name, outcomeFailed, err.Error())
+		return fmt.Errorf("node %s: %w", node.Name, err)
+	}
+
+	results.record("", node.Name, outcomeUpdated, action)
+	return nil
+}
+
+func (program *NodeDrain) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := options.Clientset()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	nodes, err := program.nodes(ctx, clientset)
+	if err != nil {
+		return err
+	}
+
+	pods, problems, err := program.evictablePods(ctx, clientset, nodes)
+	if err != nil {
+		return err
+	}
+
+	impact, err := drainImpact(ctx, options, clientset, pods)
+	if err != nil {
+		return err
+	}
+	problems = append(problems, impact...)
+
+	log.Info().Int("nodes", len(nodes)).Int("pods", len(pods)).Msg("Pods to evict")
+
+	if len(problems) > 0 {
+		printDrainProblems(problems)
+
+		refused := 0
+		for _, p := range problems {
+			if p.Refused {
+				refused++
+			}
+		}
+		if refused > 0 {
+			return usageError("%d pods use emptyDir volumes, use --delete-emptydir-data to drain them", refused)
+		}
+
+		if !program.Force {
+			return usageError("found %d problems with draining, use --force to drain anyway", len(problems))
+		}
+		log.Warn().Int("count", len(problems)).Msg("Draining despite problems")
+	}
+
+	return options.runAsLeader(ctx, clientset, func(ctx context.Context) error {
+		results := newSummary()
+		defer results.print()
+
+		// Nothing is evicted unless every node is cordoned, or the evicted pods could land on the next node to drain
+		var errs []error
+		for i := range nodes {
+			if err := cordon(ctx, options, clientset, &nodes[i], true, results); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if len(errs) > 0 {
+			return errors.Join(errs...)
+		}
+
+		errs = program.Bulk.run(ctx, len(pods), options.DryRun, false, func(i int) error {
+			pod := &pods[i]
+
+			log.Info().Str("namespace", pod.Namespace).Str("pod", pod.Name).Str("node", pod.Spec.NodeName).Msg("Evicting")
+
+			if options.DryRun {
+				results.record(pod.Namespace, pod.Name, outcomeUpdated, "dry run: evict")
+				return nil
+			}
+
+			if err := evictPod(ctx, clientset, pod, program.EvictionTimeout); err != nil {
+				fmt.Printf("Failed to evict pod %s: %v\n", pod.Name, err)
+				results.record(pod.Namespace, pod.Name, outcomeFailed, err.Error())
+				return fmt.Errorf("pod %s: %w", pod.Name, err)
+			}
+
+			results.record(pod.Namespace, pod.Name, outcomeUpdated, "evicted from "+pod.Spec.NodeName)
+			return nil
+		})
+
+		for _, pod := range pods {
+			if !results.has(pod.Namespace, pod.Name) {
+				results.record(pod.Namespace, pod.Name, outcomeSkipped, "not started")
+			}
+		}
+
+		return errors.Join(errs...)
+	})
+}
+
+// evictablePods returns the pods on the nodes which a drain evicts, sorted by namespace and name, and the problems
+// with evicting them.  As with `kubectl drain`, DaemonSet pods, mirror pods and finished pods are left alone, and pods
+// using emptyDir volumes are refused unless --delete-emptydir-data is given.
+func (program *NodeDrain) evictablePods(ctx context.Context, clientset kubernetes.Interface, nodes []corev1.Node) ([]corev1.Pod, []drainProblem, error) {
+	var pods []corev1.Pod
+	var problems []drainProblem
+
+	for _, node := range nodes {
+		list, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("spec.nodeName", node.Name).String(),
+		})
+		if err != nil {
+			return nil, nil, apiError(err)
+		}
+
+		for _, pod := range list.Items {
+			owner := metav1.GetControllerOf(&pod)
+
+			switch {
+			case pod.Annotations[mirrorPodAnnotation] != "":
+				continue
+			case owner != nil && owner.Kind == "DaemonSet":
+				continue
+			case pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed:
+				continue
+			}
+
+			if owner == nil {
+				problems = append(problems, drainProblem{pod.Namespace, "Pod/" + pod.Name, "not managed by a controller, it will not be recreated", false})
+			}
+
+			if !program.DeleteEmptydirData && usesEmptyDir(&pod) {
+				problems = append(problems, drainProblem{pod.Namespace, "Pod/" + pod.Name, "uses emptyDir, its data is lost (use --delete-emptydir-data)", true})
+				continue
+			}
+
+			pods = append(pods, pod)
+		}
+	}
+
+	sortObjects(pods)
+
+	return pods, problems, nil
+}
+
+// usesEmptyDir returns true if the pod has an emptyDir volume
+func usesEmptyDir(pod *corev1.Pod) bool {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.EmptyDir != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// drainImpact returns the workloads which evicting the pods would take below their HPA minimum, and the
+// PodDisruptionBudgets the evictions would exceed
+func drainImpact(ctx context.Context, options *Options, clientset kubernetes.Interface, pods []corev1.Pod) ([]drainProblem, error) {
+	var problems []drainProblem
+
+	// Count the pods evicted from each workload
+	owners := newOwnerResolver(clientset)
+	evicted := map[string]int{}
+	for i := range pods {
+		kind, name, err := owners.workload(ctx, &pods[i])
+		if err != nil {
+			return nil, err
+		}
+		if kind != "" {
+			evicted[pods[i].Namespace+"/"+kind+"/"+name]++
+		}
+	}
+
+	all := Selector{AllNamespaces: true, ChunkSize: 500}
+	hpas, err := all.getHpas(ctx, WithRetries(NewHPAClient(clientset), options.Retries))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hpa := range hpas {
+		count := evicted[hpa.Namespace+"/"+hpa.Spec.ScaleTargetRef.Kind+"/"+hpa.Spec.ScaleTargetRef.Name]
+		if count == 0 {
+			continue
+		}
+
+		minimum := replicasOf(hpa.Spec.MinReplicas)
+		if minimum == 0 {
+			minimum = 1
+		}
+
+		remaining := hpa.Status.CurrentReplicas - int32(count)
+		if remaining < minimum {
+			problems = append(problems, drainProblem{
+				hpa.Namespace,
+				hpa.Spec.ScaleTargetRef.Kind + "/" + hpa.Spec.ScaleTargetRef.Name,
+				fmt.Sprintf("evicting %d of %d pods leaves %d, below HPA %s minimum of %d", count, hpa.Status.CurrentReplicas, remaining, hpa.Name, minimum),
+				false,
+			})
+		}
+	}
+
+	pdbs, err := clientset.PolicyV1().PodDisruptionBudgets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, apiError(err)
+	}
+
+	for _, pdb := range pdbs.Items {
+		problem, err := pdbImpact(&pdb, pods)
+		if err != nil {
+			return nil, err
+		}
+		if problem != "" {
+			problems = append(problems, drainProblem{pdb.Namespace, "PodDisruptionBudget/" + pdb.Name, problem, false})
+		}
+	}
+
+	return problems, nil
+}
+
+// pdbImpact returns a description of how evicting the pods exceeds the disruptions the PDB allows, or "" if it does not
+func pdbImpact(pdb *policyv1.PodDisruptionBudget, pods []corev1.Pod) (string, error) {
+	selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+	if err != nil {
+		return "", fmt.Errorf("PodDisruptionBudget %s/%s: %w", pdb.Namespace, pdb.Name, err)
+	}
+
+	count := int32(0)
+	for _, pod := range pods {
+		if pod.Namespace == pdb.Namespace && selector.Matches(labels.Set(pod.Labels)) {
+			count++
+		}
+	}
+
+	if count > pdb.Status.DisruptionsAllowed {
+		return fmt.Sprintf("evicting %d pods but only %d disruptions allowed, evictions wait for replacements", count, pdb.Status.DisruptionsAllowed), nil
+	}
+
+	return "", nil
+}
+
+// printDrainProblems shows why a drain is risky
+func printDrainProblems(problems []drainProblem) {
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "OBJECT", "PROBLEM"})
+
+	for _, p := range problems {
+		t.AppendRow(table.Row{p.Namespace, p.Object, p.Problem})
+	}
+
+	t.Render()
+}
@@ -0,0 +1,210 @@
+package program
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// drainPod returns a pod on worker-1 controlled by the owner, which is of the form Kind/name, or unmanaged if owner is ""
+func drainPod(name, owner string, labels map[string]string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, Labels: labels},
+		Spec:       corev1.PodSpec{NodeName: "worker-1"},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	if owner != "" {
+		controller := true
+		kind, ownerName, _ := strings.Cut(owner, "/")
+		pod.OwnerReferences = []metav1.OwnerReference{{Kind: kind, Name: ownerName, Controller: &controller}}
+	}
+	return pod
+}
+
+func TestEvictablePods(t *testing.T) {
+	mirror := drainPod("kube-proxy", "", nil)
+	mirror.Annotations = map[string]string{mirrorPodAnnotation: "hash"}
+
+	finished := drainPod("migrate", "Job/migrate", nil)
+	finished.Status.Phase = corev1.PodSucceeded
+
+	scratch := drainPod("cache-0", "StatefulSet/cache", nil)
+	scratch.Spec.Volumes = []corev1.Volume{{Name: "scratch", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}}
+
+	objects := []runtime.Object{
+		drainPod("web-1", "ReplicaSet/web-abc", nil),
+		drainPod("fluentd", "DaemonSet/fluentd", nil),
+		drainPod("debug", "", nil),
+		mirror,
+		finished,
+		scratch,
+	}
+
+	tests := []struct {
+		name               string
+		deleteEmptydirData bool
+		wantPods           []string
+		wantProblems       []drainProblem
+	}{
+		{
+			name:     "emptyDir pods are refused",
+			wantPods: []string{"debug", "web-1"},
+			wantProblems: []drainProblem{
+				{"default", "Pod/debug", "not managed by a controller, it will not be recreated", false},
+				{"default", "Pod/cache-0", "uses emptyDir, its data is lost (use --delete-emptydir-data)", true},
+			},
+		},
+		{
+			name:               "emptyDir pods are evicted with --delete-emptydir-data",
+			deleteEmptydirData: true,
+			wantPods:           []string{"cache-0", "debug", "web-1"},
+			wantProblems: []drainProblem{
+				{"default", "Pod/debug", "not managed by a controller, it will not be recreated", false},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			program := &NodeDrain{DeleteEmptydirData: test.deleteEmptydirData}
+			nodes := []corev1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "worker-1"}}}
+
+			pods, problems, err := program.evictablePods(context.Background(), fake.NewSimpleClientset(objects...), nodes)
+			require.NoError(t, err)
+
+			var names []string
+			for _, pod := range pods {
+				names = append(names, pod.Name)
+			}
+			assert.Equal(t, test.wantPods, names, "DaemonSet, mirror and finished pods are not evicted")
+			assert.ElementsMatch(t, test.wantProblems, problems)
+		})
+	}
+}
+
+func TestDrainImpact(t *testing.T) {
+	controller := true
+	replicaSet := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+		Namespace:       "default",
+		Name:            "web-abc",
+		OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "web", Controller: &controller}},
+	}}
+
+	hpa := func(minimum, current int32) *v1.HorizontalPodAutoscaler {
+		return &v1.HorizontalPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+			Spec: v1.HorizontalPodAutoscalerSpec{
+				ScaleTargetRef: v1.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: "Deployment", Name: "web"},
+				MinReplicas:    &minimum,
+				MaxReplicas:    10,
+			},
+			Status: v1.HorizontalPodAutoscalerStatus{CurrentReplicas: current},
+		}
+	}
+
+	pdb := func(allowed int32) *policyv1.PodDisruptionBudget {
+		return &policyv1.PodDisruptionBudget{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+			Spec:       policyv1.PodDisruptionBudgetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}},
+			Status:     policyv1.PodDisruptionBudgetStatus{DisruptionsAllowed: allowed},
+		}
+	}
+
+	web := map[string]string{"app": "web"}
+	evicted := []corev1.Pod{
+		*drainPod("web-1", "ReplicaSet/web-abc", web),
+		*drainPod("web-2", "ReplicaSet/web-abc", web),
+	}
+
+	tests := []struct {
+		name    string
+		objects []runtime.Object
+		want    []drainProblem
+	}{
+		{
+			name:    "enough replicas remain",
+			objects: []runtime.Object{replicaSet, hpa(2, 4), pdb(2)},
+		},
+		{
+			name:    "below the HPA minimum",
+			objects: []runtime.Object{replicaSet, hpa(3, 4)},
+			want: []drainProblem{
+				{"default", "Deployment/web", "evicting 2 of 4 pods leaves 2, below HPA web minimum of 3", false},
+			},
+		},
+		{
+			name:    "an unset minimum is one",
+			objects: []runtime.Object{replicaSet, hpa(0, 2)},
+			want: []drainProblem{
+				{"default", "Deployment/web", "evicting 2 of 2 pods leaves 0, below HPA web minimum of 1", false},
+			},
+		},
+		{
+			name:    "beyond the PDB",
+			objects: []runtime.Object{replicaSet, hpa(1, 4), pdb(1)},
+			want: []drainProblem{
+				{"default", "PodDisruptionBudget/web", "evicting 2 pods but only 1 disruptions allowed, evictions wait for replacements", false},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			problems, err := drainImpact(context.Background(), &Options{}, fake.NewSimpleClientset(test.objects...), evicted)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, problems)
+		})
+	}
+}
+
+func TestPdbImpact(t *testing.T) {
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web"},
+		Spec:       policyv1.PodDisruptionBudgetSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}},
+		Status:     policyv1.PodDisruptionBudgetStatus{DisruptionsAllowed: 1},
+	}
+
+	web := map[string]string{"app": "web"}
+	other := drainPod("web-3", "ReplicaSet/web-abc", web)
+	other.Namespace = "staging"
+
+	tests := []struct {
+		name string
+		pods []*corev1.Pod
+		want string
+	}{
+		{name: "within the budget", pods: []*corev1.Pod{drainPod("web-1", "ReplicaSet/web-abc", web)}},
+		{
+			name: "beyond the budget",
+			pods: []*corev1.Pod{drainPod("web-1", "ReplicaSet/web-abc", web), drainPod("web-2", "ReplicaSet/web-abc", web)},
+			want: "evicting 2 pods but only 1 disruptions allowed, evictions wait for replacements",
+		},
+		{
+			name: "pods not selected",
+			pods: []*corev1.Pod{drainPod("web-1", "ReplicaSet/web-abc", web), drainPod("api-1", "ReplicaSet/api-abc", map[string]string{"app": "api"}), other},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var pods []corev1.Pod
+			for _, pod := range test.pods {
+				pods = append(pods, *pod)
+			}
+
+			problem, err := pdbImpact(pdb, pods)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, problem)
+		})
+	}
+}
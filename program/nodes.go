@@ -0,0 +1,162 @@
+package program
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Nodes shows how much of each node's allocatable CPU and memory is requested and used, so the headroom is visible
+// before raising HPA maximums which would need it
+type Nodes struct {
+	Labels map[string]string `short:"l" help:"Label filters to select nodes"`
+}
+
+// nodeCapacity is the allocatable, requested and used amount of one resource on a node
+type nodeCapacity struct {
+	Allocatable resource.Quantity
+	Requested   resource.Quantity
+	Used        *resource.Quantity
+}
+
+func (program *Nodes) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := options.Clientset()
+	if err != nil {
+		return err
+	}
+
+	dynamicClient, err := options.Dynamic()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: labels.SelectorFromSet(program.Labels).String()})
+	if err != nil {
+		return apiError(err)
+	}
+	sortObjects(nodes.Items)
+
+	requested, err := requestsByNode(ctx, clientset)
+	if err != nil {
+		return err
+	}
+
+	usage, err := nodeUsage(ctx, dynamicClient)
+	if err != nil {
+		return err
+	}
+
+	t := newTable()
+	t.AppendHeader(table.Row{"NODE", "RESOURCE", "ALLOCATABLE", "REQUESTED", "USED", "CAPACITY"})
+
+	for _, node := range nodes.Items {
+		for _, name := range auditedResources {
+			c := nodeCapacity{
+				Allocatable: node.Status.Allocatable[name],
+				Requested:   requested[node.Name][name],
+			}
+			if used, ok := usage[node.Name][name]; ok {
+				c.Used = &used
+			}
+
+			usedText := "-"
+			if c.Used != nil {
+				usedText = formatQuantity(name, *c.Used)
+			}
+
+			t.AppendRow(table.Row{
+				node.Name,
+				name,
+				formatQuantity(name, c.Allocatable),
+				formatQuantity(name, c.Requested),
+				usedText,
+				capacityGauge(c),
+			})
+		}
+	}
+
+	t.Render()
+
+	return nil
+}
+
+// requestsByNode returns the total container requests of the running pods on each node.  Finished pods no longer hold
+// their requests, so they are not counted.
+func requestsByNode(ctx context.Context, clientset kubernetes.Interface) (map[string]corev1.ResourceList, error) {
+	result := map[string]corev1.ResourceList{}
+
+	listOptions := metav1.ListOptions{Limit: 500}
+	for {
+		pods, err := clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, listOptions)
+		if err != nil {
+			return nil, apiError(err)
+		}
+
+		for _, pod := range pods.Items {
+			if pod.Spec.NodeName == "" || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+				continue
+			}
+
+			total, ok := result[pod.Spec.NodeName]
+			if !ok {
+				total = corev1.ResourceList{}
+				result[pod.Spec.NodeName] = total
+			}
+
+			for name, quantity := range podRequests(&pod) {
+				sum := total[name]
+				sum.Add(quantity)
+				total[name] = sum
+			}
+		}
+
+		if pods.Continue == "" {
+			return result, nil
+		}
+		listOptions.Continue = pods.Continue
+	}
+}
+
+// capacityGauge draws the requested (R) and used (U) amounts as a share of allocatable, colored by how much is
+// requested since that is what decides whether more pods can be scheduled
+func capacityGauge(c nodeCapacity) string {
+	if c.Allocatable.IsZero() {
+		return "no capacity"
+	}
+
+	allocatable := c.Allocatable.AsApproximateFloat64()
+	requested := int(c.Requested.AsApproximateFloat64() / allocatable * 100)
+
+	marks := []Mark{{"R", min(requested, 100)}}
+	label := strconv.Itoa(requested) + "% requested"
+
+	if c.Used != nil {
+		used := int(c.Used.AsApproximateFloat64() / allocatable * 100)
+		marks = append(marks, Mark{"U", min(used, 100)})
+		label += ", " + strconv.Itoa(used) + "% used"
+	}
+
+	gauge := formatMarks(0, 100, marks...) + label
+
+	switch {
+	case requested >= 100:
+		return paint(text.FgRed, gauge)
+	case requested >= 80:
+		return paint(text.FgYellow, gauge)
+	default:
+		return paint(text.FgGreen, gauge)
+	}
+}
@@ -0,0 +1,513 @@
+package program
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	v2 "k8s.io/api/autoscaling/v2"
+)
+
+// Notify holds the flags which send change summaries and alerts to chat and incident tools
+type Notify struct {
+	NotifySlack string `name:"notify-slack" env:"K8SUTILS_NOTIFY_SLACK" placeholder:"WEBHOOK-URL" help:"Slack incoming webhook to post change summaries and alerts to"`
+	NotifyTeams string `name:"notify-teams" env:"K8SUTILS_NOTIFY_TEAMS" placeholder:"WEBHOOK-URL" help:"Microsoft Teams incoming webhook to post change summaries and alerts to"`
+
+	NotifyPagerDuty string        `name:"notify-pagerduty" env:"K8SUTILS_NOTIFY_PAGERDUTY" placeholder:"ROUTING-KEY" help:"PagerDuty Events API routing key to send alerts to (change summaries are not sent)"`
+	NotifyAfter     time.Duration `name:"notify-after" default:"0s" help:"How long an HPA must be at its maximum or failing its conditions before it is alerted on"`
+
+	NotifyWebhook         string            `name:"notify-webhook" env:"K8SUTILS_NOTIFY_WEBHOOK" placeholder:"URL" help:"URL to POST change summaries and alerts to as JSON"`
+	NotifyWebhookHeaders  map[string]string `name:"notify-webhook-header" placeholder:"NAME=VALUE;..." help:"Headers to send to the webhook, e.g. Authorization"`
+	NotifyWebhookTemplate string            `name:"notify-webhook-template" env:"K8SUTILS_NOTIFY_WEBHOOK_TEMPLATE" placeholder:"TEMPLATE" help:"Go template for the webhook body, or @file to read it from a file (default the notification as JSON)"`
+}
+
+// notification is a summary of changes made or an alert about an HPA.  Alerts with the same key are the same problem,
+// so a resolved alert closes the one before it.
+type notification struct {
+	Kind     string         `json:"kind"`
+	Command  string         `json:"command,omitempty"`
+	Cluster  string         `json:"cluster,omitempty"`
+	Title    string         `json:"title"`
+	Lines    []string       `json:"lines,omitempty"`
+	Counts   map[string]int `json:"counts,omitempty"`
+	Severity string         `json:"severity"`
+	Key      string         `json:"key,omitempty"`
+	Resolved bool           `json:"resolved,omitempty"`
+	Time     time.Time      `json:"time"`
+	// Event is the change to an HPA which an event notification is about
+	Event *busEvent `json:"event,omitempty"`
+}
+
+// Kinds of notification
+const (
+	notificationChange = "change"
+	notificationAlert  = "alert"
+	// notificationEvent is a single change to or scaling of an HPA, which only the event buses are sent
+	notificationEvent = "event"
+)
+
+// Severities of notification
+const (
+	severityInfo     = "info"
+	severityWarning  = "warning"
+	severityCritical = "critical"
+)
+
+// notifier sends notifications to one destination
+type notifier interface {
+	name() string
+	notify(ctx context.Context, n *notification) error
+}
+
+// maxNotificationLines limits how many items a notification lists, so a large bulk run stays readable
+const maxNotificationLines = 20
+
+// notifyTimeout limits how long sending a notification can delay the program
+const notifyTimeout = 10 * time.Second
+
+// The notifiers are set up once the options are parsed, like the logger, so that summaries can notify wherever
+// they are printed
+var (
+	notifiers []notifier
+	// notifyCommand and notifyCluster describe where notifications come from
+	notifyCommand, notifyCluster string
+	notifyDryRun                 bool
+	notifyAfter                  time.Duration
+)
+
+// initNotifiers sets up the destinations given in the flags
+func (program *Options) initNotifiers(command string) error {
+	notifiers = nil
+	notifyCommand = command
+	notifyCluster = program.contextName()
+	notifyDryRun = program.DryRun
+	notifyAfter = program.NotifyAfter
+
+	if program.NotifySlack != "" {
+		notifiers = append(notifiers, &slackNotifier{url: program.NotifySlack})
+	}
+
+	if program.NotifyTeams != "" {
+		notifiers = append(notifiers, &teamsNotifier{url: program.NotifyTeams})
+	}
+
+	if program.NotifyPagerDuty != "" {
+		notifiers = append(notifiers, &pagerDutyNotifier{url: pagerDutyEventsURL, routingKey: program.NotifyPagerDuty})
+	}
+
+	if program.NotifyWebhook != "" {
+		webhook, err := newWebhookNotifier(program.NotifyWebhook, program.NotifyWebhookHeaders, program.NotifyWebhookTemplate)
+		if err != nil {
+			return usageError("--notify-webhook-template: %v", err)
+		}
+		notifiers = append(notifiers, webhook)
+	}
+
+	if datadog := program.newDatadogClient(program.contextName()); datadog != nil {
+		notifiers = append(notifiers, &datadogNotifier{client: datadog})
+	}
+
+	buses, err := program.newBusNotifiers()
+	if err != nil {
+		return err
+	}
+	notifiers = append(notifiers, buses...)
+
+	return nil
+}
+
+// sendNotification sends the notification to every destination, logging any which cannot be reached
+func sendNotification(n *notification) {
+	if len(notifiers) == 0 {
+		return
+	}
+
+	n.Command = notifyCommand
+	n.Cluster = notifyCluster
+	if n.Time.IsZero() {
+		n.Time = time.Now()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, destination := range notifiers {
+		wg.Add(1)
+		go func(destination notifier) {
+			defer wg.Done()
+			if err := destination.notify(ctx, n); err != nil {
+				log.Warn().Err(err).Str("destination", destination.name()).Msg("Failed to send notification")
+			}
+		}(destination)
+	}
+	wg.Wait()
+}
+
+// notifyChanges sends a summary of a bulk run which changed or failed to change anything
+func (s *summary) notifyChanges() {
+	counts := s.counts()
+	if counts[outcomeUpdated] == 0 && counts[outcomeFailed] == 0 && counts[outcomeReverted] == 0 {
+		return
+	}
+
+	var lines []string
+	for _, o := range s.sorted() {
+		if o.Outcome == outcomeSkipped {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s/%s %s: %s", o.Namespace, o.Name, o.Outcome, o.Reason))
+	}
+	if len(lines) > maxNotificationLines {
+		lines = append(lines[:maxNotificationLines], fmt.Sprintf("and %d more", len(lines)-maxNotificationLines))
+	}
+
+	title := fmt.Sprintf("%d updated, %d failed, %d skipped", counts[outcomeUpdated], counts[outcomeFailed], counts[outcomeSkipped])
+	if counts[outcomeReverted] > 0 {
+		title += fmt.Sprintf(", %d reverted", counts[outcomeReverted])
+	}
+	if notifyDryRun {
+		title = "Dry run: " + title
+	}
+
+	severity := severityInfo
+	if counts[outcomeFailed] > 0 {
+		severity = severityWarning
+	}
+
+	sendNotification(&notification{Kind: notificationChange, Title: title, Lines: lines, Counts: counts, Severity: severity})
+}
+
+// postJSON posts the value as JSON, returning an error for any response other than success
+func postJSON(ctx context.Context, url string, headers map[string]string, value any) error {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return post(ctx, url, "application/json", headers, body)
+}
+
+// post sends the body, returning an error for any response other than success
+func post(ctx context.Context, url, contentType string, headers map[string]string, body []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", contentType)
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return errors.New(response.Status + ": " + strings.TrimSpace(string(message)))
+	}
+
+	return nil
+}
+
+// slackNotifier posts to a Slack incoming webhook
+type slackNotifier struct {
+	url string
+}
+
+func (s *slackNotifier) name() string {
+	return "slack"
+}
+
+// slackEmoji marks the severity of a message
+var slackEmoji = map[string]string{
+	severityInfo:     ":information_source:",
+	severityWarning:  ":warning:",
+	severityCritical: ":rotating_light:",
+}
+
+func (s *slackNotifier) notify(ctx context.Context, n *notification) error {
+	if n.Kind == notificationEvent {
+		return nil
+	}
+
+	emoji := slackEmoji[n.Severity]
+	if n.Resolved {
+		emoji = ":white_check_mark:"
+	}
+
+	footer := "k8sutils"
+	if n.Cluster != "" {
+		footer += " on " + n.Cluster
+	}
+	if n.Command != "" {
+		footer += ": `" + n.Command + "`"
+	}
+
+	blocks := []map[string]any{
+		{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": emoji + " *" + n.Title + "*"}},
+	}
+	if len(n.Lines) > 0 {
+		blocks = append(blocks, map[string]any{
+			"type": "section",
+			"text": map[string]string{"type": "mrkdwn", "text": "```" + strings.Join(n.Lines, "\n") + "```"},
+		})
+	}
+	blocks = append(blocks, map[string]any{
+		"type":     "context",
+		"elements": []map[string]string{{"type": "mrkdwn", "text": footer}},
+	})
+
+	return postJSON(ctx, s.url, nil, map[string]any{"text": n.Title, "blocks": blocks})
+}
+
+// teamsNotifier posts a message card to a Microsoft Teams incoming webhook
+type teamsNotifier struct {
+	url string
+}
+
+func (t *teamsNotifier) name() string {
+	return "teams"
+}
+
+// teamsColor is the accent color of a card for each severity
+var teamsColor = map[string]string{
+	severityInfo:     "0076D7",
+	severityWarning:  "FFA500",
+	severityCritical: "D70000",
+}
+
+func (t *teamsNotifier) notify(ctx context.Context, n *notification) error {
+	if n.Kind == notificationEvent {
+		return nil
+	}
+
+	color := teamsColor[n.Severity]
+	if n.Resolved {
+		color = "2EB886"
+	}
+
+	subtitle := "k8sutils"
+	if n.Cluster != "" {
+		subtitle += " on " + n.Cluster
+	}
+	if n.Command != "" {
+		subtitle += ": " + n.Command
+	}
+
+	section := map[string]any{"activityTitle": n.Title, "activitySubtitle": subtitle}
+	if len(n.Lines) > 0 {
+		// Teams renders the text as markdown, where a line break needs two trailing spaces
+		section["text"] = strings.Join(n.Lines, "  \n")
+	}
+
+	return postJSON(ctx, t.url, nil, map[string]any{
+		"@type":      "MessageCard",
+		"@context":   "https://schema.org/extensions",
+		"summary":    n.Title,
+		"themeColor": color,
+		"sections":   []map[string]any{section},
+	})
+}
+
+// pagerDutyEventsURL is the endpoint of the PagerDuty Events API v2
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// pagerDutyNotifier triggers and resolves PagerDuty incidents for alerts.  Alerts with the same key are deduplicated
+// into one incident.
+type pagerDutyNotifier struct {
+	url, routingKey string
+}
+
+func (p *pagerDutyNotifier) name() string {
+	return "pagerduty"
+}
+
+func (p *pagerDutyNotifier) notify(ctx context.Context, n *notification) error {
+	if n.Kind != notificationAlert {
+		return nil
+	}
+
+	// The same HPA in different clusters is a different incident
+	key := n.Key
+	if n.Cluster != "" {
+		key = n.Cluster + "/" + key
+	}
+
+	event := map[string]any{
+		"routing_key":  p.routingKey,
+		"event_action": "trigger",
+		"dedup_key":    key,
+	}
+	if n.Resolved {
+		event["event_action"] = "resolve"
+		return postJSON(ctx, p.url, nil, event)
+	}
+
+	source := "k8sutils"
+	if n.Cluster != "" {
+		source = n.Cluster
+	}
+	event["payload"] = map[string]any{
+		"summary":   n.Title,
+		"source":    source,
+		"severity":  n.Severity,
+		"component": alertSubject(n.Key),
+		"group":     n.Command,
+		"timestamp": n.Time.Format(time.RFC3339),
+	}
+
+	return postJSON(ctx, p.url, nil, event)
+}
+
+// webhookNotifier posts each notification to a URL, as JSON or rendered with a template
+type webhookNotifier struct {
+	url      string
+	headers  map[string]string
+	template *template.Template
+}
+
+// webhookFuncs are available to webhook templates
+var webhookFuncs = template.FuncMap{
+	// json renders a value as JSON, e.g. to quote a string: {{ json .Title }}
+	"json": func(value any) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+	"join": strings.Join,
+}
+
+// newWebhookNotifier parses the body template, which is read from a file if it starts with @
+func newWebhookNotifier(url string, headers map[string]string, body string) (*webhookNotifier, error) {
+	webhook := &webhookNotifier{url: url, headers: headers}
+	if body == "" {
+		return webhook, nil
+	}
+
+	if file, ok := strings.CutPrefix(body, "@"); ok {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		body = string(data)
+	}
+
+	parsed, err := template.New("webhook").Funcs(webhookFuncs).Option("missingkey=error").Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	webhook.template = parsed
+
+	return webhook, nil
+}
+
+func (w *webhookNotifier) name() string {
+	return "webhook"
+}
+
+func (w *webhookNotifier) notify(ctx context.Context, n *notification) error {
+	if n.Kind == notificationEvent {
+		return nil
+	}
+
+	if w.template == nil {
+		return postJSON(ctx, w.url, w.headers, n)
+	}
+
+	var body bytes.Buffer
+	if err := w.template.Execute(&body, n); err != nil {
+		return err
+	}
+
+	return post(ctx, w.url, "application/json", w.headers, body.Bytes())
+}
+
+// hpaAlerts raises an alert when an HPA has been at its maximum replicas, or failing its conditions, for --notify-after,
+// and resolves it when the HPA recovers.  It remembers the problems seen between checks.
+type hpaAlerts struct {
+	// since is when each problem was first seen, and sent holds the problems which have been alerted on
+	since map[string]time.Time
+	sent  map[string]bool
+}
+
+// alertInterval is how often problems are checked between HPA changes, so they are alerted on once they have lasted
+// long enough even if nothing else happens
+const alertInterval = 30 * time.Second
+
+func newHpaAlerts() *hpaAlerts {
+	return &hpaAlerts{since: map[string]time.Time{}, sent: map[string]bool{}}
+}
+
+// check alerts on the problems of the HPAs which have lasted long enough, and resolves those which have cleared,
+// including those of HPAs which are gone
+func (a *hpaAlerts) check(hpas []v2.HorizontalPodAutoscaler, now time.Time) {
+	seen := map[string]bool{}
+
+	problem := func(key string, failing bool, severity, title, resolved string) {
+		seen[key] = true
+
+		switch {
+		case failing:
+			if _, ok := a.since[key]; !ok {
+				a.since[key] = now
+			}
+			if !a.sent[key] && now.Sub(a.since[key]) >= notifyAfter {
+				a.sent[key] = true
+				sendNotification(&notification{Kind: notificationAlert, Title: title, Severity: severity, Key: key})
+			}
+		case a.sent[key]:
+			sendNotification(&notification{Kind: notificationAlert, Title: resolved, Severity: severity, Key: key, Resolved: true})
+			fallthrough
+		default:
+			delete(a.since, key)
+			delete(a.sent, key)
+		}
+	}
+
+	for i := range hpas {
+		hpa := &hpas[i]
+		name := hpa.Namespace + "/" + hpa.Name
+
+		problem("at-max/"+name, hpa.Status.CurrentReplicas >= hpa.Spec.MaxReplicas, severityWarning,
+			fmt.Sprintf("HPA %s is at its maximum of %d replicas", name, hpa.Spec.MaxReplicas),
+			fmt.Sprintf("HPA %s is below its maximum again at %d/%d replicas", name, hpa.Status.CurrentReplicas, hpa.Spec.MaxReplicas))
+
+		condition := failingCondition(hpa.Status.Conditions)
+		title := ""
+		if condition != nil {
+			title = fmt.Sprintf("HPA %s is failing %s: %s", name, condition.Type, condition.Message)
+		}
+		problem("conditions/"+name, condition != nil, severityCritical, title, fmt.Sprintf("HPA %s is able to scale again", name))
+	}
+
+	for _, key := range sortedKeys(a.sent) {
+		if !seen[key] {
+			sendNotification(&notification{Kind: notificationAlert, Title: "HPA " + alertSubject(key) + " is gone", Severity: severityInfo, Key: key, Resolved: true})
+			delete(a.since, key)
+			delete(a.sent, key)
+		}
+	}
+	for key := range a.since {
+		if !seen[key] {
+			delete(a.since, key)
+		}
+	}
+}
+
+// alertSubject returns the namespace/name of the HPA an alert key of the form problem/namespace/name is about
+func alertSubject(key string) string {
+	_, subject, _ := strings.Cut(key, "/")
+	return subject
+}
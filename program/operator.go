@@ -0,0 +1,563 @@
+package program
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	autoscalinglisters "k8s.io/client-go/listers/autoscaling/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Operator runs until interrupted, changing the min and max of HPAs on a schedule given by ScalingSchedule resources.
+// Each schedule selects HPAs in its namespace by label, and has windows which open on a cron schedule and stay open for
+// a duration.  While a window is open the selected HPAs have its min and max, written as with "k8sutils hpa", relative
+// to the values they had before the schedule changed them.  When no window is open they get those values back.
+//
+// The schedules and HPAs are watched, so changes to either are reconciled as they happen, and otherwise the operator
+// waits for the next window to open or close.
+type Operator struct {
+	CRD           bool `name:"crd" help:"Print the ScalingSchedule CustomResourceDefinition, to install with kubectl apply -f -, and exit"`
+	AllNamespaces bool `short:"A" help:"Reconcile ScalingSchedules in all namespaces"`
+
+	// namespaceName is the namespace resolved from the flags and kubeconfig
+	namespaceName string
+}
+
+var scalingScheduleResource = schema.GroupVersionResource{Group: "k8sutils.io", Version: "v1alpha1", Resource: "scalingschedules"}
+
+// reconcileRetry is how long to wait before reconciling again after a pass which failed, if nothing changes sooner
+const reconcileRetry = time.Minute
+
+// The annotations a ScalingSchedule leaves on the HPAs it has changed
+const (
+	// AnnotationScheduledBy is the schedule and window, as schedule/window, whose values the HPA has
+	AnnotationScheduledBy = "k8sutils.io/scheduled-by"
+	// AnnotationScheduleOriginal is the min/max the HPA had before the schedule changed it
+	AnnotationScheduleOriginal = "k8sutils.io/schedule-original"
+)
+
+// scalingScheduleSpec is the spec of a ScalingSchedule
+type scalingScheduleSpec struct {
+	Selector metav1.LabelSelector `json:"selector"`
+	TimeZone string               `json:"timeZone,omitempty"`
+	Windows  []scalingWindow      `json:"windows"`
+}
+
+// scalingWindow opens on the cron schedule Start and stays open for Duration
+type scalingWindow struct {
+	Name     string `json:"name"`
+	Start    string `json:"start"`
+	Duration string `json:"duration"`
+	Min      string `json:"min,omitempty"`
+	Max      string `json:"max,omitempty"`
+}
+
+// scalingScheduleStatus is the status of a ScalingSchedule
+type scalingScheduleStatus struct {
+	ObservedGeneration int64    `json:"observedGeneration,omitempty"`
+	ActiveWindow       string   `json:"activeWindow,omitempty"`
+	NextTransition     string   `json:"nextTransition,omitempty"`
+	HPAs               []string `json:"hpas,omitempty"`
+	Message            string   `json:"message,omitempty"`
+}
+
+// scheduleClaim is an open window's values for one HPA
+type scheduleClaim struct {
+	schedule, window string
+	change           limits
+}
+
+func (program *Operator) Run(options *Options) error {
+
+	if program.CRD {
+		fmt.Print(scalingScheduleCRD)
+		return nil
+	}
+
+	initColors(options)
+
+	clientset, err := options.Clientset()
+	if err != nil {
+		return err
+	}
+
+	if !program.AllNamespaces {
+		if program.namespaceName, err = options.ResolveNamespace(); err != nil {
+			return err
+		}
+	}
+
+	client, err := options.Dynamic()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	// The informer would retry forever if the resource is not installed, so check first
+	_, err = client.Resource(scalingScheduleResource).Namespace(program.namespace()).List(ctx, metav1.ListOptions{Limit: 1})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("the ScalingSchedule resource is not installed, install it with: k8sutils operator --crd | kubectl apply -f -")
+		}
+		return apiError(err)
+	}
+
+	hpaClient := WithRetries(NewHPAClient(clientset), options.Retries)
+
+	return options.runAsLeader(ctx, clientset, func(ctx context.Context) error {
+		scheduleFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, 0, program.namespace(), nil)
+		scheduleInformer := scheduleFactory.ForResource(scalingScheduleResource)
+
+		hpaFactory := informers.NewSharedInformerFactoryWithOptions(clientset, 0, informers.WithNamespace(program.namespace()))
+		hpaInformer := hpaFactory.Autoscaling().V1().HorizontalPodAutoscalers()
+
+		changed := make(chan struct{}, 1)
+		notify := cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(any) { trigger(changed) },
+			UpdateFunc: func(any, any) { trigger(changed) },
+			DeleteFunc: func(any) { trigger(changed) },
+		}
+		if _, err := scheduleInformer.Informer().AddEventHandler(notify); err != nil {
+			return err
+		}
+		if _, err := hpaInformer.Informer().AddEventHandler(notify); err != nil {
+			return err
+		}
+
+		scheduleFactory.Start(ctx.Done())
+		defer scheduleFactory.Shutdown()
+		hpaFactory.Start(ctx.Done())
+		defer hpaFactory.Shutdown()
+
+		for resource, synced := range scheduleFactory.WaitForCacheSync(ctx.Done()) {
+			if !synced {
+				return connectionError(ctx.Err(), "unable to sync %v from the cluster", resource.Resource)
+			}
+		}
+		for kind, synced := range hpaFactory.WaitForCacheSync(ctx.Done()) {
+			if !synced {
+				return connectionError(ctx.Err(), "unable to sync %v from the cluster", kind)
+			}
+		}
+
+		log.Info().Str("namespace", program.namespace()).Msg("Reconciling ScalingSchedules")
+
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-changed:
+			case <-timer.C:
+			}
+
+			now := time.Now()
+			next, err := program.reconcile(ctx, options, client, hpaClient,
+				listSchedules(scheduleInformer.Lister()), listHPAs(hpaInformer.Lister()), now)
+			if err != nil && ctx.Err() == nil {
+				log.Warn().Err(err).Msg("Failed to reconcile ScalingSchedules")
+				if next.IsZero() || next.After(now.Add(reconcileRetry)) {
+					next = now.Add(reconcileRetry)
+				}
+			}
+
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			if !next.IsZero() {
+				log.Debug().Time("next", next).Msg("Waiting for the next window transition")
+				timer.Reset(time.Until(next))
+			}
+		}
+	})
+}
+
+// trigger signals the channel without blocking, so bursts of changes are reconciled in one pass
+func trigger(changed chan struct{}) {
+	select {
+	case changed <- struct{}{}:
+	default:
+	}
+}
+
+// listSchedules returns copies of the cached ScalingSchedules, sorted by namespace and name so schedules claim HPAs
+// in a fixed order
+func listSchedules(lister cache.GenericLister) []unstructured.Unstructured {
+	objects, err := lister.List(labels.Everything())
+	if err != nil {
+		return nil
+	}
+
+	schedules := make([]unstructured.Unstructured, 0, len(objects))
+	for _, object := range objects {
+		if schedule, ok := object.(*unstructured.Unstructured); ok {
+			schedules = append(schedules, *schedule.DeepCopy())
+		}
+	}
+	sortObjects(schedules)
+	return schedules
+}
+
+// listHPAs returns copies of the cached HPAs sorted by namespace and name, which may be changed without changing the
+// cache
+func listHPAs(lister autoscalinglisters.HorizontalPodAutoscalerLister) []v1.HorizontalPodAutoscaler {
+	items, err := lister.List(labels.Everything())
+	if err != nil {
+		return nil
+	}
+
+	hpas := make([]v1.HorizontalPodAutoscaler, 0, len(items))
+	for _, hpa := range items {
+		hpas = append(hpas, *hpa.DeepCopy())
+	}
+	sortHPAs(hpas)
+	return hpas
+}
+
+// namespace returns the namespace to reconcile, which is empty for all namespaces
+func (program *Operator) namespace() string {
+	if program.AllNamespaces {
+		return metav1.NamespaceAll
+	}
+	return program.namespaceName
+}
+
+// reconcile gives every HPA the values of the open window which selects it, or back the values it had before, and
+// records the outcome in the status of each schedule.  It returns when the next window opens or closes, which is zero
+// if none will.
+func (program *Operator) reconcile(ctx context.Context, options *Options, client dynamic.Interface, hpaClient HPAClient, schedules []unstructured.Unstructured, hpas []v1.HorizontalPodAutoscaler, now time.Time) (time.Time, error) {
+	var next time.Time
+
+	claims := map[string]scheduleClaim{}
+	statuses := make([]scalingScheduleStatus, len(schedules))
+	problems := make([][]string, len(schedules))
+	owner := map[string]int{}
+	// broken holds the schedules which could not be read, whose HPAs are left as they are rather than restored
+	broken := map[string]bool{}
+
+	for i := range schedules {
+		schedule := &schedules[i]
+		status := &statuses[i]
+		status.ObservedGeneration = schedule.GetGeneration()
+		owner[schedule.GetNamespace()+"/"+schedule.GetName()] = i
+
+		spec, window, transition, err := openWindow(schedule, now)
+		if err != nil {
+			problems[i] = append(problems[i], err.Error())
+			broken[schedule.GetNamespace()+"/"+schedule.GetName()] = true
+			continue
+		}
+		if !transition.IsZero() {
+			status.NextTransition = transition.UTC().Format(time.RFC3339)
+			if next.IsZero() || transition.Before(next) {
+				next = transition
+			}
+		}
+		if window == nil {
+			continue
+		}
+		status.ActiveWindow = window.Name
+
+		change, err := parseLimits(window.Min, window.Max)
+		if err != nil {
+			problems[i] = append(problems[i], fmt.Sprintf("window %s: %v", window.Name, err))
+			broken[schedule.GetNamespace()+"/"+schedule.GetName()] = true
+			continue
+		}
+
+		selector, err := metav1.LabelSelectorAsSelector(&spec.Selector)
+		if err != nil {
+			problems[i] = append(problems[i], fmt.Sprintf("bad selector: %v", err))
+			broken[schedule.GetNamespace()+"/"+schedule.GetName()] = true
+			continue
+		}
+
+		for _, hpa := range hpas {
+			if hpa.Namespace != schedule.GetNamespace() || !selector.Matches(labels.Set(hpa.Labels)) {
+				continue
+			}
+
+			key := hpa.Namespace + "/" + hpa.Name
+			if other, ok := claims[key]; ok {
+				problems[i] = append(problems[i], fmt.Sprintf("HPA %s is also selected by %s, which applies", hpa.Name, other.schedule))
+				continue
+			}
+			claims[key] = scheduleClaim{schedule: schedule.GetName(), window: window.Name, change: change}
+		}
+	}
+
+	var errs []error
+	for i := range hpas {
+		hpa := &hpas[i]
+		claim, claimed := claims[hpa.Namespace+"/"+hpa.Name]
+		_, scheduled := hpa.Annotations[AnnotationScheduledBy]
+		if !claimed && !scheduled {
+			continue
+		}
+
+		// Problems with HPAs are reported on the schedule which selects them, or which last changed them
+		index := -1
+		if claimed {
+			index = owner[hpa.Namespace+"/"+claim.schedule]
+		} else {
+			name, _, _ := strings.Cut(hpa.Annotations[AnnotationScheduledBy], "/")
+			if broken[hpa.Namespace+"/"+name] {
+				continue
+			}
+			if i, ok := owner[hpa.Namespace+"/"+name]; ok {
+				index = i
+			}
+		}
+		report := func(problem string) {
+			if index >= 0 {
+				problems[index] = append(problems[index], problem)
+			}
+		}
+
+		if isLocked(hpa) {
+			report(fmt.Sprintf("HPA %s is locked: %s", hpa.Name, hpa.Annotations[AnnotationLocked]))
+			continue
+		}
+
+		changed, err := applySchedule(ctx, options, hpaClient, hpa, claim, claimed)
+		if err != nil {
+			report(fmt.Sprintf("HPA %s: %v", hpa.Name, err))
+			errs = append(errs, fmt.Errorf("HPA %s/%s: %w", hpa.Namespace, hpa.Name, err))
+			continue
+		}
+		if claimed {
+			statuses[index].HPAs = append(statuses[index].HPAs, hpa.Name)
+		}
+		switch {
+		case changed && claimed:
+			log.Info().Str("namespace", hpa.Namespace).Str("hpa", hpa.Name).Str("schedule", claim.schedule).Str("window", claim.window).Msg("Scaled HPA for window")
+		case changed:
+			log.Info().Str("namespace", hpa.Namespace).Str("hpa", hpa.Name).Msg("Restored HPA after schedule")
+		}
+	}
+
+	for i := range schedules {
+		statuses[i].Message = strings.Join(problems[i], "; ")
+		if err := updateScheduleStatus(ctx, options, client, &schedules[i], statuses[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return next, errors.Join(errs...)
+}
+
+// openWindow parses the schedule, and returns its first open window, if any, and when a window next opens or closes
+func openWindow(schedule *unstructured.Unstructured, now time.Time) (*scalingScheduleSpec, *scalingWindow, time.Time, error) {
+	raw, _, _ := unstructured.NestedMap(schedule.Object, "spec")
+	spec := &scalingScheduleSpec{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(raw, spec); err != nil {
+		return nil, nil, time.Time{}, fmt.Errorf("bad spec: %w", err)
+	}
+
+	location := time.UTC
+	if spec.TimeZone != "" {
+		var err error
+		if location, err = time.LoadLocation(spec.TimeZone); err != nil {
+			return nil, nil, time.Time{}, fmt.Errorf("bad timeZone: %w", err)
+		}
+	}
+	now = now.In(location)
+
+	var open *scalingWindow
+	var next time.Time
+	sooner := func(t time.Time) {
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+
+	for i := range spec.Windows {
+		window := &spec.Windows[i]
+
+		start, err := cron.ParseStandard(window.Start)
+		if err != nil {
+			return nil, nil, time.Time{}, fmt.Errorf("window %s: bad start: %w", window.Name, err)
+		}
+		duration, err := time.ParseDuration(window.Duration)
+		if err != nil || duration <= 0 {
+			return nil, nil, time.Time{}, fmt.Errorf("window %s: bad duration %q", window.Name, window.Duration)
+		}
+
+		// The window is open if it last started less than its duration ago
+		opened := start.Next(now.Add(-duration))
+		if !opened.After(now) {
+			for later := start.Next(opened); !later.After(now); later = start.Next(later) {
+				opened = later
+			}
+			if open == nil {
+				open = window
+			}
+			sooner(opened.Add(duration))
+			continue
+		}
+		sooner(opened)
+	}
+
+	return spec, open, next, nil
+}
+
+// applySchedule gives the HPA the values of the claim, or back its original values if it is not claimed
+func applySchedule(ctx context.Context, options *Options, client HPAClient, hpa *v1.HorizontalPodAutoscaler, claim scheduleClaim, claimed bool) (bool, error) {
+	minimum, maximum := max(replicasOf(hpa.Spec.MinReplicas), 1), hpa.Spec.MaxReplicas
+	if original, ok := hpa.Annotations[AnnotationScheduleOriginal]; ok {
+		if _, err := fmt.Sscanf(original, "%d/%d", &minimum, &maximum); err != nil {
+			return false, fmt.Errorf("bad %s annotation %q", AnnotationScheduleOriginal, original)
+		}
+	}
+	original := fmt.Sprintf("%d/%d", minimum, maximum)
+
+	if claimed {
+		minimum, maximum = claim.change(minimum, maximum)
+	}
+
+	update := func(hpa *v1.HorizontalPodAutoscaler) error {
+		hpa.Spec.MinReplicas = &minimum
+		hpa.Spec.MaxReplicas = maximum
+
+		if hpa.Annotations == nil {
+			hpa.Annotations = map[string]string{}
+		}
+		if claimed {
+			hpa.Annotations[AnnotationScheduledBy] = claim.schedule + "/" + claim.window
+			hpa.Annotations[AnnotationScheduleOriginal] = original
+		} else {
+			delete(hpa.Annotations, AnnotationScheduledBy)
+			delete(hpa.Annotations, AnnotationScheduleOriginal)
+		}
+		return nil
+	}
+
+	// Most passes change nothing, so only go through modifyHPA, which logs, when there is a change to make
+	wanted := hpa.DeepCopy()
+	_ = update(wanted)
+	if equality.Semantic.DeepEqual(wanted.Spec, hpa.Spec) {
+		return false, nil
+	}
+
+	return modifyHPA(ctx, options, hpa, update, client, "")
+}
+
+// updateScheduleStatus writes the status of the schedule if it has changed
+func updateScheduleStatus(ctx context.Context, options *Options, client dynamic.Interface, schedule *unstructured.Unstructured, status scalingScheduleStatus) error {
+	wanted, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		return err
+	}
+
+	current, _, _ := unstructured.NestedMap(schedule.Object, "status")
+	if equality.Semantic.DeepEqual(current, wanted) || options.DryRun {
+		return nil
+	}
+
+	updated := schedule.DeepCopy()
+	if err := unstructured.SetNestedMap(updated.Object, wanted, "status"); err != nil {
+		return err
+	}
+
+	_, err = client.Resource(scalingScheduleResource).Namespace(schedule.GetNamespace()).
+		UpdateStatus(ctx, updated, metav1.UpdateOptions{FieldManager: FieldManager})
+	if err != nil {
+		return fmt.Errorf("updating status of ScalingSchedule %s/%s: %w", schedule.GetNamespace(), schedule.GetName(), apiError(err))
+	}
+
+	return nil
+}
+
+// scalingScheduleCRD defines the ScalingSchedule resource
+const scalingScheduleCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: scalingschedules.k8sutils.io
+spec:
+  group: k8sutils.io
+  scope: Namespaced
+  names:
+    kind: ScalingSchedule
+    plural: scalingschedules
+    singular: scalingschedule
+    shortNames: [ss]
+  versions:
+  - name: v1alpha1
+    served: true
+    storage: true
+    subresources:
+      status: {}
+    additionalPrinterColumns:
+    - name: Active
+      type: string
+      jsonPath: .status.activeWindow
+    - name: Next
+      type: string
+      format: date-time
+      jsonPath: .status.nextTransition
+    - name: Message
+      type: string
+      jsonPath: .status.message
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            required: [selector, windows]
+            properties:
+              selector:
+                description: Selects the HPAs in the namespace to scale
+                type: object
+                x-kubernetes-preserve-unknown-fields: true
+              timeZone:
+                description: IANA time zone of the start schedules, e.g. Europe/London (default UTC)
+                type: string
+              windows:
+                description: The first open window applies
+                type: array
+                items:
+                  type: object
+                  required: [name, start, duration]
+                  properties:
+                    name:
+                      type: string
+                    start:
+                      description: Cron schedule on which the window opens, e.g. "0 8 * * 1-5"
+                      type: string
+                    duration:
+                      description: How long the window stays open, e.g. 10h
+                      type: string
+                    min:
+                      description: Minimum while open, a number, percentage (50%) or multiplier (2x)
+                      type: string
+                    max:
+                      description: Maximum while open, a number, percentage (50%) or multiplier (2x)
+                      type: string
+          status:
+            type: object
+            x-kubernetes-preserve-unknown-fields: true
+`
@@ -0,0 +1,109 @@
+package program
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestOperatorReconcile(t *testing.T) {
+	// Monday 2024-06-03 at 09:00, in the weekday window which opened at 08:00 and closes at 18:00
+	monday := time.Date(2024, 6, 3, 9, 0, 0, 0, time.UTC)
+	closes := time.Date(2024, 6, 3, 18, 0, 0, 0, time.UTC)
+	opens := time.Date(2024, 6, 4, 8, 0, 0, 0, time.UTC)
+
+	schedule := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "k8sutils.io/v1alpha1",
+		"kind":       "ScalingSchedule",
+		"metadata":   map[string]any{"namespace": "shop", "name": "business-hours"},
+		"spec": map[string]any{
+			"selector": map[string]any{"matchLabels": map[string]any{"tier": "web"}},
+			"windows": []any{
+				map[string]any{"name": "weekdays", "start": "0 8 * * 1-5", "duration": "10h", "min": "4", "max": "2x"},
+			},
+		},
+	}}
+
+	web := newTestHPA("shop", "web", 2, 10)
+	web.Labels = map[string]string{"tier": "web"}
+	other := newTestHPA("shop", "api", 2, 10)
+
+	tests := []struct {
+		name         string
+		now          time.Time
+		hpa          v1.HorizontalPodAutoscaler
+		wantLimits   [2]int32
+		wantNext     time.Time
+		wantActive   string
+		wantAnnotate bool
+	}{
+		{
+			name:         "an open window scales the selected HPAs",
+			now:          monday,
+			hpa:          web,
+			wantLimits:   [2]int32{4, 20},
+			wantNext:     closes,
+			wantActive:   "weekdays",
+			wantAnnotate: true,
+		},
+		{
+			name: "a closed window restores the original values",
+			now:  closes.Add(time.Minute),
+			hpa: func() v1.HorizontalPodAutoscaler {
+				scaled := *web.DeepCopy()
+				*scaled.Spec.MinReplicas, scaled.Spec.MaxReplicas = 4, 20
+				scaled.Annotations = map[string]string{
+					AnnotationScheduledBy:      "business-hours/weekdays",
+					AnnotationScheduleOriginal: "2/10",
+				}
+				return scaled
+			}(),
+			wantLimits: [2]int32{2, 10},
+			wantNext:   opens,
+		},
+		{
+			name:       "HPAs which are not selected are left alone",
+			now:        monday,
+			hpa:        other,
+			wantLimits: [2]int32{2, 10},
+			wantNext:   closes,
+			wantActive: "weekdays",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+				map[schema.GroupVersionResource]string{scalingScheduleResource: "ScalingScheduleList"}, schedule.DeepCopy())
+			hpaClient := NewFakeHPAClient(test.hpa)
+
+			program := &Operator{namespaceName: "shop"}
+			next, err := program.reconcile(context.Background(), &Options{}, client, hpaClient,
+				[]unstructured.Unstructured{*schedule.DeepCopy()}, []v1.HorizontalPodAutoscaler{*test.hpa.DeepCopy()}, test.now)
+			require.NoError(t, err)
+			assert.True(t, test.wantNext.Equal(next), "next transition %v, want %v", next, test.wantNext)
+
+			hpa, err := hpaClient.Get(context.Background(), "shop", test.hpa.Name)
+			require.NoError(t, err)
+			assert.Equal(t, test.wantLimits, [2]int32{*hpa.Spec.MinReplicas, hpa.Spec.MaxReplicas})
+			_, annotated := hpa.Annotations[AnnotationScheduledBy]
+			assert.Equal(t, test.wantAnnotate, annotated)
+
+			stored, err := client.Resource(scalingScheduleResource).Namespace("shop").Get(context.Background(), "business-hours", metav1.GetOptions{})
+			require.NoError(t, err)
+			active, _, _ := unstructured.NestedString(stored.Object, "status", "activeWindow")
+			assert.Equal(t, test.wantActive, active)
+			transition, _, _ := unstructured.NestedString(stored.Object, "status", "nextTransition")
+			assert.Equal(t, test.wantNext.Format(time.RFC3339), transition)
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package program
+
+import (
+	"context"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/rs/zerolog/log"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Orphans lists the ConfigMaps and Secrets nothing refers to, as candidates for cleanup.  References are collected from
+// the volumes, envFrom, env and imagePullSecrets of pods, workloads and CronJobs, from Ingress TLS and from
+// ServiceAccounts.  Some software reads ConfigMaps and Secrets through the API instead, so check before deleting.
+type Orphans struct {
+	Labels        map[string]string `short:"l" help:"Label filters to select ConfigMaps and Secrets"`
+	AllNamespaces bool              `short:"A" help:"Look in all namespaces"`
+}
+
+// managedSecretTypes are Secret types which the cluster and its tools manage and use without a reference in a pod
+var managedSecretTypes = map[corev1.SecretType]bool{
+	corev1.SecretTypeServiceAccountToken: true,
+	corev1.SecretTypeBootstrapToken:      true,
+	"helm.sh/release.v1":                 true,
+}
+
+// rootCAConfigMap is published into every namespace by the cluster for service account token verification
+const rootCAConfigMap = "kube-root-ca.crt"
+
+// configReferences holds the ConfigMaps and Secrets referred to, keyed by "namespace/name"
+type configReferences struct {
+	configMaps map[string]bool
+	secrets    map[string]bool
+}
+
+func (program *Orphans) Run(options *Options) error {
+
+	initColors(options)
+
+	selector := Selector{AllNamespaces: program.AllNamespaces, ChunkSize: 500}
+
+	clientset, err := selector.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	refs, err := collectReferences(ctx, clientset, &selector)
+	if err != nil {
+		return err
+	}
+
+	selector.Labels = program.Labels
+
+	configMaps, err := fetch(ctx, &selector, "configmap", nil,
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]corev1.ConfigMap, string, error) {
+			list, err := clientset.CoreV1().ConfigMaps(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+	if err != nil {
+		return err
+	}
+
+	secrets, err := fetch(ctx, &selector, "secret", nil,
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]corev1.Secret, string, error) {
+			list, err := clientset.CoreV1().Secrets(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	t := newTable()
+	t.AppendHeader(table.Row{"KIND", "NAMESPACE", "NAME", "AGE"})
+	count := 0
+
+	for _, cm := range configMaps {
+		if cm.Name == rootCAConfigMap || len(cm.OwnerReferences) > 0 || refs.configMaps[cm.Namespace+"/"+cm.Name] {
+			continue
+		}
+		count++
+		t.AppendRow(table.Row{"ConfigMap", cm.Namespace, cm.Name, duration.HumanDuration(now.Sub(cm.CreationTimestamp.Time))})
+	}
+
+	for _, secret := range secrets {
+		if managedSecretTypes[secret.Type] || len(secret.OwnerReferences) > 0 || refs.secrets[secret.Namespace+"/"+secret.Name] {
+			continue
+		}
+		count++
+		t.AppendRow(table.Row{"Secret", secret.Namespace, secret.Name, duration.HumanDuration(now.Sub(secret.CreationTimestamp.Time))})
+	}
+
+	if count == 0 {
+		log.Info().Int("configmaps", len(configMaps)).Int("secrets", len(secrets)).Msg("Every ConfigMap and Secret is referenced")
+		return nil
+	}
+
+	t.Render()
+	log.Warn().Int("count", count).Msg("Unreferenced ConfigMaps and Secrets")
+
+	return nil
+}
+
+// collectReferences finds every ConfigMap and Secret referred to by pods, workloads, CronJobs, Ingresses and
+// ServiceAccounts.  Workload templates are included so objects used by workloads scaled to zero are not reported.
+func collectReferences(ctx context.Context, clientset kubernetes.Interface, selector *Selector) (*configReferences, error) {
+	refs := &configReferences{configMaps: map[string]bool{}, secrets: map[string]bool{}}
+
+	pods, err := fetch(ctx, selector, "pod", nil,
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]corev1.Pod, string, error) {
+			list, err := clientset.CoreV1().Pods(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	for i := range pods {
+		refs.addPodSpec(pods[i].Namespace, &pods[i].Spec)
+	}
+
+	templates, err := podTemplates(ctx, clientset, selector)
+	if err != nil {
+		return nil, err
+	}
+	for i := range templates {
+		refs.addPodSpec(templates[i].Namespace, &templates[i].Spec)
+	}
+
+	cronjobs, err := fetch(ctx, selector, "cronjob", nil,
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]batchv1.CronJob, string, error) {
+			list, err := clientset.BatchV1().CronJobs(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	for i := range cronjobs {
+		refs.addPodSpec(cronjobs[i].Namespace, &cronjobs[i].Spec.JobTemplate.Spec.Template.Spec)
+	}
+
+	ingresses, err := fetch(ctx, selector, "ingress", nil,
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]networkingv1.Ingress, string, error) {
+			list, err := clientset.NetworkingV1().Ingresses(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	for _, ingress := range ingresses {
+		for _, tls := range ingress.Spec.TLS {
+			refs.secrets[ingress.Namespace+"/"+tls.SecretName] = true
+		}
+	}
+
+	accounts, err := fetch(ctx, selector, "serviceaccount", nil,
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]corev1.ServiceAccount, string, error) {
+			list, err := clientset.CoreV1().ServiceAccounts(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	for _, account := range accounts {
+		for _, secret := range account.ImagePullSecrets {
+			refs.secrets[account.Namespace+"/"+secret.Name] = true
+		}
+		for _, secret := range account.Secrets {
+			refs.secrets[account.Namespace+"/"+secret.Name] = true
+		}
+	}
+
+	return refs, nil
+}
+
+// addPodSpec records the ConfigMaps and Secrets used by a pod spec's volumes, environment and image pull secrets
+func (refs *configReferences) addPodSpec(namespace string, spec *corev1.PodSpec) {
+	configMap := func(name string) { refs.configMaps[namespace+"/"+name] = true }
+	secret := func(name string) { refs.secrets[namespace+"/"+name] = true }
+
+	for _, s := range spec.ImagePullSecrets {
+		secret(s.Name)
+	}
+
+	for _, volume := range spec.Volumes {
+		switch {
+		case volume.ConfigMap != nil:
+			configMap(volume.ConfigMap.Name)
+		case volume.Secret != nil:
+			secret(volume.Secret.SecretName)
+		case volume.Projected != nil:
+			for _, source := range volume.Projected.Sources {
+				if source.ConfigMap != nil {
+					configMap(source.ConfigMap.Name)
+				}
+				if source.Secret != nil {
+					secret(source.Secret.Name)
+				}
+			}
+		}
+	}
+
+	containers := append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, c := range containers {
+		for _, from := range c.EnvFrom {
+			if from.ConfigMapRef != nil {
+				configMap(from.ConfigMapRef.Name)
+			}
+			if from.SecretRef != nil {
+				secret(from.SecretRef.Name)
+			}
+		}
+
+		for _, env := range c.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if env.ValueFrom.ConfigMapKeyRef != nil {
+				configMap(env.ValueFrom.ConfigMapKeyRef.Name)
+			}
+			if env.ValueFrom.SecretKeyRef != nil {
+				secret(env.ValueFrom.SecretKeyRef.Name)
+			}
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package program
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// SimulateOutage works out what losing a zone or a group of nodes would do to each HPA-managed workload: how many of
+// its pods survive, whether that is below the HPA minimum or more than its PodDisruptionBudget allows, and whether the
+// lost pods fit on the nodes which are left.  Nothing is modified.
+type SimulateOutage struct {
+	Zone       []string          `help:"Zones which go down (topology.kubernetes.io/zone)"`
+	NodeLabels map[string]string `help:"Label filters selecting the nodes which go down, e.g. eks.amazonaws.com/nodegroup=spot"`
+
+	AllNamespaces bool `short:"A" help:"Simulate for workloads in all namespaces"`
+}
+
+// outageImpact is what an outage does to one HPA-managed workload
+type outageImpact struct {
+	Namespace string
+	HPA       string
+	Workload  string
+	Pods      int
+	Lost      int
+	Minimum   int32
+	Problems  []string
+}
+
+func (program *SimulateOutage) Run(options *Options) error {
+
+	initColors(options)
+
+	if len(program.Zone) == 0 && len(program.NodeLabels) == 0 {
+		return usageError("say what goes down with --zone or --node-labels")
+	}
+
+	selector := Selector{AllNamespaces: program.AllNamespaces, ChunkSize: 500}
+
+	clientset, err := selector.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return apiError(err)
+	}
+
+	down := map[string]bool{}
+	var remaining []corev1.Node
+	for _, node := range nodes.Items {
+		if program.goesDown(&node) {
+			down[node.Name] = true
+		} else if !node.Spec.Unschedulable {
+			remaining = append(remaining, node)
+		}
+	}
+
+	if len(down) == 0 {
+		return usageError("no nodes match the zones or labels given")
+	}
+
+	log.Info().Int("down", len(down)).Int("remaining", len(remaining)).Msg("Simulating outage")
+
+	hpaSelector := Selector{AllNamespaces: selector.AllNamespaces, ChunkSize: 500, namespaceName: selector.namespaceName}
+	hpas, err := hpaSelector.getHpas(ctx, WithRetries(NewHPAClient(clientset), options.Retries))
+	if err != nil {
+		return err
+	}
+
+	pods, err := fetch(ctx, &selector, "pod", nil,
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]corev1.Pod, string, error) {
+			list, err := clientset.CoreV1().Pods(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+	if err != nil {
+		return err
+	}
+
+	// Group the running pods by the workload which manages them, and note which are lost
+	owners := newOwnerResolver(clientset)
+	total := map[string]int{}
+	lost := map[string][]corev1.Pod{}
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Spec.NodeName == "" || pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+
+		kind, name, err := owners.workload(ctx, pod)
+		if err != nil {
+			return err
+		}
+		if kind == "" {
+			continue
+		}
+
+		key := pod.Namespace + "/" + kind + "/" + name
+		total[key]++
+		if down[pod.Spec.NodeName] {
+			lost[key] = append(lost[key], *pod)
+		}
+	}
+
+	requested, err := requestsByNode(ctx, clientset)
+	if err != nil {
+		return err
+	}
+	unplaced := placePods(lost, remaining, requested)
+
+	pdbs, err := clientset.PolicyV1().PodDisruptionBudgets(selector.namespace()).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return apiError(err)
+	}
+
+	var impacts []outageImpact
+	for _, hpa := range hpas {
+		ref := hpa.Spec.ScaleTargetRef
+		key := hpa.Namespace + "/" + ref.Kind + "/" + ref.Name
+		if total[key] == 0 {
+			continue
+		}
+
+		impact := outageImpact{
+			Namespace: hpa.Namespace,
+			HPA:       hpa.Name,
+			Workload:  ref.Kind + "/" + ref.Name,
+			Pods:      total[key],
+			Lost:      len(lost[key]),
+			Minimum:   max(replicasOf(hpa.Spec.MinReplicas), 1),
+		}
+
+		if surviving := int32(impact.Pods - impact.Lost); surviving < impact.Minimum {
+			impact.Problems = append(impact.Problems, fmt.Sprintf("%d surviving, below HPA minimum", surviving))
+		}
+
+		for i := range pdbs.Items {
+			pdb := &pdbs.Items[i]
+			if pdb.Namespace != hpa.Namespace {
+				continue
+			}
+			problem, err := pdbImpact(pdb, lost[key])
+			if err != nil {
+				return err
+			}
+			if problem != "" {
+				impact.Problems = append(impact.Problems, fmt.Sprintf("exceeds PDB %s", pdb.Name))
+			}
+		}
+
+		if unplaced[key] > 0 {
+			impact.Problems = append(impact.Problems, fmt.Sprintf("%d pods cannot be rescheduled", unplaced[key]))
+		}
+
+		impacts = append(impacts, impact)
+	}
+
+	printOutageImpacts(impacts)
+
+	failing := 0
+	for _, impact := range impacts {
+		if len(impact.Problems) > 0 {
+			failing++
+		}
+	}
+	if failing > 0 {
+		log.Warn().Int("count", failing).Msg("Workloads disrupted by the outage")
+	} else {
+		log.Info().Int("workloads", len(impacts)).Msg("All HPA-managed workloads survive the outage")
+	}
+
+	return nil
+}
+
+// goesDown returns true if the node is in one of the zones or matches the node labels
+func (program *SimulateOutage) goesDown(node *corev1.Node) bool {
+	for _, zone := range program.Zone {
+		if node.Labels[corev1.LabelTopologyZone] == zone {
+			return true
+		}
+	}
+	return len(program.NodeLabels) > 0 && labels.SelectorFromSet(program.NodeLabels).Matches(labels.Set(node.Labels))
+}
+
+// placePods fits the lost pods onto the free capacity of the remaining nodes, largest CPU request first, and returns
+// the number of each workload's pods which do not fit.  Only CPU and memory requests are considered, not affinity,
+// taints or spread constraints, so the result is the best case.
+func placePods(lost map[string][]corev1.Pod, nodes []corev1.Node, requested map[string]corev1.ResourceList) map[string]int {
+	free := make([]corev1.ResourceList, len(nodes))
+	for i, node := range nodes {
+		free[i] = corev1.ResourceList{}
+		for _, name := range auditedResources {
+			available := node.Status.Allocatable[name].DeepCopy()
+			available.Sub(requested[node.Name][name])
+			free[i][name] = available
+		}
+	}
+
+	type pending struct {
+		key      string
+		requests corev1.ResourceList
+	}
+
+	keys := make([]string, 0, len(lost))
+	for key := range lost {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var all []pending
+	for _, key := range keys {
+		for i := range lost[key] {
+			all = append(all, pending{key, podRequests(&lost[key][i])})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		a, b := all[i].requests[corev1.ResourceCPU], all[j].requests[corev1.ResourceCPU]
+		return a.Cmp(b) > 0
+	})
+
+	unplaced := map[string]int{}
+	for _, p := range all {
+		placed := false
+		for i := range free {
+			if fits(p.requests, free[i]) {
+				for _, name := range auditedResources {
+					available := free[i][name]
+					available.Sub(p.requests[name])
+					free[i][name] = available
+				}
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			unplaced[p.key]++
+		}
+	}
+
+	return unplaced
+}
+
+// fits returns true if the CPU and memory requests fit in the free capacity
+func fits(requests, free corev1.ResourceList) bool {
+	for _, name := range auditedResources {
+		request := requests[name]
+		available := free[name]
+		if request.Cmp(available) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// podRequests returns the total container requests of the pod
+func podRequests(pod *corev1.Pod) corev1.ResourceList {
+	total := corev1.ResourceList{}
+	for _, container := range pod.Spec.Containers {
+		addResources(total, container.Resources.Requests)
+	}
+	return total
+}
+
+// printOutageImpacts shows what the outage does to each workload, highlighting those which are disrupted
+func printOutageImpacts(impacts []outageImpact) {
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "HPA", "WORKLOAD", "PODS", "LOST", "SURVIVING", "MIN", "IMPACT"})
+
+	for _, i := range impacts {
+		status := paint(text.FgGreen, "ok")
+		if len(i.Problems) > 0 {
+			status = paint(text.FgRed, strings.Join(i.Problems, ", "))
+		}
+
+		t.AppendRow(table.Row{
+			i.Namespace,
+			i.HPA,
+			i.Workload,
+			strconv.Itoa(i.Pods),
+			strconv.Itoa(i.Lost),
+			strconv.Itoa(i.Pods - i.Lost),
+			strconv.Itoa(int(i.Minimum)),
+			status,
+		})
+	}
+
+	t.Render()
+}
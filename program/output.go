@@ -1,14 +1,19 @@
 package program
 
 import (
+	"bufio"
+	"context"
 	"fmt"
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/jedib0t/go-pretty/v6/text"
 	"github.com/rs/zerolog/log"
+	"io"
 	"math"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	v1 "k8s.io/api/autoscaling/v1"
 )
@@ -24,6 +29,7 @@ func initColors(options *Options) {
 	} else {
 		log.Debug().Msg("Disabling colors")
 		text.DisableColors()
+		colorsEnabled = false
 	}
 }
 
@@ -110,7 +116,8 @@ func formatMarks(min, max int32, marks ...Mark) string {
 	return builder.String()
 }
 
-func (program *Hpa) printHPAs(hpas []v1.HorizontalPodAutoscaler) {
+// newTable returns a table writer for stdout in the plain style used by every listing
+func newTable() table.Writer {
 	t := table.NewWriter()
 	t.SetOutputMirror(os.Stdout)
 	t.SetStyle(table.StyleLight)
@@ -118,55 +125,187 @@ func (program *Hpa) printHPAs(hpas []v1.HorizontalPodAutoscaler) {
 	t.Style().Options.SeparateRows = false
 	t.Style().Options.SeparateColumns = false
 	t.Style().Options.SeparateHeader = false
+	return t
+}
+
+func (program *Hpa) printHPAs(ctx context.Context, hpas []v1.HorizontalPodAutoscaler) {
+	program.newHPAPrinter(ctx).print(hpas)
+}
+
+// hpaPrinter renders HPAs as a table.  Rows are written straight to the output as they are formatted rather than
+// being collected into a table first, so thousands of HPAs render quickly and in little memory.  The table may be
+// printed in several chunks as HPAs arrive, in which case the header is printed once and the chunks share column widths
+// as far as possible.
+type hpaPrinter struct {
+	ctx           context.Context
+	out           io.Writer
+	rollouts      *rolloutResolver
+	allNamespaces bool
+	printedHeader bool
+	widths        []int
+}
+
+// cell is a formatted table cell, with the printed width of its text excluding any color escape sequences
+type cell struct {
+	text  string
+	width int
+}
+
+func plain(s string) cell {
+	return cell{s, utf8.RuneCountInString(s)}
+}
+
+func (program *Hpa) newHPAPrinter(ctx context.Context) *hpaPrinter {
+	return &hpaPrinter{ctx: ctx, out: os.Stdout, rollouts: program.rollouts, allNamespaces: program.AllNamespaces}
+}
+
+func (p *hpaPrinter) print(hpas []v1.HorizontalPodAutoscaler) {
+	if len(hpas) == 0 && p.printedHeader {
+		return
+	}
 
-	t.AppendHeader(table.Row{"NAME", "REFERENCE", "CPU", "SCALE"})
-	for _, hpa := range hpas {
-		cpu := "unknown"
-		if hpa.Status.CurrentCPUUtilizationPercentage != nil && hpa.Spec.TargetCPUUtilizationPercentage != nil {
-			cpu = formatMarks(0, 100,
-				Mark{fmt.Sprint(*hpa.Status.CurrentCPUUtilizationPercentage, "%"), int(*hpa.Status.CurrentCPUUtilizationPercentage)},
-				Mark{"<", int(*hpa.Spec.TargetCPUUtilizationPercentage)},
-			)
-
-			log.Debug().
-				Int32("current", *hpa.Status.CurrentCPUUtilizationPercentage).
-				Int32("target", *hpa.Spec.TargetCPUUtilizationPercentage).
-				Msg("cpu")
-			if *hpa.Status.CurrentCPUUtilizationPercentage <= *hpa.Spec.TargetCPUUtilizationPercentage {
-				cpu = text.FgGreen.Sprint(cpu)
-			} else if *hpa.Status.CurrentCPUUtilizationPercentage >= 90 {
-				cpu = text.FgRed.Sprint(cpu)
-			} else {
-				cpu = text.FgYellow.Sprint(cpu)
+	rows := make([][]cell, 0, len(hpas)+1)
+
+	if !p.printedHeader {
+		header := []cell{plain("NAME"), plain("REFERENCE"), plain("CPU"), plain("SCALE")}
+		if p.allNamespaces {
+			header = append([]cell{plain("NAMESPACE")}, header...)
+		}
+		rows = append(rows, header)
+		p.printedHeader = true
+	}
+
+	for i := range hpas {
+		rows = append(rows, p.format(&hpas[i]))
+	}
+
+	for _, row := range rows {
+		p.measure(row)
+	}
+
+	w := bufio.NewWriter(p.out)
+	defer w.Flush()
+
+	for _, row := range rows {
+		for i, c := range row {
+			w.WriteByte(' ')
+			w.WriteString(c.text)
+			for pad := p.widths[i] - c.width; pad > 0; pad-- {
+				w.WriteByte(' ')
 			}
+			w.WriteByte(' ')
 		}
+		w.WriteByte('\n')
+	}
+}
 
-		pods := formatMarks(*hpa.Spec.MinReplicas, hpa.Spec.MaxReplicas,
-			Mark{fmt.Sprint(hpa.Status.CurrentReplicas), int(hpa.Status.CurrentReplicas)},
-			Mark{"|", int(hpa.Status.DesiredReplicas)},
-			Max,
-		)
+// measure records the widest value seen in each column
+func (p *hpaPrinter) measure(row []cell) {
+	for i, c := range row {
+		if i >= len(p.widths) {
+			p.widths = append(p.widths, c.width)
+		} else if c.width > p.widths[i] {
+			p.widths[i] = c.width
+		}
+	}
+}
+
+func (p *hpaPrinter) format(hpa *v1.HorizontalPodAutoscaler) []cell {
+	cpu := plain("unknown")
+	if hpa.Status.CurrentCPUUtilizationPercentage != nil && hpa.Spec.TargetCPUUtilizationPercentage != nil {
+		current := *hpa.Status.CurrentCPUUtilizationPercentage
+		target := *hpa.Spec.TargetCPUUtilizationPercentage
 
-		podColor := text.FgGreen
+		cpu = plain(formatMarks(0, 100,
+			Mark{strconv.Itoa(int(current)) + "%", int(current)},
+			Mark{"<", int(target)},
+		))
 
 		switch {
-		case hpa.Status.CurrentReplicas > int32(float32(hpa.Spec.MaxReplicas)*.8):
-			podColor = text.FgYellow
-		case hpa.Status.CurrentReplicas > int32(float32(hpa.Spec.MaxReplicas)*.8):
-			podColor = text.FgYellow
-		case hpa.Status.CurrentReplicas >= hpa.Spec.MaxReplicas:
-			podColor = text.FgMagenta
+		case current <= target:
+			cpu.text = paint(text.FgGreen, cpu.text)
+		case current >= 90:
+			cpu.text = paint(text.FgRed, cpu.text)
+		default:
+			cpu.text = paint(text.FgYellow, cpu.text)
+		}
+	}
+
+	reference := plain(hpa.Spec.ScaleTargetRef.Kind + "/" + hpa.Spec.ScaleTargetRef.Name)
+	current := hpa.Status.CurrentReplicas
+
+	if hpa.Spec.ScaleTargetRef.Kind == "Rollout" {
+		if status := p.rollouts.status(p.ctx, hpa.Namespace, hpa.Spec.ScaleTargetRef.Name); status != nil {
+			phase := plain(status.Phase)
+			reference = cell{reference.text + " " + paint(rolloutColor(phase.text), phase.text), reference.width + 1 + phase.width}
+			current = status.Replicas
 		}
+	}
+
+	pods := plain(formatMarks(*hpa.Spec.MinReplicas, hpa.Spec.MaxReplicas,
+		Mark{strconv.Itoa(int(current)), int(current)},
+		Mark{"|", int(hpa.Status.DesiredReplicas)},
+		Max,
+	))
+
+	podColor := text.FgGreen
+
+	switch {
+	case current >= hpa.Spec.MaxReplicas:
+		podColor = text.FgMagenta
+	case current > int32(float32(hpa.Spec.MaxReplicas)*.8):
+		podColor = text.FgYellow
+	}
+
+	pods.text = paint(podColor, pods.text)
+
+	name := hpa.Name
+	if isLocked(hpa) {
+		name += " (locked)"
+	}
+
+	row := make([]cell, 0, 5)
+	if p.allNamespaces {
+		row = append(row, plain(hpa.Namespace))
+	}
+
+	return append(row,
+		plain(name),
+		reference,
+		cpu,
+		pods,
+	)
+}
+
+// rolloutColor returns the color to show an Argo Rollout phase in
+func rolloutColor(phase string) text.Color {
+	switch phase {
+	case "Healthy":
+		return text.FgGreen
+	case "Degraded":
+		return text.FgRed
+	default:
+		return text.FgYellow
+	}
+}
+
+// escapes caches the escape sequence for each color used in tables
+var escapes = map[text.Color]string{
+	text.FgGreen:   text.FgGreen.EscapeSeq(),
+	text.FgYellow:  text.FgYellow.EscapeSeq(),
+	text.FgRed:     text.FgRed.EscapeSeq(),
+	text.FgMagenta: text.FgMagenta.EscapeSeq(),
+}
 
-		pods = podColor.Sprint(pods)
+var resetEscape = text.Reset.EscapeSeq()
 
-		t.AppendRow(table.Row{
-			hpa.Name,
-			hpa.Spec.ScaleTargetRef.Kind + "/" + hpa.Spec.ScaleTargetRef.Name,
-			cpu,
-			pods,
-		})
+// colorsEnabled records the decision made by initColors
+var colorsEnabled = true
 
+// paint colors the string using cached escape sequences
+func paint(color text.Color, s string) string {
+	if !colorsEnabled {
+		return s
 	}
-	t.Render()
+	return escapes[color] + s + resetEscape
 }
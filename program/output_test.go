@@ -0,0 +1,56 @@
+package program
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/autoscaling/v1"
+)
+
+func TestPrintHPAs(t *testing.T) {
+	colorsEnabled = false
+	defer func() { colorsEnabled = true }()
+
+	short := newTestHPA("default", "web", 2, 10)
+	long := newTestHPA("default", "checkout-service", 1, 4)
+
+	var out bytes.Buffer
+	printer := &hpaPrinter{ctx: context.Background(), out: &out}
+	printer.print([]v1.HorizontalPodAutoscaler{short})
+	printer.print([]v1.HorizontalPodAutoscaler{long})
+	printer.print(nil)
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	assert.Len(t, lines, 3, "the header is printed once")
+	assert.True(t, strings.HasPrefix(lines[0], " NAME "))
+	assert.True(t, strings.HasPrefix(lines[1], " web "))
+	assert.True(t, strings.HasPrefix(lines[2], " checkout-service "))
+	assert.Equal(t, strings.Index(lines[0], "REFERENCE"), strings.Index(lines[1], "Deployment/"), "columns are aligned")
+	assert.Greater(t, strings.Index(lines[2], "Deployment/"), strings.Index(lines[1], "Deployment/"),
+		"later chunks widen the columns for longer values")
+}
+
+func BenchmarkPrintHPAs(b *testing.B) {
+	hpas := make([]v1.HorizontalPodAutoscaler, 5000)
+	for i := range hpas {
+		hpas[i] = newTestHPA(fmt.Sprintf("namespace-%d", i%50), fmt.Sprintf("service-%d", i), 2, 20)
+		current, desired := int32(i%20), int32(i%20+1)
+		utilization := int32(i % 120)
+		hpas[i].Status.CurrentReplicas = current
+		hpas[i].Status.DesiredReplicas = desired
+		hpas[i].Status.CurrentCPUUtilizationPercentage = &utilization
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		printer := &hpaPrinter{ctx: context.Background(), out: io.Discard, allNamespaces: true}
+		printer.print(hpas)
+	}
+}
@@ -0,0 +1,85 @@
+package program
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/autoscaling/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/util/retry"
+)
+
+// FieldManager is the name this tool uses when writing to the API server
+const FieldManager = "k8sutils"
+
+// patchHPA sends a strategic merge patch containing only the fields which differ between original and modified, so
+// concurrent changes to other fields are not overwritten.  The patch carries the resource version of original, so it is
+// rejected with a conflict if the HPA has changed since it was read.
+func patchHPA(ctx context.Context, client HPAClient, original, modified *v1.HorizontalPodAutoscaler) (*v1.HorizontalPodAutoscaler, error) {
+	originalJSON, err := json.Marshal(original)
+	if err != nil {
+		return nil, err
+	}
+
+	modifiedJSON, err := json.Marshal(modified)
+	if err != nil {
+		return nil, err
+	}
+
+	patch, err := strategicpatch.CreateTwoWayMergePatch(originalJSON, modifiedJSON, v1.HorizontalPodAutoscaler{})
+	if err != nil {
+		return nil, err
+	}
+
+	if patch, err = withResourceVersion(patch, original.ResourceVersion); err != nil {
+		return nil, err
+	}
+
+	log.Debug().Str("hpa", modified.Name).RawJSON("patch", patch).Msg("Patching HPA")
+
+	return client.Patch(ctx, modified.Namespace, modified.Name, types.StrategicMergePatchType, patch)
+}
+
+// withResourceVersion adds the resource version precondition to the patch
+func withResourceVersion(patch []byte, resourceVersion string) ([]byte, error) {
+	if resourceVersion == "" {
+		return patch, nil
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(patch, &fields); err != nil {
+		return nil, err
+	}
+
+	metadata, ok := fields["metadata"].(map[string]any)
+	if !ok {
+		metadata = map[string]any{}
+		fields["metadata"] = metadata
+	}
+	metadata["resourceVersion"] = resourceVersion
+
+	return json.Marshal(fields)
+}
+
+// retryOnConflict runs attempt against the HPA.  If attempt fails because the HPA changed since it was read, the current
+// HPA is fetched into hpa and attempt is run again.
+func retryOnConflict(ctx context.Context, client HPAClient, hpa *v1.HorizontalPodAutoscaler, attempt func(hpa *v1.HorizontalPodAutoscaler) error) error {
+	first := true
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if !first {
+			log.Debug().Str("hpa", hpa.Name).Msg("HPA changed during update, retrying")
+
+			current, err := client.Get(ctx, hpa.Namespace, hpa.Name)
+			if err != nil {
+				return apiError(err)
+			}
+			*hpa = *current
+		}
+		first = false
+
+		return attempt(hpa)
+	})
+}
@@ -0,0 +1,83 @@
+package program
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/autoscaling/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+func TestRetryOnConflict(t *testing.T) {
+	conflict := apierrors.NewConflict(autoscalersResource, "web", errors.New("changed"))
+	failure := errors.New("failed")
+
+	tests := []struct {
+		name      string
+		results   []error
+		wantCalls int
+		wantErr   error
+	}{
+		{name: "success is not retried", results: []error{nil}, wantCalls: 1},
+		{name: "conflicts are retried", results: []error{conflict, conflict, nil}, wantCalls: 3},
+		{name: "other errors are not retried", results: []error{failure}, wantCalls: 1, wantErr: failure},
+		{name: "persistent conflicts give up", results: []error{conflict, conflict, conflict, conflict, conflict, conflict}, wantCalls: 5, wantErr: conflict},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := NewFakeHPAClient(newTestHPA("default", "web", 2, 10))
+			hpa, err := fake.Get(context.Background(), "default", "web")
+			require.NoError(t, err)
+
+			// Change the stored HPA so each retry has to fetch it again to see the new version
+			var versions []string
+			calls := 0
+			err = retryOnConflict(context.Background(), fake, hpa, func(hpa *v1.HorizontalPodAutoscaler) error {
+				versions = append(versions, hpa.ResourceVersion)
+				result := test.results[calls]
+				calls++
+				if apierrors.IsConflict(result) {
+					_, err := fake.Update(context.Background(), hpa)
+					require.NoError(t, err)
+				}
+				return result
+			})
+
+			assert.Equal(t, test.wantCalls, calls)
+			if test.wantErr != nil {
+				assert.ErrorIs(t, err, test.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			for i := 1; i < len(versions); i++ {
+				assert.NotEqual(t, versions[i-1], versions[i], "retry %d uses the current HPA", i)
+			}
+		})
+	}
+}
+
+// unauthorizedGetClient fails every Get as if the credentials had expired
+type unauthorizedGetClient struct {
+	*FakeHPAClient
+}
+
+func (c *unauthorizedGetClient) Get(ctx context.Context, namespace, name string) (*v1.HorizontalPodAutoscaler, error) {
+	return nil, apierrors.NewUnauthorized("token expired")
+}
+
+func TestRetryOnConflictFetchError(t *testing.T) {
+	fake := NewFakeHPAClient(newTestHPA("default", "web", 2, 10))
+	hpa, err := fake.Get(context.Background(), "default", "web")
+	require.NoError(t, err)
+
+	err = retryOnConflict(context.Background(), &unauthorizedGetClient{fake}, hpa, func(hpa *v1.HorizontalPodAutoscaler) error {
+		return apierrors.NewConflict(autoscalersResource, "web", errors.New("changed"))
+	})
+
+	assert.Equal(t, ExitConnection, ExitCode(err), "failing to fetch the HPA again is a connection error")
+}
@@ -0,0 +1,189 @@
+package program
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	appsv1 "k8s.io/api/apps/v1"
+	v2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// HpaPolicy holds the flags of the rules HPAs are held to, by "hpa lint" and "hpa webhook"
+type HpaPolicy struct {
+	MinTarget int32 `default:"20" help:"Lowest utilization target allowed, as a percentage of requests"`
+	MaxTarget int32 `default:"95" help:"Highest utilization target allowed, as a percentage of requests"`
+}
+
+// The policy rules
+const (
+	// policyMinEqualsMax is broken by an HPA which cannot scale because its min and max are the same
+	policyMinEqualsMax = "min-equals-max"
+	// policyMissingRequests is broken by an HPA scaling on the utilization of a resource its pods do not request, which
+	// the HPA controller cannot calculate
+	policyMissingRequests = "missing-requests"
+	// policyTargetRange is broken by a utilization target outside --min-target and --max-target
+	policyTargetRange = "target-range"
+)
+
+// policyViolation is a rule an HPA breaks, and how
+type policyViolation struct {
+	rule, message string
+}
+
+func (v policyViolation) String() string {
+	return v.rule + ": " + v.message
+}
+
+// HpaLint lists the selected HPAs which break the policy rules, failing if any do
+type HpaLint struct {
+	HpaPolicy `embed:""`
+	Selector  `embed:"" set:"resources=HPAs"`
+}
+
+func (program *HpaLint) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	selector := program.Selector
+	hpas, err := getHpasV2(ctx, clientset, &selector)
+	if err != nil {
+		return err
+	}
+
+	workloads := Selector{AllNamespaces: program.AllNamespaces, ChunkSize: program.ChunkSize, namespaceName: program.namespaceName}
+	templates, err := podTemplates(ctx, clientset, &workloads)
+	if err != nil {
+		return err
+	}
+	specs := podSpecsByWorkload(templates)
+
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "HPA", "RULE", "PROBLEM"})
+	failed := 0
+
+	for i := range hpas {
+		hpa := &hpas[i]
+		ref := hpa.Spec.ScaleTargetRef
+
+		violations := program.violations(hpa, specs[hpa.Namespace+"/"+ref.Kind+"/"+ref.Name])
+		if len(violations) > 0 {
+			failed++
+		}
+		for _, v := range violations {
+			t.AppendRow(table.Row{hpa.Namespace, hpa.Name, v.rule, paint(text.FgRed, v.message)})
+		}
+	}
+
+	if failed == 0 {
+		log.Info().Int("hpas", len(hpas)).Msg("All HPAs follow the policy")
+		return nil
+	}
+
+	t.Render()
+
+	return fmt.Errorf("%d of %d HPAs break the policy", failed, len(hpas))
+}
+
+// violations returns the rules the HPA breaks.  spec is the pod spec of the HPA's target, if known; without it the
+// requests cannot be checked.
+func (policy *HpaPolicy) violations(hpa *v2.HorizontalPodAutoscaler, spec *corev1.PodSpec) []policyViolation {
+	var result []policyViolation
+
+	if minimum := max(replicasOf(hpa.Spec.MinReplicas), 1); minimum == hpa.Spec.MaxReplicas {
+		result = append(result, policyViolation{policyMinEqualsMax, fmt.Sprintf("min and max are both %d, so the HPA cannot scale", minimum)})
+	}
+
+	for _, metric := range hpa.Spec.Metrics {
+		var resource corev1.ResourceName
+		var target v2.MetricTarget
+		container := ""
+
+		switch {
+		case metric.Resource != nil:
+			resource, target = metric.Resource.Name, metric.Resource.Target
+		case metric.ContainerResource != nil:
+			resource, target, container = metric.ContainerResource.Name, metric.ContainerResource.Target, metric.ContainerResource.Container
+		default:
+			continue
+		}
+
+		if target.Type != v2.UtilizationMetricType || target.AverageUtilization == nil {
+			continue
+		}
+
+		if utilization := *target.AverageUtilization; utilization < policy.MinTarget || utilization > policy.MaxTarget {
+			result = append(result, policyViolation{policyTargetRange,
+				fmt.Sprintf("%s target %d%% is outside %d%%-%d%%", resource, utilization, policy.MinTarget, policy.MaxTarget)})
+		}
+
+		if spec == nil {
+			continue
+		}
+
+		var missing []string
+		for _, c := range spec.Containers {
+			if container != "" && c.Name != container {
+				continue
+			}
+			if _, ok := c.Resources.Requests[resource]; !ok {
+				missing = append(missing, c.Name)
+			}
+		}
+		if len(missing) > 0 {
+			result = append(result, policyViolation{policyMissingRequests,
+				fmt.Sprintf("scales on %s utilization but %s has no %s request", resource, strings.Join(missing, ", "), resource)})
+		}
+	}
+
+	return result
+}
+
+// targetPodSpec returns the pod spec of the Deployment, StatefulSet or ReplicaSet the HPA scales, or nil if it is
+// another kind or does not exist (yet)
+func targetPodSpec(ctx context.Context, clientset kubernetes.Interface, namespace string, ref v2.CrossVersionObjectReference) (*corev1.PodSpec, error) {
+	apps := clientset.AppsV1()
+	var spec *corev1.PodSpec
+	var err error
+
+	switch ref.Kind {
+	case "Deployment":
+		var d *appsv1.Deployment
+		if d, err = apps.Deployments(namespace).Get(ctx, ref.Name, metav1.GetOptions{}); err == nil {
+			spec = &d.Spec.Template.Spec
+		}
+	case "StatefulSet":
+		var sts *appsv1.StatefulSet
+		if sts, err = apps.StatefulSets(namespace).Get(ctx, ref.Name, metav1.GetOptions{}); err == nil {
+			spec = &sts.Spec.Template.Spec
+		}
+	case "ReplicaSet":
+		var rs *appsv1.ReplicaSet
+		if rs, err = apps.ReplicaSets(namespace).Get(ctx, ref.Name, metav1.GetOptions{}); err == nil {
+			spec = &rs.Spec.Template.Spec
+		}
+	default:
+		return nil, nil
+	}
+
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+
+	return spec, err
+}
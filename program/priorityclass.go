@@ -0,0 +1,229 @@
+package program
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/rs/zerolog/log"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Priorityclass shows and sets the PriorityClass of Deployments.  When HPAs push a cluster to capacity the scheduler
+// preempts lower priority pods to place new ones, so critical autoscaled services need a higher priority than the
+// batch work around them.
+type Priorityclass struct {
+	Set    string `xor:"action" help:"Set priorityClassName to this PriorityClass"`
+	Clear  bool   `xor:"action" help:"Remove priorityClassName so the cluster default applies"`
+	Ticket string `help:"Change ticket (e.g. JIRA-123) recorded with every modification"`
+
+	Selector `embed:""`
+	Bulk     `embed:""`
+}
+
+func (program *Priorityclass) Run(options *Options) error {
+
+	initColors(options)
+
+	changing := program.Set != "" || program.Clear
+	if changing && !program.selected() {
+		return usageError("select Deployments by name, with --labels or with --all")
+	}
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	classes, err := priorityClasses(ctx, clientset)
+	if err != nil {
+		return err
+	}
+
+	if program.Set != "" {
+		if _, ok := classes[program.Set]; !ok {
+			return usageError("no PriorityClass named %q", program.Set)
+		}
+	}
+
+	deployments, err := (&Deploy{Selector: program.Selector}).getDeployments(ctx, clientset)
+	if err != nil {
+		return err
+	}
+
+	if !changing {
+		program.print(deployments, classes)
+		return nil
+	}
+
+	return options.runAsLeader(ctx, clientset, func(ctx context.Context) error {
+		return program.setPriorityClass(ctx, options, clientset, deployments)
+	})
+}
+
+// priorityClasses returns the cluster's PriorityClasses by name
+func priorityClasses(ctx context.Context, clientset kubernetes.Interface) (map[string]*schedulingv1.PriorityClass, error) {
+	list, err := clientset.SchedulingV1().PriorityClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, apiError(err)
+	}
+
+	classes := map[string]*schedulingv1.PriorityClass{}
+	for i := range list.Items {
+		classes[list.Items[i].Name] = &list.Items[i]
+	}
+	return classes, nil
+}
+
+// setPriorityClass sets or clears the priorityClassName of each Deployment's pod template, which rolls out new pods
+func (program *Priorityclass) setPriorityClass(ctx context.Context, options *Options, clientset kubernetes.Interface, deployments []appsv1.Deployment) error {
+	results := newSummary()
+	defer results.print()
+
+	errs := program.Bulk.run(ctx, len(deployments), options.DryRun, false, func(i int) error {
+		d := &deployments[i]
+
+		current := d.Spec.Template.Spec.PriorityClassName
+		if current == program.Set {
+			results.record(d.Namespace, d.Name, outcomeSkipped, "already at the requested PriorityClass")
+			return nil
+		}
+
+		message := fmt.Sprintf("priorityClassName %s -> %s", orDash(current), orDash(program.Set))
+		if program.Ticket != "" {
+			message += fmt.Sprintf(" (ticket %s)", program.Ticket)
+		}
+
+		log.Info().Str("namespace", d.Namespace).Str("deployment", d.Name).Str("change", message).Msg("Modifying")
+
+		if options.DryRun {
+			results.record(d.Namespace, d.Name, outcomeUpdated, "dry run: "+message)
+			return nil
+		}
+
+		annotations := map[string]string{AnnotationChange: message}
+		if program.Ticket != "" {
+			annotations[AnnotationTicket] = program.Ticket
+		}
+
+		// A null value removes the field in a strategic merge patch
+		var value any
+		if program.Set != "" {
+			value = program.Set
+		}
+
+		patch, err := json.Marshal(map[string]any{
+			"metadata": map[string]any{"annotations": annotations},
+			"spec": map[string]any{
+				"template": map[string]any{
+					"spec": map[string]any{"priorityClassName": value},
+				},
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		var updated *appsv1.Deployment
+		err = withRetries(ctx, options.Retries, func() (err error) {
+			updated, err = clientset.AppsV1().Deployments(d.Namespace).Patch(ctx, d.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{FieldManager: FieldManager})
+			return err
+		})
+		if err != nil {
+			err = apiError(err)
+			fmt.Printf("Failed to update deployment %s: %v\n", d.Name, err)
+			results.record(d.Namespace, d.Name, outcomeFailed, err.Error())
+			return fmt.Errorf("deployment %s: %w", d.Name, err)
+		}
+		*d = *updated
+
+		recordObjectEvent(ctx, eventCreator(clientset), corev1.ObjectReference{
+			APIVersion:      "apps/v1",
+			Kind:            "Deployment",
+			Name:            d.Name,
+			Namespace:       d.Namespace,
+			UID:             d.UID,
+			ResourceVersion: d.ResourceVersion,
+		}, "Modified", message)
+
+		results.record(d.Namespace, d.Name, outcomeUpdated, message)
+		return nil
+	})
+
+	for _, d := range deployments {
+		if !results.has(d.Namespace, d.Name) {
+			results.record(d.Namespace, d.Name, outcomeSkipped, "not started")
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// print shows the PriorityClass of each Deployment with its priority and preemption policy.  Pods without a class get
+// the cluster's global default, or priority 0 if there is none.
+func (program *Priorityclass) print(deployments []appsv1.Deployment, classes map[string]*schedulingv1.PriorityClass) {
+	var fallback *schedulingv1.PriorityClass
+	for _, class := range classes {
+		if class.GlobalDefault {
+			fallback = class
+		}
+	}
+
+	t := newTable()
+
+	header := table.Row{"NAME", "PRIORITYCLASS", "PRIORITY", "PREEMPTION"}
+	if program.AllNamespaces {
+		header = append(table.Row{"NAMESPACE"}, header...)
+	}
+	t.AppendHeader(header)
+
+	for _, d := range deployments {
+		name := d.Spec.Template.Spec.PriorityClassName
+		class := classes[name]
+
+		switch {
+		case name == "" && fallback != nil:
+			name, class = "(default) "+fallback.Name, fallback
+		case name == "":
+			name = "-"
+		}
+
+		priority, preemption := "0", string(corev1.PreemptLowerPriority)
+		switch {
+		case class != nil:
+			priority = strconv.Itoa(int(class.Value))
+			if class.PreemptionPolicy != nil {
+				preemption = string(*class.PreemptionPolicy)
+			}
+		case name != "-":
+			priority = "missing"
+		}
+
+		row := table.Row{d.Name, name, priority, preemption}
+		if program.AllNamespaces {
+			row = append(table.Row{d.Namespace}, row...)
+		}
+		t.AppendRow(row)
+	}
+
+	t.Render()
+}
+
+// orDash returns the value, or "-" if it is empty
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
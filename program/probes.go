@@ -0,0 +1,134 @@
+package program
+
+import (
+	"fmt"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// Probes audits the readiness and liveness probes and shutdown settings of HPA-managed workloads.  Every scale up and
+// scale down adds or removes pods under live traffic: without a readiness probe new pods receive requests before they
+// can serve them, and without time to drain, removed pods drop the requests they are handling.
+type Probes struct {
+	MinGracePeriod int64 `default:"10" help:"Flag terminationGracePeriodSeconds below this many seconds"`
+
+	Selector `embed:""`
+}
+
+// probeFinding is a problem with one container's probes or shutdown
+type probeFinding struct {
+	namespace string
+	workload  string
+	container string
+	problem   string
+	severe    bool
+}
+
+func (program *Probes) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	hpaSelector := Selector{AllNamespaces: program.AllNamespaces, ChunkSize: program.ChunkSize, namespaceName: program.namespaceName}
+	hpas, err := hpaSelector.getHpas(ctx, WithRetries(NewHPAClient(clientset), options.Retries))
+	if err != nil {
+		return err
+	}
+
+	scaled := map[string]bool{}
+	for _, hpa := range hpas {
+		ref := hpa.Spec.ScaleTargetRef
+		scaled[hpa.Namespace+"/"+ref.Kind+"/"+ref.Name] = true
+	}
+
+	templates, err := podTemplates(ctx, clientset, &program.Selector)
+	if err != nil {
+		return err
+	}
+
+	var findings []probeFinding
+	audited := 0
+	for _, t := range templates {
+		if !scaled[t.Namespace+"/"+t.Kind+"/"+t.Name] {
+			continue
+		}
+		audited++
+
+		for _, problem := range program.audit(&t.Spec) {
+			problem.namespace, problem.workload = t.Namespace, t.Kind+"/"+t.Name
+			findings = append(findings, problem)
+		}
+	}
+
+	if len(findings) == 0 {
+		log.Info().Int("workloads", audited).Msg("No probe or shutdown problems found")
+		return nil
+	}
+
+	tw := newTable()
+	tw.AppendHeader(table.Row{"NAMESPACE", "WORKLOAD", "CONTAINER", "PROBLEM"})
+	for _, f := range findings {
+		problem := paint(text.FgYellow, f.problem)
+		if f.severe {
+			problem = paint(text.FgRed, f.problem)
+		}
+		tw.AppendRow(table.Row{f.namespace, f.workload, f.container, problem})
+	}
+	tw.Render()
+
+	log.Warn().Int("count", len(findings)).Int("workloads", audited).Msg("Probe and shutdown problems")
+
+	return nil
+}
+
+// audit returns the problems with the pod template's probes and shutdown settings
+func (program *Probes) audit(spec *corev1.PodSpec) []probeFinding {
+	var findings []probeFinding
+
+	grace := int64(corev1.DefaultTerminationGracePeriodSeconds)
+	if spec.TerminationGracePeriodSeconds != nil {
+		grace = *spec.TerminationGracePeriodSeconds
+	}
+	if grace < program.MinGracePeriod {
+		findings = append(findings, probeFinding{container: "-", severe: true,
+			problem: fmt.Sprintf("terminationGracePeriodSeconds is %d, too short to drain requests on scale down", grace)})
+	}
+
+	for _, c := range spec.Containers {
+		add := func(severe bool, format string, args ...any) {
+			findings = append(findings, probeFinding{container: c.Name, problem: fmt.Sprintf(format, args...), severe: severe})
+		}
+
+		readiness, liveness := c.ReadinessProbe, c.LivenessProbe
+
+		if readiness == nil {
+			add(true, "no readiness probe, new pods get traffic before they are ready")
+		}
+
+		if liveness != nil && readiness != nil && equality.Semantic.DeepEqual(liveness.ProbeHandler, readiness.ProbeHandler) &&
+			liveness.FailureThreshold <= readiness.FailureThreshold {
+			add(false, "liveness probe matches the readiness probe, so an overloaded pod is restarted rather than taken out of service")
+		}
+
+		if liveness != nil && c.StartupProbe == nil && liveness.InitialDelaySeconds == 0 {
+			add(false, "liveness probe has no initial delay or startup probe, slow starting pods may be killed")
+		}
+
+		if c.Lifecycle == nil || c.Lifecycle.PreStop == nil {
+			add(false, "no preStop hook, the pod may stop before load balancers remove it")
+		}
+	}
+
+	return findings
+}
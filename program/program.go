@@ -16,19 +16,66 @@ type Options struct {
 	Version bool `help:"Show program version"`
 	// VersionCmd VersionCmd `name:"version" cmd:"" help:"show program version"`
 
+	Config       string `group:"Info" type:"path" env:"K8SUTILS_CONFIG" placeholder:"FILE" help:"YAML file of defaults for the flags, which the command line and environment override (default ~/.k8sutils.yaml)"`
+	Profile      string `group:"Info" env:"K8SUTILS_PROFILE" placeholder:"NAME" help:"Profile of the configuration file to take defaults from, e.g. the context, namespace and notifications of one environment"`
 	Debug        bool   `group:"Info" help:"Show debugging information"`
 	DryRun       bool   `group:"Info" help:"Do not modify anything"`
 	OutputFormat string `group:"Info" enum:"auto,jsonl,terminal" default:"auto" help:"How to show program output (auto|terminal|jsonl)"`
 	Quiet        bool   `group:"Info" help:"Be less verbose than usual"`
-	Hpa          Hpa    `cmd:"" help:"Horizontal Pod Autoscaler operations"`
+
+	Kubernetes     `embed:"" group:"Kubernetes"`
+	LeaderElection `embed:"" group:"Leader Election"`
+	Notify         `embed:"" group:"Notifications"`
+	Datadog        `embed:"" group:"Datadog"`
+	Tracing        `embed:"" group:"Tracing"`
+	EventBus       `embed:"" group:"Event Bus"`
+
+	Hpa            HpaCmd         `cmd:"" help:"Horizontal Pod Autoscaler operations"`
+	Scale          Scale          `cmd:"" help:"Show or change replicas of anything with a scale subresource (deployments, statefulsets, rollouts...)"`
+	Deploy         Deploy         `cmd:"" help:"Show Deployments or change their replicas"`
+	Statefulset    Statefulset    `cmd:"" aliases:"sts" help:"Show StatefulSets or change their replicas"`
+	Keda           Keda           `cmd:"" help:"Show KEDA ScaledObjects or change their replica limits"`
+	Vpa            Vpa            `cmd:"" help:"Show Vertical Pod Autoscaler recommendations next to current requests"`
+	Cronjob        Cronjob        `cmd:"" help:"Show CronJobs or suspend and resume them"`
+	Cleanup        Cleanup        `cmd:"" help:"Delete finished Jobs and old ReplicaSets"`
+	Restart        Restart        `cmd:"" help:"Restart workloads like kubectl rollout restart, optionally one at a time"`
+	Quota          Quota          `cmd:"" help:"Show ResourceQuota usage or change hard limits"`
+	Limitrange     Limitrange     `cmd:"" aliases:"limits" help:"Audit LimitRanges against the requests of the workloads they apply to"`
+	Node           NodeCmd        `cmd:"" help:"Cordon, uncordon and drain nodes"`
+	Nodes          Nodes          `cmd:"" help:"Show allocatable, requested and used CPU and memory for each node"`
+	Spread         Spread         `cmd:"" help:"Show how workload pods are spread across zones and check HPA-managed workloads against their spread constraints"`
+	Evict          Evict          `cmd:"" help:"Evict pods, respecting PodDisruptionBudgets, to rebalance them across nodes"`
+	RolloutStatus  RolloutStatus  `cmd:"" help:"Wait for many workloads to finish rolling out and report any which are stuck"`
+	Requests       Requests       `cmd:"" help:"Show or change container CPU and memory requests and limits"`
+	Priorityclass  Priorityclass  `cmd:"" aliases:"pc" help:"Show or set the PriorityClass of Deployments"`
+	SimulateOutage SimulateOutage `cmd:"" help:"Show what losing a zone or node group would do to HPA-managed workloads"`
+	Restarts       Restarts       `cmd:"" help:"Find crash looping and frequently restarting pods, and the HPAs they distort"`
+	Images         Images         `cmd:"" help:"List the images running in each namespace and the workloads using them"`
+	Daemonsets     Daemonsets     `cmd:"" help:"Show DaemonSet health per node pool and the nodes missing ready daemons"`
+	Probes         Probes         `cmd:"" help:"Audit the probes and shutdown settings of HPA-managed workloads"`
+	Certs          Certs          `cmd:"" help:"Report when the certificates in TLS Secrets and cert-manager Certificates expire"`
+	Orphans        Orphans        `cmd:"" help:"List ConfigMaps and Secrets which nothing refers to"`
+	Ns             NsCmd          `cmd:"" aliases:"namespace" help:"Namespace operations"`
+	Rightsizing    Rightsizing    `cmd:"" help:"Compare container requests of HPA-managed workloads with their actual usage"`
+	Top            TopCmd         `cmd:"" help:"Show live usage views"`
+	Operator       Operator       `cmd:"" help:"Scale HPAs on the schedules given by ScalingSchedule resources until interrupted"`
+	Doctor         Doctor         `cmd:"" help:"Check connectivity and permissions for the selected cluster"`
 }
 
 // Parse calls the CLI parsing routines
 func (program *Options) Parse(args []string) (*kong.Context, error) {
-	parser, err := kong.New(program,
+	options := []kong.Option{
 		kong.ShortUsageOnError(),
 		// kong.Description("Brief Program Summary"),
-	)
+	}
+
+	// Installed as a kubectl plugin, e.g. kubectl-hpa, the program runs the command it is named for
+	args, plugin := pluginArgs(os.Args[0], args)
+	if plugin != "" {
+		options = append(options, kong.Name(plugin))
+	}
+
+	parser, err := kong.New(program, options...)
 
 	if err != nil {
 		fmt.Println(err)
@@ -44,9 +91,10 @@ func (program *Options) Run(options *Options) error {
 }
 
 // AfterApply runs after the options are parsed but before anything runs
-func (program *Options) AfterApply() error {
+func (program *Options) AfterApply(ctx *kong.Context) error {
 	program.initLogging()
-	return nil
+	program.initTracing()
+	return program.initNotifiers(ctx.Command())
 }
 
 func (program *Options) initLogging() {
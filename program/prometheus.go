@@ -0,0 +1,129 @@
+package program
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prometheus holds the flags for commands which query a Prometheus server
+type Prometheus struct {
+	PrometheusURL   string        `name:"prometheus-url" help:"URL of the Prometheus server (or compatible API, e.g. Thanos or Mimir)"`
+	PrometheusToken string        `name:"prometheus-token" env:"PROMETHEUS_TOKEN" help:"Bearer token for the Prometheus server"`
+	QueryTimeout    time.Duration `default:"30s" help:"Maximum time to wait for each Prometheus query"`
+}
+
+// promResponse is the response of the Prometheus instant query API
+type promResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string `json:"metric"`
+			Value  [2]any            `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// query runs an instant query which should return a single value, and returns false if it returned none
+func (program *Prometheus) query(ctx context.Context, promql string) (float64, bool, error) {
+	if program.PrometheusURL == "" {
+		return 0, false, usageError("--prometheus-url is required")
+	}
+
+	endpoint, err := url.JoinPath(program.PrometheusURL, "/api/v1/query")
+	if err != nil {
+		return 0, false, usageError("bad --prometheus-url: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, program.QueryTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(url.Values{"query": {promql}}.Encode()))
+	if err != nil {
+		return 0, false, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if program.PrometheusToken != "" {
+		request.Header.Set("Authorization", "Bearer "+program.PrometheusToken)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return 0, false, connectionError(err, "querying Prometheus")
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return 0, false, connectionError(err, "reading Prometheus response")
+	}
+
+	var result promResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return 0, false, fmt.Errorf("Prometheus returned %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+	if result.Status != "success" {
+		return 0, false, fmt.Errorf("Prometheus query failed: %s", result.Error)
+	}
+
+	if len(result.Data.Result) == 0 {
+		return 0, false, nil
+	}
+
+	text, ok := result.Data.Result[0].Value[1].(string)
+	if !ok {
+		return 0, false, fmt.Errorf("unexpected Prometheus value %v", result.Data.Result[0].Value[1])
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return value, true, nil
+}
+
+// promString quotes a value for use in a PromQL label matcher
+func promString(value string) string {
+	return strconv.Quote(value)
+}
+
+// promDurationPart is one unit of a Prometheus duration, e.g. the 1d of 1d12h
+var promDurationPart = regexp.MustCompile(`(\d+)(ms|y|w|d|h|m|s)`)
+
+// promDurationUnits are the lengths of the units of Prometheus durations, where a year is always 365 days
+var promDurationUnits = map[string]time.Duration{
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+	"w":  7 * 24 * time.Hour,
+	"y":  365 * 24 * time.Hour,
+}
+
+// parsePromDuration parses a duration as Prometheus writes them, e.g. 7d or 1h30m
+func parsePromDuration(value string) (time.Duration, error) {
+	parts := promDurationPart.FindAllStringSubmatch(value, -1)
+	if len(parts) == 0 || len(strings.Join(promDurationPart.FindAllString(value, -1), "")) != len(value) {
+		return 0, fmt.Errorf("%q is not a duration such as 7d or 1h30m", value)
+	}
+
+	var result time.Duration
+	for _, part := range parts {
+		n, err := strconv.Atoi(part[1])
+		if err != nil {
+			return 0, err
+		}
+		result += time.Duration(n) * promDurationUnits[part[2]]
+	}
+	return result, nil
+}
@@ -0,0 +1,238 @@
+package program
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// Quota shows ResourceQuota usage against the hard limits and raises or lowers the limits
+type Quota struct {
+	Set    map[string]string `help:"Change hard limits, e.g. requests.cpu=2x;pods=150%;limits.memory=64Gi"`
+	Ticket string            `help:"Change ticket (e.g. JIRA-123) recorded with every modification"`
+
+	Selector `embed:""`
+	Bulk     `embed:""`
+}
+
+func (program *Quota) Run(options *Options) error {
+
+	initColors(options)
+
+	changes := map[corev1.ResourceName]quantityExpression{}
+	for name, value := range program.Set {
+		change, err := parseQuantityExpression(value)
+		if err != nil {
+			return err
+		}
+		changes[corev1.ResourceName(name)] = change
+	}
+
+	if len(changes) > 0 && !program.selected() {
+		return usageError("select quotas by name, with --labels or with --all")
+	}
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	quotas, err := fetch(ctx, &program.Selector, "resourcequota",
+		func(ctx context.Context, namespace, name string) (*corev1.ResourceQuota, error) {
+			return clientset.CoreV1().ResourceQuotas(namespace).Get(ctx, name, metav1.GetOptions{})
+		},
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]corev1.ResourceQuota, string, error) {
+			list, err := clientset.CoreV1().ResourceQuotas(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+	if err != nil {
+		return err
+	}
+
+	if len(changes) == 0 {
+		printQuotas(quotas)
+		return nil
+	}
+
+	return options.runAsLeader(ctx, clientset, func(ctx context.Context) error {
+		results := newSummary()
+		defer results.print()
+
+		errs := program.Bulk.run(ctx, len(quotas), options.DryRun, false, func(i int) error {
+			quota := &quotas[i]
+
+			message, err := program.modify(ctx, options, clientset, quota, changes)
+			switch {
+			case err != nil:
+				fmt.Printf("Failed to update quota %s: %v\n", quota.Name, err)
+				results.record(quota.Namespace, quota.Name, outcomeFailed, err.Error())
+				return fmt.Errorf("quota %s: %w", quota.Name, err)
+			case message == "":
+				results.record(quota.Namespace, quota.Name, outcomeSkipped, "already at the requested values")
+			case options.DryRun:
+				results.record(quota.Namespace, quota.Name, outcomeUpdated, "dry run: "+message)
+			default:
+				results.record(quota.Namespace, quota.Name, outcomeUpdated, message)
+			}
+			return nil
+		})
+
+		for _, quota := range quotas {
+			if !results.has(quota.Namespace, quota.Name) {
+				results.record(quota.Namespace, quota.Name, outcomeSkipped, "not started")
+			}
+		}
+
+		return errors.Join(errs...)
+	})
+}
+
+// modify applies the changes to the quota's hard limits, returning a description of the change or "" if nothing
+// changed.  Limits the quota does not have are left alone.  If the quota changes while being modified it is fetched
+// again and the changes re-applied to the current limits.
+func (program *Quota) modify(ctx context.Context, options *Options, clientset kubernetes.Interface, quota *corev1.ResourceQuota, changes map[corev1.ResourceName]quantityExpression) (string, error) {
+	quotas := clientset.CoreV1().ResourceQuotas(quota.Namespace)
+	message := ""
+	first := true
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if !first {
+			current, err := quotas.Get(ctx, quota.Name, metav1.GetOptions{})
+			if err != nil {
+				return apiError(err)
+			}
+			*quota = *current
+		}
+		first = false
+
+		modified := quota.DeepCopy()
+		var descriptions []string
+
+		for name, change := range changes {
+			current, ok := quota.Spec.Hard[name]
+			if !ok {
+				log.Debug().Str("quota", quota.Name).Str("resource", string(name)).Msg("Quota has no such limit")
+				continue
+			}
+
+			updated := change(current)
+			if updated.Cmp(current) == 0 {
+				continue
+			}
+
+			modified.Spec.Hard[name] = updated
+			descriptions = append(descriptions, fmt.Sprintf("%s %s -> %s", name, current.String(), updated.String()))
+		}
+
+		if equality.Semantic.DeepEqual(quota.Spec, modified.Spec) {
+			message = ""
+			return nil
+		}
+
+		sort.Strings(descriptions)
+		message = strings.Join(descriptions, ", ")
+		if program.Ticket != "" {
+			message += fmt.Sprintf(" (ticket %s)", program.Ticket)
+		}
+
+		log.Info().Str("namespace", quota.Namespace).Str("quota", quota.Name).Str("change", message).Msg("Modifying")
+
+		if options.DryRun {
+			return nil
+		}
+
+		if modified.Annotations == nil {
+			modified.Annotations = map[string]string{}
+		}
+		modified.Annotations[AnnotationChange] = message
+		if program.Ticket != "" {
+			modified.Annotations[AnnotationTicket] = program.Ticket
+		}
+
+		// The update carries the resourceVersion, so it fails with a conflict if the quota has changed
+		var updated *corev1.ResourceQuota
+		err := withRetries(ctx, options.Retries, func() (err error) {
+			updated, err = quotas.Update(ctx, modified, metav1.UpdateOptions{FieldManager: FieldManager})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		*quota = *updated
+
+		recordObjectEvent(ctx, eventCreator(clientset), corev1.ObjectReference{
+			APIVersion:      "v1",
+			Kind:            "ResourceQuota",
+			Name:            quota.Name,
+			Namespace:       quota.Namespace,
+			UID:             quota.UID,
+			ResourceVersion: quota.ResourceVersion,
+		}, "Modified", message)
+
+		return nil
+	})
+
+	return message, err
+}
+
+// printQuotas shows the usage of each quota limit as a gauge, like the HPA CPU gauge
+func printQuotas(quotas []corev1.ResourceQuota) {
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "QUOTA", "RESOURCE", "USED", "HARD", "USAGE"})
+
+	for _, quota := range quotas {
+		names := make([]string, 0, len(quota.Spec.Hard))
+		for name := range quota.Spec.Hard {
+			names = append(names, string(name))
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			hard := quota.Spec.Hard[corev1.ResourceName(name)]
+			used := quota.Status.Used[corev1.ResourceName(name)]
+
+			t.AppendRow(table.Row{quota.Namespace, quota.Name, name, used.String(), hard.String(), usageGauge(used, hard)})
+		}
+	}
+
+	t.Render()
+}
+
+// usageGauge draws how much of a limit is used, colored by how close it is to the limit
+func usageGauge(used, hard resource.Quantity) string {
+	if hard.IsZero() {
+		return "no limit"
+	}
+
+	percent := int(used.AsApproximateFloat64() / hard.AsApproximateFloat64() * 100)
+
+	gauge := formatMarks(0, 100, Mark{strconv.Itoa(percent) + "%", min(percent, 100)})
+
+	switch {
+	case percent >= 100:
+		return paint(text.FgRed, gauge)
+	case percent >= 80:
+		return paint(text.FgYellow, gauge)
+	default:
+		return paint(text.FgGreen, gauge)
+	}
+}
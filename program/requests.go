@@ -0,0 +1,269 @@
+package program
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Requests shows or changes the CPU and memory requests and limits of workload containers.  HPA utilization is a
+// percentage of the request, so changing a request moves every HPA target on that workload; this lets the two be
+// adjusted with the same tool and the same expressions.  Changing resources rolls out new pods.
+type Requests struct {
+	Kind      string `arg:"" help:"Kind of workload (deployments, statefulsets or daemonsets)"`
+	Container string `help:"Only show or change this container"`
+
+	CPURequest    string `name:"cpu-request" help:"Set CPU requests to a quantity (250m), a percentage of the current request (150%) or a multiplier (2x)"`
+	MemoryRequest string `help:"Set memory requests to a quantity (512Mi), a percentage or a multiplier"`
+	CPULimit      string `name:"cpu-limit" help:"Set CPU limits to a quantity, a percentage or a multiplier"`
+	MemoryLimit   string `help:"Set memory limits to a quantity, a percentage or a multiplier"`
+	Ticket        string `help:"Change ticket (e.g. JIRA-123) recorded with every modification"`
+
+	Selector `embed:""`
+	Bulk     `embed:""`
+}
+
+// resourceChange is a change to one request or limit of a container
+type resourceChange struct {
+	limit    bool
+	resource corev1.ResourceName
+	change   quantityExpression
+}
+
+func (program *Requests) Run(options *Options) error {
+
+	initColors(options)
+
+	kind, err := workloadKindFor(program.Kind)
+	if err != nil {
+		return err
+	}
+
+	changes, err := program.changes()
+	if err != nil {
+		return err
+	}
+
+	if len(changes) > 0 && !program.selected() {
+		return usageError("select workloads by name, with --labels or with --all")
+	}
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	all, err := podTemplates(ctx, clientset, &program.Selector)
+	if err != nil {
+		return err
+	}
+
+	var templates []podTemplate
+	for _, t := range all {
+		if t.Kind == kind.Kind {
+			templates = append(templates, t)
+		}
+	}
+
+	if len(changes) == 0 {
+		program.print(templates)
+		return nil
+	}
+
+	return options.runAsLeader(ctx, clientset, func(ctx context.Context) error {
+		results := newSummary()
+		defer results.print()
+
+		errs := program.Bulk.run(ctx, len(templates), options.DryRun, false, func(i int) error {
+			t := &templates[i]
+
+			patch, message, err := program.patch(t, changes)
+			if err != nil {
+				results.record(t.Namespace, t.Name, outcomeFailed, err.Error())
+				return fmt.Errorf("%s %s: %w", kind.Kind, t.Name, err)
+			}
+			if message == "" {
+				results.record(t.Namespace, t.Name, outcomeSkipped, "already at the requested values")
+				return nil
+			}
+
+			log.Info().Str("namespace", t.Namespace).Str(kind.Kind, t.Name).Str("change", message).Msg("Modifying")
+
+			if options.DryRun {
+				results.record(t.Namespace, t.Name, outcomeUpdated, "dry run: "+message)
+				return nil
+			}
+
+			err = withRetries(ctx, options.Retries, func() error {
+				return kind.patch(ctx, clientset, t.Namespace, t.Name, patch)
+			})
+			if err != nil {
+				err = apiError(err)
+				fmt.Printf("Failed to modify %s %s: %v\n", kind.Kind, t.Name, err)
+				results.record(t.Namespace, t.Name, outcomeFailed, err.Error())
+				return fmt.Errorf("%s %s: %w", kind.Kind, t.Name, err)
+			}
+
+			results.record(t.Namespace, t.Name, outcomeUpdated, message)
+			return nil
+		})
+
+		for _, t := range templates {
+			if !results.has(t.Namespace, t.Name) {
+				results.record(t.Namespace, t.Name, outcomeSkipped, "not started")
+			}
+		}
+
+		return errors.Join(errs...)
+	})
+}
+
+// changes parses the requested changes
+func (program *Requests) changes() ([]resourceChange, error) {
+	var changes []resourceChange
+
+	for _, c := range []struct {
+		value    string
+		limit    bool
+		resource corev1.ResourceName
+	}{
+		{program.CPURequest, false, corev1.ResourceCPU},
+		{program.MemoryRequest, false, corev1.ResourceMemory},
+		{program.CPULimit, true, corev1.ResourceCPU},
+		{program.MemoryLimit, true, corev1.ResourceMemory},
+	} {
+		if c.value == "" {
+			continue
+		}
+		change, err := parseQuantityExpression(c.value)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, resourceChange{c.limit, c.resource, change})
+	}
+
+	return changes, nil
+}
+
+// patch returns a strategic merge patch applying the changes to the workload's containers and a description of it, or
+// an empty description if nothing changes.  Containers are merged by name, so only the changed values are sent.  A
+// percentage or multiplier of a value the container does not set is zero, so leaves it unset.
+func (program *Requests) patch(t *podTemplate, changes []resourceChange) ([]byte, string, error) {
+	var containers []map[string]any
+	var descriptions []string
+
+	for _, container := range t.Spec.Containers {
+		if program.Container != "" && container.Name != program.Container {
+			continue
+		}
+
+		requests := map[string]string{}
+		limits := map[string]string{}
+
+		for _, c := range changes {
+			list, updated, kind := container.Resources.Requests, requests, "request"
+			if c.limit {
+				list, updated, kind = container.Resources.Limits, limits, "limit"
+			}
+
+			current := list[c.resource]
+			value := c.change(current)
+			if value.IsZero() || value.Cmp(current) == 0 {
+				continue
+			}
+
+			updated[string(c.resource)] = value.String()
+			descriptions = append(descriptions, fmt.Sprintf("%s %s %s %s -> %s", container.Name, c.resource, kind, quantityOrDash(list, c.resource), value.String()))
+		}
+
+		if len(requests) == 0 && len(limits) == 0 {
+			continue
+		}
+
+		resources := map[string]any{}
+		if len(requests) > 0 {
+			resources["requests"] = requests
+		}
+		if len(limits) > 0 {
+			resources["limits"] = limits
+		}
+		containers = append(containers, map[string]any{"name": container.Name, "resources": resources})
+	}
+
+	if program.Container != "" && !hasContainer(t.Spec.Containers, program.Container) {
+		return nil, "", fmt.Errorf("no container named %s", program.Container)
+	}
+
+	if len(descriptions) == 0 {
+		return nil, "", nil
+	}
+
+	sort.Strings(descriptions)
+	message := strings.Join(descriptions, ", ")
+	if program.Ticket != "" {
+		message += fmt.Sprintf(" (ticket %s)", program.Ticket)
+	}
+
+	annotations := map[string]string{AnnotationChange: message}
+	if program.Ticket != "" {
+		annotations[AnnotationTicket] = program.Ticket
+	}
+
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"annotations": annotations},
+		"spec": map[string]any{
+			"template": map[string]any{
+				"spec": map[string]any{"containers": containers},
+			},
+		},
+	})
+
+	return patch, message, err
+}
+
+// hasContainer returns true if one of the containers has the name
+func hasContainer(containers []corev1.Container, name string) bool {
+	for _, c := range containers {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// print shows the requests and limits of each container
+func (program *Requests) print(templates []podTemplate) {
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "NAME", "CONTAINER", "CPU REQUEST", "CPU LIMIT", "MEMORY REQUEST", "MEMORY LIMIT"})
+
+	for _, template := range templates {
+		for _, container := range template.Spec.Containers {
+			if program.Container != "" && container.Name != program.Container {
+				continue
+			}
+
+			r := container.Resources
+			t.AppendRow(table.Row{
+				template.Namespace,
+				template.Name,
+				container.Name,
+				quantityOrDash(r.Requests, corev1.ResourceCPU),
+				quantityOrDash(r.Limits, corev1.ResourceCPU),
+				quantityOrDash(r.Requests, corev1.ResourceMemory),
+				quantityOrDash(r.Limits, corev1.ResourceMemory),
+			})
+		}
+	}
+
+	t.Render()
+}
@@ -0,0 +1,148 @@
+package program
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Restart does what `kubectl rollout restart` does to the selected workloads, optionally waiting for each to become
+// ready before restarting the next
+type Restart struct {
+	Kind string `arg:"" help:"Kind of workload to restart (deployments, statefulsets or daemonsets)"`
+
+	Wait        bool          `help:"Wait for each workload to finish rolling out before restarting the next"`
+	WaitTimeout time.Duration `default:"10m" help:"Maximum time to wait for each workload with --wait"`
+
+	Selector `embed:""`
+	Bulk     `embed:""`
+}
+
+// restartedAtAnnotation is the pod template annotation `kubectl rollout restart` sets to trigger a rollout
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// rolloutPollInterval is how often to check on a rollout being waited for
+const rolloutPollInterval = 2 * time.Second
+
+func (program *Restart) Run(options *Options) error {
+
+	initColors(options)
+
+	kind, err := workloadKindFor(program.Kind)
+	if err != nil {
+		return err
+	}
+
+	if !program.selected() {
+		return usageError("select what to restart by name, with --labels or with --all")
+	}
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	targets, err := kind.list(ctx, clientset, &program.Selector)
+	if err != nil {
+		return err
+	}
+
+	patch, err := json.Marshal(map[string]any{
+		"spec": map[string]any{
+			"template": map[string]any{
+				"metadata": map[string]any{
+					"annotations": map[string]string{restartedAtAnnotation: time.Now().Format(time.RFC3339)},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return options.runAsLeader(ctx, clientset, func(ctx context.Context) error {
+		results := newSummary()
+		defer results.print()
+
+		// Waiting for each workload is what makes a restart safe to roll across many workloads, so a failure stops the
+		// remaining restarts
+		errs := program.Bulk.run(ctx, len(targets), options.DryRun, program.Wait, func(i int) error {
+			target := targets[i]
+
+			log.Info().Str("namespace", target.Namespace).Str(kind.Kind, target.Name).Msg("Restarting")
+
+			if options.DryRun {
+				results.record(target.Namespace, target.Name, outcomeUpdated, "dry run: restart")
+				return nil
+			}
+
+			err := withRetries(ctx, options.Retries, func() error {
+				return kind.patch(ctx, clientset, target.Namespace, target.Name, patch)
+			})
+			if err != nil {
+				err = apiError(err)
+				fmt.Printf("Failed to restart %s %s: %v\n", kind.Kind, target.Name, err)
+				results.record(target.Namespace, target.Name, outcomeFailed, err.Error())
+				return fmt.Errorf("%s %s: %w", kind.Kind, target.Name, err)
+			}
+
+			if program.Wait {
+				if err := waitForRollout(ctx, clientset, kind, target, program.WaitTimeout); err != nil {
+					results.record(target.Namespace, target.Name, outcomeFailed, "restarted but "+err.Error())
+					return fmt.Errorf("%s %s: %w", kind.Kind, target.Name, err)
+				}
+				results.record(target.Namespace, target.Name, outcomeUpdated, "restarted and ready")
+				return nil
+			}
+
+			results.record(target.Namespace, target.Name, outcomeUpdated, "restarted")
+			return nil
+		})
+
+		for _, target := range targets {
+			if !results.has(target.Namespace, target.Name) {
+				results.record(target.Namespace, target.Name, outcomeSkipped, "not started")
+			}
+		}
+
+		return errors.Join(errs...)
+	})
+}
+
+// waitForRollout waits until the workload has finished rolling out, logging progress as it changes
+func waitForRollout(ctx context.Context, clientset kubernetes.Interface, kind *workloadKind, target types.NamespacedName, timeout time.Duration) error {
+	last := ""
+
+	err := wait.PollUntilContextTimeout(ctx, rolloutPollInterval, timeout, true, func(ctx context.Context) (bool, error) {
+		done, message, err := kind.rolledOut(ctx, clientset, target.Namespace, target.Name)
+		if err != nil {
+			if isTransient(err) {
+				return false, nil
+			}
+			return false, apiError(err)
+		}
+
+		if message != last {
+			log.Info().Str("namespace", target.Namespace).Str(kind.Kind, target.Name).Str("status", message).Msg("Waiting for rollout")
+			last = message
+		}
+
+		return done, nil
+	})
+
+	if wait.Interrupted(err) {
+		return fmt.Errorf("not ready after %s: %s", timeout, last)
+	}
+
+	return err
+}
@@ -0,0 +1,183 @@
+package program
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Restarts lists pods which restart often or are in CrashLoopBackOff, grouped by the workload which owns them, and
+// flags the HPAs scaling those workloads.  The HPA counts pods which are not ready as using nothing when deciding to
+// scale up and as fully loaded when deciding to scale down, so crashing pods hold an HPA back in both directions.
+type Restarts struct {
+	Threshold int32 `default:"5" help:"Show pods with at least this many container restarts"`
+
+	Selector `embed:""`
+}
+
+// podRestarts is a pod with frequent restarts
+type podRestarts struct {
+	Namespace string
+	Workload  string
+	Pod       string
+	Restarts  int32
+	Crashing  bool
+	Reason    string
+}
+
+// crashLoopBackOff is the waiting reason of a container the kubelet is holding back after repeated crashes
+const crashLoopBackOff = "CrashLoopBackOff"
+
+func (program *Restarts) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	pods, err := fetch(ctx, &program.Selector, "pod",
+		func(ctx context.Context, namespace, name string) (*corev1.Pod, error) {
+			return clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		},
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]corev1.Pod, string, error) {
+			list, err := clientset.CoreV1().Pods(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+	if err != nil {
+		return err
+	}
+
+	owners := newOwnerResolver(clientset)
+	total := map[string]int{}
+	crashing := map[string]int{}
+	var found []podRestarts
+
+	for i := range pods {
+		pod := &pods[i]
+
+		kind, name, err := owners.workload(ctx, pod)
+		if err != nil {
+			return err
+		}
+		workload := "Pod/" + pod.Name
+		if kind != "" {
+			workload = kind + "/" + name
+		}
+		key := pod.Namespace + "/" + workload
+		total[key]++
+
+		r := restartsOf(pod)
+		if r.Crashing {
+			crashing[key]++
+		}
+		if r.Restarts < program.Threshold && !r.Crashing {
+			continue
+		}
+
+		r.Namespace, r.Workload = pod.Namespace, workload
+		found = append(found, r)
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		a, b := found[i], found[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Workload < b.Workload
+	})
+
+	if len(found) == 0 {
+		log.Info().Int("pods", len(pods)).Int32("threshold", program.Threshold).Msg("No restarting pods found")
+		return nil
+	}
+
+	printRestarts(found)
+
+	hpaSelector := Selector{AllNamespaces: program.AllNamespaces, ChunkSize: program.ChunkSize, namespaceName: program.namespaceName}
+	hpas, err := hpaSelector.getHpas(ctx, WithRetries(NewHPAClient(clientset), options.Retries))
+	if err != nil {
+		return err
+	}
+
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "HPA", "WORKLOAD", "CRASHING", "PROBLEM"})
+	distorted := 0
+
+	for _, hpa := range hpas {
+		ref := hpa.Spec.ScaleTargetRef
+		key := hpa.Namespace + "/" + ref.Kind + "/" + ref.Name
+		if crashing[key] == 0 {
+			continue
+		}
+
+		distorted++
+		t.AppendRow(table.Row{
+			hpa.Namespace,
+			hpa.Name,
+			ref.Kind + "/" + ref.Name,
+			fmt.Sprintf("%d of %d", crashing[key], total[key]),
+			paint(text.FgRed, "crashing pods count as idle when scaling up and busy when scaling down"),
+		})
+	}
+
+	if distorted > 0 {
+		t.Render()
+		log.Warn().Int("count", distorted).Msg("HPAs distorted by crashing pods")
+	}
+
+	return nil
+}
+
+// restartsOf returns the total container restarts of the pod, whether any container is crash looping, and the reason
+// the most recent crash ended
+func restartsOf(pod *corev1.Pod) podRestarts {
+	r := podRestarts{Pod: pod.Name}
+
+	var reasons []string
+	for _, status := range pod.Status.ContainerStatuses {
+		r.Restarts += status.RestartCount
+
+		if status.State.Waiting != nil && status.State.Waiting.Reason == crashLoopBackOff {
+			r.Crashing = true
+		}
+
+		if terminated := status.LastTerminationState.Terminated; terminated != nil && terminated.Reason != "" {
+			reasons = append(reasons, fmt.Sprintf("%s: %s (exit %d)", status.Name, terminated.Reason, terminated.ExitCode))
+		}
+	}
+	r.Reason = strings.Join(reasons, ", ")
+
+	return r
+}
+
+// printRestarts shows the restarting pods, highlighting those in CrashLoopBackOff
+func printRestarts(found []podRestarts) {
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "WORKLOAD", "POD", "RESTARTS", "STATE", "LAST TERMINATION"})
+
+	for _, r := range found {
+		state := "running"
+		if r.Crashing {
+			state = paint(text.FgRed, crashLoopBackOff)
+		}
+		t.AppendRow(table.Row{r.Namespace, r.Workload, r.Pod, strconv.Itoa(int(r.Restarts)), state, r.Reason})
+	}
+
+	t.Render()
+}
@@ -0,0 +1,100 @@
+package program
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/autoscaling/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+)
+
+// isTransient returns true for errors which are likely to succeed if the request is repeated
+func isTransient(err error) bool {
+	var netError net.Error
+	if errors.As(err, &netError) && netError.Timeout() {
+		return true
+	}
+
+	var status apierrors.APIStatus
+	if errors.As(err, &status) && status.Status().Code >= 500 {
+		return true
+	}
+
+	return apierrors.IsTimeout(err) ||
+		apierrors.IsServerTimeout(err) ||
+		apierrors.IsTooManyRequests(err) ||
+		apierrors.IsInternalError(err) ||
+		apierrors.IsServiceUnavailable(err) ||
+		apierrors.IsUnexpectedServerError(err)
+}
+
+// withRetries calls fn, retrying transient failures up to retries times with exponential backoff and jitter
+func withRetries(ctx context.Context, retries int, fn func() error) error {
+	backoff := wait.Backoff{
+		Duration: 500 * time.Millisecond,
+		Factor:   2,
+		Jitter:   0.5,
+		Steps:    retries + 1,
+		Cap:      30 * time.Second,
+	}
+
+	attempt := 0
+
+	return retry.OnError(backoff, func(err error) bool {
+		if ctx.Err() != nil || !isTransient(err) {
+			return false
+		}
+		attempt++
+		log.Warn().Err(err).Int("attempt", attempt).Msg("Transient API error, retrying")
+		return true
+	}, fn)
+}
+
+// WithRetries returns an HPAClient which retries transient failures of the given client
+func WithRetries(client HPAClient, retries int) HPAClient {
+	return &retryingHPAClient{client, retries}
+}
+
+type retryingHPAClient struct {
+	HPAClient
+	retries int
+}
+
+func (c *retryingHPAClient) List(ctx context.Context, namespace string, opts metav1.ListOptions) (list *v1.HorizontalPodAutoscalerList, err error) {
+	err = withRetries(ctx, c.retries, func() error {
+		list, err = c.HPAClient.List(ctx, namespace, opts)
+		return err
+	})
+	return list, err
+}
+
+func (c *retryingHPAClient) Get(ctx context.Context, namespace, name string) (hpa *v1.HorizontalPodAutoscaler, err error) {
+	err = withRetries(ctx, c.retries, func() error {
+		hpa, err = c.HPAClient.Get(ctx, namespace, name)
+		return err
+	})
+	return hpa, err
+}
+
+func (c *retryingHPAClient) Update(ctx context.Context, hpa *v1.HorizontalPodAutoscaler) (result *v1.HorizontalPodAutoscaler, err error) {
+	err = withRetries(ctx, c.retries, func() error {
+		result, err = c.HPAClient.Update(ctx, hpa)
+		return err
+	})
+	return result, err
+}
+
+func (c *retryingHPAClient) Patch(ctx context.Context, namespace, name string, patchType types.PatchType, data []byte) (hpa *v1.HorizontalPodAutoscaler, err error) {
+	err = withRetries(ctx, c.retries, func() error {
+		hpa, err = c.HPAClient.Patch(ctx, namespace, name, patchType, data)
+		return err
+	})
+	return hpa, err
+}
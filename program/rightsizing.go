@@ -0,0 +1,187 @@
+package program
+
+import (
+	"fmt"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Rightsizing compares the CPU and memory requests of the containers of HPA-managed workloads with their current usage
+// from the metrics API.  HPA utilization is usage as a percentage of the request, so a request far from real usage
+// makes the HPA scale too late (over-requested) or too early (under-requested).
+type Rightsizing struct {
+	Over    float64 `default:"50" help:"Flag containers using less than this percentage of their request"`
+	Under   float64 `default:"100" help:"Flag containers using more than this percentage of their request"`
+	ShowAll bool    `help:"Show every container, not just those flagged"`
+
+	Selector `embed:""`
+}
+
+// containerSizing is the request and usage of one resource of a container across a workload's pods
+type containerSizing struct {
+	namespace, workload, container string
+	resource                       corev1.ResourceName
+	request                        resource.Quantity
+	average, peak                  resource.Quantity
+	pods                           int
+}
+
+func (program *Rightsizing) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	client, err := options.Dynamic()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	usage, err := containerUsage(ctx, client, program.namespace())
+	if err != nil {
+		return err
+	}
+	if usage == nil {
+		return usageError("rightsizing needs the metrics API (metrics-server)")
+	}
+
+	hpaSelector := Selector{AllNamespaces: program.AllNamespaces, ChunkSize: program.ChunkSize, namespaceName: program.namespaceName}
+	hpas, err := hpaSelector.getHpas(ctx, WithRetries(NewHPAClient(clientset), options.Retries))
+	if err != nil {
+		return err
+	}
+	scaled := map[string]bool{}
+	for _, hpa := range hpas {
+		ref := hpa.Spec.ScaleTargetRef
+		scaled[hpa.Namespace+"/"+ref.Kind+"/"+ref.Name] = true
+	}
+
+	templates, err := podTemplates(ctx, clientset, &program.Selector)
+	if err != nil {
+		return err
+	}
+
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "WORKLOAD", "CONTAINER", "RESOURCE", "REQUEST", "AVG USAGE", "MAX USAGE", "OF REQUEST", "FINDING"})
+	flagged := 0
+
+	for _, template := range templates {
+		if !scaled[template.Namespace+"/"+template.Kind+"/"+template.Name] {
+			continue
+		}
+
+		pods, err := workloadPods(ctx, clientset, template)
+		if err != nil {
+			return err
+		}
+
+		for _, s := range sizeContainers(template, pods, usage) {
+			finding, color := program.finding(s)
+			if finding == "" && !program.ShowAll {
+				continue
+			}
+			if finding != "" {
+				flagged++
+			}
+
+			request, share := "-", "-"
+			if !s.request.IsZero() {
+				request = formatQuantity(s.resource, s.request)
+				share = fmt.Sprintf("%.0f%%", usagePercent(s.average, s.request))
+			}
+			if finding != "" {
+				finding = paint(color, finding)
+			}
+
+			t.AppendRow(table.Row{
+				s.namespace,
+				s.workload,
+				s.container,
+				string(s.resource),
+				request,
+				formatQuantity(s.resource, s.average),
+				formatQuantity(s.resource, s.peak),
+				share,
+				orDash(finding),
+			})
+		}
+	}
+
+	t.Render()
+
+	if flagged > 0 {
+		log.Warn().Int("count", flagged).Msg("Container requests which skew HPA utilization")
+	}
+
+	return nil
+}
+
+// sizeContainers measures the average and peak usage of each container of the workload's pods which have metrics
+func sizeContainers(template podTemplate, pods []corev1.Pod, usage map[string]map[string]corev1.ResourceList) []containerSizing {
+	var result []containerSizing
+
+	for _, container := range template.Spec.Containers {
+		for _, name := range auditedResources {
+			s := containerSizing{
+				namespace: template.Namespace,
+				workload:  template.Kind + "/" + template.Name,
+				container: container.Name,
+				resource:  name,
+				request:   container.Resources.Requests[name],
+			}
+
+			var total resource.Quantity
+			for _, pod := range pods {
+				used, ok := usage[pod.Namespace+"/"+pod.Name][container.Name][name]
+				if !ok {
+					continue
+				}
+				s.pods++
+				total.Add(used)
+				if used.Cmp(s.peak) > 0 {
+					s.peak = used
+				}
+			}
+			if s.pods == 0 {
+				continue
+			}
+
+			s.average = *resource.NewMilliQuantity(total.MilliValue()/int64(s.pods), total.Format)
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
+
+// finding describes how the container's request skews utilization, or returns an empty string if it does not.  Memory
+// only matters to HPAs which scale on it, but an unrealistic memory request wastes capacity either way.
+func (program *Rightsizing) finding(s containerSizing) (string, text.Color) {
+	if s.request.IsZero() {
+		return "no request, utilization unknown", text.FgRed
+	}
+
+	switch percent := usagePercent(s.average, s.request); {
+	case percent < program.Over:
+		return "over-requested, HPA scales late", text.FgYellow
+	case percent > program.Under:
+		return "under-requested, HPA scales early", text.FgRed
+	default:
+		return "", text.Reset
+	}
+}
+
+// usagePercent returns the usage as a percentage of the request
+func usagePercent(used, request resource.Quantity) float64 {
+	return 100 * used.AsApproximateFloat64() / request.AsApproximateFloat64()
+}
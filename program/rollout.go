@@ -0,0 +1,94 @@
+package program
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+var rolloutResource = schema.GroupVersionResource{Group: "argoproj.io", Version: "v1alpha1", Resource: "rollouts"}
+
+// rolloutStatus is the part of an Argo Rollout's status shown alongside the HPAs which scale it
+type rolloutStatus struct {
+	// Phase is the health of the rollout, e.g. Healthy, Progressing, Paused or Degraded
+	Phase string
+	// Replicas is the total number of pods, which during a canary includes both the stable and canary pods
+	Replicas int32
+}
+
+// rolloutResolver looks up the Argo Rollouts which HPAs scale.  The HPA's own status only reflects the Rollout's scale
+// subresource, so the Rollout is read directly for its health and total replicas.  Results are cached for the life of
+// the resolver.
+type rolloutResolver struct {
+	client dynamic.Interface
+
+	lock     sync.Mutex
+	cache    map[string]*rolloutStatus
+	disabled bool
+}
+
+func newRolloutResolver(client dynamic.Interface) *rolloutResolver {
+	return &rolloutResolver{client: client, cache: map[string]*rolloutStatus{}}
+}
+
+// status returns the status of the named Rollout, or nil if it cannot be read
+func (r *rolloutResolver) status(ctx context.Context, namespace, name string) *rolloutStatus {
+	if r == nil {
+		return nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.disabled {
+		return nil
+	}
+
+	key := namespace + "/" + name
+	if status, ok := r.cache[key]; ok {
+		return status
+	}
+
+	rollout, err := r.client.Resource(rolloutResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if isUnavailable(err) {
+			// Argo Rollouts is not installed or we may not read it, so do not try again for every HPA
+			log.Debug().Err(err).Msg("Unable to read Argo Rollouts, showing HPA status only")
+			r.disabled = true
+			return nil
+		}
+		log.Debug().Err(err).Str("rollout", key).Msg("Unable to read rollout")
+		r.cache[key] = nil
+		return nil
+	}
+
+	phase, _, _ := unstructured.NestedString(rollout.Object, "status", "phase")
+	replicas, _, _ := unstructured.NestedInt64(rollout.Object, "status", "replicas")
+
+	status := &rolloutStatus{Phase: phase, Replicas: int32(replicas)}
+	r.cache[key] = status
+	return status
+}
+
+// isUnavailable returns true if the error shows that a resource type cannot be read at all, because the cluster does
+// not serve it or we are not allowed to read it, rather than that one object is missing
+func isUnavailable(err error) bool {
+	if apierrors.IsForbidden(err) {
+		return true
+	}
+
+	var status apierrors.APIStatus
+	if apierrors.IsNotFound(err) && errors.As(err, &status) {
+		details := status.Status().Details
+		return details == nil || details.Name == ""
+	}
+
+	return false
+}
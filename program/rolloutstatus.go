@@ -0,0 +1,130 @@
+package program
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// RolloutStatus does what `kubectl rollout status` does for many workloads at once, waiting until all of them have
+// rolled out and reporting the ones which are stuck.  It is meant to follow a bulk restart or image change.
+type RolloutStatus struct {
+	Kind        string        `default:"deployments" help:"Kind of workload to watch (deployments, statefulsets or daemonsets)"`
+	WaitTimeout time.Duration `default:"10m" help:"Maximum time to wait for all the workloads to roll out"`
+
+	Selector `embed:""`
+}
+
+// workloadRollout is the last seen rollout status of a workload
+type workloadRollout struct {
+	target  types.NamespacedName
+	done    bool
+	stuck   bool
+	message string
+}
+
+func (program *RolloutStatus) Run(options *Options) error {
+
+	initColors(options)
+
+	kind, err := workloadKindFor(program.Kind)
+	if err != nil {
+		return err
+	}
+
+	if !program.selected() {
+		return usageError("select what to watch by name, with --labels or with --all")
+	}
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	targets, err := kind.list(ctx, clientset, &program.Selector)
+	if err != nil {
+		return err
+	}
+
+	rollouts := make([]workloadRollout, len(targets))
+	for i, target := range targets {
+		rollouts[i] = workloadRollout{target: target, message: "not checked"}
+	}
+
+	err = wait.PollUntilContextTimeout(ctx, rolloutPollInterval, program.WaitTimeout, true, func(ctx context.Context) (bool, error) {
+		waiting := 0
+
+		for i := range rollouts {
+			r := &rollouts[i]
+			if r.done || r.stuck {
+				continue
+			}
+
+			done, message, err := kind.rolledOut(ctx, clientset, r.target.Namespace, r.target.Name)
+			switch {
+			case err != nil && isTransient(err):
+				waiting++
+				continue
+			case err != nil:
+				return false, apiError(err)
+			}
+
+			if message != r.message {
+				log.Info().Str("namespace", r.target.Namespace).Str(kind.Kind, r.target.Name).Str("status", message).Msg("Rollout status")
+			}
+
+			r.done = done
+			r.stuck = message == progressDeadlineExceeded
+			r.message = message
+
+			if !done && !r.stuck {
+				waiting++
+			}
+		}
+
+		return waiting == 0, nil
+	})
+	if err != nil && !wait.Interrupted(err) {
+		return err
+	}
+
+	return printRolloutStatus(kind, rollouts, program.WaitTimeout)
+}
+
+// printRolloutStatus shows the final status of every workload, returning an error if any did not roll out
+func printRolloutStatus(kind *workloadKind, rollouts []workloadRollout, timeout time.Duration) error {
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "NAME", "STATUS"})
+
+	failed := 0
+	for _, r := range rollouts {
+		status := paint(text.FgGreen, r.message)
+		switch {
+		case r.stuck:
+			status = paint(text.FgRed, r.message)
+			failed++
+		case !r.done:
+			status = paint(text.FgYellow, fmt.Sprintf("not rolled out after %s: %s", timeout, r.message))
+			failed++
+		}
+		t.AppendRow(table.Row{r.target.Namespace, r.target.Name, status})
+	}
+
+	t.Render()
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d %ss not rolled out", failed, len(rollouts), kind.Kind)
+	}
+
+	log.Info().Int("count", len(rollouts)).Msg("All rolled out")
+	return nil
+}
@@ -0,0 +1,294 @@
+package program
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/rs/zerolog/log"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/scale"
+	"k8s.io/client-go/util/retry"
+)
+
+// Scale shows or changes the replicas of anything which implements the scale subresource, such as Deployments,
+// StatefulSets, ReplicaSets and Argo Rollouts
+type Scale struct {
+	Resource string `arg:"" help:"Type of resource to scale (e.g. deployments, sts, rollouts.argoproj.io)"`
+	Replicas string `help:"Set replicas to a number (5), a percentage of the current replicas (50%) or a multiplier (2x)"`
+	Ticket   string `help:"Change ticket (e.g. JIRA-123) recorded with every modification"`
+
+	Selector `embed:""`
+	Bulk     `embed:""`
+}
+
+// scaleClients holds the clients needed to work with the scale subresource of arbitrary resource types
+type scaleClients struct {
+	clientset *kubernetes.Clientset
+	scales    scale.ScalesGetter
+	metadata  metadata.Interface
+	mapper    meta.RESTMapper
+}
+
+// newScaleClients builds the clients for the scale subresource on the given cluster
+func newScaleClients(options *Options, clientset *kubernetes.Clientset) (*scaleClients, error) {
+	config, err := options.RestConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// Custom resources such as Argo Rollouts only accept JSON
+	config.ContentType = runtime.ContentTypeJSON
+	config.AcceptContentTypes = runtime.ContentTypeJSON
+
+	cached := memory.NewMemCacheClient(clientset.Discovery())
+	mapper := newMapper(cached)
+
+	scales, err := scale.NewForConfig(config, mapper, dynamic.LegacyAPIPathResolverFunc, scale.NewDiscoveryScaleKindResolver(cached))
+	if err != nil {
+		return nil, connectionError(err, "unable to create scale client")
+	}
+
+	metadataClient, err := metadata.NewForConfig(metadata.ConfigFor(config))
+	if err != nil {
+		return nil, connectionError(err, "unable to create metadata client")
+	}
+
+	return &scaleClients{clientset: clientset, scales: scales, metadata: metadataClient, mapper: mapper}, nil
+}
+
+// newMapper returns a mapper between kinds and resources which accepts the same short names as kubectl
+func newMapper(discovery discovery.CachedDiscoveryInterface) meta.RESTMapper {
+	return restmapper.NewShortcutExpander(restmapper.NewDeferredDiscoveryRESTMapper(discovery), discovery, nil)
+}
+
+// resolve finds the resource type named on the command line, accepting the same names as kubectl (e.g. "deploy",
+// "statefulsets.apps" or "rollouts.v1alpha1.argoproj.io")
+func (clients *scaleClients) resolve(name string) (schema.GroupVersionResource, schema.GroupVersionKind, error) {
+	fullySpecified, groupResource := schema.ParseResourceArg(strings.ToLower(name))
+
+	var resource schema.GroupVersionResource
+	var err error
+
+	if fullySpecified != nil {
+		resource, err = clients.mapper.ResourceFor(*fullySpecified)
+	}
+	if fullySpecified == nil || err != nil {
+		resource, err = clients.mapper.ResourceFor(groupResource.WithVersion(""))
+	}
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return resource, schema.GroupVersionKind{}, usageError("unknown resource type %q", name)
+		}
+		return resource, schema.GroupVersionKind{}, apiError(err)
+	}
+
+	kind, err := clients.mapper.KindFor(resource)
+	if err != nil {
+		return resource, kind, apiError(err)
+	}
+
+	return resource, kind, nil
+}
+
+func (program *Scale) Run(options *Options) error {
+
+	initColors(options)
+
+	var change expression
+	if program.Replicas != "" {
+		if !program.selected() {
+			return usageError("select what to scale by name, with --labels or with --all")
+		}
+
+		var err error
+		if change, err = parseExpression(program.Replicas); err != nil {
+			return err
+		}
+	}
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	clients, err := newScaleClients(options, clientset)
+	if err != nil {
+		return err
+	}
+
+	resource, kind, err := clients.resolve(program.Resource)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	return options.runAsLeader(ctx, clientset, func(ctx context.Context) error {
+		targets, err := program.list(ctx, clients.metadata, resource)
+		if err != nil {
+			return err
+		}
+
+		if change == nil {
+			return program.show(ctx, options, clients, resource.GroupResource(), targets)
+		}
+
+		results := newSummary()
+		defer results.print()
+
+		return program.scale(ctx, options, clients, resource.GroupResource(), kind, targets, change, results)
+	})
+}
+
+// show prints the replicas of each target
+func (program *Scale) show(ctx context.Context, options *Options, clients *scaleClients, resource schema.GroupResource, targets []types.NamespacedName) error {
+	t := newTable()
+
+	header := table.Row{"NAME", "DESIRED", "CURRENT", "SELECTOR"}
+	if program.AllNamespaces {
+		header = append(table.Row{"NAMESPACE"}, header...)
+	}
+	t.AppendHeader(header)
+
+	var errs []error
+
+	for _, target := range targets {
+		var current *autoscalingv1.Scale
+		err := withRetries(ctx, options.Retries, func() (err error) {
+			current, err = clients.scales.Scales(target.Namespace).Get(ctx, resource, target.Name, metav1.GetOptions{})
+			return err
+		})
+		if err != nil {
+			if err := apiError(err); ExitCode(err) == ExitConnection {
+				return err
+			}
+			fmt.Printf("Failed to get %s %s: %v\n", resource, target.Name, err)
+			errs = append(errs, err)
+			continue
+		}
+
+		row := table.Row{current.Name, current.Spec.Replicas, current.Status.Replicas, current.Status.Selector}
+		if program.AllNamespaces {
+			row = append(table.Row{current.Namespace}, row...)
+		}
+		t.AppendRow(row)
+	}
+
+	t.Render()
+
+	return errors.Join(errs...)
+}
+
+// scale applies the change to the replicas of each target, recording the outcomes in results
+func (program *Scale) scale(ctx context.Context, options *Options, clients *scaleClients, resource schema.GroupResource, kind schema.GroupVersionKind, targets []types.NamespacedName, change expression, results *summary) error {
+	errs := program.Bulk.run(ctx, len(targets), options.DryRun, false, func(i int) error {
+		target := targets[i]
+
+		message, err := program.scaleOne(ctx, options, clients, resource, kind, target, change)
+		switch {
+		case err != nil:
+			fmt.Printf("Failed to scale %s %s: %v\n", resource, target.Name, err)
+			results.record(target.Namespace, target.Name, outcomeFailed, err.Error())
+			return fmt.Errorf("%s %s: %w", resource, target.Name, err)
+		case message == "":
+			results.record(target.Namespace, target.Name, outcomeSkipped, "already at the requested replicas")
+		case options.DryRun:
+			results.record(target.Namespace, target.Name, outcomeUpdated, "dry run: "+message)
+		default:
+			results.record(target.Namespace, target.Name, outcomeUpdated, message)
+		}
+		return nil
+	})
+
+	for _, target := range targets {
+		if !results.has(target.Namespace, target.Name) {
+			results.record(target.Namespace, target.Name, outcomeSkipped, "not started")
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// scaleOne changes the replicas of a single target, returning a description of the change or "" if it is already
+// at the requested replicas.  If the target changes while being scaled it is fetched again and the change re-applied
+// to the current replicas.
+func (program *Scale) scaleOne(ctx context.Context, options *Options, clients *scaleClients, resource schema.GroupResource, kind schema.GroupVersionKind, target types.NamespacedName, change expression) (string, error) {
+	scales := clients.scales.Scales(target.Namespace)
+	message := ""
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var current *autoscalingv1.Scale
+		err := withRetries(ctx, options.Retries, func() (err error) {
+			current, err = scales.Get(ctx, resource, target.Name, metav1.GetOptions{})
+			return err
+		})
+		if err != nil {
+			return apiError(err)
+		}
+
+		replicas := change(current.Spec.Replicas)
+		if replicas < 0 {
+			replicas = 0
+		}
+
+		if replicas == current.Spec.Replicas {
+			message = ""
+			return nil
+		}
+
+		message = fmt.Sprintf("replicas %d -> %d", current.Spec.Replicas, replicas)
+		if program.Ticket != "" {
+			message += fmt.Sprintf(" (ticket %s)", program.Ticket)
+		}
+
+		log.Info().
+			Str("namespace", target.Namespace).
+			Str(strings.ToLower(kind.Kind), target.Name).
+			Int32("from", current.Spec.Replicas).
+			Int32("to", replicas).
+			Str("ticket", program.Ticket).
+			Msg("Scaling")
+
+		if options.DryRun {
+			return nil
+		}
+
+		current.Spec.Replicas = replicas
+		err = withRetries(ctx, options.Retries, func() (err error) {
+			current, err = scales.Update(ctx, resource, current, metav1.UpdateOptions{FieldManager: FieldManager})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		recordObjectEvent(ctx, eventCreator(clients.clientset), corev1.ObjectReference{
+			APIVersion:      kind.GroupVersion().String(),
+			Kind:            kind.Kind,
+			Name:            current.Name,
+			Namespace:       current.Namespace,
+			UID:             current.UID,
+			ResourceVersion: current.ResourceVersion,
+		}, "Scaled", message)
+
+		return nil
+	})
+
+	return message, err
+}
@@ -0,0 +1,191 @@
+package program
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/rs/zerolog/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+)
+
+// Selector holds the flags which select the resources to operate on.  Commands embed it with the "resources" variable
+// naming the kind they select, e.g. `embed:"" set:"resources=HPAs"`, for the help.
+type Selector struct {
+	Labels map[string]string `short:"l" help:"Label filters to select ${resources=resources}"`
+	All    bool              `help:"Select all ${resources=resources} in the namespace"`
+	Names  []string          `arg:"" optional:"" help:"Names of specific ${resources=resources}"`
+
+	AllNamespaces bool  `short:"A" help:"Select ${resources=resources} in all namespaces"`
+	ChunkSize     int64 `default:"500" help:"Number of ${resources=resources} to fetch per list request"`
+
+	// namespaceName is the namespace resolved from the flags and kubeconfig
+	namespaceName string
+}
+
+// selected returns true if the user has named the resources to operate on
+func (selector *Selector) selected() bool {
+	return selector.All || len(selector.Names) > 0 || len(selector.Labels) > 0
+}
+
+// connect builds the Kubernetes client and resolves the namespace to operate in
+func (selector *Selector) connect(options *Options) (*kubernetes.Clientset, error) {
+	clientset, err := options.Clientset()
+	if err != nil {
+		return nil, err
+	}
+
+	if !selector.AllNamespaces {
+		if selector.namespaceName, err = options.ResolveNamespace(); err != nil {
+			return nil, err
+		}
+	}
+
+	return clientset, nil
+}
+
+// labelSelector returns the label selector string for the selected labels
+func (selector *Selector) labelSelector() string {
+	return labels.SelectorFromSet(selector.Labels).String()
+}
+
+// namespace returns the namespace to list resources in, which is empty for all namespaces
+func (selector *Selector) namespace() string {
+	if selector.AllNamespaces {
+		return metav1.NamespaceAll
+	}
+	return selector.namespaceName
+}
+
+// list returns the selected resources of the given type, sorted by namespace and name.  Resources given by name are
+// not looked up, so the caller reports any which do not exist.
+func (selector *Selector) list(ctx context.Context, client metadata.Interface, resource schema.GroupVersionResource) ([]types.NamespacedName, error) {
+	var result []types.NamespacedName
+
+	if len(selector.Names) > 0 && !selector.AllNamespaces {
+		for _, name := range selector.Names {
+			result = append(result, types.NamespacedName{Namespace: selector.namespaceName, Name: name})
+		}
+		sortNames(result)
+		return result, nil
+	}
+
+	wanted := map[string]bool{}
+	for _, name := range selector.Names {
+		wanted[name] = true
+	}
+
+	listOptions := metav1.ListOptions{Limit: selector.ChunkSize, LabelSelector: selector.labelSelector()}
+
+	for {
+		list, err := client.Resource(resource).Namespace(selector.namespace()).List(ctx, listOptions)
+		if err != nil {
+			return nil, apiError(err)
+		}
+
+		log.Debug().Int("count", len(list.Items)).Str("resource", resource.Resource).Msg("Listed resources")
+
+		for _, item := range list.Items {
+			if len(wanted) == 0 || wanted[item.Name] {
+				result = append(result, types.NamespacedName{Namespace: item.Namespace, Name: item.Name})
+			}
+		}
+
+		if list.Continue == "" {
+			break
+		}
+		listOptions.Continue = list.Continue
+	}
+
+	sortNames(result)
+	return result, nil
+}
+
+// sortNames sorts by namespace and then name
+func sortNames(names []types.NamespacedName) {
+	sort.Slice(names, func(i, j int) bool {
+		if names[i].Namespace != names[j].Namespace {
+			return names[i].Namespace < names[j].Namespace
+		}
+		return names[i].Name < names[j].Name
+	})
+}
+
+// sortObjects sorts Kubernetes objects by namespace and then name
+func sortObjects[T any, P interface {
+	*T
+	metav1.Object
+}](items []T) {
+	sort.Slice(items, func(i, j int) bool {
+		a, b := P(&items[i]), P(&items[j])
+		if a.GetNamespace() != b.GetNamespace() {
+			return a.GetNamespace() < b.GetNamespace()
+		}
+		return a.GetName() < b.GetName()
+	})
+}
+
+// fetch returns the selected objects sorted by namespace and name.  Objects given by name are fetched with get and
+// any which cannot be found are reported and skipped, otherwise they are listed a page at a time with list, which
+// returns the page and the continue token.  If get is nil objects given by name are picked out of the listing.
+func fetch[T any, P interface {
+	*T
+	metav1.Object
+}](ctx context.Context, selector *Selector, kind string,
+	get func(ctx context.Context, namespace, name string) (*T, error),
+	list func(ctx context.Context, namespace string, options metav1.ListOptions) ([]T, string, error),
+) ([]T, error) {
+	var result []T
+
+	if len(selector.Names) > 0 && !selector.AllNamespaces && get != nil {
+		for _, name := range selector.Names {
+			item, err := get(ctx, selector.namespaceName, name)
+			if err != nil {
+				if err := apiError(err); ExitCode(err) == ExitConnection {
+					return nil, err
+				}
+				fmt.Printf("Failed to get %s %s: %v\n", kind, name, err)
+				continue
+			}
+			result = append(result, *item)
+		}
+
+		sortObjects[T, P](result)
+		return result, nil
+	}
+
+	wanted := map[string]bool{}
+	for _, name := range selector.Names {
+		wanted[name] = true
+	}
+
+	listOptions := metav1.ListOptions{Limit: selector.ChunkSize, LabelSelector: selector.labelSelector()}
+
+	for {
+		items, next, err := list(ctx, selector.namespace(), listOptions)
+		if err != nil {
+			return nil, apiError(err)
+		}
+
+		log.Debug().Int("count", len(items)).Str("kind", kind).Msg("Listed resources")
+
+		for i := range items {
+			if len(wanted) == 0 || wanted[P(&items[i]).GetName()] {
+				result = append(result, items[i])
+			}
+		}
+
+		if next == "" {
+			break
+		}
+		listOptions.Continue = next
+	}
+
+	sortObjects[T, P](result)
+	return result, nil
+}
@@ -0,0 +1,266 @@
+package program
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Spread shows how the pods of workloads are distributed across zones and nodes, and checks the topology spread
+// constraints of HPA-managed workloads against the number of replicas the HPA may run.  The scheduler honors spread
+// constraints when adding pods but an HPA scale-down removes pods without regard to them, so the constraints are
+// easy to break without anyone noticing.
+type Spread struct {
+	Selector `embed:""`
+}
+
+// spreadProblem is a topology spread constraint a workload cannot meet
+type spreadProblem struct {
+	Namespace string
+	Workload  string
+	HPA       string
+	Problem   string
+}
+
+func (program *Spread) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	templates, err := podTemplates(ctx, clientset, &program.Selector)
+	if err != nil {
+		return err
+	}
+
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return apiError(err)
+	}
+
+	nodeLabels := map[string]map[string]string{}
+	var schedulable []corev1.Node
+	for _, node := range nodes.Items {
+		nodeLabels[node.Name] = node.Labels
+		if !node.Spec.Unschedulable {
+			schedulable = append(schedulable, node)
+		}
+	}
+
+	hpaSelector := Selector{AllNamespaces: program.AllNamespaces, ChunkSize: program.ChunkSize, namespaceName: program.namespaceName}
+	hpas, err := hpaSelector.getHpas(ctx, WithRetries(NewHPAClient(clientset), options.Retries))
+	if err != nil {
+		return err
+	}
+
+	hpaFor := map[string]*v1.HorizontalPodAutoscaler{}
+	for i := range hpas {
+		ref := hpas[i].Spec.ScaleTargetRef
+		hpaFor[hpas[i].Namespace+"/"+ref.Kind+"/"+ref.Name] = &hpas[i]
+	}
+
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "WORKLOAD", "ZONE", "NODES", "PODS"})
+
+	var problems []spreadProblem
+
+	for _, template := range templates {
+		workload := template.Kind + "/" + template.Name
+
+		pods, err := workloadPods(ctx, clientset, template)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range zoneDistribution(pods, nodeLabels) {
+			t.AppendRow(table.Row{template.Namespace, workload, row.zone, row.nodes, row.pods})
+		}
+
+		hpa := hpaFor[template.Namespace+"/"+workload]
+		if hpa == nil {
+			continue
+		}
+
+		for _, problem := range checkSpread(template.Spec.TopologySpreadConstraints, hpa, pods, schedulable) {
+			problems = append(problems, spreadProblem{template.Namespace, workload, hpa.Name, problem})
+		}
+	}
+
+	t.Render()
+
+	if len(problems) == 0 {
+		log.Info().Int("workloads", len(templates)).Msg("No topology spread problems found")
+		return nil
+	}
+
+	t = newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "WORKLOAD", "HPA", "PROBLEM"})
+	for _, p := range problems {
+		t.AppendRow(table.Row{p.Namespace, p.Workload, p.HPA, p.Problem})
+	}
+	t.Render()
+
+	log.Warn().Int("count", len(problems)).Msg("Topology spread problems found")
+
+	return nil
+}
+
+// workloadPods returns the pods of the workload which have not finished
+func workloadPods(ctx context.Context, clientset kubernetes.Interface, template podTemplate) ([]corev1.Pod, error) {
+	selector, err := metav1.LabelSelectorAsSelector(template.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s/%s: %w", template.Kind, template.Namespace, template.Name, err)
+	}
+
+	list, err := clientset.CoreV1().Pods(template.Namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, apiError(err)
+	}
+
+	var pods []corev1.Pod
+	for _, pod := range list.Items {
+		if pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+			pods = append(pods, pod)
+		}
+	}
+
+	return pods, nil
+}
+
+type zoneRow struct {
+	zone  string
+	nodes int
+	pods  int
+}
+
+// zoneDistribution counts the pods and distinct nodes in each zone.  Pods not yet scheduled are counted under
+// "pending".
+func zoneDistribution(pods []corev1.Pod, nodeLabels map[string]map[string]string) []zoneRow {
+	counts := map[string]int{}
+	nodes := map[string]map[string]bool{}
+
+	for _, pod := range pods {
+		zone := "pending"
+		if pod.Spec.NodeName != "" {
+			zone = nodeLabels[pod.Spec.NodeName][corev1.LabelTopologyZone]
+			if zone == "" {
+				zone = "-"
+			}
+			if nodes[zone] == nil {
+				nodes[zone] = map[string]bool{}
+			}
+			nodes[zone][pod.Spec.NodeName] = true
+		}
+		counts[zone]++
+	}
+
+	var rows []zoneRow
+	for zone, count := range counts {
+		rows = append(rows, zoneRow{zone, len(nodes[zone]), count})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].zone < rows[j].zone })
+
+	return rows
+}
+
+// checkSpread returns the ways the workload's hard (DoNotSchedule) spread constraints cannot be met with the replicas
+// its HPA runs.  Domains are counted over the schedulable nodes, without considering node affinity or taints, so a
+// constraint reported as satisfiable may still be limited further by those.
+func checkSpread(constraints []corev1.TopologySpreadConstraint, hpa *v1.HorizontalPodAutoscaler, pods []corev1.Pod, nodes []corev1.Node) []string {
+	var problems []string
+
+	for _, constraint := range constraints {
+		if constraint.WhenUnsatisfiable != corev1.DoNotSchedule {
+			continue
+		}
+
+		domains := map[string]int{}
+		for _, node := range nodes {
+			if value, ok := node.Labels[constraint.TopologyKey]; ok {
+				domains[value] = 0
+			}
+		}
+
+		if len(domains) == 0 {
+			problems = append(problems, fmt.Sprintf("no schedulable node has label %s, new pods cannot be scheduled", constraint.TopologyKey))
+			continue
+		}
+
+		// With fewer domains than minDomains the scheduler treats the emptiest domain as empty, so each domain can
+		// hold only maxSkew pods
+		if constraint.MinDomains != nil && int32(len(domains)) < *constraint.MinDomains {
+			limit := int32(len(domains)) * constraint.MaxSkew
+			if hpa.Spec.MaxReplicas > limit {
+				problems = append(problems, fmt.Sprintf("%d %s domains, fewer than minDomains %d, fit only %d pods but the HPA maximum is %d",
+					len(domains), constraint.TopologyKey, *constraint.MinDomains, limit, hpa.Spec.MaxReplicas))
+			}
+		}
+
+		nodeDomain := map[string]string{}
+		for _, node := range nodes {
+			if value, ok := node.Labels[constraint.TopologyKey]; ok {
+				nodeDomain[node.Name] = value
+			}
+		}
+
+		pending := 0
+		for _, pod := range pods {
+			if pod.Spec.NodeName == "" {
+				pending++
+				continue
+			}
+			if domain, ok := nodeDomain[pod.Spec.NodeName]; ok {
+				domains[domain]++
+			}
+		}
+
+		if skew, most, least := maxSkew(domains); skew > constraint.MaxSkew {
+			problems = append(problems, fmt.Sprintf("%s skew is %d (%s), above maxSkew %d, usually left by a scale-down",
+				constraint.TopologyKey, skew, most+" vs "+least, constraint.MaxSkew))
+		}
+
+		if pending > 0 {
+			problems = append(problems, fmt.Sprintf("%d pods pending, check whether %s spread is blocking them", pending, constraint.TopologyKey))
+		}
+	}
+
+	return problems
+}
+
+// maxSkew returns the difference between the fullest and emptiest domains, and descriptions of both
+func maxSkew(domains map[string]int) (int32, string, string) {
+	names := make([]string, 0, len(domains))
+	for name := range domains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	most, least := names[0], names[0]
+	for _, name := range names {
+		if domains[name] > domains[most] {
+			most = name
+		}
+		if domains[name] < domains[least] {
+			least = name
+		}
+	}
+
+	describe := func(name string) string {
+		return fmt.Sprintf("%d in %s", domains[name], name)
+	}
+
+	return int32(domains[most] - domains[least]), describe(most), describe(least)
+}
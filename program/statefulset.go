@@ -0,0 +1,190 @@
+package program
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Statefulset shows StatefulSets and changes their replicas.  StatefulSets scale down from the highest ordinal, and
+// depending on their PVC retention policy the removed pods' volumes may be deleted, so scale downs are logged pod by
+// pod and those which would delete volumes are refused unless explicitly allowed.
+type Statefulset struct {
+	Replicas         string `help:"Set replicas to a number (5), a percentage of the current replicas (50%) or a multiplier (2x)"`
+	Ticket           string `help:"Change ticket (e.g. JIRA-123) recorded with every modification"`
+	AllowPVCDeletion bool   `name:"allow-pvc-deletion" help:"Scale down StatefulSets whose retention policy deletes the volumes of removed pods"`
+
+	Selector `embed:""`
+	Bulk     `embed:""`
+}
+
+func (program *Statefulset) Run(options *Options) error {
+
+	initColors(options)
+
+	var change expression
+	if program.Replicas != "" {
+		if !program.selected() {
+			return usageError("select what to scale by name, with --labels or with --all")
+		}
+
+		var err error
+		if change, err = parseExpression(program.Replicas); err != nil {
+			return err
+		}
+	}
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	statefulsets, err := program.getStatefulSets(ctx, clientset)
+	if err != nil {
+		return err
+	}
+
+	if change == nil {
+		program.printStatefulSets(statefulsets)
+		return nil
+	}
+
+	clients, err := newScaleClients(options, clientset)
+	if err != nil {
+		return err
+	}
+
+	resource, kind, err := clients.resolve("statefulsets.apps")
+	if err != nil {
+		return err
+	}
+
+	return options.runAsLeader(ctx, clientset, func(ctx context.Context) error {
+		results := newSummary()
+		defer results.print()
+
+		var targets []types.NamespacedName
+		for i := range statefulsets {
+			sts := &statefulsets[i]
+			if reason := program.checkScaleDown(sts, change); reason != "" {
+				results.record(sts.Namespace, sts.Name, outcomeSkipped, reason)
+				continue
+			}
+			targets = append(targets, types.NamespacedName{Namespace: sts.Namespace, Name: sts.Name})
+		}
+
+		scale := Scale{Ticket: program.Ticket, Selector: program.Selector, Bulk: program.Bulk}
+		return scale.scale(ctx, options, clients, resource.GroupResource(), kind, targets, change, results)
+	})
+}
+
+// checkScaleDown logs the pods a scale down will remove and what becomes of their volumes.  It returns the reason the
+// StatefulSet must not be scaled, or "" if it may be.
+func (program *Statefulset) checkScaleDown(sts *appsv1.StatefulSet, change expression) string {
+	current := replicasOf(sts.Spec.Replicas)
+	replicas := change(current)
+	if replicas >= current {
+		return ""
+	}
+
+	var removed []string
+	for ordinal := current - 1; ordinal >= replicas; ordinal-- {
+		removed = append(removed, sts.Name+"-"+strconv.Itoa(int(ordinal)))
+	}
+
+	policy := whenScaled(sts)
+
+	log.Warn().
+		Str("namespace", sts.Namespace).
+		Str("statefulset", sts.Name).
+		Strs("pods", removed).
+		Str("podManagementPolicy", string(sts.Spec.PodManagementPolicy)).
+		Str("pvcWhenScaled", string(policy)).
+		Msg("Scale down removes pods from the highest ordinal")
+
+	if policy == appsv1.DeletePersistentVolumeClaimRetentionPolicyType && !program.AllowPVCDeletion {
+		log.Error().Str("statefulset", sts.Name).Msg("Refusing to scale down, the volumes of the removed pods would be deleted (use --allow-pvc-deletion)")
+		return fmt.Sprintf("would delete PVCs of %s", strings.Join(removed, ", "))
+	}
+
+	return ""
+}
+
+// whenScaled returns what happens to the volumes of pods removed by a scale down
+func whenScaled(sts *appsv1.StatefulSet) appsv1.PersistentVolumeClaimRetentionPolicyType {
+	if sts.Spec.PersistentVolumeClaimRetentionPolicy == nil || sts.Spec.PersistentVolumeClaimRetentionPolicy.WhenScaled == "" {
+		return appsv1.RetainPersistentVolumeClaimRetentionPolicyType
+	}
+	return sts.Spec.PersistentVolumeClaimRetentionPolicy.WhenScaled
+}
+
+// replicasOf returns the replicas of a workload, which default to 1
+func replicasOf(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
+
+// getStatefulSets returns the selected StatefulSets sorted by namespace and name
+func (program *Statefulset) getStatefulSets(ctx context.Context, clientset kubernetes.Interface) ([]appsv1.StatefulSet, error) {
+	statefulsets := clientset.AppsV1().StatefulSets
+
+	return fetch(ctx, &program.Selector, "statefulset",
+		func(ctx context.Context, namespace, name string) (*appsv1.StatefulSet, error) {
+			return statefulsets(namespace).Get(ctx, name, metav1.GetOptions{})
+		},
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]appsv1.StatefulSet, string, error) {
+			list, err := statefulsets(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+}
+
+// printStatefulSets shows the StatefulSets as a table, highlighting any which are not fully ready
+func (program *Statefulset) printStatefulSets(statefulsets []appsv1.StatefulSet) {
+	t := newTable()
+
+	header := table.Row{"NAME", "READY", "UP-TO-DATE", "POD MANAGEMENT", "PVC WHEN SCALED"}
+	if program.AllNamespaces {
+		header = append(table.Row{"NAMESPACE"}, header...)
+	}
+	t.AppendHeader(header)
+
+	for i := range statefulsets {
+		sts := &statefulsets[i]
+		replicas := replicasOf(sts.Spec.Replicas)
+
+		ready := fmt.Sprintf("%d/%d", sts.Status.ReadyReplicas, replicas)
+		if sts.Status.ReadyReplicas < replicas {
+			ready = paint(text.FgYellow, ready)
+		}
+
+		policy := string(whenScaled(sts))
+		if whenScaled(sts) == appsv1.DeletePersistentVolumeClaimRetentionPolicyType {
+			policy = paint(text.FgRed, policy)
+		}
+
+		row := table.Row{sts.Name, ready, strconv.Itoa(int(sts.Status.UpdatedReplicas)), string(sts.Spec.PodManagementPolicy), policy}
+		if program.AllNamespaces {
+			row = append(table.Row{sts.Namespace}, row...)
+		}
+		t.AppendRow(row)
+	}
+
+	t.Render()
+}
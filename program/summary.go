@@ -0,0 +1,124 @@
+package program
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+)
+
+// Outcomes of an item in a bulk run
+const (
+	outcomeUpdated  = "updated"
+	outcomeSkipped  = "skipped"
+	outcomeFailed   = "failed"
+	outcomeReverted = "reverted"
+)
+
+type outcome struct {
+	Namespace string
+	Name      string
+	Outcome   string
+	Reason    string
+}
+
+// summary collects the outcome of every item in a bulk run so it can be reported at the end.  It is safe for
+// concurrent use.
+type summary struct {
+	lock     sync.Mutex
+	outcomes map[string]*outcome
+	order    []string
+}
+
+func newSummary() *summary {
+	return &summary{outcomes: map[string]*outcome{}}
+}
+
+// record sets the outcome of an item, replacing any earlier outcome
+func (s *summary) record(namespace, name, result, reason string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := namespace + "/" + name
+	if _, ok := s.outcomes[key]; !ok {
+		s.order = append(s.order, key)
+	}
+	s.outcomes[key] = &outcome{namespace, name, result, reason}
+}
+
+// has returns true if an outcome has been recorded for the item
+func (s *summary) has(namespace, name string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, ok := s.outcomes[namespace+"/"+name]
+	return ok
+}
+
+// counts returns the number of items with each outcome
+func (s *summary) counts() map[string]int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	counts := map[string]int{}
+	for _, o := range s.outcomes {
+		counts[o.Outcome]++
+	}
+	return counts
+}
+
+// sorted returns the outcome of every item, sorted by namespace and name
+func (s *summary) sorted() []outcome {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	keys := append([]string(nil), s.order...)
+	sort.Strings(keys)
+
+	result := make([]outcome, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, *s.outcomes[key])
+	}
+	return result
+}
+
+// print shows a table of every item's outcome followed by the totals
+func (s *summary) print() {
+	outcomes := s.sorted()
+
+	if len(outcomes) == 0 {
+		return
+	}
+
+	t := newTable()
+
+	t.AppendHeader(table.Row{"NAMESPACE", "NAME", "RESULT", "REASON"})
+
+	for _, o := range outcomes {
+		result := o.Outcome
+		switch o.Outcome {
+		case outcomeUpdated:
+			result = text.FgGreen.Sprint(result)
+		case outcomeFailed:
+			result = text.FgRed.Sprint(result)
+		default:
+			result = text.FgYellow.Sprint(result)
+		}
+
+		t.AppendRow(table.Row{o.Namespace, o.Name, result, o.Reason})
+	}
+
+	t.Render()
+
+	counts := s.counts()
+	log.Info().
+		Int(outcomeUpdated, counts[outcomeUpdated]).
+		Int(outcomeSkipped, counts[outcomeSkipped]).
+		Int(outcomeFailed, counts[outcomeFailed]).
+		Int(outcomeReverted, counts[outcomeReverted]).
+		Msg("Summary")
+
+	s.notifyChanges()
+}
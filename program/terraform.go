@@ -0,0 +1,251 @@
+package program
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	v2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// hclBody is the body of an HCL block: attributes and nested blocks, in order
+type hclBody struct {
+	items []hclItem
+}
+
+// hclItem is an attribute, with a name and a rendered value or a map of strings, or a nested block, with a name and
+// labels
+type hclItem struct {
+	name    string
+	value   string
+	entries map[string]string
+	labels  []string
+	body    *hclBody
+}
+
+func (b *hclBody) attribute(name, value string) {
+	b.items = append(b.items, hclItem{name: name, value: value})
+}
+
+func (b *hclBody) mapAttribute(name string, entries map[string]string) {
+	b.items = append(b.items, hclItem{name: name, entries: entries})
+}
+
+func (b *hclBody) block(name string, labels ...string) *hclBody {
+	body := &hclBody{}
+	b.items = append(b.items, hclItem{name: name, labels: labels, body: body})
+	return body
+}
+
+// write renders the body at the indent, aligning the equals signs of consecutive attributes as terraform fmt does
+func (b *hclBody) write(out *strings.Builder, indent string) {
+	for i := 0; i < len(b.items); {
+		item := b.items[i]
+
+		if item.body != nil {
+			if i > 0 {
+				out.WriteString("\n")
+			}
+			out.WriteString(indent + item.name)
+			for _, label := range item.labels {
+				out.WriteString(" " + hclString(label))
+			}
+			out.WriteString(" {\n")
+			item.body.write(out, indent+"  ")
+			out.WriteString(indent + "}\n")
+			i++
+			continue
+		}
+
+		end := i
+		width := 0
+		for ; end < len(b.items) && b.items[end].body == nil; end++ {
+			width = max(width, len(b.items[end].name))
+		}
+		for ; i < end; i++ {
+			value := b.items[i].value
+			if b.items[i].entries != nil {
+				value = hclMap(b.items[i].entries, indent)
+			}
+			out.WriteString(fmt.Sprintf("%s%-*s = %s\n", indent, width, b.items[i].name, value))
+		}
+	}
+}
+
+// hclString quotes a string, escaping the sequences which would start an interpolation or directive
+func hclString(value string) string {
+	quoted, _ := json.Marshal(value)
+	return strings.NewReplacer("${", "$${", "%{", "%%{").Replace(string(quoted))
+}
+
+// hclMap renders a map of strings at the indent, one entry per line
+func hclMap(values map[string]string, indent string) string {
+	keys := make([]string, 0, len(values))
+	width := 0
+	for key := range values {
+		keys = append(keys, key)
+		width = max(width, len(hclString(key)))
+	}
+	sort.Strings(keys)
+
+	var out strings.Builder
+	out.WriteString("{\n")
+	for _, key := range keys {
+		out.WriteString(fmt.Sprintf("%s  %-*s = %s\n", indent, width, hclString(key), hclString(values[key])))
+	}
+	out.WriteString(indent + "}")
+	return out.String()
+}
+
+// terraformName is not allowed in a Terraform resource name
+var terraformName = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// terraformHPA returns the HPA as a kubernetes_horizontal_pod_autoscaler_v2 resource of the Terraform Kubernetes
+// provider, with the command to import the existing HPA into the state
+func terraformHPA(hpa *v2.HorizontalPodAutoscaler) []byte {
+	name := terraformName.ReplaceAllString(hpa.Namespace+"_"+hpa.Name, "_")
+	if name[0] >= '0' && name[0] <= '9' || name[0] == '-' {
+		name = "_" + name
+	}
+
+	root := &hclBody{}
+	r := root.block("resource", "kubernetes_horizontal_pod_autoscaler_v2", name)
+
+	metadata := r.block("metadata")
+	metadata.attribute("name", hclString(hpa.Name))
+	metadata.attribute("namespace", hclString(hpa.Namespace))
+	if len(hpa.Labels) > 0 {
+		metadata.mapAttribute("labels", hpa.Labels)
+	}
+	if len(hpa.Annotations) > 0 {
+		metadata.mapAttribute("annotations", hpa.Annotations)
+	}
+
+	spec := r.block("spec")
+	if hpa.Spec.MinReplicas != nil {
+		spec.attribute("min_replicas", strconv.Itoa(int(*hpa.Spec.MinReplicas)))
+	}
+	spec.attribute("max_replicas", strconv.Itoa(int(hpa.Spec.MaxReplicas)))
+
+	ref := spec.block("scale_target_ref")
+	if hpa.Spec.ScaleTargetRef.APIVersion != "" {
+		ref.attribute("api_version", hclString(hpa.Spec.ScaleTargetRef.APIVersion))
+	}
+	ref.attribute("kind", hclString(hpa.Spec.ScaleTargetRef.Kind))
+	ref.attribute("name", hclString(hpa.Spec.ScaleTargetRef.Name))
+
+	for _, metric := range hpa.Spec.Metrics {
+		m := spec.block("metric")
+		m.attribute("type", hclString(string(metric.Type)))
+
+		switch {
+		case metric.Resource != nil:
+			source := m.block("resource")
+			source.attribute("name", hclString(string(metric.Resource.Name)))
+			terraformTarget(source, metric.Resource.Target)
+		case metric.ContainerResource != nil:
+			source := m.block("container_resource")
+			source.attribute("container", hclString(metric.ContainerResource.Container))
+			source.attribute("name", hclString(string(metric.ContainerResource.Name)))
+			terraformTarget(source, metric.ContainerResource.Target)
+		case metric.Pods != nil:
+			source := m.block("pods")
+			terraformMetric(source, metric.Pods.Metric)
+			terraformTarget(source, metric.Pods.Target)
+		case metric.Object != nil:
+			source := m.block("object")
+			described := source.block("described_object")
+			described.attribute("api_version", hclString(metric.Object.DescribedObject.APIVersion))
+			described.attribute("kind", hclString(metric.Object.DescribedObject.Kind))
+			described.attribute("name", hclString(metric.Object.DescribedObject.Name))
+			terraformMetric(source, metric.Object.Metric)
+			terraformTarget(source, metric.Object.Target)
+		case metric.External != nil:
+			source := m.block("external")
+			terraformMetric(source, metric.External.Metric)
+			terraformTarget(source, metric.External.Target)
+		}
+	}
+
+	if behavior := hpa.Spec.Behavior; behavior != nil {
+		b := spec.block("behavior")
+		for _, direction := range []struct {
+			name  string
+			rules *v2.HPAScalingRules
+		}{{"scale_up", behavior.ScaleUp}, {"scale_down", behavior.ScaleDown}} {
+			if direction.rules == nil {
+				continue
+			}
+			d := b.block(direction.name)
+			if window := direction.rules.StabilizationWindowSeconds; window != nil {
+				d.attribute("stabilization_window_seconds", strconv.Itoa(int(*window)))
+			}
+			if policy := direction.rules.SelectPolicy; policy != nil {
+				d.attribute("select_policy", hclString(string(*policy)))
+			}
+			for _, policy := range direction.rules.Policies {
+				p := d.block("policy")
+				p.attribute("type", hclString(string(policy.Type)))
+				p.attribute("value", strconv.Itoa(int(policy.Value)))
+				p.attribute("period_seconds", strconv.Itoa(int(policy.PeriodSeconds)))
+			}
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "# terraform import kubernetes_horizontal_pod_autoscaler_v2.%s %s/%s\n", name, hpa.Namespace, hpa.Name)
+	root.write(&out, "")
+	return []byte(out.String())
+}
+
+// terraformMetric writes the metric block of a pods, object or external metric
+func terraformMetric(source *hclBody, metric v2.MetricIdentifier) {
+	m := source.block("metric")
+	m.attribute("name", hclString(metric.Name))
+
+	if metric.Selector == nil {
+		return
+	}
+	selector := m.block("selector")
+	terraformSelector(selector, metric.Selector)
+}
+
+// terraformSelector writes a label selector
+func terraformSelector(selector *hclBody, from *metav1.LabelSelector) {
+	if len(from.MatchLabels) > 0 {
+		selector.mapAttribute("match_labels", from.MatchLabels)
+	}
+	for _, expression := range from.MatchExpressions {
+		e := selector.block("match_expressions")
+		e.attribute("key", hclString(expression.Key))
+		e.attribute("operator", hclString(string(expression.Operator)))
+		values := make([]string, len(expression.Values))
+		for i, value := range expression.Values {
+			values[i] = hclString(value)
+		}
+		e.attribute("values", "["+strings.Join(values, ", ")+"]")
+	}
+}
+
+// terraformTarget writes the target block of a metric
+func terraformTarget(source *hclBody, target v2.MetricTarget) {
+	t := source.block("target")
+	t.attribute("type", hclString(string(target.Type)))
+
+	quantity := func(name string, value *resource.Quantity) {
+		if value != nil {
+			t.attribute(name, hclString(value.String()))
+		}
+	}
+
+	if target.AverageUtilization != nil {
+		t.attribute("average_utilization", strconv.Itoa(int(*target.AverageUtilization)))
+	}
+	quantity("average_value", target.AverageValue)
+	quantity("value", target.Value)
+}
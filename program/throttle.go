@@ -0,0 +1,47 @@
+package program
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// How long a request must wait on the client side rate limiter before it is reported, normally and with --verbose
+const (
+	throttleWarning        = time.Second
+	verboseThrottleWarning = 10 * time.Millisecond
+)
+
+// throttleReporter wraps a rate limiter and reports when requests are delayed by client-side throttling
+type throttleReporter struct {
+	flowcontrol.RateLimiter
+	threshold time.Duration
+}
+
+func newThrottleReporter(qps float32, burst int, threshold time.Duration) flowcontrol.RateLimiter {
+	return &throttleReporter{flowcontrol.NewTokenBucketRateLimiter(qps, burst), threshold}
+}
+
+func (t *throttleReporter) Accept() {
+	start := time.Now()
+	t.RateLimiter.Accept()
+	t.report(time.Since(start))
+}
+
+func (t *throttleReporter) Wait(ctx context.Context) error {
+	start := time.Now()
+	err := t.RateLimiter.Wait(ctx)
+	t.report(time.Since(start))
+	return err
+}
+
+func (t *throttleReporter) report(waited time.Duration) {
+	if waited >= t.threshold {
+		log.Warn().
+			Dur("waited", waited).
+			Float32("qps", t.QPS()).
+			Msg("Requests are being throttled on the client side, consider raising --qps and --burst")
+	}
+}
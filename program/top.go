@@ -0,0 +1,206 @@
+package program
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	v2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// TopCmd groups the live usage views
+type TopCmd struct {
+	Hpa TopHpa `cmd:"" help:"Show HPA status with the live usage of their pods, refreshing in place"`
+}
+
+// TopHpa combines each HPA's status with the live CPU and memory usage of its pods from the metrics API, redrawn every
+// --interval, in place of running "kubectl top" and "kubectl get hpa -w" side by side.
+type TopHpa struct {
+	Interval time.Duration `default:"5s" help:"Time between refreshes"`
+	Sort     string        `default:"pressure" enum:"pressure,cpu,name" help:"Order by replica pressure (replicas as a share of the maximum), CPU utilization against target, or name"`
+	Once     bool          `help:"Show the table once and exit rather than refreshing"`
+
+	Selector `embed:"" set:"resources=HPAs"`
+}
+
+// hpaTop is one line of the view
+type hpaTop struct {
+	hpa *v2.HorizontalPodAutoscaler
+	// pods with metrics and their total usage and CPU requests
+	pods              int
+	cpu, memory       resource.Quantity
+	cpuRequest        resource.Quantity
+	pressure, cpuLoad float64
+}
+
+func (program *TopHpa) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	client, err := options.Dynamic()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	owners := newOwnerResolver(clientset)
+
+	ticker := time.NewTicker(program.Interval)
+	defer ticker.Stop()
+
+	for {
+		rows, err := program.measure(ctx, clientset, client, owners)
+		if err != nil {
+			return err
+		}
+
+		if !program.Once {
+			fmt.Print(clearScreen)
+			fmt.Println(time.Now().Format(time.RFC1123))
+		}
+		printHpaTop(rows)
+
+		if program.Once {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// measure fetches the HPAs, their pods and the pods' usage, and returns the lines of the view in order
+func (program *TopHpa) measure(ctx context.Context, clientset kubernetes.Interface, client dynamic.Interface, owners *ownerResolver) ([]hpaTop, error) {
+	selector := program.Selector
+	hpas, err := getHpasV2(ctx, clientset, &selector)
+	if err != nil {
+		return nil, err
+	}
+
+	usage, err := containerUsage(ctx, client, program.namespace())
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := clientset.CoreV1().Pods(program.namespace()).List(ctx, metav1.ListOptions{FieldSelector: "status.phase=Running"})
+	if err != nil {
+		return nil, apiError(err)
+	}
+
+	byWorkload := map[string][]*corev1.Pod{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		kind, name, err := owners.workload(ctx, pod)
+		if err != nil {
+			return nil, err
+		}
+		key := pod.Namespace + "/" + kind + "/" + name
+		byWorkload[key] = append(byWorkload[key], pod)
+	}
+
+	rows := make([]hpaTop, 0, len(hpas))
+	for i := range hpas {
+		hpa := &hpas[i]
+		ref := hpa.Spec.ScaleTargetRef
+
+		row := hpaTop{hpa: hpa}
+		if hpa.Spec.MaxReplicas > 0 {
+			row.pressure = 100 * float64(hpa.Status.CurrentReplicas) / float64(hpa.Spec.MaxReplicas)
+		}
+
+		for _, pod := range byWorkload[hpa.Namespace+"/"+ref.Kind+"/"+ref.Name] {
+			containers, ok := usage[pod.Namespace+"/"+pod.Name]
+			if !ok {
+				continue
+			}
+			row.pods++
+			for _, used := range containers {
+				row.cpu.Add(used[corev1.ResourceCPU])
+				row.memory.Add(used[corev1.ResourceMemory])
+			}
+			row.cpuRequest.Add(podRequests(pod)[corev1.ResourceCPU])
+		}
+
+		// Live CPU utilization as a share of the HPA's target, so 100% is where it scales up
+		if _, target, ok := cpuUtilization(hpa); ok && !row.cpuRequest.IsZero() {
+			row.cpuLoad = usagePercent(row.cpu, row.cpuRequest) * 100 / float64(target)
+		}
+
+		rows = append(rows, row)
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		switch program.Sort {
+		case "cpu":
+			return rows[i].cpuLoad > rows[j].cpuLoad
+		case "pressure":
+			return rows[i].pressure > rows[j].pressure
+		default:
+			return false
+		}
+	})
+
+	return rows, nil
+}
+
+// printHpaTop shows the lines of the view, coloring HPAs at their maximum and those above their CPU target
+func printHpaTop(rows []hpaTop) {
+	t := newTable()
+	t.AppendHeader(table.Row{"NAMESPACE", "HPA", "REPLICAS", "DESIRED", "PRESSURE", "CPU", "CPU USED", "MEMORY USED", "PODS"})
+
+	for _, row := range rows {
+		hpa := row.hpa
+
+		pressure := fmt.Sprintf("%.0f%%", row.pressure)
+		if hpa.Status.CurrentReplicas >= hpa.Spec.MaxReplicas {
+			pressure = paint(text.FgRed, pressure)
+		}
+
+		cpu := "-"
+		if _, target, ok := cpuUtilization(hpa); ok && !row.cpuRequest.IsZero() {
+			cpu = fmt.Sprintf("%.0f%%/%d%%", usagePercent(row.cpu, row.cpuRequest), target)
+			if row.cpuLoad > 100 {
+				cpu = paint(text.FgYellow, cpu)
+			}
+		}
+
+		cpuUsed, memoryUsed := "-", "-"
+		if row.pods > 0 {
+			cpuUsed = formatQuantity(corev1.ResourceCPU, row.cpu)
+			memoryUsed = formatQuantity(corev1.ResourceMemory, row.memory)
+		}
+
+		t.AppendRow(table.Row{
+			hpa.Namespace,
+			hpa.Name,
+			fmt.Sprintf("%d/%d-%d", hpa.Status.CurrentReplicas, max(replicasOf(hpa.Spec.MinReplicas), 1), hpa.Spec.MaxReplicas),
+			strconv.Itoa(int(hpa.Status.DesiredReplicas)),
+			pressure,
+			cpu,
+			cpuUsed,
+			memoryUsed,
+			strconv.Itoa(row.pods),
+		})
+	}
+
+	t.Render()
+}
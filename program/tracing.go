@@ -0,0 +1,311 @@
+package program
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/autoscaling/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Tracing holds the flags which export traces of bulk runs to an OpenTelemetry collector or tracing backend
+type Tracing struct {
+	OtlpEndpoint    string            `name:"otlp-endpoint" env:"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT,OTEL_EXPORTER_OTLP_ENDPOINT" placeholder:"URL" help:"OTLP/HTTP endpoint to export traces of bulk runs to, e.g. http://localhost:4318"`
+	OtlpHeaders     map[string]string `name:"otlp-header" env:"OTEL_EXPORTER_OTLP_HEADERS" mapsep:"," placeholder:"NAME=VALUE,..." help:"Headers to send to the OTLP endpoint, e.g. for authentication"`
+	OtelServiceName string            `name:"otel-service-name" env:"OTEL_SERVICE_NAME" default:"k8sutils" help:"Service name of the exported traces"`
+}
+
+// otlpTracesPath is where an OTLP/HTTP endpoint receives traces
+const otlpTracesPath = "/v1/traces"
+
+// spanBatch is how many ended spans are sent to the endpoint at a time
+const spanBatch = 512
+
+// tracer collects ended spans and exports them in batches.  Like the notifiers it is set up once the options are
+// parsed, and is nil when tracing is not enabled, in which case spans are not recorded.
+var tracer *spanExporter
+
+// initTracing sets up the exporter given in the flags
+func (program *Options) initTracing() {
+	tracer = nil
+	if program.OtlpEndpoint == "" {
+		return
+	}
+
+	endpoint := strings.TrimSuffix(program.OtlpEndpoint, "/")
+	if !strings.HasSuffix(endpoint, otlpTracesPath) {
+		endpoint += otlpTracesPath
+	}
+
+	tracer = &spanExporter{endpoint: endpoint, headers: program.OtlpHeaders, service: program.OtelServiceName, cluster: program.contextName()}
+}
+
+// spanExporter sends spans to an OTLP/HTTP endpoint as JSON
+type spanExporter struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	cluster  string
+
+	lock  sync.Mutex
+	spans []*span
+}
+
+// span is a timed operation, part of a trace.  The methods of a nil span do nothing, so code can be instrumented
+// whether or not tracing is enabled.
+type span struct {
+	traceID    [16]byte
+	spanID     [8]byte
+	parentID   [8]byte
+	name       string
+	client     bool
+	start, end time.Time
+	attributes map[string]any
+	err        error
+}
+
+type spanKey struct{}
+
+// startSpan starts a span, a child of the one in the context if any, and returns a context carrying it.  Attributes
+// are given as pairs of key and value.
+func startSpan(ctx context.Context, name string, attributes ...any) (context.Context, *span) {
+	if tracer == nil {
+		return ctx, nil
+	}
+
+	s := &span{name: name, start: time.Now(), attributes: map[string]any{}}
+	if parent, ok := ctx.Value(spanKey{}).(*span); ok {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		_, _ = rand.Read(s.traceID[:])
+	}
+	_, _ = rand.Read(s.spanID[:])
+
+	for i := 0; i+1 < len(attributes); i += 2 {
+		s.attributes[attributes[i].(string)] = attributes[i+1]
+	}
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// hpaAttributes are the attributes identifying an HPA, with the names of the OpenTelemetry semantic conventions
+func hpaAttributes(namespace, name string) []any {
+	return []any{"k8s.namespace.name", namespace, "k8s.hpa.name", name}
+}
+
+// set adds an attribute to the span
+func (s *span) set(key string, value any) {
+	if s != nil {
+		s.attributes[key] = value
+	}
+}
+
+// finish ends the span, marking it failed if err is not nil, and returns err
+func (s *span) finish(err error) error {
+	if s == nil {
+		return err
+	}
+
+	s.end = time.Now()
+	s.err = err
+	tracer.add(s)
+	return err
+}
+
+// traceIDString returns the ID of the span's trace, for finding it in the tracing backend
+func (s *span) traceIDString() string {
+	if s == nil {
+		return ""
+	}
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// add queues an ended span, exporting the queue once it is a full batch
+func (t *spanExporter) add(s *span) {
+	t.lock.Lock()
+	t.spans = append(t.spans, s)
+	full := len(t.spans) >= spanBatch
+	t.lock.Unlock()
+
+	if full {
+		t.flush()
+	}
+}
+
+// flushTraces exports the spans which have ended.  A collector which cannot be reached only costs the traces.
+func flushTraces() {
+	if tracer != nil {
+		tracer.flush()
+	}
+}
+
+func (t *spanExporter) flush() {
+	t.lock.Lock()
+	spans := t.spans
+	t.spans = nil
+	t.lock.Unlock()
+
+	if len(spans) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	if err := postJSON(ctx, t.endpoint, t.headers, t.request(spans)); err != nil {
+		log.Warn().Err(err).Int("spans", len(spans)).Msg("Failed to export traces")
+	}
+}
+
+// otlpAttribute is a key and typed value in the OTLP JSON encoding
+type otlpAttribute struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+// otlpAttributes encodes attributes, sorted by key so exports are repeatable
+func otlpAttributes(attributes map[string]any) []otlpAttribute {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]otlpAttribute, 0, len(keys))
+	for _, key := range keys {
+		var value map[string]any
+		switch v := attributes[key].(type) {
+		case bool:
+			value = map[string]any{"boolValue": v}
+		case int:
+			// 64 bit integers are strings in the JSON encoding
+			value = map[string]any{"intValue": strconv.Itoa(v)}
+		case int32:
+			value = map[string]any{"intValue": strconv.Itoa(int(v))}
+		case float64:
+			value = map[string]any{"doubleValue": v}
+		default:
+			value = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+		result = append(result, otlpAttribute{Key: key, Value: value})
+	}
+	return result
+}
+
+// OTLP span kinds and status codes
+const (
+	otlpKindInternal = 1
+	otlpKindClient   = 3
+	otlpStatusOK     = 1
+	otlpStatusError  = 2
+)
+
+// request returns the export request for the spans, in the OTLP JSON encoding
+func (t *spanExporter) request(spans []*span) map[string]any {
+	encoded := make([]map[string]any, 0, len(spans))
+	for _, s := range spans {
+		kind := otlpKindInternal
+		if s.client {
+			kind = otlpKindClient
+		}
+		status := map[string]any{"code": otlpStatusOK}
+		if s.err != nil {
+			status = map[string]any{"code": otlpStatusError, "message": s.err.Error()}
+		}
+
+		e := map[string]any{
+			"traceId":           hex.EncodeToString(s.traceID[:]),
+			"spanId":            hex.EncodeToString(s.spanID[:]),
+			"name":              s.name,
+			"kind":              kind,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.attributes),
+			"status":            status,
+		}
+		if s.parentID != ([8]byte{}) {
+			e["parentSpanId"] = hex.EncodeToString(s.parentID[:])
+		}
+		encoded = append(encoded, e)
+	}
+
+	resource := map[string]any{"service.name": t.service, "service.version": Version}
+	if t.cluster != "" {
+		resource["k8s.cluster.name"] = t.cluster
+	}
+
+	return map[string]any{
+		"resourceSpans": []map[string]any{{
+			"resource": map[string]any{"attributes": otlpAttributes(resource)},
+			"scopeSpans": []map[string]any{{
+				"scope": map[string]string{"name": "k8sutils", "version": Version},
+				"spans": encoded,
+			}},
+		}},
+	}
+}
+
+// WithTracing returns an HPAClient which records a span for each call of the given client
+func WithTracing(client HPAClient) HPAClient {
+	return &tracingHPAClient{client}
+}
+
+type tracingHPAClient struct {
+	HPAClient
+}
+
+// clientSpan starts the span of an API call
+func clientSpan(ctx context.Context, name, namespace, hpa string) (context.Context, *span) {
+	ctx, s := startSpan(ctx, name, "k8s.namespace.name", namespace)
+	if s != nil {
+		s.client = true
+		if hpa != "" {
+			s.set("k8s.hpa.name", hpa)
+		}
+	}
+	return ctx, s
+}
+
+func (c *tracingHPAClient) List(ctx context.Context, namespace string, opts metav1.ListOptions) (*v1.HorizontalPodAutoscalerList, error) {
+	ctx, s := clientSpan(ctx, "list", namespace, "")
+	list, err := c.HPAClient.List(ctx, namespace, opts)
+	if list != nil {
+		s.set("k8sutils.hpa.count", len(list.Items))
+	}
+	return list, s.finish(err)
+}
+
+func (c *tracingHPAClient) Get(ctx context.Context, namespace, name string) (*v1.HorizontalPodAutoscaler, error) {
+	ctx, s := clientSpan(ctx, "get", namespace, name)
+	hpa, err := c.HPAClient.Get(ctx, namespace, name)
+	return hpa, s.finish(err)
+}
+
+func (c *tracingHPAClient) Update(ctx context.Context, hpa *v1.HorizontalPodAutoscaler) (*v1.HorizontalPodAutoscaler, error) {
+	ctx, s := clientSpan(ctx, "update", hpa.Namespace, hpa.Name)
+	result, err := c.HPAClient.Update(ctx, hpa)
+	return result, s.finish(err)
+}
+
+func (c *tracingHPAClient) Patch(ctx context.Context, namespace, name string, patchType types.PatchType, data []byte) (*v1.HorizontalPodAutoscaler, error) {
+	ctx, s := clientSpan(ctx, "patch", namespace, name)
+	s.set("k8sutils.patch.type", string(patchType))
+	hpa, err := c.HPAClient.Patch(ctx, namespace, name, patchType, data)
+	return hpa, s.finish(err)
+}
+
+func (c *tracingHPAClient) CreateEvent(ctx context.Context, event *corev1.Event) error {
+	ctx, s := clientSpan(ctx, "event", event.Namespace, event.InvolvedObject.Name)
+	return s.finish(c.HPAClient.CreateEvent(ctx, event))
+}
@@ -0,0 +1,31 @@
+package program
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// loggingTransport logs every request made to the API server
+type loggingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+
+	event := log.Info().
+		Str("verb", req.Method).
+		Str("url", req.URL.String()).
+		Dur("duration", time.Since(start))
+
+	if err != nil {
+		event.Err(err).Msg("API request failed")
+	} else {
+		event.Int("status", resp.StatusCode).Msg("API request")
+	}
+
+	return resp, err
+}
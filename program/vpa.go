@@ -0,0 +1,232 @@
+package program
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+)
+
+// Vpa shows VerticalPodAutoscalers with their recommendations next to the current requests of the containers they
+// manage, so vertical and horizontal autoscaling can be checked together
+type Vpa struct {
+	Selector `embed:""`
+}
+
+var vpaResource = schema.GroupVersionResource{Group: "autoscaling.k8s.io", Version: "v1", Resource: "verticalpodautoscalers"}
+
+// containerRecommendation is the recommendation for one resource of one container
+type containerRecommendation struct {
+	Container  string
+	Resource   corev1.ResourceName
+	Request    string
+	LowerBound string
+	Target     string
+	UpperBound string
+}
+
+func (program *Vpa) Run(options *Options) error {
+
+	initColors(options)
+
+	clientset, err := program.connect(options)
+	if err != nil {
+		return err
+	}
+
+	client, err := options.Dynamic()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := newContext()
+	defer cancel()
+
+	vpas, err := fetch(ctx, &program.Selector, "VerticalPodAutoscaler",
+		func(ctx context.Context, namespace, name string) (*unstructured.Unstructured, error) {
+			return client.Resource(vpaResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		},
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]unstructured.Unstructured, string, error) {
+			list, err := client.Resource(vpaResource).Namespace(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.GetContinue(), nil
+		})
+	if apierrors.IsNotFound(err) {
+		return usageError("the VerticalPodAutoscaler API is not installed in this cluster (no %s resource)", vpaResource.GroupResource())
+	}
+	if err != nil {
+		return err
+	}
+
+	mapper := newMapper(memory.NewMemCacheClient(clientset.Discovery()))
+
+	t := newTable()
+
+	header := table.Row{"NAME", "REFERENCE", "MODE", "CONTAINER", "RESOURCE", "REQUEST", "LOWER", "TARGET", "UPPER"}
+	if program.AllNamespaces {
+		header = append(table.Row{"NAMESPACE"}, header...)
+	}
+	t.AppendHeader(header)
+
+	for i := range vpas {
+		vpa := &vpas[i]
+
+		kind, _, _ := unstructured.NestedString(vpa.Object, "spec", "targetRef", "kind")
+		name, _, _ := unstructured.NestedString(vpa.Object, "spec", "targetRef", "name")
+		apiVersion, _, _ := unstructured.NestedString(vpa.Object, "spec", "targetRef", "apiVersion")
+
+		mode, _, _ := unstructured.NestedString(vpa.Object, "spec", "updatePolicy", "updateMode")
+		if mode == "" {
+			mode = "Auto"
+		}
+
+		requests := targetRequests(ctx, client, mapper, vpa.GetNamespace(), apiVersion, kind, name)
+
+		recommendations := vpaRecommendations(vpa, requests)
+		if len(recommendations) == 0 {
+			recommendations = []containerRecommendation{{Container: "(no recommendation)"}}
+		}
+
+		for _, r := range recommendations {
+			request := r.Request
+			if request != "" && r.Target != "" && outsideBounds(request, r.LowerBound, r.UpperBound) {
+				request = paint(text.FgYellow, request)
+			}
+
+			row := table.Row{vpa.GetName(), kind + "/" + name, mode, r.Container, string(r.Resource), request, r.LowerBound, r.Target, r.UpperBound}
+			if program.AllNamespaces {
+				row = append(table.Row{vpa.GetNamespace()}, row...)
+			}
+			t.AppendRow(row)
+		}
+	}
+
+	t.Render()
+
+	return nil
+}
+
+// vpaRecommendations returns the VPA's recommendation for each container and resource, alongside the container's
+// current request
+func vpaRecommendations(vpa *unstructured.Unstructured, requests map[string]corev1.ResourceList) []containerRecommendation {
+	containers, _, _ := unstructured.NestedSlice(vpa.Object, "status", "recommendation", "containerRecommendations")
+
+	var result []containerRecommendation
+
+	for _, c := range containers {
+		container, ok := c.(map[string]any)
+		if !ok {
+			continue
+		}
+		containerName, _ := container["containerName"].(string)
+
+		for _, resourceName := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+			r := containerRecommendation{
+				Container:  containerName,
+				Resource:   resourceName,
+				LowerBound: recommendedQuantity(container, "lowerBound", resourceName),
+				Target:     recommendedQuantity(container, "target", resourceName),
+				UpperBound: recommendedQuantity(container, "upperBound", resourceName),
+			}
+			if request, ok := requests[containerName][resourceName]; ok {
+				r.Request = formatQuantity(resourceName, request)
+			}
+			result = append(result, r)
+		}
+	}
+
+	return result
+}
+
+// recommendedQuantity returns one recommended value from a container recommendation, formatted for display
+func recommendedQuantity(container map[string]any, field string, resourceName corev1.ResourceName) string {
+	value, _, _ := unstructured.NestedString(container, field, string(resourceName))
+	if value == "" {
+		return ""
+	}
+
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return value
+	}
+	return formatQuantity(resourceName, quantity)
+}
+
+// formatQuantity shows CPU in millicores and memory in MiB, which is how people usually write requests
+func formatQuantity(resourceName corev1.ResourceName, quantity resource.Quantity) string {
+	switch resourceName {
+	case corev1.ResourceCPU:
+		return fmt.Sprintf("%dm", quantity.MilliValue())
+	case corev1.ResourceMemory:
+		return fmt.Sprintf("%dMi", quantity.Value()/(1024*1024))
+	default:
+		return quantity.String()
+	}
+}
+
+// outsideBounds returns true if the request is below the lower bound or above the upper bound
+func outsideBounds(request, lower, upper string) bool {
+	r, err := resource.ParseQuantity(request)
+	if err != nil {
+		return false
+	}
+	if l, err := resource.ParseQuantity(lower); err == nil && r.Cmp(l) < 0 {
+		return true
+	}
+	if u, err := resource.ParseQuantity(upper); err == nil && r.Cmp(u) > 0 {
+		return true
+	}
+	return false
+}
+
+// targetRequests returns the requests of each container in the pod template of the VPA's target, or nil if the
+// target cannot be read
+func targetRequests(ctx context.Context, client dynamic.Interface, mapper meta.RESTMapper, namespace, apiVersion, kind, name string) map[string]corev1.ResourceList {
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return nil
+	}
+
+	mapping, err := mapper.RESTMapping(gv.WithKind(kind).GroupKind(), gv.Version)
+	if err != nil {
+		log.Debug().Err(err).Str("kind", kind).Msg("Unable to find the VPA target's resource")
+		return nil
+	}
+
+	target, err := client.Resource(mapping.Resource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		log.Debug().Err(err).Str("target", kind+"/"+name).Msg("Unable to read the VPA target")
+		return nil
+	}
+
+	rawTemplate, found, _ := unstructured.NestedMap(target.Object, "spec", "template")
+	if !found {
+		return nil
+	}
+
+	var template corev1.PodTemplateSpec
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(rawTemplate, &template); err != nil {
+		return nil
+	}
+
+	requests := map[string]corev1.ResourceList{}
+	for _, container := range template.Spec.Containers {
+		requests[container.Name] = container.Resources.Requests
+	}
+
+	return requests
+}
@@ -0,0 +1,35 @@
+package program
+
+import (
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// warningLogger reports warnings sent by the API server (e.g. use of a deprecated API version), showing each distinct
+// warning only once per run
+type warningLogger struct {
+	lock sync.Mutex
+	seen map[string]bool
+}
+
+func newWarningLogger() *warningLogger {
+	return &warningLogger{seen: map[string]bool{}}
+}
+
+// HandleWarningHeader implements rest.WarningHandler
+func (w *warningLogger) HandleWarningHeader(code int, agent string, message string) {
+	if code != 299 || message == "" {
+		return
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.seen[message] {
+		return
+	}
+	w.seen[message] = true
+
+	log.Warn().Str("agent", agent).Msg("API server warning: " + message)
+}
@@ -0,0 +1,130 @@
+package program
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	v1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// redrawDelay collects bursts of HPA changes into a single redraw
+const redrawDelay = 250 * time.Millisecond
+
+// clearScreen moves the cursor home and clears the terminal
+const clearScreen = "\033[H\033[2J"
+
+// watch shows the HPA table, redrawing it whenever an HPA changes, until interrupted
+func (program *Hpa) watch(ctx context.Context, clientset *kubernetes.Clientset) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithNamespace(program.namespace()),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = program.labelSelector()
+		}))
+
+	informer := factory.Autoscaling().V1().HorizontalPodAutoscalers()
+
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+
+	_, err := informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(any) { notify() },
+		UpdateFunc: func(any, any) { notify() },
+		DeleteFunc: func(any) { notify() },
+	})
+	if err != nil {
+		return err
+	}
+
+	// Alerts need the conditions, which only the v2 API has, and are checked between changes too
+	var checkAlerts func()
+	var tick <-chan time.Time
+	if len(notifiers) > 0 {
+		v2Informer := factory.Autoscaling().V2().HorizontalPodAutoscalers()
+		v2Informer.Informer()
+		alerts := newHpaAlerts()
+		checkAlerts = func() {
+			hpas, err := listV2(v2Informer.Lister(), program.Names)
+			if err != nil {
+				log.Warn().Err(err).Msg("Checking HPAs for alerts")
+				return
+			}
+			alerts.check(hpas, time.Now())
+		}
+
+		ticker := time.NewTicker(alertInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	factory.Start(ctx.Done())
+	defer factory.Shutdown()
+
+	for kind, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return connectionError(ctx.Err(), "unable to sync %v from the cluster", kind)
+		}
+	}
+
+	lister := informer.Lister()
+
+	// Draw the HPAs as they are now, even if there are none and nothing changes
+	notify()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tick:
+			checkAlerts()
+			continue
+		case <-changed:
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(redrawDelay):
+		}
+
+		items, err := lister.List(labels.Everything())
+		if err != nil {
+			return err
+		}
+
+		hpas := make([]v1.HorizontalPodAutoscaler, 0, len(items))
+		for _, hpa := range items {
+			hpas = append(hpas, *hpa)
+		}
+
+		if len(program.Names) > 0 {
+			hpas = filterByName(hpas, program.Names)
+		}
+
+		sortHPAs(hpas)
+		if checkAlerts != nil {
+			checkAlerts()
+		}
+
+		log.Debug().Int("count", len(hpas)).Msg("Redrawing")
+
+		fmt.Print(clearScreen)
+		fmt.Println(time.Now().Format(time.RFC1123))
+		if len(hpas) == 0 {
+			fmt.Println("No HPAs found")
+			continue
+		}
+		program.printHPAs(ctx, hpas)
+	}
+}
@@ -0,0 +1,349 @@
+package program
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// workloadKind describes how to work with one kind of pod controller (Deployment, StatefulSet or DaemonSet) for the
+// commands which handle all of them alike
+type workloadKind struct {
+	Kind string
+
+	// list returns the selected workloads of this kind
+	list func(ctx context.Context, clientset kubernetes.Interface, selector *Selector) ([]types.NamespacedName, error)
+	// patch applies a strategic merge patch to a workload
+	patch func(ctx context.Context, clientset kubernetes.Interface, namespace, name string, data []byte) error
+	// rolledOut reports whether the workload's latest change has been fully rolled out, and if not what it is waiting
+	// for
+	rolledOut func(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (bool, string, error)
+}
+
+var deploymentKind = &workloadKind{
+	Kind: "Deployment",
+	list: func(ctx context.Context, clientset kubernetes.Interface, selector *Selector) ([]types.NamespacedName, error) {
+		return listNames(fetch(ctx, selector, "deployment",
+			func(ctx context.Context, namespace, name string) (*appsv1.Deployment, error) {
+				return clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+			},
+			func(ctx context.Context, namespace string, options metav1.ListOptions) ([]appsv1.Deployment, string, error) {
+				list, err := clientset.AppsV1().Deployments(namespace).List(ctx, options)
+				if err != nil {
+					return nil, "", err
+				}
+				return list.Items, list.Continue, nil
+			}))
+	},
+	patch: func(ctx context.Context, clientset kubernetes.Interface, namespace, name string, data []byte) error {
+		_, err := clientset.AppsV1().Deployments(namespace).Patch(ctx, name, types.StrategicMergePatchType, data, metav1.PatchOptions{FieldManager: FieldManager})
+		return err
+	},
+	rolledOut: func(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (bool, string, error) {
+		d, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, "", err
+		}
+		done, message := deploymentRolledOut(d)
+		return done, message, nil
+	},
+}
+
+var statefulSetKind = &workloadKind{
+	Kind: "StatefulSet",
+	list: func(ctx context.Context, clientset kubernetes.Interface, selector *Selector) ([]types.NamespacedName, error) {
+		return listNames(fetch(ctx, selector, "statefulset",
+			func(ctx context.Context, namespace, name string) (*appsv1.StatefulSet, error) {
+				return clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+			},
+			func(ctx context.Context, namespace string, options metav1.ListOptions) ([]appsv1.StatefulSet, string, error) {
+				list, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, options)
+				if err != nil {
+					return nil, "", err
+				}
+				return list.Items, list.Continue, nil
+			}))
+	},
+	patch: func(ctx context.Context, clientset kubernetes.Interface, namespace, name string, data []byte) error {
+		_, err := clientset.AppsV1().StatefulSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, data, metav1.PatchOptions{FieldManager: FieldManager})
+		return err
+	},
+	rolledOut: func(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (bool, string, error) {
+		sts, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, "", err
+		}
+		done, message := statefulSetRolledOut(sts)
+		return done, message, nil
+	},
+}
+
+var daemonSetKind = &workloadKind{
+	Kind: "DaemonSet",
+	list: func(ctx context.Context, clientset kubernetes.Interface, selector *Selector) ([]types.NamespacedName, error) {
+		return listNames(fetch(ctx, selector, "daemonset",
+			func(ctx context.Context, namespace, name string) (*appsv1.DaemonSet, error) {
+				return clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+			},
+			func(ctx context.Context, namespace string, options metav1.ListOptions) ([]appsv1.DaemonSet, string, error) {
+				list, err := clientset.AppsV1().DaemonSets(namespace).List(ctx, options)
+				if err != nil {
+					return nil, "", err
+				}
+				return list.Items, list.Continue, nil
+			}))
+	},
+	patch: func(ctx context.Context, clientset kubernetes.Interface, namespace, name string, data []byte) error {
+		_, err := clientset.AppsV1().DaemonSets(namespace).Patch(ctx, name, types.StrategicMergePatchType, data, metav1.PatchOptions{FieldManager: FieldManager})
+		return err
+	},
+	rolledOut: func(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (bool, string, error) {
+		ds, err := clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, "", err
+		}
+		done, message := daemonSetRolledOut(ds)
+		return done, message, nil
+	},
+}
+
+// workloadKindFor returns the workload kind named on the command line, accepting the same names as kubectl
+func workloadKindFor(name string) (*workloadKind, error) {
+	switch strings.ToLower(name) {
+	case "deployment", "deployments", "deploy":
+		return deploymentKind, nil
+	case "statefulset", "statefulsets", "sts":
+		return statefulSetKind, nil
+	case "daemonset", "daemonsets", "ds":
+		return daemonSetKind, nil
+	default:
+		return nil, usageError("unknown workload kind %q, use deployments, statefulsets or daemonsets", name)
+	}
+}
+
+// listNames returns the names of the objects returned by fetch
+func listNames[T any, P interface {
+	*T
+	metav1.Object
+}](items []T, err error) ([]types.NamespacedName, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]types.NamespacedName, 0, len(items))
+	for i := range items {
+		object := P(&items[i])
+		names = append(names, types.NamespacedName{Namespace: object.GetNamespace(), Name: object.GetName()})
+	}
+	return names, nil
+}
+
+// progressDeadlineExceeded is the rollout status of a Deployment which has stopped making progress, which waiting
+// longer will not fix
+const progressDeadlineExceeded = "exceeded its progress deadline"
+
+// deploymentRolledOut reports whether a Deployment has finished rolling out, using the same rules as
+// `kubectl rollout status`
+func deploymentRolledOut(d *appsv1.Deployment) (bool, string) {
+	if d.Generation > d.Status.ObservedGeneration {
+		return false, "waiting for the rollout to be observed"
+	}
+
+	for _, condition := range d.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+			return false, progressDeadlineExceeded
+		}
+	}
+
+	replicas := replicasOf(d.Spec.Replicas)
+
+	switch {
+	case d.Status.UpdatedReplicas < replicas:
+		return false, fmt.Sprintf("%d of %d updated replicas", d.Status.UpdatedReplicas, replicas)
+	case d.Status.Replicas > d.Status.UpdatedReplicas:
+		return false, fmt.Sprintf("%d old replicas pending termination", d.Status.Replicas-d.Status.UpdatedReplicas)
+	case d.Status.AvailableReplicas < d.Status.UpdatedReplicas:
+		return false, fmt.Sprintf("%d of %d updated replicas available", d.Status.AvailableReplicas, d.Status.UpdatedReplicas)
+	}
+
+	return true, "rolled out"
+}
+
+// statefulSetRolledOut reports whether a StatefulSet has finished rolling out, using the same rules as
+// `kubectl rollout status`
+func statefulSetRolledOut(sts *appsv1.StatefulSet) (bool, string) {
+	if sts.Generation > sts.Status.ObservedGeneration {
+		return false, "waiting for the rollout to be observed"
+	}
+
+	replicas := replicasOf(sts.Spec.Replicas)
+
+	if sts.Status.ReadyReplicas < replicas {
+		return false, fmt.Sprintf("%d of %d pods ready", sts.Status.ReadyReplicas, replicas)
+	}
+
+	if sts.Spec.UpdateStrategy.Type == appsv1.RollingUpdateStatefulSetStrategyType && sts.Spec.UpdateStrategy.RollingUpdate != nil &&
+		sts.Spec.UpdateStrategy.RollingUpdate.Partition != nil {
+		partition := *sts.Spec.UpdateStrategy.RollingUpdate.Partition
+		if sts.Status.UpdatedReplicas < replicas-partition {
+			return false, fmt.Sprintf("%d of %d partitioned pods updated", sts.Status.UpdatedReplicas, replicas-partition)
+		}
+		return true, "partitioned rollout complete"
+	}
+
+	if sts.Status.UpdateRevision != sts.Status.CurrentRevision {
+		return false, fmt.Sprintf("%d of %d pods updated", sts.Status.UpdatedReplicas, replicas)
+	}
+
+	return true, "rolled out"
+}
+
+// daemonSetRolledOut reports whether a DaemonSet has finished rolling out, using the same rules as
+// `kubectl rollout status`
+func daemonSetRolledOut(ds *appsv1.DaemonSet) (bool, string) {
+	if ds.Generation > ds.Status.ObservedGeneration {
+		return false, "waiting for the rollout to be observed"
+	}
+
+	switch {
+	case ds.Status.UpdatedNumberScheduled < ds.Status.DesiredNumberScheduled:
+		return false, fmt.Sprintf("%d of %d updated pods scheduled", ds.Status.UpdatedNumberScheduled, ds.Status.DesiredNumberScheduled)
+	case ds.Status.NumberAvailable < ds.Status.DesiredNumberScheduled:
+		return false, fmt.Sprintf("%d of %d updated pods available", ds.Status.NumberAvailable, ds.Status.DesiredNumberScheduled)
+	}
+
+	return true, "rolled out"
+}
+
+// podTemplate is the pod template of a workload
+type podTemplate struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Labels    map[string]string
+	Selector  *metav1.LabelSelector
+	Spec      corev1.PodSpec
+}
+
+// podSpecsByWorkload indexes the pod templates by "namespace/Kind/name", the form HPA targets are matched in
+func podSpecsByWorkload(templates []podTemplate) map[string]*corev1.PodSpec {
+	specs := map[string]*corev1.PodSpec{}
+	for i := range templates {
+		t := &templates[i]
+		specs[t.Namespace+"/"+t.Kind+"/"+t.Name] = &t.Spec
+	}
+	return specs
+}
+
+// podTemplates returns the pod templates of the selected Deployments, StatefulSets and DaemonSets, sorted by
+// namespace, name and kind
+func podTemplates(ctx context.Context, clientset kubernetes.Interface, selector *Selector) ([]podTemplate, error) {
+	var result []podTemplate
+
+	deployments, err := fetch(ctx, selector, "deployment", nil,
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]appsv1.Deployment, string, error) {
+			list, err := clientset.AppsV1().Deployments(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range deployments {
+		result = append(result, podTemplate{"Deployment", d.Namespace, d.Name, d.Spec.Template.Labels, d.Spec.Selector, d.Spec.Template.Spec})
+	}
+
+	statefulsets, err := fetch(ctx, selector, "statefulset", nil,
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]appsv1.StatefulSet, string, error) {
+			list, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	for _, sts := range statefulsets {
+		result = append(result, podTemplate{"StatefulSet", sts.Namespace, sts.Name, sts.Spec.Template.Labels, sts.Spec.Selector, sts.Spec.Template.Spec})
+	}
+
+	daemonsets, err := fetch(ctx, selector, "daemonset", nil,
+		func(ctx context.Context, namespace string, options metav1.ListOptions) ([]appsv1.DaemonSet, string, error) {
+			list, err := clientset.AppsV1().DaemonSets(namespace).List(ctx, options)
+			if err != nil {
+				return nil, "", err
+			}
+			return list.Items, list.Continue, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	for _, ds := range daemonsets {
+		result = append(result, podTemplate{"DaemonSet", ds.Namespace, ds.Name, ds.Spec.Template.Labels, ds.Spec.Selector, ds.Spec.Template.Spec})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		switch {
+		case a.Namespace != b.Namespace:
+			return a.Namespace < b.Namespace
+		case a.Name != b.Name:
+			return a.Name < b.Name
+		default:
+			return a.Kind < b.Kind
+		}
+	})
+
+	return result, nil
+}
+
+// ownerResolver finds the workload a person manages from the controller of a pod, following ReplicaSets up to the
+// Deployment or Rollout which owns them.  ReplicaSet lookups are cached since many pods share one.
+type ownerResolver struct {
+	clientset   kubernetes.Interface
+	replicaSets map[types.NamespacedName]*metav1.OwnerReference
+}
+
+func newOwnerResolver(clientset kubernetes.Interface) *ownerResolver {
+	return &ownerResolver{clientset: clientset, replicaSets: map[types.NamespacedName]*metav1.OwnerReference{}}
+}
+
+// workload returns the kind and name of the workload which manages the pod, or empty strings if it has no controller
+func (r *ownerResolver) workload(ctx context.Context, pod *corev1.Pod) (string, string, error) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return "", "", nil
+	}
+
+	if owner.Kind != "ReplicaSet" {
+		return owner.Kind, owner.Name, nil
+	}
+
+	key := types.NamespacedName{Namespace: pod.Namespace, Name: owner.Name}
+	parent, ok := r.replicaSets[key]
+	if !ok {
+		rs, err := r.clientset.AppsV1().ReplicaSets(pod.Namespace).Get(ctx, owner.Name, metav1.GetOptions{})
+		if err != nil {
+			return "", "", apiError(err)
+		}
+		parent = metav1.GetControllerOf(rs)
+		r.replicaSets[key] = parent
+	}
+
+	// A bare ReplicaSet is the workload itself
+	if parent == nil {
+		return owner.Kind, owner.Name, nil
+	}
+
+	return parent.Kind, parent.Name, nil
+}